@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"os"
@@ -28,7 +29,7 @@ func TestIntegration_BundleContents_AllRequiredFiles(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "bundle")
 
 	// Run predeploy to create database and storage
-	predeployResult, err := predeploy.Run(predeploy.Options{
+	predeployResult, err := predeploy.Run(context.Background(), predeploy.Options{
 		Apps:          []string{"testdata/sample-app"},
 		BackendBinary: "", // Let container download the backend
 		OutputDir:     tmpDir,
@@ -111,7 +112,7 @@ func TestIntegration_BundleContents_ValidSQLiteDatabase(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "bundle")
 
 	// Run predeploy
-	predeployResult, err := predeploy.Run(predeploy.Options{
+	predeployResult, err := predeploy.Run(context.Background(), predeploy.Options{
 		Apps:          []string{"testdata/sample-app"},
 		BackendBinary: "",
 		OutputDir:     tmpDir,
@@ -184,7 +185,7 @@ func TestIntegration_BundleContents_ManifestContent(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "bundle")
 
 	// Run predeploy
-	predeployResult, err := predeploy.Run(predeploy.Options{
+	predeployResult, err := predeploy.Run(context.Background(), predeploy.Options{
 		Apps:          []string{"testdata/sample-app"},
 		BackendBinary: "",
 		OutputDir:     tmpDir,
@@ -247,7 +248,7 @@ func TestIntegration_BundleContents_CredentialsContent(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "bundle")
 
 	// Run predeploy
-	predeployResult, err := predeploy.Run(predeploy.Options{
+	predeployResult, err := predeploy.Run(context.Background(), predeploy.Options{
 		Apps:          []string{"testdata/sample-app"},
 		BackendBinary: "",
 		OutputDir:     tmpDir,
@@ -317,7 +318,7 @@ func TestIntegration_BundleContents_StorageDirectory(t *testing.T) {
 	outputDir := filepath.Join(tmpDir, "bundle")
 
 	// Run predeploy
-	predeployResult, err := predeploy.Run(predeploy.Options{
+	predeployResult, err := predeploy.Run(context.Background(), predeploy.Options{
 		Apps:          []string{"testdata/sample-app"},
 		BackendBinary: "",
 		OutputDir:     tmpDir,
@@ -1,18 +1,30 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
 
 	"github.com/ozanturksever/convex-bundler/pkg/cli"
 	"github.com/ozanturksever/convex-bundler/pkg/credentials"
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
 	"github.com/ozanturksever/convex-bundler/pkg/selfhost"
 )
 
@@ -126,6 +138,227 @@ func TestIntegration_SelfHostCLIParsing(t *testing.T) {
 	assert.Equal(t, "2.0.0", config.OpsVersion)
 }
 
+// TestIntegration_SelfHostJSONOutput tests that the selfhost command emits a JSON result with --json
+func TestIntegration_SelfHostJSONOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSelfHostTestBundle(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "convex-backend-ops")
+	createSelfHostMockOpsBinary(t, opsBinary)
+
+	selfhostPath := filepath.Join(tmpDir, "my-backend-selfhost")
+
+	var stdout bytes.Buffer
+	err := run(context.Background(), []string{
+		"convex-bundler", "selfhost",
+		"--bundle", bundleDir,
+		"--ops-binary", opsBinary,
+		"--output", selfhostPath,
+		"--platform", "linux-x64",
+		"--ops-version", "2.0.0",
+		"--json",
+	}, &stdout)
+	require.NoError(t, err)
+
+	var result selfHostOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result), "stdout should be a single JSON document")
+	assert.True(t, result.Success)
+	assert.Equal(t, selfhostPath, result.OutputPath)
+
+	info, err := os.Stat(selfhostPath)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), result.Size)
+
+	require.NotNil(t, result.Header)
+	assert.Equal(t, selfhost.CompressionGzip, result.Header.Compression)
+	assert.Equal(t, "2.0.0", result.Header.OpsVersion)
+	require.NotNil(t, result.Header.Manifest)
+	assert.Equal(t, "Test Backend", result.Header.Manifest.Name)
+}
+
+// TestIntegration_SelfHostOpsBinaryURL tests downloading the ops binary with --ops-binary-url
+func TestIntegration_SelfHostOpsBinaryURL(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", t.TempDir()) // keeps the ops download out of the system temp directory
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSelfHostTestBundle(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "convex-backend-ops")
+	createSelfHostMockOpsBinary(t, opsBinary)
+	opsData, err := os.ReadFile(opsBinary)
+	require.NoError(t, err)
+	sum := sha256.Sum256(opsData)
+	opsSHA256 := hex.EncodeToString(sum[:])
+
+	var rangeRequests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "" {
+			rangeRequests = append(rangeRequests, r.Header.Get("Range"))
+		}
+		w.Header().Set("ETag", `"ops-v1"`)
+		http.ServeContent(w, r, "convex-backend-ops", time.Time{}, bytes.NewReader(opsData))
+	}))
+	defer server.Close()
+
+	// A previous run was interrupted halfway through the download
+	downloadPath := opsDownloadPath(server.URL + "/convex-backend-ops")
+	require.NoError(t, os.MkdirAll(filepath.Dir(downloadPath), 0755))
+	half := len(opsData) / 2
+	require.NoError(t, os.WriteFile(downloadPath+".part", opsData[:half], 0644))
+	require.NoError(t, os.WriteFile(downloadPath+".etag", []byte(`"ops-v1"`), 0644))
+
+	selfhostPath := filepath.Join(tmpDir, "my-backend-selfhost")
+	args := []string{
+		"convex-bundler", "selfhost",
+		"--bundle", bundleDir,
+		"--ops-binary-url", server.URL + "/convex-backend-ops",
+		"--output", selfhostPath,
+		"--platform", "linux-x64",
+	}
+	require.NoError(t, run(context.Background(), append(args, "--ops-binary-sha256", strings.ToUpper(opsSHA256)), io.Discard))
+
+	// The download resumed where it stopped, and the executable starts with the ops binary
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%d-", half)}, rangeRequests)
+	data, err := os.ReadFile(selfhostPath)
+	require.NoError(t, err)
+	assert.Equal(t, opsData, data[:len(opsData)])
+	verifyResult, err := selfhost.Verify(selfhostPath)
+	require.NoError(t, err)
+	assert.True(t, verifyResult.Valid)
+
+	// A download that does not match the checksum is rejected
+	require.NoError(t, os.Remove(selfhostPath))
+	wrongSHA256 := strings.Repeat("0", 64)
+	err = run(context.Background(), append(args, "--ops-binary-sha256", wrongSHA256), io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ops binary checksum mismatch: expected "+wrongSHA256+", got "+opsSHA256)
+	assert.NoFileExists(t, selfhostPath)
+	assert.NoFileExists(t, downloadPath, "a download that fails the checksum is not reused")
+}
+
+// TestIntegration_SelfHostRepack tests recompressing an executable with selfhost repack
+func TestIntegration_SelfHostRepack(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSelfHostTestBundle(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "convex-backend-ops")
+	createSelfHostMockOpsBinary(t, opsBinary)
+
+	gzipPath := filepath.Join(tmpDir, "my-backend-selfhost")
+	require.NoError(t, run(context.Background(), []string{
+		"convex-bundler", "selfhost",
+		"--bundle", bundleDir,
+		"--ops-binary", opsBinary,
+		"--output", gzipPath,
+		"--platform", "linux-x64",
+	}, io.Discard))
+	original, err := os.ReadFile(gzipPath)
+	require.NoError(t, err)
+
+	zstdPath := filepath.Join(tmpDir, "my-backend-selfhost-zstd")
+	var stdout bytes.Buffer
+	require.NoError(t, run(context.Background(), []string{
+		"convex-bundler", "selfhost", "repack",
+		"--input", gzipPath,
+		"--compression", "zstd",
+		"--output", zstdPath,
+	}, &stdout))
+	assert.Contains(t, stdout.String(), "with zstd compression")
+
+	// The input is left untouched when --output is given
+	unchanged, err := os.ReadFile(gzipPath)
+	require.NoError(t, err)
+	assert.Equal(t, original, unchanged)
+
+	header, err := selfhost.ReadHeaderFromExecutable(zstdPath)
+	require.NoError(t, err)
+	assert.Equal(t, selfhost.CompressionZstd, header.Compression)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = selfhost.Extract(selfhost.ExtractOptions{ExecutablePath: zstdPath, OutputDir: extractDir})
+	require.NoError(t, err)
+	assertBundleStructure(t, extractDir)
+}
+
+// TestIntegration_SelfHostExtractDB tests that extract-db writes only the
+// embedded database, which opens with the SQLite driver
+func TestIntegration_SelfHostExtractDB(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSelfHostTestBundle(t, bundleDir)
+
+	// Replace the mock database with a real one
+	dbPath := filepath.Join(bundleDir, "convex.db")
+	require.NoError(t, os.Remove(dbPath))
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY, body TEXT); INSERT INTO documents (body) VALUES ('hello')")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	opsBinary := filepath.Join(tmpDir, "convex-backend-ops")
+	createSelfHostMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "my-backend-selfhost")
+	require.NoError(t, run(context.Background(), []string{
+		"convex-bundler", "selfhost",
+		"--bundle", bundleDir,
+		"--ops-binary", opsBinary,
+		"--output", executablePath,
+		"--platform", "linux-x64",
+	}, io.Discard))
+
+	extractedPath := filepath.Join(tmpDir, "out", "convex.db")
+	require.NoError(t, os.MkdirAll(filepath.Dir(extractedPath), 0755))
+	var stdout bytes.Buffer
+	require.NoError(t, run(context.Background(), []string{
+		"convex-bundler", "selfhost", "extract-db",
+		"--input", executablePath,
+		"--output", extractedPath,
+	}, &stdout))
+	assert.Contains(t, stdout.String(), "Extracted convex.db")
+
+	// Nothing but the database is written
+	entries, err := os.ReadDir(filepath.Dir(extractedPath))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	extracted, err := sql.Open("sqlite", extractedPath)
+	require.NoError(t, err)
+	defer extracted.Close()
+	var body string
+	require.NoError(t, extracted.QueryRow("SELECT body FROM documents").Scan(&body))
+	assert.Equal(t, "hello", body)
+
+	// A bundle whose convex.db is not SQLite is rejected
+	require.NoError(t, os.WriteFile(dbPath, []byte("not a database"), 0644))
+	require.NoError(t, run(context.Background(), []string{
+		"convex-bundler", "selfhost",
+		"--bundle", bundleDir,
+		"--ops-binary", opsBinary,
+		"--output", executablePath,
+		"--platform", "linux-x64",
+	}, io.Discard))
+	err = run(context.Background(), []string{
+		"convex-bundler", "selfhost", "extract-db",
+		"--input", executablePath,
+		"--output", filepath.Join(tmpDir, "bad.db"),
+	}, io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a SQLite database")
+	assert.NoFileExists(t, filepath.Join(tmpDir, "bad.db"))
+}
+
 // TestIntegration_SelfHostCorruptedExecutable tests that corrupted executables fail verification
 func TestIntegration_SelfHostCorruptedExecutable(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -156,8 +389,10 @@ func TestIntegration_SelfHostCorruptedExecutable(t *testing.T) {
 	data, err := os.ReadFile(selfhostPath)
 	require.NoError(t, err)
 
-	// Corrupt bytes in the middle (after header, in compressed data)
-	corruptionOffset := len(data) / 2
+	// Corrupt bytes in the compressed data, just before the end marker and
+	// footer. The mock bundle compresses to less than the ops binary and
+	// header, so the middle of the file is not inside the compressed data.
+	corruptionOffset := len(data) - selfhost.MagicEndLen - selfhost.FooterSize - 16
 	data[corruptionOffset] ^= 0xFF
 	data[corruptionOffset+1] ^= 0xFF
 	data[corruptionOffset+2] ^= 0xFF
@@ -460,16 +695,5 @@ func compareDirectories(t *testing.T, originalDir, extractedDir string) {
 
 // getExpectedPlatform returns the expected platform string for the current runtime
 func getExpectedPlatform() string {
-	// This should match the logic in selfhost.getHostPlatform()
-	platformMap := map[string]string{
-		"linux-amd64":  "linux-x64",
-		"linux-arm64":  "linux-arm64",
-		"darwin-amd64": "darwin-x64",
-		"darwin-arm64": "darwin-arm64",
-	}
-	key := runtime.GOOS + "-" + runtime.GOARCH
-	if platform, ok := platformMap[key]; ok {
-		return platform
-	}
-	return key
+	return platform.Host()
 }
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -56,7 +61,7 @@ func TestIntegration_FullBundleWorkflow(t *testing.T) {
 	assert.Equal(t, "linux-x64", config.Platform)
 
 	// Test version detection (should use CLI override)
-	detectedVersion, err := version.Detect(config.Apps[0], config.Version)
+	detectedVersion, err := version.DetectMulti(config.Apps, config.Version)
 	require.NoError(t, err)
 	assert.Equal(t, "2.0.0", detectedVersion)
 
@@ -80,7 +85,7 @@ func TestIntegration_FullBundleWorkflow(t *testing.T) {
 
 	// Test pre-deployment (this requires Docker)
 	// Use empty BackendBinary to let the container download the appropriate Linux binary
-	predeployResult, err := predeploy.Run(predeploy.Options{
+	predeployResult, err := predeploy.Run(context.Background(), predeploy.Options{
 		Apps:          config.Apps,
 		BackendBinary: "", // Let container download the Linux binary
 		OutputDir:     tmpDir,
@@ -91,6 +96,13 @@ func TestIntegration_FullBundleWorkflow(t *testing.T) {
 	assert.NotEmpty(t, predeployResult.DatabasePath)
 	assert.DirExists(t, predeployResult.StoragePath)
 
+	// The deployed database must contain the sample app's functions
+	stats, err := bundle.InspectDatabase(predeployResult.DatabasePath)
+	require.NoError(t, err)
+	assert.True(t, stats.Recognized)
+	assert.Greater(t, stats.Modules, 0)
+	assert.Greater(t, stats.Functions, 0)
+
 	// Create a fake backend binary for the bundle step
 	// In real usage, the user would provide the actual binary
 	fakeBackendBinary := filepath.Join(tmpDir, "fake-backend")
@@ -297,6 +309,335 @@ func TestIntegration_BundleWithoutPredeploy(t *testing.T) {
 	assertBundleStructure(t, outputDir)
 }
 
+// TestIntegration_DryRun tests that --dry-run validates inputs without creating the bundle
+func TestIntegration_DryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	ranMarker := filepath.Join(tmpDir, "backend-ran")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("#!/bin/sh\ntouch '"+ranMarker+"'\necho 'convex-local-backend 1.2.3'\n"), 0755))
+
+	err := run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", outputDir,
+		"--backend-binary", backendBinary,
+		"--bundle-version", "1.0.0",
+		"--dry-run",
+	}, io.Discard)
+	require.NoError(t, err)
+
+	assert.NoDirExists(t, outputDir, "dry run should not create the output directory")
+	assert.NoFileExists(t, ranMarker, "dry run should not execute the backend binary")
+}
+
+// TestIntegration_DryRunJSON tests that --json emits a single parseable result document
+func TestIntegration_DryRunJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake"), 0755))
+
+	var stdout bytes.Buffer
+	err := run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", outputDir,
+		"--backend-binary", backendBinary,
+		"--name", "JSON Backend",
+		"--bundle-version", "4.5.6",
+		"--dry-run",
+		"--json",
+	}, &stdout)
+	require.NoError(t, err)
+
+	var result bundleOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result), "stdout should be a single JSON document")
+	assert.True(t, result.Success)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, outputDir, result.BundlePath)
+	assert.Len(t, result.Files, 5)
+	require.NotNil(t, result.Manifest)
+	assert.Equal(t, "JSON Backend", result.Manifest.Name)
+	assert.Equal(t, "4.5.6", result.Manifest.Version)
+}
+
+// TestIntegration_DryRunLabels tests that --label values reach the manifest
+func TestIntegration_DryRunLabels(t *testing.T) {
+	tmpDir := t.TempDir()
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake"), 0755))
+
+	var stdout bytes.Buffer
+	err := run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", filepath.Join(tmpDir, "bundle"),
+		"--backend-binary", backendBinary,
+		"--bundle-version", "1.0.0",
+		"--label", "git.branch=main",
+		"--label", "environment=prod",
+		"--dry-run",
+		"--json",
+	}, &stdout)
+	require.NoError(t, err)
+
+	var result bundleOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	require.NotNil(t, result.Manifest)
+	assert.Equal(t, map[string]string{"git.branch": "main", "environment": "prod"}, result.Manifest.Labels)
+}
+
+// TestIntegration_BundlePrebuiltDatabase tests that --database and --storage
+// bundle the given files without running pre-deployment (no Docker required)
+func TestIntegration_BundlePrebuiltDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("#!/bin/sh\necho 'convex-local-backend 0.1.0'\n"), 0755))
+
+	databasePath := filepath.Join(tmpDir, "prebuilt.db")
+	db, err := sql.Open("sqlite", databasePath)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY, body TEXT)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO documents (body) VALUES ('prebuilt')")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "file.txt"), []byte("stored"), 0644))
+
+	var stdout bytes.Buffer
+	err = run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", outputDir,
+		"--backend-binary", backendBinary,
+		"--bundle-version", "1.0.0",
+		"--database", databasePath,
+		"--storage", storagePath,
+		"--json",
+	}, &stdout)
+	require.NoError(t, err)
+
+	var result bundleOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	assert.True(t, result.Success)
+	assertBundleStructure(t, outputDir)
+	require.NotNil(t, result.Manifest)
+	assert.Equal(t, "0.1.0", result.Manifest.BackendVersion)
+
+	expected, err := os.ReadFile(databasePath)
+	require.NoError(t, err)
+	actual, err := os.ReadFile(filepath.Join(outputDir, "convex.db"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	stored, err := os.ReadFile(filepath.Join(outputDir, "storage", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "stored", string(stored))
+
+	// A file that is not a SQLite database is rejected before bundling
+	notADatabase := filepath.Join(tmpDir, "not-a.db")
+	require.NoError(t, os.WriteFile(notADatabase, []byte("fake db"), 0644))
+	err = run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", filepath.Join(tmpDir, "rejected"),
+		"--backend-binary", backendBinary,
+		"--database", notADatabase,
+	}, io.Discard)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --database")
+	assert.NoDirExists(t, filepath.Join(tmpDir, "rejected"))
+}
+
+// TestIntegration_BundleTimeout tests that an expired --timeout aborts bundling
+// without leaving a partial bundle (no Docker required)
+func TestIntegration_BundleTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake"), 0755))
+
+	databasePath := filepath.Join(tmpDir, "prebuilt.db")
+	db, err := sql.Open("sqlite", databasePath)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY, body TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	err = run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", outputDir,
+		"--backend-binary", backendBinary,
+		"--bundle-version", "1.0.0",
+		"--database", databasePath,
+		"--timeout", "1ns",
+	}, io.Discard)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "timed out after 1ns")
+	assert.NoDirExists(t, outputDir)
+}
+
+// TestIntegration_PredeployTimeout tests that a --timeout expiring during
+// pre-deployment stops the container and leaves no output
+func TestIntegration_PredeployTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode (requires Docker)")
+	}
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake"), 0755))
+
+	start := time.Now()
+	err := run(context.Background(), []string{
+		"convex-bundler",
+		"--app", "testdata/sample-app",
+		"--output", outputDir,
+		"--backend-binary", backendBinary,
+		"--bundle-version", "1.0.0",
+		"--docker-image", "node:20-slim",
+		"--timeout", "3s",
+	}, io.Discard)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Contains(t, err.Error(), "timed out after 3s")
+	// Tearing down the container may take a while, but not a full deployment
+	assert.Less(t, time.Since(start), 2*time.Minute)
+	assert.NoDirExists(t, outputDir)
+}
+
+// TestIntegration_BundleJSONError tests that failures are reported as JSON in --json mode
+func TestIntegration_BundleJSONError(t *testing.T) {
+	var stdout bytes.Buffer
+	err := run(context.Background(), []string{
+		"convex-bundler",
+		"--output", "/tmp/out",
+		"--backend-binary", "/bin/backend",
+		"--json",
+	}, &stdout)
+	require.Error(t, err)
+
+	var result errorOutput
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+	assert.False(t, result.Success)
+	assert.Equal(t, exitBundleError, result.Error.Code)
+	assert.Contains(t, result.Error.Message, "at least one --app is required")
+	require.NotNil(t, result.Error.Validation)
+	assert.Equal(t, "app", result.Error.Validation.Flag)
+}
+
+// TestIntegration_InfoCommand tests the info subcommand against a bundle directory
+func TestIntegration_InfoCommand(t *testing.T) {
+	outputDir, creds := createInfoTestBundle(t)
+
+	t.Run("text", func(t *testing.T) {
+		var stdout bytes.Buffer
+		require.NoError(t, run(context.Background(), []string{"convex-bundler", "info", outputDir}, &stdout))
+
+		out := stdout.String()
+		assert.Contains(t, out, "Name: Info Backend")
+		assert.Contains(t, out, "storage/: 2 files")
+		assert.Contains(t, out, "    build.id=42\n    environment=staging\n")
+		assert.Contains(t, out, "not a valid SQLite database")
+		assert.Contains(t, out, credentials.Redact(creds.AdminKey))
+		assert.NotContains(t, out, creds.AdminKey, "admin key must be redacted")
+		assert.NotContains(t, out, creds.InstanceSecret, "instance secret must not be printed")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var stdout bytes.Buffer
+		require.NoError(t, run(context.Background(), []string{"convex-bundler", "info", outputDir, "--json"}, &stdout))
+		assert.NotContains(t, stdout.String(), creds.AdminKey, "admin key must be redacted")
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+		assert.Equal(t, true, result["success"])
+		assert.Equal(t, float64(2), result["storageFileCount"])
+		assert.Equal(t, true, result["hasCredentials"])
+		assert.Equal(t, false, result["databaseValid"])
+		assert.Equal(t, credentials.Redact(creds.AdminKey), result["adminKey"])
+		manifestResult := result["manifest"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"environment": "staging", "build.id": "42"}, manifestResult["labels"])
+	})
+}
+
+// TestIntegration_ValidateCommand tests the validate subcommand exit status and messages
+func TestIntegration_ValidateCommand(t *testing.T) {
+	t.Run("valid bundle", func(t *testing.T) {
+		outputDir, _ := createInfoTestBundle(t)
+		sqliteHeader := append([]byte("SQLite format 3\x00"), make([]byte, 84)...)
+		require.NoError(t, os.WriteFile(filepath.Join(outputDir, "convex.db"), sqliteHeader, 0644))
+
+		var stdout bytes.Buffer
+		err := run(context.Background(), []string{"convex-bundler", "validate", outputDir}, &stdout)
+		require.NoError(t, err)
+		assert.Contains(t, stdout.String(), "Bundle is valid")
+	})
+
+	t.Run("missing convex.db", func(t *testing.T) {
+		outputDir, _ := createInfoTestBundle(t)
+		require.NoError(t, os.Remove(filepath.Join(outputDir, "convex.db")))
+
+		var stdout bytes.Buffer
+		err := run(context.Background(), []string{"convex-bundler", "validate", outputDir}, &stdout)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, errValidationFailed)
+		assert.NotEqual(t, 0, exitCode(err))
+		assert.Contains(t, stdout.String(), "missing required file: convex.db")
+	})
+
+	t.Run("missing convex.db json", func(t *testing.T) {
+		outputDir, _ := createInfoTestBundle(t)
+		require.NoError(t, os.Remove(filepath.Join(outputDir, "convex.db")))
+
+		var stdout bytes.Buffer
+		err := run(context.Background(), []string{"convex-bundler", "validate", outputDir, "--json"}, &stdout)
+		require.Error(t, err)
+
+		var result validateOutput
+		require.NoError(t, json.Unmarshal(stdout.Bytes(), &result))
+		assert.False(t, result.Success)
+		assert.Equal(t, outputDir, result.BundleDir)
+		assert.Contains(t, result.Problems, "missing required file: convex.db")
+	})
+}
+
+func TestIntegration_KeyCommand(t *testing.T) {
+	creds, err := credentials.Generate("my-app")
+	require.NoError(t, err)
+
+	t.Run("secret file", func(t *testing.T) {
+		secretFile := filepath.Join(t.TempDir(), "secret")
+		require.NoError(t, os.WriteFile(secretFile, []byte(creds.InstanceSecret+"\n"), 0600))
+
+		var stdout bytes.Buffer
+		err := run(context.Background(), []string{"convex-bundler", "key", "--instance", "my-app", "--secret-file", secretFile, "--read-only"}, &stdout)
+		require.NoError(t, err)
+		assert.Regexp(t, `^my-app\|[0-9a-f]+\n$`, stdout.String())
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		var stdout bytes.Buffer
+		err := runKey(&cli.KeyConfig{InstanceName: "my-app", SecretFile: "-", System: true}, bytes.NewBufferString(creds.InstanceSecret), &stdout)
+		require.NoError(t, err)
+		assert.Regexp(t, `^my-app\|[0-9a-f]+\n$`, stdout.String())
+	})
+
+	t.Run("invalid secret", func(t *testing.T) {
+		var stdout bytes.Buffer
+		err := run(context.Background(), []string{"convex-bundler", "key", "--instance", "my-app", "--secret", "abc"}, &stdout)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid instance secret")
+	})
+}
+
 // Helper functions
 
 func assertBundleStructure(t *testing.T, outputDir string) {
@@ -360,3 +701,41 @@ func assertCredentialsContent(t *testing.T, outputDir string) {
 	assert.NotEmpty(t, creds["adminKey"])
 	assert.NotEmpty(t, creds["instanceSecret"])
 }
+
+// createInfoTestBundle creates a bundle with two storage files and a fake database
+func createInfoTestBundle(t *testing.T) (string, *credentials.Credentials) {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	storagePath := filepath.Join(tmpDir, "storage")
+
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake"), 0755))
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake db"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(storagePath, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "one.bin"), []byte("1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "sub", "two.bin"), []byte("2"), 0644))
+
+	mf := manifest.New(manifest.Options{
+		Name:     "Info Backend",
+		Version:  "1.0.0",
+		Apps:     []string{"/app"},
+		Platform: "linux-x64",
+		Labels:   map[string]string{"environment": "staging", "build.id": "42"},
+	})
+	creds, err := credentials.Generate("info-test")
+	require.NoError(t, err)
+
+	require.NoError(t, bundle.Create(bundle.Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+	}))
+
+	return outputDir, creds
+}
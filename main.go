@@ -1,12 +1,24 @@
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
 
 	"github.com/ozanturksever/convex-bundler/pkg/bundle"
 	"github.com/ozanturksever/convex-bundler/pkg/cli"
 	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/database"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
 	"github.com/ozanturksever/convex-bundler/pkg/predeploy"
 	"github.com/ozanturksever/convex-bundler/pkg/selfhost"
@@ -20,135 +32,696 @@ var (
 	buildTime  = "unknown"
 )
 
+// exitBundleError is the exit code used when the bundle command fails
+const exitBundleError = 1
+
+// errValidationFailed is returned by runValidate when the bundle has problems
+var errValidationFailed = errors.New("bundle validation failed")
+
 func main() {
-	// Check for version flag early
-	if len(os.Args) == 2 && (os.Args[1] == "--version" || os.Args[1] == "-v") {
-		fmt.Printf("convex-bundler %s\n", appVersion)
-		fmt.Printf("  commit: %s\n", commit)
-		fmt.Printf("  built:  %s\n", buildTime)
-		return
+	// Cancel in-flight work (and tear down containers) on Ctrl-C or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx, os.Args, os.Stdout)
+	stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
 	}
+}
 
-	// Check if this is the selfhost subcommand
-	if cli.IsSelfHostCommand(os.Args) {
-		if err := runSelfHost(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(selfhost.ExitGeneralError)
-		}
-		return
+// run parses args with the cli command tree and dispatches to the selected command.
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	inv, err := cli.ParseCommand(args, cli.ParseOptions{Output: stdout})
+	if err != nil {
+		err = fmt.Errorf("failed to parse arguments: %w", err)
+		return reportError(stdout, jsonRequested(args), exitBundleError, err)
 	}
 
-	if err := runBundle(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	switch inv.Command {
+	case cli.CommandBundle:
+		return runBundle(ctx, inv.Bundle, stdout)
+	case cli.CommandSelfHost:
+		return runSelfHost(ctx, inv.SelfHost, stdout)
+	case cli.CommandRepack:
+		return runRepack(inv.Repack, stdout)
+	case cli.CommandExtractDB:
+		return runExtractDB(inv.ExtractDB, stdout)
+	case cli.CommandInfo:
+		return runInfo(inv.Info, stdout)
+	case cli.CommandValidate:
+		return runValidate(inv.Validate, stdout)
+	case cli.CommandKey:
+		return runKey(inv.Key, os.Stdin, stdout)
+	case cli.CommandVersion:
+		fmt.Fprintf(stdout, "convex-bundler %s\n", appVersion)
+		fmt.Fprintf(stdout, "  commit: %s\n", commit)
+		fmt.Fprintf(stdout, "  built:  %s\n", buildTime)
+	}
+
+	// Help and completion output is written by the command tree itself
+	return nil
+}
+
+// exitCode maps an error returned by run to the process exit code.
+func exitCode(err error) int {
+	if errors.Is(err, errValidationFailed) {
+		return selfhost.ExitVerificationFailed
 	}
+	return exitBundleError
 }
 
-func runBundle() error {
-	// Parse CLI arguments
-	config, err := cli.Parse(os.Args)
+// runBundle builds the bundle described by config.
+// Human-readable progress is written to stdout by default; in JSON mode a
+// single JSON document describing the result or failure is written instead
+// and progress messages go to stderr.
+func runBundle(ctx context.Context, config *cli.Config, stdout io.Writer) error {
+	if config.OutputFormat != cli.OutputFormatJSON {
+		_, err := bundleApps(ctx, config, stdout, newLogger(stdout, config.Verbose, config.Quiet))
+		return err
+	}
+
+	result, err := bundleApps(ctx, config, io.Discard, newLogger(os.Stderr, config.Verbose, config.Quiet))
 	if err != nil {
-		return fmt.Errorf("failed to parse arguments: %w", err)
+		return reportError(stdout, true, exitBundleError, err)
 	}
+	return writeJSON(stdout, result)
+}
 
-	fmt.Printf("Bundling Convex apps...\n")
-	fmt.Printf("  Apps: %v\n", config.Apps)
-	fmt.Printf("  Output: %s\n", config.Output)
-	fmt.Printf("  Platform: %s\n", config.Platform)
+// newLogger returns a logger writing to w at the level selected by the
+// --verbose and --quiet flags.
+func newLogger(w io.Writer, verbose, quiet bool) logging.Logger {
+	level := logging.LevelInfo
+	switch {
+	case verbose:
+		level = logging.LevelDebug
+	case quiet:
+		level = logging.LevelWarn
+	}
+	return logging.New(w, level)
+}
+
+// bundleApps runs the bundle pipeline, logging progress messages to log and
+// writing the final summary to out. With --timeout the pipeline is cancelled
+// when the timeout expires, which stops the pre-deployment container and
+// removes a partially written bundle.
+func bundleApps(ctx context.Context, config *cli.Config, out io.Writer, log logging.Logger) (result *bundleOutput, err error) {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+		defer func() {
+			if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("timed out after %s: %w", config.Timeout, err)
+			}
+		}()
+	}
+
+	if config.DryRun {
+		log.Infof("Bundling Convex apps (dry run)...")
+	} else {
+		log.Infof("Bundling Convex apps...")
+	}
+	log.Infof("  Apps: %v", config.Apps)
+	log.Infof("  Output: %s", config.Output)
+	log.Infof("  Platform: %s", config.Platform)
 
 	// Detect version
-	detectedVersion, err := version.Detect(config.Apps[0], config.Version)
+	detectedVersion, err := version.DetectMulti(config.Apps, config.Version)
 	if err != nil {
-		return fmt.Errorf("failed to detect version: %w", err)
+		return nil, fmt.Errorf("failed to detect version: %w", err)
 	}
-	fmt.Printf("  Version: %s\n", detectedVersion)
+	log.Infof("  Version: %s", detectedVersion)
 
 	// Generate credentials
-	fmt.Println("Generating credentials...")
-	creds, err := credentials.Generate(config.Name)
+	log.Infof("Generating credentials...")
+	creds, err := credentials.Generate(config.InstanceName)
 	if err != nil {
-		return fmt.Errorf("failed to generate credentials: %w", err)
+		return nil, fmt.Errorf("failed to generate credentials: %w", err)
+	}
+	var passphrase string
+	if config.EncryptCredentials {
+		passphrase, err = readPassphrase(config.CredentialsPassphraseFile)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create manifest
+	manifestApps := config.Apps
+	if !config.AbsoluteApps {
+		manifestApps, err = manifest.NormalizeApps(config.Apps, ".")
+		if err != nil {
+			return nil, fmt.Errorf("failed to normalize app paths: %w", err)
+		}
+	}
 	mf := manifest.New(manifest.Options{
 		Name:     config.Name,
 		Version:  detectedVersion,
-		Apps:     config.Apps,
+		Apps:     manifestApps,
 		Platform: config.Platform,
+		Labels:   config.Labels,
 	})
 
-	// Run pre-deployment
-	fmt.Println("Running pre-deployment...")
-	predeployResult, err := predeploy.Run(predeploy.Options{
-		Apps:          config.Apps,
-		BackendBinary: config.BackendBinary,
-		OutputDir:     config.Output,
-		Platform:      config.Platform,
-		DockerImage:   config.DockerImage,
-	})
-	if err != nil {
-		return fmt.Errorf("pre-deployment failed: %w", err)
+	if config.DryRun {
+		if err := printBundlePlan(out, config, mf, creds); err != nil {
+			return nil, err
+		}
+		return &bundleOutput{
+			Success:    true,
+			DryRun:     true,
+			BundlePath: config.Output,
+			Files:      plannedFiles(),
+			Manifest:   mf,
+		}, nil
+	}
+
+	// Record the backend version; a binary that cannot run here, e.g. one
+	// built for another platform, leaves it unset. Dry runs never get here,
+	// so they do not execute the binary.
+	if mf.BackendVersion, err = bundle.DetectBackendVersion(config.BackendBinary); err != nil {
+		log.Warnf("Could not detect backend version: %v", err)
+	} else {
+		log.Infof("  Backend version: %s", mf.BackendVersion)
+	}
+
+	databasePath, storagePath := config.Database, config.Storage
+	if config.Database != "" {
+		log.Infof("Using prebuilt database %s (skipping pre-deployment)", config.Database)
+	} else {
+		// Run pre-deployment
+		log.Infof("Running pre-deployment...")
+		predeployResult, err := predeploy.Run(ctx, predeploy.Options{
+			Apps:          config.Apps,
+			BackendBinary: config.BackendBinary,
+			OutputDir:     config.Output,
+			Platform:      config.Platform,
+			DockerImage:   config.DockerImage,
+			Logger:        log,
+			KeepTemp:      config.KeepTemp,
+			Progress: func(appIndex, appTotal int, appPath, phase string) {
+				if phase == predeploy.PhaseDeploying {
+					log.Infof("Deploying app %d/%d (%s)...", appIndex+1, appTotal, appPath)
+				}
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("pre-deployment failed: %w", err)
+		}
+		defer func() {
+			if err := predeployResult.Cleanup(); err != nil {
+				log.Warnf("Failed to clean up pre-deployment files: %v", err)
+			}
+		}()
+		databasePath, storagePath = predeployResult.DatabasePath, predeployResult.StoragePath
+
+		// Record the toolchain that produced the database
+		mf.ConvexCLIVersion = predeployResult.ConvexCLIVersion
+		mf.PackageManager = predeployResult.PackageManager
 	}
 
 	// Create bundle
-	fmt.Println("Creating bundle...")
-	err = bundle.Create(bundle.Options{
+	log.Infof("Creating bundle...")
+	bundleResult, err := bundle.CreateWithResultContext(ctx, bundle.Options{
 		OutputDir:     config.Output,
 		BackendBinary: config.BackendBinary,
-		DatabasePath:  predeployResult.DatabasePath,
-		StoragePath:   predeployResult.StoragePath,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
 		Manifest:      mf,
 		Credentials:   creds,
+		Reproducible:  config.Reproducible,
+		DedupeStorage: config.DedupeStorage,
+		RequireStatic: config.RequireStatic,
+		EnvVars:       config.EnvVars,
+		Concurrency:   config.Concurrency,
+		Logger:        log,
+
+		IncludeAppSources:     config.IncludeAppSources,
+		Apps:                  config.Apps,
+		CredentialsPassphrase: passphrase,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create bundle: %w", err)
+		return nil, fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	if config.Checksums {
+		log.Debugf("Writing %s", bundle.ChecksumManifestName)
+		if err := bundle.WriteChecksumManifest(config.Output); err != nil {
+			return nil, fmt.Errorf("failed to write checksum manifest: %w", err)
+		}
+	}
+
+	fmt.Fprintf(out, "\nBundle created successfully at: %s\n", config.Output)
+	fmt.Fprintln(out, "Contents:")
+	fmt.Fprintln(out, "  - backend (executable)")
+	fmt.Fprintln(out, "  - convex.db (database)")
+	fmt.Fprintln(out, "  - storage/ (file storage)")
+	fmt.Fprintln(out, "  - manifest.json")
+	if config.EncryptCredentials {
+		fmt.Fprintln(out, "  - credentials.json (encrypted)")
+	} else {
+		fmt.Fprintln(out, "  - credentials.json")
+	}
+	if config.EnvVars != nil {
+		fmt.Fprintf(out, "  - %s\n", bundle.EnvFileName)
+	}
+	if config.IncludeAppSources {
+		fmt.Fprintf(out, "  - %s/ (app sources)\n", bundle.AppSourcesDir)
+	}
+	if config.Checksums {
+		fmt.Fprintf(out, "  - %s\n", bundle.ChecksumManifestName)
+	}
+	fmt.Fprintln(out, "Size:")
+	fmt.Fprintf(out, "  - backend: %d bytes\n", bundleResult.BackendSize)
+	fmt.Fprintf(out, "  - convex.db: %d bytes\n", bundleResult.DatabaseSize)
+	fmt.Fprintf(out, "  - storage/: %d bytes in %d files\n", bundleResult.StorageSize, bundleResult.StorageFileCount)
+	if config.IncludeAppSources {
+		fmt.Fprintf(out, "  - %s/: %d bytes\n", bundle.AppSourcesDir, bundleResult.AppSourcesSize)
+	}
+	fmt.Fprintf(out, "  - total: %d bytes\n", bundleResult.TotalSize)
+
+	files, totalSize, err := listFiles(config.Output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bundle contents: %w", err)
+	}
+
+	return &bundleOutput{
+		Success:           true,
+		BundlePath:        config.Output,
+		Files:             files,
+		TotalSize:         totalSize,
+		Manifest:          mf,
+		StorageBytesSaved: bundleResult.BytesSaved,
+	}, nil
+}
+
+// readPassphrase reads the credentials passphrase from path, ignoring a
+// trailing newline.
+func readPassphrase(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credentials passphrase: %w", err)
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("credentials passphrase file is empty: %s", path)
 	}
+	return passphrase, nil
+}
 
-	fmt.Printf("\nBundle created successfully at: %s\n", config.Output)
-	fmt.Println("Contents:")
-	fmt.Println("  - backend (executable)")
-	fmt.Println("  - convex.db (database)")
-	fmt.Println("  - storage/ (file storage)")
-	fmt.Println("  - manifest.json")
-	fmt.Println("  - credentials.json")
+// printBundlePlan validates the in-memory manifest and credentials and prints
+// what a real run would produce, without starting containers or writing files.
+func printBundlePlan(out io.Writer, config *cli.Config, mf *manifest.Manifest, creds *credentials.Credentials) error {
+	manifestData, err := mf.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize manifest: %w", err)
+	}
+	if _, err := creds.ToJSON(); err != nil {
+		return fmt.Errorf("failed to serialize credentials: %w", err)
+	}
+
+	dockerImage := config.DockerImage
+	if dockerImage == "" {
+		dockerImage = predeploy.DefaultPredeployImage
+	}
+
+	fmt.Fprintln(out, "\nDry run: no containers started and no files written.")
+	if config.Database != "" {
+		fmt.Fprintf(out, "Pre-deployment: skipped (prebuilt database %s)\n", config.Database)
+	} else {
+		fmt.Fprintf(out, "Pre-deployment image: %s\n", dockerImage)
+	}
+	fmt.Fprintf(out, "Planned bundle at: %s\n", config.Output)
+	fmt.Fprintln(out, "Contents:")
+	fmt.Fprintf(out, "  - backend (executable, from %s)\n", config.BackendBinary)
+	fmt.Fprintln(out, "  - convex.db (database)")
+	fmt.Fprintln(out, "  - storage/ (file storage)")
+	fmt.Fprintln(out, "  - manifest.json")
+	if config.EncryptCredentials {
+		fmt.Fprintln(out, "  - credentials.json (encrypted)")
+	} else {
+		fmt.Fprintln(out, "  - credentials.json")
+	}
+	if config.EnvVars != nil {
+		fmt.Fprintf(out, "  - %s\n", bundle.EnvFileName)
+	}
+	if config.IncludeAppSources {
+		fmt.Fprintf(out, "  - %s/ (app sources)\n", bundle.AppSourcesDir)
+	}
+	fmt.Fprintf(out, "\nmanifest.json:\n%s\n", manifestData)
 
 	return nil
 }
 
-func runSelfHost() error {
-	// Parse selfhost CLI arguments (skip "convex-bundler" and "selfhost" from args)
-	config, err := cli.ParseSelfHost(os.Args[1:]) // Pass args starting from "selfhost"
+// runSelfHost creates the self-extracting executable described by config,
+// reporting in text or JSON like runBundle.
+func runSelfHost(ctx context.Context, config *cli.SelfHostConfig, stdout io.Writer) error {
+	if config.OutputFormat != cli.OutputFormatJSON {
+		_, err := createSelfHost(ctx, config, stdout, newLogger(stdout, config.Verbose, config.Quiet))
+		return err
+	}
+
+	result, err := createSelfHost(ctx, config, io.Discard, newLogger(os.Stderr, config.Verbose, config.Quiet))
 	if err != nil {
-		return fmt.Errorf("failed to parse arguments: %w", err)
+		return reportError(stdout, true, selfhost.ExitGeneralError, err)
 	}
+	return writeJSON(stdout, result)
+}
 
-	fmt.Println("Creating self-extracting executable...")
-	fmt.Printf("  Bundle: %s\n", config.BundleDir)
-	fmt.Printf("  Ops Binary: %s\n", config.OpsBinary)
-	fmt.Printf("  Output: %s\n", config.Output)
-	fmt.Printf("  Platform: %s\n", config.Platform)
-	fmt.Printf("  Compression: %s\n", config.Compression)
+// createSelfHost builds the self-extracting executable, logging progress
+// messages to log and writing the final summary to out.
+func createSelfHost(ctx context.Context, config *cli.SelfHostConfig, out io.Writer, log logging.Logger) (*selfHostOutput, error) {
+	log.Infof("Creating self-extracting executable...")
+	log.Infof("  Bundle: %s", config.BundleDir)
+	opsBinary := config.OpsBinary
+	if config.OpsBinaryURL != "" {
+		log.Infof("  Ops Binary: %s", config.OpsBinaryURL)
+		downloaded, err := downloadOpsBinary(ctx, config.OpsBinaryURL, config.OpsBinarySHA256, log)
+		if err != nil {
+			return nil, err
+		}
+		opsBinary = downloaded
+	} else {
+		log.Infof("  Ops Binary: %s", config.OpsBinary)
+	}
+	log.Infof("  Output: %s", config.Output)
+	log.Infof("  Platform: %s", config.Platform)
+	log.Infof("  Compression: %s", config.Compression)
+
+	// A dynamically linked backend may not run on the install target
+	if err := bundle.CheckBackendLinking(filepath.Join(config.BundleDir, "backend"), config.RequireStatic, log); err != nil {
+		return nil, err
+	}
 
 	// Create self-extracting executable
-	err = selfhost.Create(selfhost.CreateOptions{
-		BundleDir:   config.BundleDir,
-		OpsBinary:   config.OpsBinary,
-		OutputPath:  config.Output,
-		Platform:    config.Platform,
-		Compression: config.Compression,
-		OpsVersion:  config.OpsVersion,
+	created, err := selfhost.CreateWithInfo(ctx, selfhost.CreateOptions{
+		BundleDir:           config.BundleDir,
+		OpsBinary:           opsBinary,
+		OutputPath:          config.Output,
+		Platform:            config.Platform,
+		Compression:         config.Compression,
+		OpsVersion:          config.OpsVersion,
+		InstallPrefix:       config.InstallPrefix,
+		ServiceName:         config.ServiceName,
+		HealthCheckPath:     config.HealthCheckPath,
+		HealthCheckTimeout:  config.HealthCheckTimeout,
+		Reproducible:        config.Reproducible,
+		ParallelCompression: config.ParallelCompression,
+		MaxBundleSize:       config.MaxSize,
+		ChecksumSidecar:     config.SidecarChecksum,
+		OmitCredentials:     config.OmitCredentials,
+		MinOpsVersion:       config.MinOpsVersion,
+		MinBackendVersion:   config.MinBackendVersion,
+		Logger:              log,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to create self-extracting executable: %w", err)
+		return nil, fmt.Errorf("failed to create self-extracting executable: %w", err)
+	}
+
+	fmt.Fprintf(out, "\nSelf-extracting executable created successfully at: %s\n", config.Output)
+	var sidecarPath string
+	if config.SidecarChecksum {
+		sidecarPath = selfhost.ChecksumSidecarPath(config.Output)
+		fmt.Fprintf(out, "Checksum sidecar written to: %s\n", sidecarPath)
 	}
+	fmt.Fprintln(out, "\nThe executable supports the following commands:")
+	fmt.Fprintln(out, "  install    - Install from embedded bundle")
+	fmt.Fprintln(out, "  extract    - Extract embedded bundle to a directory")
+	fmt.Fprintln(out, "  info       - Display embedded bundle information")
+	fmt.Fprintln(out, "  verify     - Verify embedded bundle integrity")
 
-	fmt.Printf("\nSelf-extracting executable created successfully at: %s\n", config.Output)
-	fmt.Println("\nThe executable supports the following commands:")
-	fmt.Println("  install    - Install from embedded bundle")
-	fmt.Println("  extract    - Extract embedded bundle to a directory")
-	fmt.Println("  info       - Display embedded bundle information")
-	fmt.Println("  verify     - Verify embedded bundle integrity")
+	info, err := os.Stat(config.Output)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat created executable: %w", err)
+	}
+
+	return &selfHostOutput{
+		Success:             true,
+		OutputPath:          config.Output,
+		Size:                info.Size(),
+		Header:              created.Header,
+		CompressionDecision: created.CompressionDecision,
+		ChecksumSidecar:     sidecarPath,
+	}, nil
+}
+
+// runRepack recompresses the bundle in config.Input, writing the result to
+// config.Output if set and rewriting the input in place otherwise.
+func runRepack(config *cli.RepackConfig, stdout io.Writer) error {
+	path := config.Input
+	if config.Output != "" && config.Output != config.Input {
+		if err := copyExecutable(config.Input, config.Output); err != nil {
+			return err
+		}
+		path = config.Output
+	}
+
+	if err := selfhost.Repack(path, config.Compression); err != nil {
+		if path != config.Input {
+			os.Remove(path)
+		}
+		return fmt.Errorf("failed to repack executable: %w", err)
+	}
+
+	header, err := selfhost.ReadHeaderFromExecutable(path)
+	if err != nil {
+		return fmt.Errorf("failed to read repacked header: %w", err)
+	}
+	fmt.Fprintf(stdout, "Repacked %s with %s compression\n", path, header.Compression)
+	return nil
+}
+
+// runExtractDB writes the convex.db embedded in a self-extracting executable
+// to the output path.
+func runExtractDB(config *cli.ExtractDBConfig, stdout io.Writer) error {
+	data, err := selfhost.ExtractFile(config.Input, "convex.db")
+	if err != nil {
+		return fmt.Errorf("failed to extract database: %w", err)
+	}
+	if !database.HasSQLiteHeader(data) {
+		return fmt.Errorf("convex.db in %s is not a SQLite database", config.Input)
+	}
+	if err := os.WriteFile(config.Output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	fmt.Fprintf(stdout, "Extracted convex.db (%d bytes) to %s\n", len(data), config.Output)
+	return nil
+}
+
+// copyExecutable copies src to dst, preserving its permissions.
+func copyExecutable(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open input: %w", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat input: %w", err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy executable: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %w", err)
+	}
+	return nil
+}
+
+// opsDownloadPath returns where downloadOpsBinary keeps the download of
+// url: a directory in the system temp directory named after the URL, so a
+// later run resumes an interrupted download or reuses a finished one.
+func opsDownloadPath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(os.TempDir(), "convex-bundler-ops-"+hex.EncodeToString(sum[:8]), "convex-backend-ops")
+}
+
+// downloadOpsBinary downloads the ops binary at url to opsDownloadPath,
+// checks it against expectedSHA256 if set, and returns its path.
+func downloadOpsBinary(ctx context.Context, url, expectedSHA256 string, log logging.Logger) (string, error) {
+	path := opsDownloadPath(url)
+	log.Infof("Downloading ops binary from %s...", url)
+	if err := predeploy.DownloadFile(ctx, url, path); err != nil {
+		return "", fmt.Errorf("failed to download ops binary: %w", err)
+	}
+
+	if expectedSHA256 != "" {
+		actual, err := fileSHA256(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read downloaded ops binary: %w", err)
+		}
+		if !strings.EqualFold(actual, expectedSHA256) {
+			// Download it again next time rather than reusing the bad file
+			if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+				log.Warnf("Failed to remove downloaded ops binary: %v", err)
+			}
+			return "", fmt.Errorf("ops binary checksum mismatch: expected %s, got %s", strings.ToLower(expectedSHA256), actual)
+		}
+	}
+
+	if err := os.Chmod(path, 0755); err != nil {
+		return "", fmt.Errorf("failed to make ops binary executable: %w", err)
+	}
+	return path, nil
+}
+
+// fileSHA256 returns the hex SHA256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// runInfo prints a summary of the bundle directory.
+func runInfo(config *cli.InfoConfig, stdout io.Writer) error {
+	info, err := bundle.Inspect(config.BundleDir)
+	if err != nil {
+		return reportError(stdout, config.OutputFormat == cli.OutputFormatJSON, exitBundleError, err)
+	}
+
+	if config.OutputFormat == cli.OutputFormatJSON {
+		return writeJSON(stdout, infoOutput{Success: true, Info: info})
+	}
+
+	printBundleInfo(stdout, info)
+	return nil
+}
+
+// printBundleInfo writes a human-readable bundle summary to out.
+func printBundleInfo(out io.Writer, info *bundle.Info) {
+	fmt.Fprintf(out, "Bundle: %s\n", info.Dir)
+	fmt.Fprintf(out, "  Name: %s\n", info.Manifest.Name)
+	fmt.Fprintf(out, "  Version: %s\n", info.Manifest.Version)
+	fmt.Fprintf(out, "  Platform: %s\n", info.Manifest.Platform)
+	if info.Manifest.BackendVersion != "" {
+		fmt.Fprintf(out, "  Backend version: %s\n", info.Manifest.BackendVersion)
+	}
+	fmt.Fprintf(out, "  Apps: %v\n", info.Manifest.Apps)
+	fmt.Fprintf(out, "  Created: %s\n", info.Manifest.CreatedAt)
+	if len(info.Manifest.Labels) > 0 {
+		fmt.Fprintln(out, "  Labels:")
+		keys := make([]string, 0, len(info.Manifest.Labels))
+		for key := range info.Manifest.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(out, "    %s=%s\n", key, info.Manifest.Labels[key])
+		}
+	}
+
+	fmt.Fprintln(out, "Contents:")
+	if info.HasBackend {
+		fmt.Fprintln(out, "  - backend: present")
+	} else {
+		fmt.Fprintln(out, "  - backend: missing")
+	}
+
+	switch {
+	case info.DatabaseSize == 0 && !info.DatabaseValid:
+		fmt.Fprintln(out, "  - convex.db: missing or empty")
+	case info.DatabaseValid:
+		fmt.Fprintf(out, "  - convex.db: %d bytes (valid SQLite database)\n", info.DatabaseSize)
+		if stats := info.DatabaseStats; stats != nil && stats.Recognized {
+			fmt.Fprintf(out, "    %d tables, %d modules, %d functions\n", stats.Tables, stats.Modules, stats.Functions)
+		}
+	default:
+		fmt.Fprintf(out, "  - convex.db: %d bytes (not a valid SQLite database)\n", info.DatabaseSize)
+	}
+
+	fmt.Fprintf(out, "  - storage/: %d files\n", info.StorageFileCount)
+
+	if info.CredentialsEncrypted && info.HasCredentials {
+		fmt.Fprintln(out, "  - credentials.json: present (encrypted)")
+	} else if info.HasCredentials {
+		fmt.Fprintf(out, "  - credentials.json: present (admin key: %s)\n", info.AdminKey)
+	} else {
+		fmt.Fprintln(out, "  - credentials.json: missing")
+	}
+}
+
+// runValidate checks the bundle directory and reports any problems.
+// It returns an error wrapping errValidationFailed if any problems are found.
+func runValidate(config *cli.ValidateConfig, stdout io.Writer) error {
+	asJSON := config.OutputFormat == cli.OutputFormatJSON
+
+	opts := bundle.VerifyOptions{VerifyDatabase: config.CheckDatabase}
+	if config.CredentialsPassphraseFile != "" {
+		passphrase, err := readPassphrase(config.CredentialsPassphraseFile)
+		if err != nil {
+			return reportError(stdout, asJSON, exitBundleError, err)
+		}
+		opts.CredentialsPassphrase = passphrase
+	}
+
+	result, err := bundle.VerifyWithOptions(config.BundleDir, opts)
+	if err != nil {
+		return reportError(stdout, asJSON, exitBundleError, err)
+	}
+
+	if asJSON {
+		if err := writeJSON(stdout, validateOutput{
+			Success:   result.Valid,
+			BundleDir: config.BundleDir,
+			Problems:  result.Problems,
+		}); err != nil {
+			return err
+		}
+	} else if result.Valid {
+		fmt.Fprintf(stdout, "Bundle is valid: %s\n", config.BundleDir)
+	} else {
+		fmt.Fprintf(stdout, "Bundle is invalid: %s\n", config.BundleDir)
+		fmt.Fprintln(stdout, "Problems:")
+		for _, problem := range result.Problems {
+			fmt.Fprintf(stdout, "  - %s\n", problem)
+		}
+	}
+
+	if !result.Valid {
+		return fmt.Errorf("%w: %d problem(s) found", errValidationFailed, len(result.Problems))
+	}
+	return nil
+}
+
+// runKey issues a key for an existing instance and prints it to stdout.
+// stdin is read when the secret file is "-".
+func runKey(config *cli.KeyConfig, stdin io.Reader, stdout io.Writer) error {
+	secret := config.Secret
+	if config.SecretFile != "" {
+		var data []byte
+		var err error
+		if config.SecretFile == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(config.SecretFile)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read instance secret: %w", err)
+		}
+		secret = string(data)
+	}
+
+	key, err := credentials.IssueKey(secret, config.InstanceName, credentials.KeyOptions{
+		MemberID: config.MemberID,
+		ReadOnly: config.ReadOnly,
+		System:   config.System,
+	})
+	if err != nil {
+		return err
+	}
 
+	fmt.Fprintln(stdout, key)
 	return nil
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ozanturksever/convex-bundler/pkg/bundle"
+	"github.com/ozanturksever/convex-bundler/pkg/cli"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/selfhost"
+)
+
+// bundleOutput is the JSON document emitted by the bundle command in JSON mode.
+type bundleOutput struct {
+	Success    bool               `json:"success"`
+	DryRun     bool               `json:"dryRun,omitempty"`
+	BundlePath string             `json:"bundlePath"`
+	Files      []fileOutput       `json:"files"`
+	TotalSize  int64              `json:"totalSize"`
+	Manifest   *manifest.Manifest `json:"manifest"`
+
+	// StorageBytesSaved is the size of storage files hardlinked by --dedupe-storage
+	StorageBytesSaved int64 `json:"storageBytesSaved,omitempty"`
+}
+
+// selfHostOutput is the JSON document emitted by the selfhost command in JSON mode.
+type selfHostOutput struct {
+	Success             bool                          `json:"success"`
+	OutputPath          string                        `json:"outputPath"`
+	Size                int64                         `json:"size"`
+	Header              *selfhost.Header              `json:"header"`
+	CompressionDecision *selfhost.CompressionDecision `json:"compressionDecision,omitempty"` // set for --compression auto
+	ChecksumSidecar     string                        `json:"checksumSidecar,omitempty"`     // set for --sidecar-checksum
+}
+
+// infoOutput is the JSON document emitted by the info command in JSON mode.
+type infoOutput struct {
+	Success bool `json:"success"`
+	*bundle.Info
+}
+
+// validateOutput is the JSON document emitted by the validate command in JSON mode.
+type validateOutput struct {
+	Success   bool     `json:"success"`
+	BundleDir string   `json:"bundleDir"`
+	Problems  []string `json:"problems"`
+}
+
+// fileOutput describes a single file in a JSON result.
+type fileOutput struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// errorOutput is the JSON document emitted when a command fails in JSON mode.
+type errorOutput struct {
+	Success bool        `json:"success"`
+	Error   errorDetail `json:"error"`
+}
+
+// errorDetail carries the exit code and message of a failed command.
+type errorDetail struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+
+	// Validation identifies the offending flag when argument validation failed
+	Validation *cli.ValidationError `json:"validation,omitempty"`
+}
+
+// writeJSON writes v to w as indented JSON followed by a newline.
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// reportError emits err as a JSON error document when asJSON is set and
+// returns err unchanged so callers can propagate it.
+func reportError(w io.Writer, asJSON bool, code int, err error) error {
+	if asJSON {
+		detail := errorDetail{Code: code, Message: err.Error()}
+		var validationErr *cli.ValidationError
+		if errors.As(err, &validationErr) {
+			detail.Validation = validationErr
+		}
+		writeJSON(w, errorOutput{Success: false, Error: detail})
+	}
+	return err
+}
+
+// jsonRequested reports whether args ask for JSON output. It is used when
+// argument parsing fails and the parsed output format is unavailable.
+func jsonRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--json" || arg == "--json=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns all regular files under dir with paths relative to dir,
+// along with their combined size.
+func listFiles(dir string) ([]fileOutput, int64, error) {
+	var files []fileOutput
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, fileOutput{Path: filepath.ToSlash(relPath), Size: info.Size()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// plannedFiles returns the file list for a bundle that has not been created yet.
+func plannedFiles() []fileOutput {
+	names := []string{"backend", "convex.db", "storage/", "manifest.json", "credentials.json"}
+	files := make([]fileOutput, 0, len(names))
+	for _, name := range names {
+		files = append(files, fileOutput{Path: name})
+	}
+	return files
+}
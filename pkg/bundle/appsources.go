@@ -0,0 +1,108 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+)
+
+// AppSourcesDir is the bundle directory that Options.IncludeAppSources
+// copies the app source trees into
+const AppSourcesDir = "apps"
+
+// defaultAppIgnore is applied to every app source tree before the app's own
+// ignore file: installed dependencies and git metadata are left out, since
+// the lockfile and the tree itself reproduce them. An app can re-include
+// them with "!node_modules/".
+const defaultAppIgnore = "node_modules/\n.git/\n"
+
+// appSourceNames returns the directory under AppSourcesDir for each app:
+// the base name of the app directory, with "-2", "-3", ... appended to
+// names already taken by an earlier app.
+func appSourceNames(apps []string) ([]string, error) {
+	names := make([]string, len(apps))
+	taken := make(map[string]bool, len(apps))
+	for i, app := range apps {
+		absApp, err := filepath.Abs(app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for app %s: %w", app, err)
+		}
+		base := filepath.Base(absApp)
+		if base == string(filepath.Separator) || base == "." {
+			base = "app"
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[name] = true
+		names[i] = name
+	}
+	return names, nil
+}
+
+// loadAppIgnore returns the matcher for the app source tree at dir: the
+// defaultAppIgnore patterns followed by those of its ignore file, if any.
+func loadAppIgnore(dir string) (*ignore.Matcher, error) {
+	var patterns io.Reader = strings.NewReader(defaultAppIgnore)
+	f, err := os.Open(filepath.Join(dir, ignore.FileName))
+	switch {
+	case err == nil:
+		defer f.Close()
+		patterns = io.MultiReader(patterns, strings.NewReader("\n"), f)
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("failed to open %s: %w", ignore.FileName, err)
+	}
+
+	m, err := ignore.Parse(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ignore.FileName, err)
+	}
+	return m, nil
+}
+
+// copyAppSources replaces AppSourcesDir in outputDir with a copy of each app
+// directory in AppSourcesDir/<name>, skipping outputDir itself if it lies
+// inside an app, and returns the slash-separated bundle paths in the order
+// of apps.
+func copyAppSources(ctx context.Context, apps []string, outputDir string, size *treeSize) ([]string, error) {
+	names, err := appSourceNames(apps)
+	if err != nil {
+		return nil, err
+	}
+	absOutput, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for output directory: %w", err)
+	}
+
+	// Replace the sources a previous run left, which may be of other apps
+	if err := os.RemoveAll(filepath.Join(outputDir, AppSourcesDir)); err != nil {
+		return nil, fmt.Errorf("failed to remove existing app sources: %w", err)
+	}
+
+	paths := make([]string, len(apps))
+	for i, app := range apps {
+		absApp, err := filepath.Abs(app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for app %s: %w", app, err)
+		}
+		matcher, err := loadAppIgnore(absApp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ignore file of app %s: %w", app, err)
+		}
+		dest := filepath.Join(outputDir, AppSourcesDir, names[i])
+		if err := copyTree(absApp, dest, &treeCopy{ctx: ctx, size: size, ignore: matcher, root: absApp, skip: absOutput}); err != nil {
+			return nil, fmt.Errorf("failed to copy sources of app %s: %w", app, err)
+		}
+		paths[i] = path.Join(AppSourcesDir, names[i])
+	}
+	return paths, nil
+}
@@ -0,0 +1,53 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// backendVersionTimeout bounds how long the backend may take to print its version
+const backendVersionTimeout = 10 * time.Second
+
+// DetectBackendVersion runs the backend binary at binaryPath with --version
+// and returns the version it reports, e.g. "0.1.0" for
+// "convex-local-backend 0.1.0". It returns an error if the binary cannot run
+// on this machine, as when it was built for another platform, or prints no
+// recognizable version.
+func DetectBackendVersion(binaryPath string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendVersionTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, binaryPath, "--version")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("backend --version did not finish within %s", backendVersionTimeout)
+		}
+		return "", fmt.Errorf("failed to run backend --version: %w (output: %s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseBackendVersion(stdout.String())
+}
+
+// parseBackendVersion extracts the version from backend --version output:
+// the last word of the first non-empty line, which must contain a digit.
+func parseBackendVersion(output string) (string, error) {
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		version := fields[len(fields)-1]
+		if !strings.ContainsFunc(version, unicode.IsDigit) {
+			break
+		}
+		return version, nil
+	}
+	return "", fmt.Errorf("unrecognized backend --version output: %q", strings.TrimSpace(output))
+}
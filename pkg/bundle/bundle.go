@@ -1,75 +1,283 @@
 package bundle
 
 import (
+	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
 
 	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
 )
 
 // Options for creating a bundle
 type Options struct {
-	OutputDir     string
-	BackendBinary string
-	DatabasePath  string
-	StoragePath   string
-	Manifest      *manifest.Manifest
-	Credentials   *credentials.Credentials
+	OutputDir        string
+	BackendBinary    string
+	DatabasePath     string
+	StoragePath      string // Directory copied to storage/, minus paths matched by its .convexbundleignore (empty for an empty storage/)
+	Manifest         *manifest.Manifest
+	Credentials      *credentials.Credentials
+	Reproducible     bool              // Stamp the manifest with manifest.ReproducibleTime instead of its creation time
+	DedupeStorage    bool              // Hardlink storage files with identical content instead of copying each one
+	StorageChecksums bool              // Record each storage file's checksum in the manifest (needed by CreateDelta)
+	FollowSymlinks   bool              // Copy the contents of directory symlinks in StoragePath instead of recreating the links
+	SymlinkBackend   bool              // Symlink backend to BackendBinary instead of copying it, for fast development rebuilds (copied on Windows)
+	RequireStatic    bool              // Fail instead of warning if BackendBinary is dynamically linked (see CheckStaticLinking)
+	EnvVars          map[string]string // If non-nil (even empty), write convex.env with the instance secret and these vars for the installer to source
+	Concurrency      int               // Storage files copied at once (default 1)
+	Logger           logging.Logger    // Receives progress messages (default: discard)
+
+	// IncludeAppSources copies each of Apps to apps/<name> in the bundle,
+	// minus node_modules/, .git/ and paths matched by the app's
+	// .convexbundleignore, and records the paths in the manifest's
+	// AppSources, so the bundle carries the source that produced convex.db
+	IncludeAppSources bool
+	Apps              []string
+
+	// CredentialsPassphrase, if set, stores credentials.json encrypted with
+	// this passphrase (see credentials.Credentials.ToEncryptedJSON). It
+	// cannot be combined with EnvVars, since convex.env holds the secret in
+	// plaintext.
+	CredentialsPassphrase string
+
+	// PreBundleHook, if set, is called with the path of the bundle's copy of
+	// convex.db before anything else is packaged, e.g. to run a migration or
+	// seed data. DatabasePath itself is never modified. The hook must close
+	// every connection to the database before returning, so no journal or
+	// WAL file is left behind.
+	PreBundleHook func(dbPath string) error
+}
+
+// Result describes a bundle written by CreateWithResult
+type Result struct {
+	DedupedFiles     int   `json:"dedupedFiles"`     // Storage files hardlinked to an identical file
+	BytesSaved       int64 `json:"bytesSaved"`       // Size of the deduplicated storage files
+	BackendSize      int64 `json:"backendSize"`      // Size of the backend binary (its target, when linked)
+	DatabaseSize     int64 `json:"databaseSize"`     // Size of convex.db
+	StorageSize      int64 `json:"storageSize"`      // Total size of the storage files, including deduplicated ones
+	StorageFileCount int   `json:"storageFileCount"` // Number of storage files
+	AppSourcesSize   int64 `json:"appSourcesSize"`   // Total size of the app source files copied to apps/
+	TotalSize        int64 `json:"totalSize"`        // Size of all bundle files, including manifest.json, credentials.json and convex.env
 }
 
 // Create assembles the final bundle directory
 func Create(opts Options) error {
+	return CreateContext(context.Background(), opts)
+}
+
+// CreateContext is like Create but stops when ctx is cancelled. See
+// CreateWithResultContext.
+func CreateContext(ctx context.Context, opts Options) error {
+	_, err := CreateWithResultContext(ctx, opts)
+	return err
+}
+
+// CreateWithResult assembles the final bundle directory and reports the size
+// of each component and what storage deduplication saved
+func CreateWithResult(opts Options) (*Result, error) {
+	return CreateWithResultContext(context.Background(), opts)
+}
+
+// CreateWithResultContext is like CreateWithResult but stops between files
+// when ctx is cancelled, removing the output directory if this call created it.
+func CreateWithResultContext(ctx context.Context, opts Options) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("bundle creation cancelled: %w", err)
+	}
+	_, statErr := os.Stat(opts.OutputDir)
+	createdOutput := os.IsNotExist(statErr)
+
+	result, err := create(ctx, opts)
+	if err != nil && ctx.Err() != nil {
+		if createdOutput {
+			os.RemoveAll(opts.OutputDir)
+		}
+		return nil, fmt.Errorf("bundle creation cancelled: %w", ctx.Err())
+	}
+	return result, err
+}
+
+// create assembles the bundle directory for CreateWithResultContext.
+func create(ctx context.Context, opts Options) (*Result, error) {
+	log := logging.OrNop(opts.Logger)
+	result := &Result{}
+
+	if opts.IncludeAppSources && len(opts.Apps) == 0 {
+		return nil, fmt.Errorf("app sources requested but no apps were given")
+	}
+	if opts.CredentialsPassphrase != "" && opts.EnvVars != nil {
+		return nil, fmt.Errorf("encrypted credentials cannot be combined with %s, which stores the instance secret in plaintext", EnvFileName)
+	}
+
+	// A dynamically linked backend may not run on the install target
+	if err := CheckBackendLinking(opts.BackendBinary, opts.RequireStatic, log); err != nil {
+		return nil, err
+	}
+
 	// Create output directory
 	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
-	// Copy backend binary
+	// Copy or link backend binary. Remove what a previous run left first, so
+	// a copy is never written through an old symlink into the source binary.
 	backendDest := filepath.Join(opts.OutputDir, "backend")
-	if err := copyFile(opts.BackendBinary, backendDest); err != nil {
-		return fmt.Errorf("failed to copy backend binary: %w", err)
+	if err := os.Remove(backendDest); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove existing backend: %w", err)
 	}
-	// Make it executable
+	if opts.SymlinkBackend && runtime.GOOS != "windows" {
+		absBackend, err := filepath.Abs(opts.BackendBinary)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve backend binary: %w", err)
+		}
+		log.Debugf("Linking %s to backend binary %s", backendDest, absBackend)
+		if err := os.Symlink(absBackend, backendDest); err != nil {
+			return nil, fmt.Errorf("failed to link backend binary: %w", err)
+		}
+	} else {
+		log.Debugf("Copying backend binary %s to %s", opts.BackendBinary, backendDest)
+		if err := copyFile(opts.BackendBinary, backendDest); err != nil {
+			return nil, fmt.Errorf("failed to copy backend binary: %w", err)
+		}
+	}
+	// Make it executable (the symlink's target, when linked)
 	if err := os.Chmod(backendDest, 0755); err != nil {
-		return fmt.Errorf("failed to make backend executable: %w", err)
+		return nil, fmt.Errorf("failed to make backend executable: %w", err)
+	}
+	backendInfo, err := os.Stat(backendDest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat backend binary: %w", err)
 	}
+	result.BackendSize = backendInfo.Size()
 
 	// Copy database
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	dbDest := filepath.Join(opts.OutputDir, "convex.db")
+	log.Debugf("Copying database %s to %s", opts.DatabasePath, dbDest)
 	if err := copyFile(opts.DatabasePath, dbDest); err != nil {
-		return fmt.Errorf("failed to copy database: %w", err)
+		return nil, fmt.Errorf("failed to copy database: %w", err)
 	}
+	if opts.PreBundleHook != nil {
+		log.Debugf("Running pre-bundle hook on %s", dbDest)
+		if err := opts.PreBundleHook(dbDest); err != nil {
+			return nil, fmt.Errorf("pre-bundle hook failed: %w", err)
+		}
+	}
+	dbInfo, err := os.Stat(dbDest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat database: %w", err)
+	}
+	result.DatabaseSize = dbInfo.Size()
 
 	// Copy/create storage directory
 	storageDest := filepath.Join(opts.OutputDir, "storage")
-	if err := copyDir(opts.StoragePath, storageDest); err != nil {
-		return fmt.Errorf("failed to copy storage directory: %w", err)
+	log.Debugf("Copying storage %s to %s", opts.StoragePath, storageDest)
+	var deduper *storageDeduper
+	if opts.DedupeStorage {
+		deduper = &storageDeduper{copied: make(map[dedupeKey]string), result: result}
+	}
+	var storageSize treeSize
+	var storageIgnore *ignore.Matcher
+	if opts.StoragePath != "" {
+		storageIgnore, err = ignore.Load(opts.StoragePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load storage ignore file: %w", err)
+		}
+	}
+	if opts.StoragePath == "" {
+		// No file storage: the bundle still gets an empty storage/
+		if err := os.MkdirAll(storageDest, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+	} else if err := copyStorage(opts.StoragePath, storageDest, opts.Concurrency, &treeCopy{ctx: ctx, deduper: deduper, size: &storageSize, followSymlinks: opts.FollowSymlinks, ignore: storageIgnore, root: opts.StoragePath}); err != nil {
+		return nil, fmt.Errorf("failed to copy storage directory: %w", err)
+	}
+	result.StorageSize = storageSize.bytes
+	result.StorageFileCount = storageSize.files
+	if result.DedupedFiles > 0 {
+		log.Infof("Deduplicated %d storage files, saving %d bytes", result.DedupedFiles, result.BytesSaved)
+	}
+
+	// Copy app sources
+	var appSources []string
+	if opts.IncludeAppSources {
+		log.Debugf("Copying %d app source trees to %s", len(opts.Apps), filepath.Join(opts.OutputDir, AppSourcesDir))
+		var appSize treeSize
+		appSources, err = copyAppSources(ctx, opts.Apps, opts.OutputDir, &appSize)
+		if err != nil {
+			return nil, err
+		}
+		result.AppSourcesSize = appSize.bytes
 	}
 
-	// Write manifest.json
-	manifestData, err := opts.Manifest.ToJSON()
+	// Write manifest.json, leaving the caller's manifest unmodified
+	mf := *opts.Manifest
+	mf.AppSources = appSources
+	if opts.Reproducible {
+		mf.CreatedAt = manifest.ReproducibleTime().Format(time.RFC3339)
+	}
+	if opts.StorageChecksums {
+		sums, err := storageChecksums(storageDest, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to checksum storage: %w", err)
+		}
+		mf.StorageChecksums = sums
+	}
+	manifestData, err := mf.ToJSON()
 	if err != nil {
-		return fmt.Errorf("failed to serialize manifest: %w", err)
+		return nil, fmt.Errorf("failed to serialize manifest: %w", err)
 	}
 	manifestPath := filepath.Join(opts.OutputDir, "manifest.json")
+	log.Debugf("Writing %s", manifestPath)
 	if err := os.WriteFile(manifestPath, manifestData, 0644); err != nil {
-		return fmt.Errorf("failed to write manifest.json: %w", err)
+		return nil, fmt.Errorf("failed to write manifest.json: %w", err)
 	}
 
 	// Write credentials.json
-	credsData, err := opts.Credentials.ToJSON()
+	var credsData []byte
+	if opts.CredentialsPassphrase != "" {
+		log.Debugf("Encrypting credentials")
+		credsData, err = opts.Credentials.ToEncryptedJSON(opts.CredentialsPassphrase)
+	} else {
+		credsData, err = opts.Credentials.ToJSON()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to serialize credentials: %w", err)
+		return nil, fmt.Errorf("failed to serialize credentials: %w", err)
 	}
 	credsPath := filepath.Join(opts.OutputDir, "credentials.json")
+	log.Debugf("Writing %s", credsPath)
 	if err := os.WriteFile(credsPath, credsData, 0644); err != nil {
-		return fmt.Errorf("failed to write credentials.json: %w", err)
+		return nil, fmt.Errorf("failed to write credentials.json: %w", err)
 	}
 
-	return nil
+	result.TotalSize = result.BackendSize + result.DatabaseSize + result.StorageSize + result.AppSourcesSize +
+		int64(len(manifestData)) + int64(len(credsData))
+
+	// Write convex.env
+	if opts.EnvVars != nil {
+		envPath := filepath.Join(opts.OutputDir, EnvFileName)
+		log.Debugf("Writing %s", envPath)
+		if err := writeEnvFile(envPath, opts.Credentials.InstanceSecret, opts.EnvVars); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", EnvFileName, err)
+		}
+		envInfo, err := os.Stat(envPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", EnvFileName, err)
+		}
+		result.TotalSize += envInfo.Size()
+	}
+
+	return result, nil
 }
 
 // copyFile copies a file from src to dst
@@ -100,11 +308,123 @@ func copyFile(src, dst string) error {
 
 // copyDir copies a directory from src to dst
 func copyDir(src, dst string) error {
+	return copyTree(src, dst, &treeCopy{})
+}
+
+// copyStorage runs copyTree with up to concurrency files copied at once.
+func copyStorage(src, dst string, concurrency int, c *treeCopy) error {
+	if concurrency > 1 {
+		c.pool = newCopyPool(concurrency)
+	}
+	err := copyTree(src, dst, c)
+	if c.pool != nil {
+		if waitErr := c.pool.wait(); err == nil {
+			err = waitErr
+		}
+	}
+	return err
+}
+
+// copyPool runs copyTree's file copies on up to a fixed number of goroutines
+type copyPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+
+	mu  sync.Mutex
+	err error // First copy error
+}
+
+// newCopyPool returns a pool running at most limit copies at once.
+func newCopyPool(limit int) *copyPool {
+	return &copyPool{slots: make(chan struct{}, limit)}
+}
+
+// run calls fn on a new goroutine once a slot is free. After a copy has
+// failed, run returns that error instead of starting fn.
+func (p *copyPool) run(fn func() error) error {
+	p.slots <- struct{}{}
+	if err := p.firstErr(); err != nil {
+		<-p.slots
+		return err
+	}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+		if err := fn(); err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// wait waits for the running copies and returns the first error.
+func (p *copyPool) wait() error {
+	p.wg.Wait()
+	return p.firstErr()
+}
+
+func (p *copyPool) firstErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// treeSize counts the files copied by copyTree
+type treeSize struct {
+	files int
+	bytes int64
+}
+
+// fileID identifies a file by device and inode
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// treeCopy configures copyTree
+type treeCopy struct {
+	ctx            context.Context // Stops the copy between files when cancelled, if set
+	pool           *copyPool       // Copies files in parallel when set
+	deduper        *storageDeduper // Hardlinks duplicate files when set
+	size           *treeSize       // Counts the copied files when set
+	sizeMu         sync.Mutex      // Guards size for parallel copies
+	followSymlinks bool            // Copy the contents of directory symlinks instead of the links
+	ignore         *ignore.Matcher // Skips the paths it matches, relative to root, when set
+	root           string          // Directory the ignore patterns are relative to
+	skip           string          // Absolute path that is not copied, e.g. an output directory inside the tree
+
+	// visited holds the directories being copied on the current path, so a
+	// directory reached again through a symlink is reported as a cycle
+	visited map[fileID]bool
+}
+
+// copyTree copies a directory from src to dst. Symlinks to directories are
+// recreated as symlinks unless c.followSymlinks is set; symlinks to files
+// are copied as the files they point to.
+func copyTree(src, dst string, c *treeCopy) error {
 	srcInfo, err := os.Stat(src)
 	if err != nil {
 		return err
 	}
 
+	if id, ok := fileIDOf(srcInfo); ok {
+		if c.visited[id] {
+			return fmt.Errorf("symlink cycle detected at %s", src)
+		}
+		if c.visited == nil {
+			c.visited = make(map[fileID]bool)
+		}
+		c.visited[id] = true
+		defer delete(c.visited, id)
+	}
+
 	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
 		return err
 	}
@@ -117,17 +437,163 @@ func copyDir(src, dst string) error {
 	for _, entry := range entries {
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
+		if c.skip != "" && srcPath == c.skip {
+			continue
+		}
 
-		if entry.IsDir() {
-			if err := copyDir(srcPath, dstPath); err != nil {
+		isDir := entry.IsDir()
+		isSymlink := entry.Type()&os.ModeSymlink != 0
+		if isSymlink {
+			target, err := os.Stat(srcPath)
+			if err != nil {
 				return err
 			}
-		} else {
-			if err := copyFile(srcPath, dstPath); err != nil {
+			isDir = target.IsDir()
+		}
+
+		// Ignore patterns apply to symlinks too, matched as what they point to
+		if c.ignore != nil {
+			rel, err := filepath.Rel(c.root, srcPath)
+			if err != nil {
 				return err
 			}
+			if c.ignore.Match(filepath.ToSlash(rel), isDir) {
+				continue
+			}
+		}
+
+		if isSymlink && isDir && !c.followSymlinks {
+			if err := copySymlink(srcPath, dstPath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if isDir {
+			if err := copyTree(srcPath, dstPath, c); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if c.ctx != nil {
+			if err := c.ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if c.pool != nil {
+			if err := c.pool.run(func() error { return c.copyFile(srcPath, dstPath) }); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := c.copyFile(srcPath, dstPath); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+// copyFile copies a single file for copyTree and counts it.
+func (c *treeCopy) copyFile(src, dst string) error {
+	if c.deduper != nil {
+		if err := c.deduper.copyFile(src, dst); err != nil {
+			return err
+		}
+	} else {
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+	}
+	if c.size != nil {
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		c.sizeMu.Lock()
+		c.size.files++
+		c.size.bytes += info.Size()
+		c.sizeMu.Unlock()
+	}
+	return nil
+}
+
+// copySymlink recreates the symlink src at dst, replacing anything already there
+func copySymlink(src, dst string) error {
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return os.Symlink(link, dst)
+}
+
+// dedupeKey identifies file content; the mode is included because hardlinks share permissions
+type dedupeKey struct {
+	sum  [sha256.Size]byte
+	mode os.FileMode
+}
+
+// storageDeduper copies files, hardlinking any whose content matches a file it already copied
+type storageDeduper struct {
+	mu     sync.Mutex
+	copied map[dedupeKey]string // First destination path written for each content
+	result *Result
+}
+
+// copyFile copies src to dst, or hardlinks dst to an identical earlier copy.
+// If the filesystem does not support hardlinks the file is copied instead.
+// It is safe for concurrent use, though identical files copied at the same
+// time may both be copied.
+func (d *storageDeduper) copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	sum, err := fileSHA256(src)
+	if err != nil {
+		return err
+	}
+
+	key := dedupeKey{sum: sum, mode: info.Mode()}
+	d.mu.Lock()
+	if first, ok := d.copied[key]; ok {
+		if err := os.Link(first, dst); err == nil {
+			d.result.DedupedFiles++
+			d.result.BytesSaved += info.Size()
+			d.mu.Unlock()
+			return nil
+		}
+	}
+	d.mu.Unlock()
+
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	if _, ok := d.copied[key]; !ok {
+		d.copied[key] = dst
+	}
+	d.mu.Unlock()
+	return nil
+}
+
+// fileSHA256 returns the SHA256 of the file at path
+func fileSHA256(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
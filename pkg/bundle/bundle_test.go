@@ -1,16 +1,30 @@
 package bundle
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"debug/elf"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/selfhost"
 )
 
 func TestCreate(t *testing.T) {
@@ -151,6 +165,86 @@ func TestCreate_StorageWithFiles(t *testing.T) {
 	assert.Equal(t, "content1", string(content))
 }
 
+func TestCreate_StorageIgnoreFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("db"), 0644))
+
+	storagePath := filepath.Join(tmpDir, "storage")
+	for _, name := range []string{"data.bin", "scratch.txt", "keep.txt", "tmp/cache.bin", "sub/notes.txt"} {
+		path := filepath.Join(storagePath, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(name), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, ignore.FileName), []byte("*.txt\n!keep.txt\ntmp/\n"), 0644))
+
+	mf := manifest.New(manifest.Options{Name: "Test", Version: "1.0.0", Platform: "linux-x64"})
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	result, err := CreateWithResult(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+	})
+	require.NoError(t, err)
+
+	storageDest := filepath.Join(outputDir, "storage")
+	assert.FileExists(t, filepath.Join(storageDest, "data.bin"))
+	assert.FileExists(t, filepath.Join(storageDest, "keep.txt"))
+	assert.NoFileExists(t, filepath.Join(storageDest, "scratch.txt"))
+	assert.NoFileExists(t, filepath.Join(storageDest, "sub", "notes.txt"))
+	assert.NoDirExists(t, filepath.Join(storageDest, "tmp"))
+	assert.NoFileExists(t, filepath.Join(storageDest, ignore.FileName))
+	assert.Equal(t, 2, result.StorageFileCount)
+}
+
+func TestCreate_StorageIgnoreDirectorySymlink(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("db"), 0644))
+
+	cacheTarget := filepath.Join(tmpDir, "cache-target")
+	require.NoError(t, os.MkdirAll(cacheTarget, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheTarget, "cached.bin"), []byte("cached"), 0644))
+
+	storagePath := filepath.Join(tmpDir, "storage")
+	writeStorage(t, storagePath, map[string]string{"data.bin": "data", ignore.FileName: "cache/\n"})
+	require.NoError(t, os.Symlink(cacheTarget, filepath.Join(storagePath, "cache")))
+	require.NoError(t, os.Symlink(cacheTarget, filepath.Join(storagePath, "linked")))
+
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+	for _, follow := range []bool{false, true} {
+		require.NoError(t, Create(Options{
+			OutputDir:      outputDir,
+			BackendBinary:  backendBinary,
+			DatabasePath:   databasePath,
+			StoragePath:    storagePath,
+			Manifest:       manifest.New(manifest.Options{Name: "Test", Version: "1.0.0", Platform: "linux-x64"}),
+			Credentials:    creds,
+			FollowSymlinks: follow,
+		}))
+
+		storageDest := filepath.Join(outputDir, "storage")
+		_, err := os.Lstat(filepath.Join(storageDest, "cache"))
+		assert.True(t, os.IsNotExist(err), "ignored directory symlink should not be bundled (follow symlinks: %v)", follow)
+		assert.FileExists(t, filepath.Join(storageDest, "linked", "cached.bin"), "follow symlinks: %v", follow)
+		require.NoError(t, os.RemoveAll(outputDir))
+	}
+}
+
 func TestCreate_MissingBackendBinary(t *testing.T) {
 	tmpDir := t.TempDir()
 	outputDir := filepath.Join(tmpDir, "bundle")
@@ -222,6 +316,549 @@ func TestCopyDir(t *testing.T) {
 	assert.FileExists(t, filepath.Join(dstDir, "subdir", "file2.txt"))
 }
 
+func TestCopyDir_Empty(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	dstDir := filepath.Join(tmpDir, "dst")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+
+	require.NoError(t, copyDir(srcDir, dstDir))
+
+	entries, err := os.ReadDir(dstDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCopyDir_SymlinkCycle(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "sub", "file.txt"), []byte("content"), 0644))
+	require.NoError(t, os.Symlink("..", filepath.Join(srcDir, "sub", "loop")))
+
+	// By default the directory symlink is recreated, not followed
+	dstDir := filepath.Join(tmpDir, "dst")
+	require.NoError(t, copyDir(srcDir, dstDir))
+	link, err := os.Readlink(filepath.Join(dstDir, "sub", "loop"))
+	require.NoError(t, err)
+	assert.Equal(t, "..", link)
+	assert.FileExists(t, filepath.Join(dstDir, "sub", "file.txt"))
+
+	// Following symlinks stops at the cycle instead of recursing forever
+	done := make(chan error, 1)
+	go func() {
+		done <- copyTree(srcDir, filepath.Join(tmpDir, "followed"), &treeCopy{followSymlinks: true})
+	}()
+	select {
+	case err := <-done:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "symlink cycle detected")
+	case <-time.After(10 * time.Second):
+		t.Fatal("copyTree did not terminate on a symlink cycle")
+	}
+}
+
+func TestCopyDir_FollowSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	targetDir := filepath.Join(tmpDir, "target")
+	require.NoError(t, os.MkdirAll(targetDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(targetDir, "file.txt"), []byte("content"), 0644))
+
+	srcDir := filepath.Join(tmpDir, "src")
+	require.NoError(t, os.MkdirAll(srcDir, 0755))
+	require.NoError(t, os.Symlink(targetDir, filepath.Join(srcDir, "a")))
+	require.NoError(t, os.Symlink(targetDir, filepath.Join(srcDir, "b")))
+
+	// Two links to the same directory are not a cycle
+	var size treeSize
+	dstDir := filepath.Join(tmpDir, "dst")
+	require.NoError(t, copyTree(srcDir, dstDir, &treeCopy{size: &size, followSymlinks: true}))
+	for _, name := range []string{"a", "b"} {
+		info, err := os.Lstat(filepath.Join(dstDir, name))
+		require.NoError(t, err)
+		assert.True(t, info.IsDir(), "%s should be copied as a directory", name)
+		assert.FileExists(t, filepath.Join(dstDir, name, "file.txt"))
+	}
+	assert.Equal(t, 2, size.files)
+}
+
+func TestCreate_NoStoragePath(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	result, err := CreateWithResult(Options{
+		OutputDir:        outputDir,
+		BackendBinary:    backendBinary,
+		DatabasePath:     databasePath,
+		Manifest:         manifest.New(manifest.Options{Name: "No Storage", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:      creds,
+		StorageChecksums: true,
+	})
+	require.NoError(t, err)
+	assert.Zero(t, result.StorageFileCount)
+
+	info, err := os.Stat(filepath.Join(outputDir, "storage"))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	entries, err := os.ReadDir(filepath.Join(outputDir, "storage"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCreate_PreBundleHook(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	db, err := sql.Open("sqlite", databasePath)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE markers (name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+	original, err := os.ReadFile(databasePath)
+	require.NoError(t, err)
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	opts := Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Hook", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+		PreBundleHook: func(dbPath string) error {
+			db, err := sql.Open("sqlite", dbPath)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			_, err = db.Exec("INSERT INTO markers (name) VALUES ('seeded')")
+			return err
+		},
+	}
+	result, err := CreateWithResult(opts)
+	require.NoError(t, err)
+
+	bundledPath := filepath.Join(outputDir, "convex.db")
+	db, err = sql.Open("sqlite", bundledPath)
+	require.NoError(t, err)
+	defer db.Close()
+	var name string
+	require.NoError(t, db.QueryRow("SELECT name FROM markers").Scan(&name))
+	assert.Equal(t, "seeded", name)
+
+	info, err := os.Stat(bundledPath)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), result.DatabaseSize)
+
+	// The source database is left unchanged
+	current, err := os.ReadFile(databasePath)
+	require.NoError(t, err)
+	assert.Equal(t, original, current)
+
+	opts.OutputDir = filepath.Join(tmpDir, "failed")
+	opts.PreBundleHook = func(string) error { return errors.New("migration failed") }
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pre-bundle hook failed: migration failed")
+	assert.NoFileExists(t, filepath.Join(opts.OutputDir, "manifest.json"))
+}
+
+func TestInspect(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	dbContent := append([]byte("SQLite format 3\x00"), make([]byte, 100)...)
+	require.NoError(t, os.WriteFile(databasePath, dbContent, 0644))
+
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(filepath.Join(storagePath, "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "nested", "b.txt"), []byte("b"), 0644))
+
+	mf := manifest.New(manifest.Options{
+		Name:     "Inspect Bundle",
+		Version:  "1.2.0",
+		Apps:     []string{"/app1"},
+		Platform: "linux-x64",
+	})
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	require.NoError(t, Create(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+	}))
+
+	info, err := Inspect(outputDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Inspect Bundle", info.Manifest.Name)
+	assert.Equal(t, "1.2.0", info.Manifest.Version)
+	assert.True(t, info.HasBackend)
+	assert.True(t, info.HasCredentials)
+	assert.Equal(t, int64(len(dbContent)), info.DatabaseSize)
+	assert.True(t, info.DatabaseValid)
+	assert.Equal(t, 2, info.StorageFileCount)
+
+	// Admin key must be redacted
+	assert.NotEqual(t, creds.AdminKey, info.AdminKey)
+	assert.Equal(t, credentials.Redact(creds.AdminKey), info.AdminKey)
+}
+
+func TestInspect_InvalidDatabaseAndMissingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mf := manifest.New(manifest.Options{Name: "Partial", Version: "1.0.0", Platform: "linux-x64"})
+	data, err := mf.ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "manifest.json"), data, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "convex.db"), []byte("not a database"), 0644))
+
+	info, err := Inspect(tmpDir)
+	require.NoError(t, err)
+
+	assert.False(t, info.HasBackend)
+	assert.False(t, info.HasCredentials)
+	assert.Empty(t, info.AdminKey)
+	assert.Equal(t, int64(len("not a database")), info.DatabaseSize)
+	assert.False(t, info.DatabaseValid)
+	assert.Equal(t, 0, info.StorageFileCount)
+}
+
+// createConvexTestDatabase writes a database laid out like the Convex
+// backend's SQLite persistence, with two user tables and three modules, one
+// of which has been deleted.
+func createConvexTestDatabase(t *testing.T, path string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE documents (
+		id BLOB NOT NULL, ts INTEGER NOT NULL, table_id BLOB NOT NULL,
+		json_value BLOB NOT NULL, deleted INTEGER NOT NULL, prev_ts INTEGER,
+		PRIMARY KEY (ts, table_id, id))`)
+	require.NoError(t, err)
+
+	insert := func(id, tableID string, ts int64, value string, deleted bool) {
+		_, err := db.Exec(`INSERT INTO documents (id, ts, table_id, json_value, deleted) VALUES (?, ?, ?, ?, ?)`,
+			[]byte(id), ts, []byte(tableID), []byte(value), deleted)
+		require.NoError(t, err)
+	}
+
+	insert("tables", "tables", 1, `{"name":"_tables","state":"active","number":1}`, false)
+	insert("modules", "tables", 1, `{"name":"_modules","state":"active","number":2}`, false)
+	insert("messages", "tables", 2, `{"name":"messages","state":"active","number":10001}`, false)
+	insert("users", "tables", 2, `{"name":"users","state":"active","number":10002}`, false)
+	insert("dropped", "tables", 2, `{"name":"dropped","state":"active","number":10003}`, false)
+	insert("dropped", "tables", 3, `{}`, true)
+
+	insert("m1", "modules", 2, `{"path":"messages.js","analyzeResult":{"functions":[{"name":"list"}]}}`, false)
+	insert("m1", "modules", 3, `{"path":"messages.js","analyzeResult":{"functions":[{"name":"list"},{"name":"send"}]}}`, false)
+	insert("m2", "modules", 3, `{"path":"http.js","analyzeResult":{"functions":[{"name":"default"}]}}`, false)
+	insert("m3", "modules", 3, `{"path":"old.js","analyzeResult":{"functions":[{"name":"stale"}]}}`, false)
+	insert("m3", "modules", 4, `{}`, true)
+}
+
+func TestInspectDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "convex.db")
+	createConvexTestDatabase(t, dbPath)
+
+	stats, err := InspectDatabase(dbPath)
+	require.NoError(t, err)
+	assert.Equal(t, &DBStats{Recognized: true, Tables: 2, Modules: 2, Functions: 3}, stats)
+}
+
+func TestInspectDatabase_UnknownSchema(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	t.Run("no documents table", func(t *testing.T) {
+		dbPath := filepath.Join(tmpDir, "other.db")
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY, value TEXT)`)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		stats, err := InspectDatabase(dbPath)
+		require.NoError(t, err)
+		assert.Equal(t, &DBStats{}, stats)
+	})
+
+	t.Run("no modules table", func(t *testing.T) {
+		dbPath := filepath.Join(tmpDir, "nomodules.db")
+		db, err := sql.Open("sqlite", dbPath)
+		require.NoError(t, err)
+		_, err = db.Exec(`CREATE TABLE documents (id BLOB, ts INTEGER, table_id BLOB, json_value BLOB, deleted INTEGER)`)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO documents VALUES (x'01', 1, x'02', '{"name":"messages","state":"active","number":10001}', 0)`)
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		stats, err := InspectDatabase(dbPath)
+		require.NoError(t, err)
+		assert.Equal(t, &DBStats{}, stats)
+	})
+
+	t.Run("not a database", func(t *testing.T) {
+		dbPath := filepath.Join(tmpDir, "garbage.db")
+		require.NoError(t, os.WriteFile(dbPath, []byte("not a database at all, just some text"), 0644))
+
+		_, err := InspectDatabase(dbPath)
+		require.Error(t, err)
+	})
+}
+
+func TestInspect_DatabaseStats(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+	dbPath := filepath.Join(outputDir, "convex.db")
+	require.NoError(t, os.Remove(dbPath))
+	createConvexTestDatabase(t, dbPath)
+
+	info, err := Inspect(outputDir)
+	require.NoError(t, err)
+	require.True(t, info.DatabaseValid)
+	require.NotNil(t, info.DatabaseStats)
+	assert.True(t, info.DatabaseStats.Recognized)
+	assert.Equal(t, 2, info.DatabaseStats.Modules)
+}
+
+func TestInspect_MissingManifest(t *testing.T) {
+	_, err := Inspect(t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read manifest.json")
+}
+
+func TestOpen(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+	storageFile := filepath.Join(outputDir, "storage", "blob.bin")
+	require.NoError(t, os.WriteFile(storageFile, []byte("blob"), 0644))
+
+	b, err := Open(outputDir)
+	require.NoError(t, err)
+
+	assert.Equal(t, outputDir, b.Dir)
+	assert.Equal(t, "Verify Bundle", b.Manifest.Name)
+	assert.Equal(t, "1.0.0", b.Manifest.Version)
+	require.NotNil(t, b.Credentials)
+	assert.NotEmpty(t, b.Credentials.AdminKey)
+	assert.Equal(t, filepath.Join(outputDir, "convex.db"), b.DatabasePath)
+	assert.Equal(t, filepath.Join(outputDir, "storage"), b.StoragePath)
+	assert.Equal(t, filepath.Join(outputDir, "backend"), b.BackendPath)
+
+	size, err := b.DatabaseSize()
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), size)
+
+	count, err := b.StorageFileCount()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestOpen_MissingOptionalFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	mf := manifest.New(manifest.Options{Name: "Partial", Version: "1.0.0", Platform: "linux-x64"})
+	data, err := mf.ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "manifest.json"), data, 0644))
+
+	b, err := Open(tmpDir)
+	require.NoError(t, err)
+
+	assert.Nil(t, b.Credentials)
+	assert.Empty(t, b.DatabasePath)
+	assert.Empty(t, b.StoragePath)
+	assert.Empty(t, b.BackendPath)
+
+	size, err := b.DatabaseSize()
+	require.NoError(t, err)
+	assert.Zero(t, size)
+
+	count, err := b.StorageFileCount()
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestOpen_InvalidCredentials(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "credentials.json"), []byte("{not json"), 0600))
+
+	_, err := Open(outputDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse credentials.json")
+}
+
+func TestOpen_NotADirectory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, []byte("x"), 0644))
+
+	_, err := Open(file)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a directory")
+}
+
+func TestVerify_ValidBundle(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+
+	result, err := Verify(outputDir)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.Problems)
+}
+
+func TestVerify_Problems(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(t *testing.T, dir string)
+		problem string
+	}{
+		{
+			name:    "missing database",
+			modify:  func(t *testing.T, dir string) { require.NoError(t, os.Remove(filepath.Join(dir, "convex.db"))) },
+			problem: "missing required file: convex.db",
+		},
+		{
+			name: "invalid database",
+			modify: func(t *testing.T, dir string) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "convex.db"), []byte("garbage"), 0644))
+			},
+			problem: "convex.db is not a valid SQLite database",
+		},
+		{
+			name:    "backend not executable",
+			modify:  func(t *testing.T, dir string) { require.NoError(t, os.Chmod(filepath.Join(dir, "backend"), 0644)) },
+			problem: "backend is not executable",
+		},
+		{
+			name:    "missing storage",
+			modify:  func(t *testing.T, dir string) { require.NoError(t, os.RemoveAll(filepath.Join(dir, "storage"))) },
+			problem: "missing required directory: storage",
+		},
+		{
+			name: "malformed manifest",
+			modify: func(t *testing.T, dir string) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "manifest.json"), []byte("{"), 0644))
+			},
+			problem: "invalid manifest.json",
+		},
+		{
+			name: "bad instance secret",
+			modify: func(t *testing.T, dir string) {
+				data := `{"adminKey": "key", "instanceSecret": "not-hex"}`
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "credentials.json"), []byte(data), 0644))
+			},
+			problem: "instanceSecret must be a 64-character hex string",
+		},
+		{
+			name: "admin key from another secret",
+			modify: func(t *testing.T, dir string) {
+				other, err := credentials.Generate("test-instance")
+				require.NoError(t, err)
+				data, err := os.ReadFile(filepath.Join(dir, "credentials.json"))
+				require.NoError(t, err)
+				var creds credentials.Credentials
+				require.NoError(t, json.Unmarshal(data, &creds))
+				creds.InstanceSecret = other.InstanceSecret
+				data, err = creds.ToJSON()
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "credentials.json"), data, 0644))
+			},
+			problem: "admin key was not issued with this instance secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := createVerifyTestBundle(t)
+			tt.modify(t, outputDir)
+
+			result, err := Verify(outputDir)
+			require.NoError(t, err)
+			assert.False(t, result.Valid)
+			require.Len(t, result.Problems, 1)
+			assert.Contains(t, result.Problems[0], tt.problem)
+		})
+	}
+}
+
+func TestVerifyResult_Err(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+	result, err := Verify(outputDir)
+	require.NoError(t, err)
+	assert.NoError(t, result.Err())
+
+	require.NoError(t, os.Remove(filepath.Join(outputDir, "convex.db")))
+	require.NoError(t, os.RemoveAll(filepath.Join(outputDir, "storage")))
+	result, err = Verify(outputDir)
+	require.NoError(t, err)
+	require.Error(t, result.Err())
+	assert.Contains(t, result.Err().Error(), "missing required file: convex.db")
+	assert.Contains(t, result.Err().Error(), "missing required directory: storage")
+}
+
+func TestVerify_NotADirectory(t *testing.T) {
+	_, err := Verify(filepath.Join(t.TempDir(), "nonexistent"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle directory does not exist")
+}
+
+// createVerifyTestBundle creates a complete bundle that passes Verify
+func createVerifyTestBundle(t *testing.T) string {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, append([]byte("SQLite format 3\x00"), make([]byte, 84)...), 0644))
+
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+
+	mf := manifest.New(manifest.Options{
+		Name:     "Verify Bundle",
+		Version:  "1.0.0",
+		Apps:     []string{"/app1"},
+		Platform: "linux-x64",
+	})
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	require.NoError(t, Create(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+	}))
+
+	return outputDir
+}
+
 // Helper function
 func assertBundleContents(t *testing.T, outputDir string, expectedManifest *manifest.Manifest, expectedCreds *credentials.Credentials) {
 	t.Helper()
@@ -261,3 +898,1043 @@ func assertBundleContents(t *testing.T, outputDir string, expectedManifest *mani
 	assert.Equal(t, expectedCreds.AdminKey, creds.AdminKey)
 	assert.Equal(t, expectedCreds.InstanceSecret, creds.InstanceSecret)
 }
+
+func TestCreate_Reproducible(t *testing.T) {
+	t.Setenv(manifest.SourceDateEpochEnv, "1700000000")
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+
+	mf := manifest.New(manifest.Options{
+		Name:     "Test Bundle",
+		Version:  "1.0.0",
+		Apps:     []string{"/app1"},
+		Platform: "linux-x64",
+	})
+	originalCreatedAt := mf.CreatedAt
+
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	require.NoError(t, Create(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+		Reproducible:  true,
+	}))
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "manifest.json"))
+	require.NoError(t, err)
+	var written manifest.Manifest
+	require.NoError(t, json.Unmarshal(data, &written))
+	assert.Equal(t, "2023-11-14T22:13:20Z", written.CreatedAt)
+	assert.Equal(t, originalCreatedAt, mf.CreatedAt, "caller's manifest should not be modified")
+}
+
+func TestCreate_DedupeStorage(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+
+	// Three copies of one blob, one unique file, and a same-content file with other permissions
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(filepath.Join(storagePath, "nested"), 0755))
+	blob := []byte("identical blob content")
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "a.bin"), blob, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "b.bin"), blob, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "nested", "c.bin"), blob, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "unique.bin"), []byte("unique"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storagePath, "executable.bin"), blob, 0755))
+
+	mf := manifest.New(manifest.Options{Name: "Dedupe", Version: "1.0.0", Platform: "linux-x64"})
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	result, err := CreateWithResult(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+		DedupeStorage: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.DedupedFiles)
+	assert.Equal(t, int64(2*len(blob)), result.BytesSaved)
+
+	storageDest := filepath.Join(outputDir, "storage")
+	infoA, err := os.Stat(filepath.Join(storageDest, "a.bin"))
+	require.NoError(t, err)
+	for _, name := range []string{"b.bin", filepath.Join("nested", "c.bin")} {
+		info, err := os.Stat(filepath.Join(storageDest, name))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(infoA, info), "%s should be hardlinked to a.bin", name)
+	}
+	infoExec, err := os.Stat(filepath.Join(storageDest, "executable.bin"))
+	require.NoError(t, err)
+	assert.False(t, os.SameFile(infoA, infoExec), "files with different permissions must not be linked")
+
+	// The deduplicated bundle still round-trips through a self-host executable
+	opsBinary := filepath.Join(tmpDir, "ops")
+	require.NoError(t, os.WriteFile(opsBinary, []byte("#!/bin/sh\necho ops\n"), 0755))
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, selfhost.Create(selfhost.CreateOptions{
+		BundleDir:  outputDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = selfhost.Extract(selfhost.ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	for _, name := range []string{"a.bin", "b.bin", filepath.Join("nested", "c.bin"), "executable.bin"} {
+		data, err := os.ReadFile(filepath.Join(extractDir, "storage", name))
+		require.NoError(t, err)
+		assert.Equal(t, blob, data, name)
+	}
+
+	// Without the option every file is copied
+	result, err = CreateWithResult(Options{
+		OutputDir:     filepath.Join(tmpDir, "plain"),
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      mf,
+		Credentials:   creds,
+	})
+	require.NoError(t, err)
+	assert.Zero(t, result.DedupedFiles)
+}
+
+// writeStorage replaces dir with the given files (slash-separated path -> content)
+func writeStorage(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// readStorage returns every file under dir (slash-separated path -> content)
+func readStorage(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	require.NoError(t, filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		require.NoError(t, err)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	}))
+	return files
+}
+
+func TestCreateDelta_ApplyDelta(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("database v1"), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	// Base release
+	writeStorage(t, storagePath, map[string]string{
+		"unchanged.bin":   "same",
+		"modified.bin":    "old",
+		"removed.bin":     "gone soon",
+		"nested/keep.bin": "nested",
+	})
+	baseDir := filepath.Join(tmpDir, "base")
+	baseManifest := manifest.New(manifest.Options{Name: "Delta", Version: "1.0.0", Platform: "linux-x64"})
+	require.NoError(t, Create(Options{
+		OutputDir:        baseDir,
+		BackendBinary:    backendBinary,
+		DatabasePath:     databasePath,
+		StoragePath:      storagePath,
+		Manifest:         baseManifest,
+		Credentials:      creds,
+		StorageChecksums: true,
+	}))
+	writtenBase, err := readManifest(baseDir)
+	require.NoError(t, err)
+	assert.Len(t, writtenBase.StorageChecksums, 4)
+
+	// Next release: one modified, one removed, one added
+	newFiles := map[string]string{
+		"unchanged.bin":    "same",
+		"modified.bin":     "new",
+		"nested/keep.bin":  "nested",
+		"nested/added.bin": "added",
+	}
+	writeStorage(t, storagePath, newFiles)
+	require.NoError(t, os.WriteFile(databasePath, []byte("database v2"), 0644))
+
+	deltaDir := filepath.Join(tmpDir, "delta")
+	delta, err := CreateDelta(writtenBase, Options{
+		OutputDir:     deltaDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Delta", Version: "1.1.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"modified.bin", "nested/added.bin"}, delta.Changed)
+	assert.Equal(t, []string{"removed.bin"}, delta.Removed)
+	assert.Equal(t, map[string]string{"modified.bin": "new", "nested/added.bin": "added"}, readStorage(t, filepath.Join(deltaDir, "storage")))
+
+	require.NoError(t, ApplyDelta(baseDir, deltaDir))
+	assert.Equal(t, newFiles, readStorage(t, filepath.Join(baseDir, "storage")))
+	db, err := os.ReadFile(filepath.Join(baseDir, "convex.db"))
+	require.NoError(t, err)
+	assert.Equal(t, "database v2", string(db))
+	merged, err := readManifest(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, "1.1.0", merged.Version)
+
+	// The merged bundle is the base for the next delta, so re-applying the old delta fails
+	err = ApplyDelta(baseDir, deltaDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "delta is for base bundle 1.0.0")
+}
+
+func TestCreateDelta_StorageIgnoreFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("database"), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	files := map[string]string{
+		"data.bin":      "v1",
+		"scratch.tmp":   "scratch",
+		"tmp/cache.bin": "cache",
+		ignore.FileName: "*.tmp\ntmp/\n",
+	}
+	writeStorage(t, storagePath, files)
+	baseDir := filepath.Join(tmpDir, "base")
+	require.NoError(t, Create(Options{
+		OutputDir:        baseDir,
+		BackendBinary:    backendBinary,
+		DatabasePath:     databasePath,
+		StoragePath:      storagePath,
+		Manifest:         manifest.New(manifest.Options{Name: "Delta", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:      creds,
+		StorageChecksums: true,
+	}))
+	writtenBase, err := readManifest(baseDir)
+	require.NoError(t, err)
+
+	// Ignored files change too, but are left out of the delta like the base
+	files["data.bin"] = "v2"
+	files["scratch.tmp"] = "other scratch"
+	files["tmp/new.bin"] = "new cache"
+	writeStorage(t, storagePath, files)
+
+	deltaDir := filepath.Join(tmpDir, "delta")
+	delta, err := CreateDelta(writtenBase, Options{
+		OutputDir:     deltaDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Delta", Version: "1.1.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data.bin"}, delta.Changed)
+	assert.Empty(t, delta.Removed)
+	assert.Equal(t, map[string]string{"data.bin": "v2"}, readStorage(t, filepath.Join(deltaDir, "storage")))
+	deltaManifest, err := readManifest(deltaDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data.bin"}, sortedKeys(deltaManifest.StorageChecksums))
+
+	require.NoError(t, ApplyDelta(baseDir, deltaDir))
+	assert.Equal(t, map[string]string{"data.bin": "v2"}, readStorage(t, filepath.Join(baseDir, "storage")))
+}
+
+func TestCreateDelta_RequiresStorageChecksums(t *testing.T) {
+	mf := manifest.New(manifest.Options{Name: "Delta", Version: "1.0.0", Platform: "linux-x64"})
+	_, err := CreateDelta(mf, Options{OutputDir: t.TempDir()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no storage checksums")
+
+	err = ApplyDelta(t.TempDir(), t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), DeltaFileName)
+}
+
+func TestVerifyWithOptions_DatabaseIntegrity(t *testing.T) {
+	// The test bundle's convex.db has a valid SQLite header but no valid pages
+	outputDir := createVerifyTestBundle(t)
+
+	result, err := Verify(outputDir)
+	require.NoError(t, err)
+	assert.True(t, result.Valid, "integrity check is opt-in")
+
+	result, err = VerifyWithOptions(outputDir, VerifyOptions{VerifyDatabase: true})
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	require.Len(t, result.Problems, 1)
+	assert.Contains(t, result.Problems[0], "convex.db:")
+}
+
+func TestValidateDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "convex.db")
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY, body TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	require.NoError(t, ValidateDatabase(dbPath))
+
+	emptyPath := filepath.Join(tmpDir, "empty.db")
+	require.NoError(t, os.WriteFile(emptyPath, nil, 0644))
+	textPath := filepath.Join(tmpDir, "text.db")
+	require.NoError(t, os.WriteFile(textPath, []byte("not a database"), 0644))
+	// The test bundle's convex.db has a valid SQLite header but no valid pages
+	corruptPath := filepath.Join(createVerifyTestBundle(t), "convex.db")
+
+	for _, path := range []string{filepath.Join(tmpDir, "missing.db"), tmpDir, emptyPath, textPath, corruptPath} {
+		assert.Error(t, ValidateDatabase(path), path)
+	}
+}
+
+func TestWriteChecksumManifest(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "storage", "file.txt"), []byte("stored"), 0644))
+
+	require.NoError(t, WriteChecksumManifest(outputDir))
+
+	data, err := os.ReadFile(filepath.Join(outputDir, ChecksumManifestName))
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 5)
+	// sha256("stored")
+	assert.Contains(t, lines, "87b04e58961f9a99d853d4046a0b5b793e7c3e4bbd21f5aca8fb17c20cdb1d8b  storage/file.txt")
+	for _, line := range lines {
+		assert.Regexp(t, `^[0-9a-f]{64}  \S+$`, line)
+	}
+
+	require.NoError(t, VerifyChecksumManifest(outputDir))
+
+	// The file is compatible with sha256sum -c
+	if _, err := exec.LookPath("sha256sum"); err == nil {
+		cmd := exec.Command("sha256sum", "-c", ChecksumManifestName)
+		cmd.Dir = outputDir
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+}
+
+func TestVerifyChecksumManifest_DetectsChanges(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+	storageFile := filepath.Join(outputDir, "storage", "file.txt")
+	require.NoError(t, os.WriteFile(storageFile, []byte("stored"), 0644))
+	require.NoError(t, WriteChecksumManifest(outputDir))
+
+	require.NoError(t, os.WriteFile(storageFile, []byte("tampered"), 0644))
+	require.NoError(t, os.Remove(filepath.Join(outputDir, "backend")))
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, "storage", "extra.txt"), []byte("extra"), 0644))
+
+	err := VerifyChecksumManifest(outputDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "storage/file.txt: checksum mismatch")
+	assert.Contains(t, err.Error(), "backend: missing")
+	assert.Contains(t, err.Error(), "storage/extra.txt: not listed in SHA256SUMS")
+}
+
+func TestVerifyChecksumManifest_Errors(t *testing.T) {
+	outputDir := createVerifyTestBundle(t)
+
+	err := VerifyChecksumManifest(outputDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read SHA256SUMS")
+
+	require.NoError(t, os.WriteFile(filepath.Join(outputDir, ChecksumManifestName), []byte("not-a-checksum  backend\n"), 0644))
+	err = VerifyChecksumManifest(outputDir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid checksum on SHA256SUMS line 1")
+}
+
+func TestCreate_SymlinkBackend(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the backend is copied on Windows")
+	}
+
+	tmpDir := t.TempDir()
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	backendContent := []byte("#!/bin/sh\necho real backend\n")
+	require.NoError(t, os.WriteFile(backendBinary, backendContent, 0644))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, append([]byte("SQLite format 3\x00"), make([]byte, 84)...), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	outputDir := filepath.Join(tmpDir, "bundle")
+	opts := Options{
+		OutputDir:      outputDir,
+		BackendBinary:  backendBinary,
+		DatabasePath:   databasePath,
+		StoragePath:    storagePath,
+		Manifest:       manifest.New(manifest.Options{Name: "Linked", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:    creds,
+		SymlinkBackend: true,
+	}
+	require.NoError(t, Create(opts))
+
+	backendPath := filepath.Join(outputDir, "backend")
+	linkInfo, err := os.Lstat(backendPath)
+	require.NoError(t, err)
+	assert.NotZero(t, linkInfo.Mode()&os.ModeSymlink, "backend should be a symlink")
+	target, err := os.Readlink(backendPath)
+	require.NoError(t, err)
+	assert.Equal(t, backendBinary, target)
+
+	sourceInfo, err := os.Stat(backendBinary)
+	require.NoError(t, err)
+	assert.NotZero(t, sourceInfo.Mode()&0111, "the linked binary should be made executable")
+
+	// A linked bundle still packages the real backend
+	opsBinary := filepath.Join(tmpDir, "ops")
+	require.NoError(t, os.WriteFile(opsBinary, []byte("#!/bin/sh\necho ops\n"), 0755))
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, selfhost.Create(selfhost.CreateOptions{
+		BundleDir:  outputDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = selfhost.Extract(selfhost.ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	extractedInfo, err := os.Lstat(filepath.Join(extractDir, "backend"))
+	require.NoError(t, err)
+	assert.True(t, extractedInfo.Mode().IsRegular(), "the extracted backend should be a regular file")
+	data, err := os.ReadFile(filepath.Join(extractDir, "backend"))
+	require.NoError(t, err)
+	assert.Equal(t, backendContent, data)
+
+	// Rebundling with a copy replaces the link without touching the source
+	opts.SymlinkBackend = false
+	require.NoError(t, Create(opts))
+	copiedInfo, err := os.Lstat(backendPath)
+	require.NoError(t, err)
+	assert.True(t, copiedInfo.Mode().IsRegular())
+	data, err = os.ReadFile(backendBinary)
+	require.NoError(t, err)
+	assert.Equal(t, backendContent, data, "the source binary must be left intact")
+}
+
+func TestCreateWithResult_Sizes(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database content"), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	writeStorage(t, storagePath, map[string]string{
+		"a.bin":        "first blob",
+		"nested/b.bin": "second, longer blob",
+	})
+
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+	result, err := CreateWithResult(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Sizes", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+	})
+	require.NoError(t, err)
+
+	sizeOf := func(rel string) int64 {
+		info, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(rel)))
+		require.NoError(t, err)
+		return info.Size()
+	}
+	assert.Equal(t, sizeOf("backend"), result.BackendSize)
+	assert.Equal(t, sizeOf("convex.db"), result.DatabaseSize)
+	assert.Equal(t, sizeOf("storage/a.bin")+sizeOf("storage/nested/b.bin"), result.StorageSize)
+	assert.Equal(t, 2, result.StorageFileCount)
+
+	var total int64
+	require.NoError(t, filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return err
+	}))
+	assert.Equal(t, total, result.TotalSize)
+}
+
+func TestCreate_Concurrency(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("dir%d/file%d.bin", i%5, i)] = strings.Repeat(fmt.Sprintf("blob %d\n", i), i+1)
+	}
+	writeStorage(t, storagePath, files)
+
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+	for _, dedupe := range []bool{false, true} {
+		outputDir := filepath.Join(tmpDir, fmt.Sprintf("bundle-%t", dedupe))
+		result, err := CreateWithResult(Options{
+			OutputDir:     outputDir,
+			BackendBinary: backendBinary,
+			DatabasePath:  databasePath,
+			StoragePath:   storagePath,
+			Manifest:      manifest.New(manifest.Options{Name: "Concurrency", Version: "1.0.0", Platform: "linux-x64"}),
+			Credentials:   creds,
+			DedupeStorage: dedupe,
+			Concurrency:   8,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, files, readStorage(t, filepath.Join(outputDir, "storage")))
+		assert.Equal(t, len(files), result.StorageFileCount)
+	}
+}
+
+func TestCreateContext_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = CreateContext(ctx, Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Cancelled", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NoDirExists(t, outputDir)
+}
+
+func TestCopyStorage_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+	storagePath := filepath.Join(tmpDir, "storage")
+	writeStorage(t, storagePath, map[string]string{"a.bin": "a", "nested/b.bin": "b"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := copyStorage(storagePath, filepath.Join(tmpDir, "copy"), 4, &treeCopy{ctx: ctx})
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCreate_EnvVars(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	vars := map[string]string{
+		"PLAIN":   "http://localhost:3210/path",
+		"SPACES":  "hello world",
+		"QUOTES":  `it's "quoted"`,
+		"SHELL":   "$HOME `id` $(id) \\ ;&|",
+		"NEWLINE": "line one\nline two",
+		"EMPTY":   "",
+	}
+	result, err := CreateWithResult(Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Env", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+		EnvVars:       vars,
+	})
+	require.NoError(t, err)
+
+	envPath := filepath.Join(outputDir, EnvFileName)
+	data, err := os.ReadFile(envPath)
+	require.NoError(t, err)
+	assert.Equal(t, "INSTANCE_SECRET="+creds.InstanceSecret+"\n"+
+		"EMPTY=''\n"+
+		"NEWLINE='line one\nline two'\n"+
+		"PLAIN=http://localhost:3210/path\n"+
+		"QUOTES='it'\\''s \"quoted\"'\n"+
+		"SHELL='$HOME `id` $(id) \\ ;&|'\n"+
+		"SPACES='hello world'\n", string(data))
+
+	info, err := os.Stat(envPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the env file holds the instance secret")
+
+	var total int64
+	require.NoError(t, filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return err
+	}))
+	assert.Equal(t, total, result.TotalSize)
+
+	// A shell sourcing the file sees the original values
+	if _, err := exec.LookPath("sh"); err == nil {
+		vars[InstanceSecretEnvVar] = creds.InstanceSecret
+		for name, want := range vars {
+			out, err := exec.Command("sh", "-c", `. "$1" && printf '%s' "$`+name+`"`, "sh", envPath).Output()
+			require.NoError(t, err, name)
+			assert.Equal(t, want, string(out), name)
+		}
+	}
+
+	// The env file is embedded in self-host executables
+	opsBinary := filepath.Join(tmpDir, "ops")
+	require.NoError(t, os.WriteFile(opsBinary, []byte("#!/bin/sh\necho ops\n"), 0755))
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, selfhost.Create(selfhost.CreateOptions{
+		BundleDir:  outputDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = selfhost.Extract(selfhost.ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	extracted, err := os.ReadFile(filepath.Join(extractDir, EnvFileName))
+	require.NoError(t, err)
+	assert.Equal(t, data, extracted)
+
+	// Names must be shell variable names
+	_, err = CreateWithResult(Options{
+		OutputDir:     filepath.Join(tmpDir, "invalid"),
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Env", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+		EnvVars:       map[string]string{"BAD-NAME": "x"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid environment variable name "BAD-NAME"`)
+}
+
+func TestCreate_IncludeAppSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, append([]byte("SQLite format 3\x00"), make([]byte, 84)...), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	// A second app with the same base name, dependencies and an ignore file
+	otherApp := filepath.Join(tmpDir, "other", "sample-app")
+	for name, content := range map[string]string{
+		"convex/messages.ts":           "export const list = 1;",
+		"convex/_generated/api.d.ts":   "generated",
+		"node_modules/convex/index.js": "dependency",
+		ignore.FileName:                "convex/_generated/\n",
+	} {
+		path := filepath.Join(otherApp, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	opts := Options{
+		OutputDir:         outputDir,
+		BackendBinary:     backendBinary,
+		DatabasePath:      databasePath,
+		StoragePath:       storagePath,
+		Manifest:          manifest.New(manifest.Options{Name: "Apps", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:       creds,
+		IncludeAppSources: true,
+		Apps:              []string{"../../testdata/sample-app", otherApp},
+	}
+	result, err := CreateWithResult(opts)
+	require.NoError(t, err)
+	assert.Positive(t, result.AppSourcesSize)
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "manifest.json"))
+	require.NoError(t, err)
+	var mf manifest.Manifest
+	require.NoError(t, json.Unmarshal(data, &mf))
+	assert.Equal(t, []string{"apps/sample-app", "apps/sample-app-2"}, mf.AppSources)
+
+	assert.FileExists(t, filepath.Join(outputDir, "apps", "sample-app-2", "convex", "messages.ts"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "apps", "sample-app-2", "node_modules"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "apps", "sample-app-2", "convex", "_generated"))
+
+	verifyResult, err := Verify(outputDir)
+	require.NoError(t, err)
+	assert.True(t, verifyResult.Valid, verifyResult.Problems)
+
+	// The app sources are embedded in self-host executables
+	opsBinary := filepath.Join(tmpDir, "ops")
+	require.NoError(t, os.WriteFile(opsBinary, []byte("#!/bin/sh\necho ops\n"), 0755))
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, selfhost.Create(selfhost.CreateOptions{
+		BundleDir:  outputDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = selfhost.Extract(selfhost.ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	want, err := os.ReadFile("../../testdata/sample-app/convex/messages.ts")
+	require.NoError(t, err)
+	extracted, err := os.ReadFile(filepath.Join(extractDir, "apps", "sample-app", "convex", "messages.ts"))
+	require.NoError(t, err)
+	assert.Equal(t, want, extracted)
+	assert.FileExists(t, filepath.Join(extractDir, "apps", "sample-app", "package.json"))
+
+	// Verify reports app sources recorded in the manifest but missing
+	require.NoError(t, os.RemoveAll(filepath.Join(outputDir, "apps", "sample-app-2")))
+	verifyResult, err = Verify(outputDir)
+	require.NoError(t, err)
+	assert.False(t, verifyResult.Valid)
+	assert.Contains(t, verifyResult.Problems, "missing app sources: apps/sample-app-2")
+
+	// Rebundling replaces the previous sources
+	opts.Apps = []string{"../../testdata/sample-app"}
+	opts.Manifest = manifest.New(manifest.Options{Name: "Apps", Version: "1.0.0", Platform: "linux-x64"})
+	_, err = CreateWithResult(opts)
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(outputDir, "apps", "sample-app-2"))
+
+	// IncludeAppSources needs the apps
+	opts.Apps = nil
+	_, err = CreateWithResult(opts)
+	require.Error(t, err)
+}
+
+func TestCopyAppSources_OutputInsideApp(t *testing.T) {
+	app := filepath.Join(t.TempDir(), "app")
+	require.NoError(t, os.MkdirAll(filepath.Join(app, "convex"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(app, "convex", "schema.ts"), []byte("schema"), 0644))
+	outputDir := filepath.Join(app, "dist")
+	require.NoError(t, os.MkdirAll(outputDir, 0755))
+
+	paths, err := copyAppSources(context.Background(), []string{app}, outputDir, &treeSize{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"apps/app"}, paths)
+	assert.FileExists(t, filepath.Join(outputDir, "apps", "app", "convex", "schema.ts"))
+	assert.NoDirExists(t, filepath.Join(outputDir, "apps", "app", "dist"))
+}
+
+func TestParseEnvVars(t *testing.T) {
+	vars, err := ParseEnvVars(nil)
+	require.NoError(t, err)
+	assert.Nil(t, vars)
+
+	vars, err = ParseEnvVars([]string{"A=1", "B_2=x=y", "EMPTY="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "1", "B_2": "x=y", "EMPTY": ""}, vars)
+
+	for pair, want := range map[string]string{
+		"NOVALUE":           "expected NAME=value",
+		"1ABC=x":            "invalid environment variable name",
+		"=x":                "invalid environment variable name",
+		"INSTANCE_SECRET=x": "set from the bundle credentials",
+	} {
+		_, err := ParseEnvVars([]string{pair})
+		assert.ErrorContains(t, err, want, pair)
+	}
+
+	_, err = ParseEnvVars([]string{"A=1", "A=2"})
+	assert.ErrorContains(t, err, `duplicate environment variable "A"`)
+}
+
+// writeTestELF writes a minimal x86-64 ELF executable to path. If interp is
+// set, it has a PT_INTERP program header naming that dynamic loader.
+func writeTestELF(t *testing.T, path, interp string) {
+	t.Helper()
+	const ehdrSize, phdrSize = 64, 56
+
+	var progs []elf.Prog64
+	var data []byte
+	if interp != "" {
+		data = append([]byte(interp), 0)
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_INTERP),
+			Flags:  uint32(elf.PF_R),
+			Off:    ehdrSize + phdrSize*2,
+			Filesz: uint64(len(data)),
+			Memsz:  uint64(len(data)),
+			Align:  1,
+		})
+	}
+	progs = append(progs, elf.Prog64{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_X), Align: 0x1000})
+
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     ehdrSize,
+		Ehsize:    ehdrSize,
+		Phentsize: phdrSize,
+		Phnum:     uint16(len(progs)),
+		Shentsize: 64,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, hdr))
+	for _, prog := range progs {
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, prog))
+	}
+	// Keep the interpreter string at the offset computed for two headers
+	buf.Write(make([]byte, ehdrSize+phdrSize*2-buf.Len()))
+	buf.Write(data)
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0755))
+}
+
+func TestCheckStaticLinking(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	static := filepath.Join(tmpDir, "static")
+	writeTestELF(t, static, "")
+	libs, err := CheckStaticLinking(static)
+	require.NoError(t, err)
+	assert.Empty(t, libs)
+
+	dynamic := filepath.Join(tmpDir, "dynamic")
+	writeTestELF(t, dynamic, "/lib64/ld-linux-x86-64.so.2")
+	libs, err = CheckStaticLinking(dynamic)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/lib64/ld-linux-x86-64.so.2"}, libs)
+
+	script := filepath.Join(tmpDir, "script")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+	_, err = CheckStaticLinking(script)
+	assert.ErrorContains(t, err, "not an ELF executable")
+}
+
+func TestCreate_RequireStatic(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("fake database"), 0644))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+	mf := manifest.New(manifest.Options{Name: "Test Bundle", Version: "1.0.0", Apps: []string{"/app1"}, Platform: "linux-x64"})
+
+	static := filepath.Join(tmpDir, "static")
+	writeTestELF(t, static, "")
+	dynamic := filepath.Join(tmpDir, "dynamic")
+	writeTestELF(t, dynamic, "/lib/ld-musl-x86_64.so.1")
+
+	var logs bytes.Buffer
+	create := func(backend string, requireStatic bool) error {
+		return Create(Options{
+			OutputDir:     filepath.Join(tmpDir, "bundle"),
+			BackendBinary: backend,
+			DatabasePath:  databasePath,
+			Manifest:      mf,
+			Credentials:   creds,
+			RequireStatic: requireStatic,
+			Logger:        logging.New(&logs, logging.LevelInfo),
+		})
+	}
+
+	// Dynamic linking is only a warning by default
+	require.NoError(t, create(dynamic, false))
+	assert.Contains(t, logs.String(), "Backend binary is dynamically linked")
+	logs.Reset()
+	require.NoError(t, create(static, true))
+	assert.NotContains(t, logs.String(), "dynamically linked")
+
+	err = create(dynamic, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "backend binary is dynamically linked")
+	assert.Contains(t, err.Error(), "/lib/ld-musl-x86_64.so.1")
+
+	// A backend that cannot be inspected cannot be required to be static
+	script := filepath.Join(tmpDir, "script")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, create(script, false))
+	assert.ErrorContains(t, create(script, true), "cannot verify that backend binary is statically linked")
+}
+
+func TestCreate_EncryptedCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+	outputDir := filepath.Join(tmpDir, "bundle")
+
+	backendBinary := filepath.Join(tmpDir, "fake-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend binary"), 0755))
+	databasePath := filepath.Join(tmpDir, "convex.db")
+	require.NoError(t, os.WriteFile(databasePath, append([]byte("SQLite format 3\x00"), make([]byte, 84)...), 0644))
+	storagePath := filepath.Join(tmpDir, "storage")
+	require.NoError(t, os.MkdirAll(storagePath, 0755))
+	creds, err := credentials.Generate("test-instance")
+	require.NoError(t, err)
+
+	opts := Options{
+		OutputDir:     outputDir,
+		BackendBinary: backendBinary,
+		DatabasePath:  databasePath,
+		StoragePath:   storagePath,
+		Manifest:      manifest.New(manifest.Options{Name: "Encrypted", Version: "1.0.0", Platform: "linux-x64"}),
+		Credentials:   creds,
+
+		CredentialsPassphrase: "correct horse",
+	}
+	require.NoError(t, Create(opts))
+
+	credsPath := filepath.Join(outputDir, "credentials.json")
+	data, err := os.ReadFile(credsPath)
+	require.NoError(t, err)
+	assert.True(t, credentials.IsEncrypted(data))
+	assert.NotContains(t, string(data), creds.InstanceSecret)
+	loaded, err := credentials.LoadEncrypted(credsPath, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, creds, loaded)
+
+	// Without a passphrase only the encrypted form is checked
+	result, err := Verify(outputDir)
+	require.NoError(t, err)
+	assert.True(t, result.Valid, "problems: %v", result.Problems)
+
+	result, err = VerifyWithOptions(outputDir, VerifyOptions{CredentialsPassphrase: "correct horse"})
+	require.NoError(t, err)
+	assert.True(t, result.Valid, "problems: %v", result.Problems)
+
+	result, err = VerifyWithOptions(outputDir, VerifyOptions{CredentialsPassphrase: "battery staple"})
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	require.Len(t, result.Problems, 1)
+	assert.Contains(t, result.Problems[0], "wrong passphrase")
+
+	info, err := Inspect(outputDir)
+	require.NoError(t, err)
+	assert.True(t, info.HasCredentials)
+	assert.True(t, info.CredentialsEncrypted)
+	assert.Empty(t, info.AdminKey)
+
+	b, err := Open(outputDir)
+	require.NoError(t, err)
+	assert.True(t, b.CredentialsEncrypted)
+	assert.Nil(t, b.Credentials)
+
+	// convex.env would hold the instance secret in plaintext
+	opts.OutputDir = filepath.Join(tmpDir, "with-env")
+	opts.EnvVars = map[string]string{}
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "encrypted credentials cannot be combined")
+}
+
+func TestDetectBackendVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("mock backend is a shell script")
+	}
+	tmpDir := t.TempDir()
+
+	backend := filepath.Join(tmpDir, "backend")
+	require.NoError(t, os.WriteFile(backend, []byte("#!/bin/sh\n[ \"$1\" = --version ] && echo 'convex-local-backend 0.1.0-precompiled.7' && exit 0\nexit 2\n"), 0755))
+	version, err := DetectBackendVersion(backend)
+	require.NoError(t, err)
+	assert.Equal(t, "0.1.0-precompiled.7", version)
+
+	// Falls back to an error the caller can ignore when detection fails
+	tests := []struct {
+		name   string
+		binary []byte
+		want   string
+	}{
+		{name: "exits non-zero", binary: []byte("#!/bin/sh\necho 'unknown flag' >&2\nexit 1\n"), want: "unknown flag"},
+		{name: "no version", binary: []byte("#!/bin/sh\necho 'usage: backend [options]'\n"), want: "unrecognized backend --version output"},
+		{name: "not executable here", binary: []byte("fake backend binary"), want: "failed to run backend --version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "-"))
+			require.NoError(t, os.WriteFile(path, tt.binary, 0755))
+			_, err := DetectBackendVersion(path)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+
+	_, err = DetectBackendVersion(filepath.Join(tmpDir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestParseBackendVersion(t *testing.T) {
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{output: "convex-local-backend 0.1.0\n", want: "0.1.0"},
+		{output: "\n1.2.3\n", want: "1.2.3"},
+		{output: "convex-local-backend precompiled-2025-12-12-73e805a\nextra line\n", want: "precompiled-2025-12-12-73e805a"},
+	}
+	for _, tt := range tests {
+		version, err := parseBackendVersion(tt.output)
+		require.NoError(t, err, "%q", tt.output)
+		assert.Equal(t, tt.want, version)
+	}
+
+	_, err := parseBackendVersion("")
+	assert.Error(t, err)
+	_, err = parseBackendVersion("convex-local-backend\n")
+	assert.Error(t, err)
+}
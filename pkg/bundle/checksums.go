@@ -0,0 +1,129 @@
+package bundle
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChecksumManifestName is the name of the checksum manifest written into a
+// bundle directory by WriteChecksumManifest
+const ChecksumManifestName = "SHA256SUMS"
+
+// WriteChecksumManifest writes a SHA256SUMS file into bundleDir listing the
+// SHA256 of every regular file in it, one "<hex>  <path>" line per file with
+// slash-separated paths relative to bundleDir, so the bundle can be checked
+// with `sha256sum -c SHA256SUMS` from inside it.
+func WriteChecksumManifest(bundleDir string) error {
+	sums, err := bundleChecksums(bundleDir)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksums: %w", err)
+	}
+
+	var b strings.Builder
+	for _, path := range sortedKeys(sums) {
+		fmt.Fprintf(&b, "%s  %s\n", sums[path], path)
+	}
+	if err := os.WriteFile(filepath.Join(bundleDir, ChecksumManifestName), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ChecksumManifestName, err)
+	}
+	return nil
+}
+
+// VerifyChecksumManifest checks the files in bundleDir against its SHA256SUMS
+// file. It reports every file that is missing, modified or not listed,
+// joined with errors.Join.
+func VerifyChecksumManifest(bundleDir string) error {
+	f, err := os.Open(filepath.Join(bundleDir, ChecksumManifestName))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", ChecksumManifestName, err)
+	}
+	defer f.Close()
+
+	expected := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		// sha256sum separates the checksum and path with "  " (text mode)
+		// or " *" (binary mode)
+		sum, path, ok := strings.Cut(line, " ")
+		if !ok || len(path) < 2 || (path[0] != ' ' && path[0] != '*') {
+			return fmt.Errorf("invalid %s line %d: %q", ChecksumManifestName, lineNum, line)
+		}
+		path = path[1:]
+		if _, err := hex.DecodeString(sum); err != nil || len(sum) != 64 {
+			return fmt.Errorf("invalid checksum on %s line %d: %q", ChecksumManifestName, lineNum, sum)
+		}
+		expected[path] = strings.ToLower(sum)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", ChecksumManifestName, err)
+	}
+
+	actual, err := bundleChecksums(bundleDir)
+	if err != nil {
+		return fmt.Errorf("failed to compute checksums: %w", err)
+	}
+
+	var errs []error
+	for _, path := range sortedKeys(expected) {
+		sum, ok := actual[path]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s: missing", path))
+		case sum != expected[path]:
+			errs = append(errs, fmt.Errorf("%s: checksum mismatch", path))
+		}
+	}
+	var unlisted []string
+	for path := range actual {
+		if _, ok := expected[path]; !ok {
+			unlisted = append(unlisted, path)
+		}
+	}
+	sort.Strings(unlisted)
+	for _, path := range unlisted {
+		errs = append(errs, fmt.Errorf("%s: not listed in %s", path, ChecksumManifestName))
+	}
+	return errors.Join(errs...)
+}
+
+// bundleChecksums returns the hex SHA256 of every regular file under
+// bundleDir except the checksum manifest, keyed by slash-separated path
+func bundleChecksums(bundleDir string) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := filepath.Walk(bundleDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(bundleDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == ChecksumManifestName {
+			return nil
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		sums[rel] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
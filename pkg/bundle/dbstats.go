@@ -0,0 +1,208 @@
+package bundle
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ozanturksever/convex-bundler/pkg/database"
+)
+
+// DBStats summarizes what has been deployed into a bundle's convex.db
+type DBStats struct {
+	// Recognized is false when the database does not have the layout of the
+	// Convex backend's SQLite persistence, which differs across backend
+	// versions; the counts are then zero
+	Recognized bool `json:"recognized"`
+
+	// Tables is the number of user-defined tables
+	Tables int `json:"tables"`
+
+	// Modules is the number of deployed function modules, across all components
+	Modules int `json:"modules"`
+
+	// Functions is the number of queries, mutations, actions and HTTP
+	// actions exported by the modules
+	Functions int `json:"functions"`
+}
+
+// documentsColumns are the columns of the documents table that every
+// revision of a Convex document is stored in
+var documentsColumns = []string{"id", "ts", "table_id", "json_value", "deleted"}
+
+// modulesTable is the system table holding module metadata
+const modulesTable = "_modules"
+
+// InspectDatabase opens the Convex SQLite database at dbPath read-only and
+// counts its user tables, deployed modules and functions. A database that
+// opens but has an unexpected schema is not an error: it is reported with
+// Recognized unset.
+func InspectDatabase(dbPath string) (*DBStats, error) {
+	db, err := database.OpenReadOnly(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	stats := &DBStats{}
+	ok, err := hasColumns(db, "documents", documentsColumns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database schema: %w", err)
+	}
+	if !ok {
+		return stats, nil
+	}
+
+	// Table metadata documents name each table; their ID is the table ID the
+	// table's own documents are stored under. They are looked up through the
+	// tables that hold documents with a "state", so that revisions deleting
+	// them, which have no fields, are seen too.
+	metadataTables, err := queryBlobs(db, `SELECT DISTINCT table_id FROM documents WHERE instr(CAST(json_value AS TEXT), '"state"') > 0`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table metadata: %w", err)
+	}
+	var tables []document
+	for _, tableID := range metadataTables {
+		docs, err := latestDocuments(db, `SELECT id, ts, json_value, deleted FROM documents WHERE table_id = ?`, tableID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table metadata: %w", err)
+		}
+		tables = append(tables, docs...)
+	}
+	var moduleTables [][]byte
+	for _, doc := range tables {
+		var meta struct {
+			Name   *string `json:"name"`
+			State  string  `json:"state"`
+			Number *int64  `json:"number"`
+		}
+		if json.Unmarshal(doc.value, &meta) != nil || meta.Name == nil || meta.Number == nil || meta.State != "active" {
+			continue
+		}
+		switch {
+		case *meta.Name == modulesTable:
+			moduleTables = append(moduleTables, doc.id)
+		case !strings.HasPrefix(*meta.Name, "_"):
+			stats.Tables++
+		}
+	}
+	if len(moduleTables) == 0 {
+		return &DBStats{}, nil
+	}
+	stats.Recognized = true
+
+	for _, tableID := range moduleTables {
+		modules, err := latestDocuments(db, `SELECT id, ts, json_value, deleted FROM documents WHERE table_id = ?`, tableID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read modules: %w", err)
+		}
+		for _, doc := range modules {
+			var module struct {
+				Deleted       bool `json:"deleted"`
+				AnalyzeResult *struct {
+					Functions []json.RawMessage `json:"functions"`
+				} `json:"analyzeResult"`
+			}
+			if json.Unmarshal(doc.value, &module) != nil || module.Deleted {
+				continue
+			}
+			stats.Modules++
+			if module.AnalyzeResult != nil {
+				stats.Functions += len(module.AnalyzeResult.Functions)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// hasColumns reports whether table exists with all of columns.
+func hasColumns(db *sql.DB, table string, columns []string) (bool, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		found[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	for _, column := range columns {
+		if !found[column] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// queryBlobs runs query, which selects a single BLOB column, and returns the values.
+func queryBlobs(db *sql.DB, query string) ([][]byte, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values [][]byte
+	for rows.Next() {
+		var value []byte
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// document is the latest revision of a Convex document
+type document struct {
+	id    []byte
+	ts    int64
+	value []byte
+}
+
+// latestDocuments runs query, which selects id, ts, json_value and deleted
+// from documents, and returns the latest revision of each document unless
+// that revision deleted it.
+func latestDocuments(db *sql.DB, query string, args ...any) ([]document, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := make(map[string]document)
+	deleted := make(map[string]bool)
+	for rows.Next() {
+		var doc document
+		var isDeleted bool
+		if err := rows.Scan(&doc.id, &doc.ts, &doc.value, &isDeleted); err != nil {
+			return nil, err
+		}
+		key := string(doc.id)
+		if prev, ok := latest[key]; ok && prev.ts >= doc.ts {
+			continue
+		}
+		latest[key] = doc
+		deleted[key] = isDeleted
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	docs := make([]document, 0, len(latest))
+	for key, doc := range latest {
+		if !deleted[key] {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
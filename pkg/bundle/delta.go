@@ -0,0 +1,236 @@
+package bundle
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+)
+
+// DeltaFileName is the file in a delta bundle that describes its storage changes
+const DeltaFileName = "delta.json"
+
+// Delta describes how a delta bundle's storage differs from its base bundle
+type Delta struct {
+	BaseVersion   string   `json:"baseVersion"`   // Version of the base bundle
+	BaseCreatedAt string   `json:"baseCreatedAt"` // Creation time of the base bundle
+	Changed       []string `json:"changed"`       // Storage files added or modified since the base, included in the delta
+	Removed       []string `json:"removed"`       // Storage files deleted since the base
+}
+
+// CreateDelta writes a delta bundle to opts.OutputDir. It is a complete bundle
+// except that storage/ holds only the files that were added or changed since
+// baseManifest, with removed files listed in delta.json. The delta's manifest
+// records checksums of the full new storage, so it can be the base of the next
+// delta. baseManifest must have been written with Options.StorageChecksums.
+func CreateDelta(baseManifest *manifest.Manifest, opts Options) (*Delta, error) {
+	if baseManifest == nil || baseManifest.StorageChecksums == nil {
+		return nil, fmt.Errorf("base manifest has no storage checksums; build the base bundle with storage checksums enabled")
+	}
+
+	// Skip what a full bundle would leave out of storage/
+	storageIgnore, err := ignore.Load(opts.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage ignore file: %w", err)
+	}
+	sums, err := storageChecksums(opts.StoragePath, storageIgnore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum storage: %w", err)
+	}
+
+	delta := &Delta{
+		BaseVersion:   baseManifest.Version,
+		BaseCreatedAt: baseManifest.CreatedAt,
+		Changed:       []string{},
+		Removed:       []string{},
+	}
+	for _, rel := range sortedKeys(sums) {
+		if baseManifest.StorageChecksums[rel] != sums[rel] {
+			delta.Changed = append(delta.Changed, rel)
+		}
+	}
+	for _, rel := range sortedKeys(baseManifest.StorageChecksums) {
+		if _, ok := sums[rel]; !ok {
+			delta.Removed = append(delta.Removed, rel)
+		}
+	}
+
+	// Build the bundle with empty storage, then add only the changed files
+	emptyStorage, err := os.MkdirTemp("", "convex-delta-storage-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(emptyStorage)
+
+	mf := *opts.Manifest
+	mf.StorageChecksums = sums
+	deltaOpts := opts
+	deltaOpts.Manifest = &mf
+	deltaOpts.StoragePath = emptyStorage
+	deltaOpts.StorageChecksums = false
+	deltaOpts.DedupeStorage = false
+	if _, err := CreateWithResult(deltaOpts); err != nil {
+		return nil, err
+	}
+
+	storageDest := filepath.Join(opts.OutputDir, "storage")
+	for _, rel := range delta.Changed {
+		dst := filepath.Join(storageDest, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+		if err := copyFile(filepath.Join(opts.StoragePath, filepath.FromSlash(rel)), dst); err != nil {
+			return nil, fmt.Errorf("failed to copy storage file %s: %w", rel, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(delta, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize delta: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(opts.OutputDir, DeltaFileName), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", DeltaFileName, err)
+	}
+
+	return delta, nil
+}
+
+// ApplyDelta updates the bundle in baseDir to the bundle described by the
+// delta in deltaDir: changed storage files are copied, removed ones deleted,
+// and the backend, database, credentials and manifest replaced. The merged
+// storage is verified against the delta's manifest. Not atomic; apply to a
+// copy of the base if it must survive a failed update.
+func ApplyDelta(baseDir, deltaDir string) error {
+	data, err := os.ReadFile(filepath.Join(deltaDir, DeltaFileName))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", DeltaFileName, err)
+	}
+	var delta Delta
+	if err := json.Unmarshal(data, &delta); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", DeltaFileName, err)
+	}
+
+	baseManifest, err := readManifest(baseDir)
+	if err != nil {
+		return err
+	}
+	if baseManifest.Version != delta.BaseVersion || baseManifest.CreatedAt != delta.BaseCreatedAt {
+		return fmt.Errorf("delta is for base bundle %s (%s), not %s (%s)", delta.BaseVersion, delta.BaseCreatedAt, baseManifest.Version, baseManifest.CreatedAt)
+	}
+	deltaManifest, err := readManifest(deltaDir)
+	if err != nil {
+		return err
+	}
+
+	storageDir := filepath.Join(baseDir, "storage")
+	for _, rel := range append(append([]string{}, delta.Removed...), delta.Changed...) {
+		if !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return fmt.Errorf("invalid storage path in delta: %s", rel)
+		}
+	}
+
+	for _, rel := range delta.Removed {
+		if err := os.Remove(filepath.Join(storageDir, filepath.FromSlash(rel))); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove storage file %s: %w", rel, err)
+		}
+	}
+	for _, rel := range delta.Changed {
+		dst := filepath.Join(storageDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return fmt.Errorf("failed to create storage directory: %w", err)
+		}
+		if err := replaceFile(filepath.Join(deltaDir, "storage", filepath.FromSlash(rel)), dst); err != nil {
+			return fmt.Errorf("failed to copy storage file %s: %w", rel, err)
+		}
+	}
+
+	// The manifest goes last so an interrupted apply still names the old base
+	for _, name := range []string{"backend", "convex.db", "credentials.json", "manifest.json"} {
+		if err := replaceFile(filepath.Join(deltaDir, name), filepath.Join(baseDir, name)); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+
+	merged, err := storageChecksums(storageDir, nil)
+	if err != nil {
+		return fmt.Errorf("failed to checksum merged storage: %w", err)
+	}
+	if !maps.Equal(merged, deltaManifest.StorageChecksums) {
+		return fmt.Errorf("merged storage does not match the delta manifest")
+	}
+
+	return nil
+}
+
+// replaceFile copies src over dst. dst is removed first so that files
+// hardlinked to it (see Options.DedupeStorage) are left unchanged.
+func replaceFile(src, dst string) error {
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return copyFile(src, dst)
+}
+
+// readManifest reads manifest.json from a bundle directory
+func readManifest(bundleDir string) (*manifest.Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(bundleDir, "manifest.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest.json: %w", err)
+	}
+	var mf manifest.Manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+	return &mf, nil
+}
+
+// storageChecksums returns the "sha256:<hex>" checksum of every regular file
+// under dir, keyed by its slash-separated path relative to dir, skipping the
+// paths matcher matches (if not nil)
+func storageChecksums(dir string, matcher *ignore.Matcher) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if path != dir && matcher.Match(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = "sha256:" + hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package bundle
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// EnvFileName is the startup env file written into a bundle directory when
+// Options.EnvVars is set
+const EnvFileName = "convex.env"
+
+// InstanceSecretEnvVar is the variable in the env file holding the instance
+// secret from credentials.json
+const InstanceSecretEnvVar = "INSTANCE_SECRET"
+
+// envNamePattern matches POSIX shell variable names
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envSafeValuePattern matches values that need no quoting in a shell
+var envSafeValuePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+// ValidateEnvName returns an error if name cannot be used as a variable in
+// the env file: it must be a shell variable name other than
+// InstanceSecretEnvVar, which is always written from the credentials.
+func ValidateEnvName(name string) error {
+	if !envNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid environment variable name %q: must contain only letters, digits and '_' and not start with a digit", name)
+	}
+	if name == InstanceSecretEnvVar {
+		return fmt.Errorf("environment variable %s is set from the bundle credentials", name)
+	}
+	return nil
+}
+
+// ParseEnvVars parses "NAME=value" pairs into an env var map. Names must be
+// valid (see ValidateEnvName) and unique; values may be empty. Returns nil
+// for no pairs.
+func ParseEnvVars(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	vars := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid environment variable %q: expected NAME=value", pair)
+		}
+		if err := ValidateEnvName(name); err != nil {
+			return nil, err
+		}
+		if _, dup := vars[name]; dup {
+			return nil, fmt.Errorf("duplicate environment variable %q", name)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// writeEnvFile writes the instance secret and vars, sorted by name after
+// the secret, to path as NAME=value lines that a POSIX shell can source.
+// The file holds the instance secret, so only its owner can read it.
+func writeEnvFile(path, instanceSecret string, vars map[string]string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s=%s\n", InstanceSecretEnvVar, quoteEnvValue(instanceSecret))
+	for _, name := range sortedKeys(vars) {
+		if err := ValidateEnvName(name); err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, quoteEnvValue(vars[name]))
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
+
+// quoteEnvValue returns value as a shell word: unchanged if it has no
+// special characters, otherwise single-quoted, with each embedded single
+// quote written by closing the quotes, escaping it and reopening them.
+func quoteEnvValue(value string) string {
+	if value != "" && envSafeValuePattern.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
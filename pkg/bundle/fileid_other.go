@@ -0,0 +1,11 @@
+//go:build !unix
+
+package bundle
+
+import "os"
+
+// fileIDOf reports no identity on platforms without inode information, so
+// copyTree cannot detect directory cycles there.
+func fileIDOf(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
@@ -0,0 +1,139 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/database"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+)
+
+// Info summarizes the contents of an existing bundle directory
+type Info struct {
+	// Dir is the inspected bundle directory
+	Dir string `json:"dir"`
+
+	// Manifest is the parsed manifest.json
+	Manifest *manifest.Manifest `json:"manifest"`
+
+	// HasBackend indicates whether the backend binary is present
+	HasBackend bool `json:"hasBackend"`
+
+	// HasCredentials indicates whether credentials.json is present and parseable
+	HasCredentials bool `json:"hasCredentials"`
+
+	// CredentialsEncrypted indicates credentials.json is encrypted with a
+	// passphrase; AdminKey is then empty
+	CredentialsEncrypted bool `json:"credentialsEncrypted,omitempty"`
+
+	// AdminKey is the redacted admin key from credentials.json
+	AdminKey string `json:"adminKey,omitempty"`
+
+	// DatabaseSize is the size of convex.db in bytes (0 if missing)
+	DatabaseSize int64 `json:"databaseSize"`
+
+	// DatabaseValid indicates whether convex.db starts with the SQLite header
+	DatabaseValid bool `json:"databaseValid"`
+
+	// DatabaseStats counts what is deployed in a valid convex.db (nil if it
+	// could not be read)
+	DatabaseStats *DBStats `json:"databaseStats,omitempty"`
+
+	// StorageFileCount is the number of regular files under storage/
+	StorageFileCount int `json:"storageFileCount"`
+}
+
+// Inspect reads an existing bundle directory and summarizes its contents.
+// The manifest must be readable; other missing files are reported in the result.
+func Inspect(dir string) (*Info, error) {
+	dirInfo, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("bundle directory does not exist: %s", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access bundle directory: %w", err)
+	}
+	if !dirInfo.IsDir() {
+		return nil, fmt.Errorf("bundle path is not a directory: %s", dir)
+	}
+
+	mf, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Dir:      dir,
+		Manifest: mf,
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "backend")); err == nil {
+		info.HasBackend = true
+	}
+
+	if credsData, err := os.ReadFile(filepath.Join(dir, "credentials.json")); err == nil {
+		var creds credentials.Credentials
+		if credentials.IsEncrypted(credsData) {
+			info.HasCredentials = credentials.ValidateEncrypted(credsData) == nil
+			info.CredentialsEncrypted = true
+		} else if json.Unmarshal(credsData, &creds) == nil {
+			info.HasCredentials = true
+			info.AdminKey = credentials.Redact(creds.AdminKey)
+		}
+	}
+
+	dbPath := filepath.Join(dir, "convex.db")
+	if dbInfo, err := os.Stat(dbPath); err == nil {
+		info.DatabaseSize = dbInfo.Size()
+		info.DatabaseValid = isSQLiteFile(dbPath)
+		if info.DatabaseValid {
+			// Best effort: a database the driver cannot read is still reported as present
+			info.DatabaseStats, _ = InspectDatabase(dbPath)
+		}
+	}
+
+	storageDir := filepath.Join(dir, "storage")
+	if _, err := os.Stat(storageDir); err == nil {
+		count, err := countFiles(storageDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count storage files: %w", err)
+		}
+		info.StorageFileCount = count
+	}
+
+	return info, nil
+}
+
+// isSQLiteFile reports whether the file at path begins with the SQLite header
+func isSQLiteFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, len(database.Magic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return database.HasSQLiteHeader(header)
+}
+
+// countFiles counts the regular files under dir
+func countFiles(dir string) (int, error) {
+	var count int
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,122 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+)
+
+// Bundle is an existing bundle directory opened for reading
+type Bundle struct {
+	// Dir is the bundle directory
+	Dir string
+
+	// Manifest is the parsed manifest.json
+	Manifest *manifest.Manifest
+
+	// Credentials is the parsed credentials.json (nil if missing or encrypted)
+	Credentials *credentials.Credentials
+
+	// CredentialsEncrypted indicates credentials.json is encrypted; decrypt
+	// it with credentials.LoadEncrypted
+	CredentialsEncrypted bool
+
+	// DatabasePath is the path to convex.db (empty if missing)
+	DatabasePath string
+
+	// StoragePath is the path to the storage directory (empty if missing)
+	StoragePath string
+
+	// BackendPath is the path to the backend binary (empty if missing)
+	BackendPath string
+}
+
+// Open reads an existing bundle directory. The manifest must be readable and
+// credentials.json, if present, must parse or be well-formed encrypted
+// credentials; other missing files leave their path fields empty.
+func Open(dir string) (*Bundle, error) {
+	dirInfo, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("bundle directory does not exist: %s", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access bundle directory: %w", err)
+	}
+	if !dirInfo.IsDir() {
+		return nil, fmt.Errorf("bundle path is not a directory: %s", dir)
+	}
+
+	mf, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		Dir:      dir,
+		Manifest: mf,
+	}
+
+	credsData, err := os.ReadFile(filepath.Join(dir, "credentials.json"))
+	switch {
+	case err == nil && credentials.IsEncrypted(credsData):
+		if err := credentials.ValidateEncrypted(credsData); err != nil {
+			return nil, fmt.Errorf("failed to parse credentials.json: %w", err)
+		}
+		b.CredentialsEncrypted = true
+	case err == nil:
+		var creds credentials.Credentials
+		if err := json.Unmarshal(credsData, &creds); err != nil {
+			return nil, fmt.Errorf("failed to parse credentials.json: %w", err)
+		}
+		b.Credentials = &creds
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("failed to read credentials.json: %w", err)
+	}
+
+	if path := filepath.Join(dir, "convex.db"); fileExists(path) {
+		b.DatabasePath = path
+	}
+	if path := filepath.Join(dir, "storage"); fileExists(path) {
+		b.StoragePath = path
+	}
+	if path := filepath.Join(dir, "backend"); fileExists(path) {
+		b.BackendPath = path
+	}
+
+	return b, nil
+}
+
+// DatabaseSize returns the size of convex.db in bytes (0 if missing)
+func (b *Bundle) DatabaseSize() (int64, error) {
+	if b.DatabasePath == "" {
+		return 0, nil
+	}
+	info, err := os.Stat(b.DatabasePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat database: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// StorageFileCount returns the number of regular files under storage/
+// (0 if missing)
+func (b *Bundle) StorageFileCount() (int, error) {
+	if b.StoragePath == "" {
+		return 0, nil
+	}
+	count, err := countFiles(b.StoragePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count storage files: %w", err)
+	}
+	return count, nil
+}
+
+// fileExists reports whether path exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
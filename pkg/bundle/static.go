@@ -0,0 +1,66 @@
+package bundle
+
+import (
+	"bytes"
+	"debug/elf"
+	"fmt"
+	"io"
+
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
+)
+
+// CheckStaticLinking inspects the ELF executable at path and returns the
+// shared libraries it needs at run time, or an empty list if it is statically
+// linked. A binary that requests a dynamic loader (PT_INTERP) without naming
+// any libraries is reported as needing the loader itself. The check is best
+// effort: it returns an error for files that are not ELF executables, such as
+// scripts or Mach-O binaries.
+func CheckStaticLinking(path string) ([]string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("not an ELF executable: %w", err)
+	}
+	defer f.Close()
+
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dynamic section: %w", err)
+	}
+	if len(libs) > 0 {
+		return libs, nil
+	}
+
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		interp, err := io.ReadAll(prog.Open())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read interpreter: %w", err)
+		}
+		return []string{string(bytes.TrimRight(interp, "\x00"))}, nil
+	}
+	return []string{}, nil
+}
+
+// CheckBackendLinking logs a warning to log if the backend binary at path is
+// dynamically linked, or returns an error instead if requireStatic is set.
+func CheckBackendLinking(path string, requireStatic bool, log logging.Logger) error {
+	log = logging.OrNop(log)
+	libs, err := CheckStaticLinking(path)
+	if err != nil {
+		if requireStatic {
+			return fmt.Errorf("cannot verify that backend binary is statically linked: %w", err)
+		}
+		log.Debugf("Skipping static linking check of %s: %v", path, err)
+		return nil
+	}
+	if len(libs) == 0 {
+		return nil
+	}
+	if requireStatic {
+		return fmt.Errorf("backend binary is dynamically linked (needs %v); use a statically linked build", libs)
+	}
+	log.Warnf("Backend binary is dynamically linked (needs %v) and may not run on minimal install targets", libs)
+	return nil
+}
@@ -0,0 +1,237 @@
+package bundle
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/database"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+)
+
+// VerifyResult contains the result of bundle directory verification
+type VerifyResult struct {
+	// Valid indicates whether no problems were found
+	Valid bool `json:"valid"`
+
+	// Problems lists every issue found, in a stable order
+	Problems []string `json:"problems"`
+}
+
+// Err returns every problem joined into a single error with errors.Join, or
+// nil if the bundle is valid.
+func (r *VerifyResult) Err() error {
+	errs := make([]error, len(r.Problems))
+	for i, problem := range r.Problems {
+		errs[i] = errors.New(problem)
+	}
+	return errors.Join(errs...)
+}
+
+// VerifyOptions configures optional, more expensive verification checks
+type VerifyOptions struct {
+	// VerifyDatabase runs PRAGMA integrity_check on convex.db, catching
+	// corruption that a header check alone misses
+	VerifyDatabase bool
+
+	// CredentialsPassphrase decrypts an encrypted credentials.json so its
+	// keys can be checked. Without it, only the encrypted form is validated.
+	CredentialsPassphrase string
+}
+
+// Verify checks that a bundle directory is complete and well-formed.
+// It collects all problems rather than stopping at the first one; an error is
+// only returned if the directory itself cannot be accessed.
+func Verify(dir string) (*VerifyResult, error) {
+	return VerifyWithOptions(dir, VerifyOptions{})
+}
+
+// VerifyWithOptions is like Verify but also runs the checks enabled in opts.
+func VerifyWithOptions(dir string, opts VerifyOptions) (*VerifyResult, error) {
+	dirInfo, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("bundle directory does not exist: %s", dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access bundle directory: %w", err)
+	}
+	if !dirInfo.IsDir() {
+		return nil, fmt.Errorf("bundle path is not a directory: %s", dir)
+	}
+
+	var problems []string
+	problems = append(problems, verifyManifest(dir)...)
+	problems = append(problems, verifyBackend(dir)...)
+	dbProblems := verifyDatabase(dir)
+	if opts.VerifyDatabase && len(dbProblems) == 0 {
+		if err := database.CheckIntegrity(filepath.Join(dir, "convex.db")); err != nil {
+			dbProblems = append(dbProblems, fmt.Sprintf("convex.db: %v", err))
+		}
+	}
+	problems = append(problems, dbProblems...)
+	problems = append(problems, verifyStorage(dir)...)
+	problems = append(problems, verifyCredentials(dir, opts.CredentialsPassphrase)...)
+
+	return &VerifyResult{
+		Valid:    len(problems) == 0,
+		Problems: problems,
+	}, nil
+}
+
+// verifyManifest checks manifest.json exists, parses, and has required fields
+func verifyManifest(dir string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return []string{"missing required file: manifest.json"}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read manifest.json: %v", err)}
+	}
+
+	var mf manifest.Manifest
+	if err := json.Unmarshal(data, &mf); err != nil {
+		return []string{fmt.Sprintf("invalid manifest.json: %v", err)}
+	}
+
+	var problems []string
+	if mf.Name == "" {
+		problems = append(problems, "manifest.json: name is required")
+	}
+	if mf.Version == "" {
+		problems = append(problems, "manifest.json: version is required")
+	}
+	if mf.Platform == "" {
+		problems = append(problems, "manifest.json: platform is required")
+	}
+	for _, source := range mf.AppSources {
+		if !strings.HasPrefix(source, AppSourcesDir+"/") || !fs.ValidPath(source) {
+			problems = append(problems, fmt.Sprintf("manifest.json: invalid app source path %q", source))
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(source))); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("missing app sources: %s", source))
+		}
+	}
+	return problems
+}
+
+// verifyBackend checks the backend binary exists and is executable
+func verifyBackend(dir string) []string {
+	info, err := os.Stat(filepath.Join(dir, "backend"))
+	if os.IsNotExist(err) {
+		return []string{"missing required file: backend"}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("failed to access backend: %v", err)}
+	}
+	if info.IsDir() {
+		return []string{"backend is a directory"}
+	}
+	if info.Mode()&0111 == 0 {
+		return []string{"backend is not executable"}
+	}
+	return nil
+}
+
+// verifyDatabase checks convex.db exists, is non-empty, and is a SQLite database
+func verifyDatabase(dir string) []string {
+	dbPath := filepath.Join(dir, "convex.db")
+	info, err := os.Stat(dbPath)
+	if os.IsNotExist(err) {
+		return []string{"missing required file: convex.db"}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("failed to access convex.db: %v", err)}
+	}
+	if info.Size() == 0 {
+		return []string{"convex.db is empty"}
+	}
+	if !isSQLiteFile(dbPath) {
+		return []string{"convex.db is not a valid SQLite database"}
+	}
+	return nil
+}
+
+// ValidateDatabase checks that the file at path is a non-empty SQLite
+// database that passes PRAGMA integrity_check, e.g. before bundling a
+// prebuilt database instead of running pre-deployment.
+func ValidateDatabase(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to access database: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("database is not a regular file: %s", path)
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("database is empty: %s", path)
+	}
+	if !isSQLiteFile(path) {
+		return fmt.Errorf("database is not a valid SQLite database: %s", path)
+	}
+	return database.CheckIntegrity(path)
+}
+
+// verifyStorage checks the storage directory exists
+func verifyStorage(dir string) []string {
+	info, err := os.Stat(filepath.Join(dir, "storage"))
+	if os.IsNotExist(err) {
+		return []string{"missing required directory: storage"}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("failed to access storage: %v", err)}
+	}
+	if !info.IsDir() {
+		return []string{"storage is not a directory"}
+	}
+	return nil
+}
+
+// verifyCredentials checks credentials.json exists and contains a usable admin key and instance secret.
+// Encrypted credentials are decrypted with passphrase, or only checked for well-formedness without one.
+func verifyCredentials(dir, passphrase string) []string {
+	data, err := os.ReadFile(filepath.Join(dir, "credentials.json"))
+	if os.IsNotExist(err) {
+		return []string{"missing required file: credentials.json"}
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read credentials.json: %v", err)}
+	}
+
+	var creds credentials.Credentials
+	if credentials.IsEncrypted(data) {
+		if passphrase == "" {
+			if err := credentials.ValidateEncrypted(data); err != nil {
+				return []string{fmt.Sprintf("credentials.json: %v", err)}
+			}
+			return nil
+		}
+		decrypted, err := credentials.DecryptJSON(data, passphrase)
+		if err != nil {
+			return []string{fmt.Sprintf("credentials.json: %v", err)}
+		}
+		creds = *decrypted
+	} else if err := json.Unmarshal(data, &creds); err != nil {
+		return []string{fmt.Sprintf("invalid credentials.json: %v", err)}
+	}
+
+	var problems []string
+	if creds.AdminKey == "" {
+		problems = append(problems, "credentials.json: adminKey is required")
+	}
+	if secret, err := hex.DecodeString(creds.InstanceSecret); err != nil || len(secret) != 32 {
+		problems = append(problems, "credentials.json: instanceSecret must be a 64-character hex string")
+	}
+	if len(problems) == 0 {
+		if err := credentials.VerifyConsistency(&creds); err != nil {
+			problems = append(problems, fmt.Sprintf("credentials.json: %v", err))
+		}
+	}
+	return problems
+}
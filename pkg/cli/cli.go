@@ -1,22 +1,97 @@
 package cli
 
 import (
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ozanturksever/convex-bundler/pkg/bundle"
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
+	"github.com/ozanturksever/convex-bundler/pkg/version"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// EnvPrefix is the prefix for environment variables that provide fallback values
+// for the main bundle command flags. The variable name for a flag is the prefix
+// followed by the flag name upper-cased with dashes replaced by underscores
+// (e.g., --backend-binary -> CONVEX_BUNDLER_BACKEND_BINARY).
+const EnvPrefix = "CONVEX_BUNDLER_"
+
+// Output formats for command results
+const (
+	// OutputFormatText prints human-readable progress and results (default)
+	OutputFormatText = "text"
+
+	// OutputFormatJSON prints a single JSON object describing the result
+	OutputFormatJSON = "json"
+)
+
+// ValidationError reports a flag that failed validation, so callers can tell
+// which flag was at fault with errors.As. Error returns Reason.
+type ValidationError struct {
+	// Flag is the flag name without leading dashes (e.g. "platform")
+	Flag string `json:"flag"`
+
+	// Value is the offending value, empty if the flag is missing
+	Value string `json:"value"`
+
+	// Reason is the human-readable message
+	Reason string `json:"reason"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+// flagError returns a ValidationError for flag and value with a message
+// formatted from format and args.
+func flagError(flag, value, format string, args ...interface{}) error {
+	return &ValidationError{Flag: flag, Value: value, Reason: fmt.Sprintf(format, args...)}
+}
+
 // Config holds the parsed CLI configuration for the main bundle command
 type Config struct {
 	Apps          []string
 	Output        string
 	BackendBinary string
 	Name          string
+	InstanceName  string // Convex instance name for the admin key (default: slugified Name)
 	Version       string
 	Platform      string
 	DockerImage   string
+	DryRun        bool
+	OutputFormat  string            // OutputFormatText or OutputFormatJSON
+	Reproducible  bool              // Use a fixed timestamp (SOURCE_DATE_EPOCH or the Unix epoch) in the manifest
+	DedupeStorage bool              // Hardlink identical storage files instead of copying each one
+	AbsoluteApps  bool              // Record app paths in the manifest as given instead of normalizing them
+	KeepTemp      bool              // Keep the pre-deployment temp directory for debugging
+	Labels        map[string]string // Key/value labels recorded in the manifest
+	Checksums     bool              // Write a SHA256SUMS file into the bundle directory
+	RequireStatic bool              // Fail instead of warning if the backend binary is dynamically linked
+	EnvVars       map[string]string // Variables written to convex.env with the instance secret (nil for no env file)
+	Database      string            // Prebuilt convex.db to bundle instead of running pre-deployment
+	Storage       string            // Storage directory to bundle with Database (empty for no files)
+	Timeout       time.Duration     // Abort the whole pipeline after this long (0 for no limit)
+	Concurrency   int               // Storage files copied at once
+	Verbose       bool              // Log debug messages in addition to progress
+	Quiet         bool              // Log only warnings
+
+	// IncludeAppSources copies each app directory into apps/ in the bundle
+	IncludeAppSources bool
+
+	// EncryptCredentials stores credentials.json encrypted with the
+	// passphrase read from CredentialsPassphraseFile
+	EncryptCredentials        bool
+	CredentialsPassphraseFile string
 }
 
 // SelfHostConfig holds the parsed CLI configuration for the selfhost subcommand
@@ -27,31 +102,228 @@ type SelfHostConfig struct {
 	// OpsBinary is the path to the convex-backend-ops binary
 	OpsBinary string
 
+	// OpsBinaryURL is downloaded and used as the ops binary instead of OpsBinary
+	OpsBinaryURL string
+
+	// OpsBinarySHA256 is the expected hex SHA256 of the OpsBinaryURL download (optional)
+	OpsBinarySHA256 string
+
 	// Output is the output path for the self-extracting executable
 	Output string
 
 	// Platform is the target platform (e.g., "linux-x64", "linux-arm64")
 	Platform string
 
-	// Compression is the compression algorithm ("gzip" or "zstd")
+	// Compression is the compression algorithm ("gzip", "zstd", "brotli" or "auto")
 	Compression string
 
 	// OpsVersion is an optional version string for the ops binary (for metadata)
 	OpsVersion string
+
+	// Reproducible uses a fixed timestamp in the header and archive entries
+	Reproducible bool
+
+	// InstallPrefix is the directory the embedded ops binary installs under
+	InstallPrefix string
+
+	// ServiceName is the systemd service name the embedded ops binary installs
+	ServiceName string
+
+	// HealthCheckPath is the endpoint the installer polls for backend readiness
+	HealthCheckPath string
+
+	// HealthCheckTimeout is how long the installer waits for the backend to become ready
+	HealthCheckTimeout time.Duration
+
+	// ParallelCompression compresses gzip bundles on all CPUs
+	ParallelCompression bool
+
+	// MaxSize is the largest allowed executable size in bytes (0 for no limit)
+	MaxSize int64
+
+	// SidecarChecksum writes a <output>.sha256 checksum file next to the executable
+	SidecarChecksum bool
+
+	// OmitCredentials leaves credentials.json out of the embedded bundle
+	OmitCredentials bool
+
+	// RequireStatic fails instead of warning if the bundle's backend is dynamically linked
+	RequireStatic bool
+
+	// MinOpsVersion is the oldest ops binary version allowed to install the bundle
+	MinOpsVersion string
+
+	// MinBackendVersion is the oldest backend version the bundle runs on
+	MinBackendVersion string
+
+	// OutputFormat is OutputFormatText or OutputFormatJSON
+	OutputFormat string
+
+	// Verbose enables debug messages in addition to progress
+	Verbose bool
+
+	// Quiet suppresses progress messages, leaving only warnings
+	Quiet bool
 }
 
-// ParseOptions configures the Parse and ParseSelfHost functions
+// RepackConfig holds the parsed CLI configuration for the selfhost repack subcommand
+type RepackConfig struct {
+	// Input is the self-extracting executable to recompress
+	Input string
+
+	// Output is where the repacked executable is written (empty to rewrite Input in place)
+	Output string
+
+	// Compression is the new compression algorithm ("gzip", "zstd", "brotli" or "auto")
+	Compression string
+}
+
+// ExtractDBConfig holds the parsed CLI configuration for the selfhost extract-db subcommand
+type ExtractDBConfig struct {
+	// Input is the self-extracting executable to read the database from
+	Input string
+
+	// Output is where convex.db is written
+	Output string
+}
+
+// InfoConfig holds the parsed CLI configuration for the info subcommand
+type InfoConfig struct {
+	// BundleDir is the path to the bundle directory to inspect
+	BundleDir string
+
+	// OutputFormat is OutputFormatText or OutputFormatJSON
+	OutputFormat string
+}
+
+// ValidateConfig holds the parsed CLI configuration for the validate subcommand
+type ValidateConfig struct {
+	// BundleDir is the path to the bundle directory to validate
+	BundleDir string
+
+	// OutputFormat is OutputFormatText or OutputFormatJSON
+	OutputFormat string
+
+	// CheckDatabase runs a SQLite integrity check on convex.db
+	CheckDatabase bool
+
+	// CredentialsPassphraseFile holds the passphrase that decrypts an
+	// encrypted credentials.json so its keys can be checked (optional)
+	CredentialsPassphraseFile string
+}
+
+// KeyConfig holds the parsed CLI configuration for the key subcommand
+type KeyConfig struct {
+	// Secret is the hex-encoded instance secret given with --secret
+	Secret string
+
+	// SecretFile is a file containing the instance secret, or "-" for stdin
+	SecretFile string
+
+	// InstanceName is the Convex instance the key is issued for
+	InstanceName string
+
+	// MemberID is the member the admin key is issued for (0 for a generic admin key)
+	MemberID uint64
+
+	// ReadOnly issues a key that can only run queries
+	ReadOnly bool
+
+	// System issues a system key instead of an admin key
+	System bool
+}
+
+// ParseOptions configures the Parse, ParseCommand, and subcommand parse functions
 type ParseOptions struct {
-	SkipValidation bool // Skip file existence validation (for testing)
+	SkipValidation bool      // Skip file existence validation (for testing)
+	Output         io.Writer // Destination for help and completion output (default: os.Stdout)
 }
 
-// Parse parses command-line arguments and returns a Config
-func Parse(args []string, opts ...ParseOptions) (*Config, error) {
+// CommandName identifies the command selected on the command line
+type CommandName string
+
+// Commands recognized by ParseCommand
+const (
+	CommandBundle     CommandName = "bundle"
+	CommandSelfHost   CommandName = "selfhost"
+	CommandRepack     CommandName = "repack"
+	CommandExtractDB  CommandName = "extract-db"
+	CommandInfo       CommandName = "info"
+	CommandValidate   CommandName = "validate"
+	CommandKey        CommandName = "key"
+	CommandVersion    CommandName = "version"
+	CommandCompletion CommandName = "completion"
+
+	// CommandHelp indicates help was printed and there is nothing else to run
+	CommandHelp CommandName = "help"
+)
+
+// Invocation holds the command selected by ParseCommand and its parsed configuration.
+// Only the config matching Command is set.
+type Invocation struct {
+	Command   CommandName
+	Bundle    *Config
+	SelfHost  *SelfHostConfig
+	Repack    *RepackConfig
+	ExtractDB *ExtractDBConfig
+	Info      *InfoConfig
+	Validate  *ValidateConfig
+	Key       *KeyConfig
+}
+
+// NewRootCommand returns the root convex-bundler command with the bundle flags and
+// all subcommands registered. Configs parsed by the returned command are discarded;
+// use ParseCommand to obtain them.
+func NewRootCommand() *cobra.Command {
+	return newCommandTree(&Invocation{}, ParseOptions{})
+}
+
+// ParseCommand parses command-line arguments (including the program name) using the
+// full command tree and returns the selected command with its configuration.
+func ParseCommand(args []string, opts ...ParseOptions) (*Invocation, error) {
 	var parseOpts ParseOptions
 	if len(opts) > 0 {
 		parseOpts = opts[0]
 	}
+
+	inv := &Invocation{Command: CommandHelp}
+	root := newCommandTree(inv, parseOpts)
+	if parseOpts.Output != nil {
+		root.SetOut(parseOpts.Output)
+	}
+
+	if len(args) > 0 {
+		args = args[1:] // Skip program name
+	}
+	root.SetArgs(args)
+	if err := root.Execute(); err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// newCommandTree builds the root bundle command and its subcommands. Each command
+// validates its flags when run and records its config in inv.
+func newCommandTree(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
+	root := newRootCommand(inv, parseOpts)
+	root.AddCommand(
+		newSelfHostCommand(inv, parseOpts),
+		newInfoCommand(inv, parseOpts),
+		newValidateCommand(inv, parseOpts),
+		newKeyCommand(inv),
+		newVersionCommand(inv),
+		NewCompletionCommand(root),
+	)
+	return root
+}
+
+// newRootCommand builds the root bundle command, binding its flags to a new Config.
+func newRootCommand(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
 	config := &Config{}
+	var jsonOutput, showVersion bool
+	var labels []string
+	var envVars []string
 
 	cmd := &cobra.Command{
 		Use:   "convex-bundler [flags]",
@@ -63,6 +335,7 @@ The bundler performs the following steps:
   1. Validates the Convex app directory and backend binary
   2. Detects version from git tags, package.json, or CLI override
   3. Runs pre-deployment to initialize the database with your schema
+     (skipped when a prebuilt database is given with --database)
   4. Generates secure credentials (admin key and instance secret)
   5. Creates the final bundle with all necessary files
 
@@ -71,7 +344,13 @@ The output bundle contains:
   - convex.db       Pre-initialized SQLite database
   - storage/        File storage directory
   - manifest.json   Bundle metadata
-  - credentials.json  Admin key and instance secret`,
+  - credentials.json  Admin key and instance secret
+
+Every flag can also be set through an environment variable named
+CONVEX_BUNDLER_<FLAG>, with dashes replaced by underscores (for example
+CONVEX_BUNDLER_BACKEND_BINARY or CONVEX_BUNDLER_OUTPUT). Explicit flags take
+precedence over environment variables, which take precedence over defaults.
+Multiple apps can be given in CONVEX_BUNDLER_APP as a comma-separated list.`,
 		Example: `  # Basic usage with required flags
   convex-bundler --app ./my-app --output ./bundle --backend-binary ./convex-local-backend
 
@@ -88,8 +367,44 @@ The output bundle contains:
 
   # Use custom Docker image for pre-deployment
   convex-bundler --app ./my-app -o ./bundle --backend-binary ./backend \
-    --docker-image ghcr.io/my-org/convex-predeploy:v1.0.0`,
+    --docker-image ghcr.io/my-org/convex-predeploy:v1.0.0
+
+  # Validate inputs and show the planned bundle without running Docker
+  convex-bundler --app ./my-app -o ./bundle --backend-binary ./backend --dry-run
+
+  # Bundle a prebuilt database and storage without running pre-deployment
+  convex-bundler --app ./my-app -o ./bundle --backend-binary ./backend \
+    --database ./convex.db --storage ./storage`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if showVersion {
+				inv.Command = CommandVersion
+				return nil
+			}
+
+			// Fill unset flags from environment variables
+			if err := applyEnvFallbacks(cmd.Flags(), EnvPrefix); err != nil {
+				return err
+			}
+			config.OutputFormat = outputFormat(jsonOutput)
+
+			parsedLabels, err := manifest.ParseLabels(labels)
+			if err != nil {
+				return flagError("label", "", "invalid --label: %v", err)
+			}
+			config.Labels = parsedLabels
+
+			parsedEnvVars, err := bundle.ParseEnvVars(envVars)
+			if err != nil {
+				return flagError("env", "", "invalid --env: %v", err)
+			}
+			config.EnvVars = parsedEnvVars
+
+			if err := validateConfig(config, parseOpts); err != nil {
+				return err
+			}
+			inv.Command = CommandBundle
+			inv.Bundle = config
 			return nil
 		},
 		SilenceUsage:  true,
@@ -100,51 +415,125 @@ The output bundle contains:
 	cmd.Flags().StringVarP(&config.Output, "output", "o", "", "Output path for the bundle directory")
 	cmd.Flags().StringVar(&config.BackendBinary, "backend-binary", "", "Path to the convex-local-backend binary")
 	cmd.Flags().StringVar(&config.Name, "name", "Convex Backend", "Display name")
+	cmd.Flags().StringVar(&config.InstanceName, "instance-name", "", "Convex instance name used in the admin key (default: --name lower-cased with spaces and punctuation replaced by '-')")
 	cmd.Flags().StringVar(&config.Version, "bundle-version", "", "Bundle version override (semver)")
-	cmd.Flags().StringVar(&config.Platform, "platform", "linux-x64", "Target platform: linux-x64, linux-arm64")
+	cmd.Flags().StringVar(&config.Platform, "platform", platform.Default, "Target platform: "+strings.Join(platform.Names(), ", "))
 	cmd.Flags().StringVar(&config.DockerImage, "docker-image", "", "Docker image for pre-deployment (default: convex-predeploy:latest)")
+	cmd.Flags().BoolVar(&config.DryRun, "dry-run", false, "Validate inputs and print the planned bundle without running pre-deployment or writing files")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as a single JSON object instead of human-readable text")
+	cmd.Flags().BoolVar(&config.Reproducible, "reproducible", false, "Use a fixed timestamp (SOURCE_DATE_EPOCH or 1970-01-01) in the manifest")
+	cmd.Flags().BoolVar(&config.DedupeStorage, "dedupe-storage", false, "Hardlink storage files with identical content instead of copying each one")
+	cmd.Flags().BoolVar(&config.KeepTemp, "keep-temp", false, "Keep the pre-deployment temp directory (database and storage copies) for debugging")
+	cmd.Flags().BoolVar(&config.AbsoluteApps, "absolute-app-paths", false, "Record app paths in the manifest as given instead of relative to the working directory")
+	cmd.Flags().BoolVar(&config.Checksums, "checksums", false, "Write a SHA256SUMS file (sha256sum -c compatible) into the bundle directory")
+	cmd.Flags().BoolVar(&config.RequireStatic, "require-static", false, "Fail if the backend binary is dynamically linked instead of only warning")
+	cmd.Flags().StringArrayVar(&labels, "label", nil, "Label recorded in the manifest as key=value (can be specified multiple times)")
+	cmd.Flags().StringVar(&config.Database, "database", "", "Prebuilt convex.db to bundle instead of running pre-deployment in Docker")
+	cmd.Flags().StringVar(&config.Storage, "storage", "", "Storage directory to bundle with --database (default: empty)")
+	cmd.Flags().StringArrayVar(&envVars, "env", nil, "Variable written as NAME=value to convex.env along with INSTANCE_SECRET (can be specified multiple times)")
+	cmd.Flags().DurationVar(&config.Timeout, "timeout", 0, "Abort pre-deployment and bundling after this long, removing partial output (default: no limit)")
+	cmd.Flags().IntVar(&config.Concurrency, "concurrency", 1, "Number of storage files copied in parallel")
+	cmd.Flags().BoolVar(&config.IncludeAppSources, "include-app-sources", false, "Copy each --app directory (without node_modules/, .git/ and .convexbundleignore matches) into apps/ in the bundle")
+	cmd.Flags().BoolVar(&config.EncryptCredentials, "encrypt-credentials", false, "Store credentials.json encrypted with the passphrase from --credentials-passphrase-file")
+	cmd.Flags().StringVar(&config.CredentialsPassphraseFile, "credentials-passphrase-file", "", "File containing the passphrase for --encrypt-credentials")
+	cmd.Flags().BoolVarP(&showVersion, "version", "v", false, "Print version information and exit")
+	addLogLevelFlags(cmd, &config.Verbose, &config.Quiet)
 
-	cmd.SetArgs(args[1:]) // Skip program name
-	if err := cmd.Execute(); err != nil {
-		return nil, err
-	}
+	return cmd
+}
 
+// addLogLevelFlags registers the mutually exclusive --verbose and --quiet flags on cmd.
+func addLogLevelFlags(cmd *cobra.Command, verbose, quiet *bool) {
+	cmd.Flags().BoolVar(verbose, "verbose", false, "Print debug messages in addition to progress")
+	cmd.Flags().BoolVarP(quiet, "quiet", "q", false, "Print only warnings and the final result")
+	cmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+}
+
+// validateConfig checks required bundle flags and, unless skipped, that the
+// app directories and backend binary exist.
+func validateConfig(config *Config, parseOpts ParseOptions) error {
 	// Validate required flags
 	if len(config.Apps) == 0 {
-		return nil, errors.New("at least one --app is required")
+		return flagError("app", "", "at least one --app is required")
 	}
 	if config.Output == "" {
-		return nil, errors.New("--output is required")
+		return flagError("output", "", "--output is required")
 	}
 	if config.BackendBinary == "" {
-		return nil, errors.New("--backend-binary is required")
+		return flagError("backend-binary", "", "--backend-binary is required")
+	}
+	if config.Name == "" {
+		return flagError("name", "", "--name is required")
+	}
+	// The instance name is embedded in the admin key
+	if config.InstanceName == "" {
+		config.InstanceName = credentials.SlugifyInstanceName(config.Name)
+		if config.InstanceName == "" {
+			return flagError("instance-name", "", "--instance-name is required: no instance name can be derived from --name %q", config.Name)
+		}
+	}
+	if err := credentials.ValidateInstanceName(config.InstanceName); err != nil {
+		return flagError("instance-name", config.InstanceName, "invalid --instance-name: %v", err)
+	}
+	if _, ok := platform.Lookup(config.Platform); !ok {
+		return flagError("platform", config.Platform, "invalid platform %q: must be one of %s", config.Platform, strings.Join(platform.Names(), ", "))
+	}
+	if config.Storage != "" && config.Database == "" {
+		return flagError("storage", config.Storage, "--storage requires --database")
+	}
+	if config.Timeout < 0 {
+		return flagError("timeout", config.Timeout.String(), "--timeout must not be negative")
+	}
+	if config.Concurrency < 1 {
+		return flagError("concurrency", strconv.Itoa(config.Concurrency), "--concurrency must be at least 1")
+	}
+	if config.EncryptCredentials && config.CredentialsPassphraseFile == "" {
+		return flagError("credentials-passphrase-file", "", "--encrypt-credentials requires --credentials-passphrase-file")
+	}
+	if !config.EncryptCredentials && config.CredentialsPassphraseFile != "" {
+		return flagError("encrypt-credentials", "false", "--credentials-passphrase-file requires --encrypt-credentials")
+	}
+	if config.EncryptCredentials && config.EnvVars != nil {
+		return flagError("env", "", "--env cannot be combined with --encrypt-credentials: convex.env stores the instance secret in plaintext")
 	}
 
 	// Validate that apps and backend binary exist (unless skipped)
 	if !parseOpts.SkipValidation {
 		for _, app := range config.Apps {
 			if _, err := os.Stat(app); os.IsNotExist(err) {
-				return nil, fmt.Errorf("app directory does not exist: %s", app)
+				return flagError("app", app, "app directory does not exist: %s", app)
 			}
 		}
 		if _, err := os.Stat(config.BackendBinary); os.IsNotExist(err) {
-			return nil, fmt.Errorf("backend binary does not exist: %s", config.BackendBinary)
+			return flagError("backend-binary", config.BackendBinary, "backend binary does not exist: %s", config.BackendBinary)
+		}
+		if config.Database != "" {
+			if err := bundle.ValidateDatabase(config.Database); err != nil {
+				return flagError("database", config.Database, "invalid --database: %v", err)
+			}
+		}
+		if config.Storage != "" {
+			if info, err := os.Stat(config.Storage); err != nil || !info.IsDir() {
+				return flagError("storage", config.Storage, "storage directory does not exist: %s", config.Storage)
+			}
+		}
+		if config.CredentialsPassphraseFile != "" {
+			if _, err := os.Stat(config.CredentialsPassphraseFile); os.IsNotExist(err) {
+				return flagError("credentials-passphrase-file", config.CredentialsPassphraseFile, "passphrase file does not exist: %s", config.CredentialsPassphraseFile)
+			}
 		}
 	}
 
-	return config, nil
+	return nil
 }
 
-// ParseSelfHost parses command-line arguments for the selfhost subcommand
-func ParseSelfHost(args []string, opts ...ParseOptions) (*SelfHostConfig, error) {
-	var parseOpts ParseOptions
-	if len(opts) > 0 {
-		parseOpts = opts[0]
-	}
+// newSelfHostCommand builds the selfhost subcommand, binding its flags to a new SelfHostConfig.
+func newSelfHostCommand(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
 	config := &SelfHostConfig{}
+	var jsonOutput bool
 
 	cmd := &cobra.Command{
-		Use:   "convex-bundler selfhost [flags]",
+		Use:   "selfhost [flags]",
 		Short: "Create a self-extracting executable from a bundle",
 		Long: `Create a self-extracting executable that combines a convex-backend-ops binary
 with an embedded bundle. The resulting executable can install, extract, verify,
@@ -157,91 +546,575 @@ The self-extracting executable contains:
     - convex.db (pre-initialized database)
     - storage/ directory
     - manifest.json
-    - credentials.json`,
+    - credentials.json (unless --omit-credentials)`,
 		Example: `  # Create self-extracting executable
   convex-bundler selfhost --bundle ./bundle --ops-binary ./convex-backend-ops \
     --output ./my-backend-selfhost --platform linux-x64
 
   # With zstd compression
   convex-bundler selfhost -b ./bundle -o ./convex-backend-ops \
-    --output ./my-backend-selfhost -p linux-x64 -c zstd`,
+    --output ./my-backend-selfhost -p linux-x64 -c zstd
+
+  # Download and verify the ops binary
+  convex-bundler selfhost -b ./bundle \
+    --ops-binary-url https://example.com/convex-backend-ops \
+    --ops-binary-sha256 <sha256> --output ./my-backend-selfhost -p linux-x64`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			config.OutputFormat = outputFormat(jsonOutput)
+			if err := validateSelfHostConfig(config, parseOpts); err != nil {
+				return err
+			}
+			inv.Command = CommandSelfHost
+			inv.SelfHost = config
 			return nil
 		},
-		SilenceUsage:  true,
-		SilenceErrors: true,
 	}
 
 	cmd.Flags().StringVarP(&config.BundleDir, "bundle", "b", "", "Path to convex-bundler output directory")
 	cmd.Flags().StringVarP(&config.OpsBinary, "ops-binary", "o", "", "Path to convex-backend-ops binary")
+	cmd.Flags().StringVar(&config.OpsBinaryURL, "ops-binary-url", "", "Download the convex-backend-ops binary from this URL instead of --ops-binary")
+	cmd.Flags().StringVar(&config.OpsBinarySHA256, "ops-binary-sha256", "", "Expected SHA256 (hex) of the --ops-binary-url download")
 	cmd.Flags().StringVar(&config.Output, "output", "", "Output path for self-extracting executable")
-	cmd.Flags().StringVarP(&config.Platform, "platform", "p", "", "Target platform: linux-x64, linux-arm64")
-	cmd.Flags().StringVarP(&config.Compression, "compression", "c", "gzip", "Compression algorithm: gzip, zstd")
-	cmd.Flags().StringVar(&config.OpsVersion, "ops-version", "", "Version of the ops binary (for metadata)")
+	cmd.Flags().StringVarP(&config.Platform, "platform", "p", "", "Target platform: "+strings.Join(platform.SelfHostTargets(), ", "))
+	cmd.Flags().StringVarP(&config.Compression, "compression", "c", "gzip", "Compression algorithm: gzip, zstd, brotli, or auto to pick the smallest")
+	cmd.Flags().StringVar(&config.OpsVersion, "ops-version", "", "Version (semver) of the ops binary (for metadata)")
+	cmd.Flags().StringVar(&config.InstallPrefix, "install-prefix", "", "Install prefix recorded for the installer (default: /usr/local)")
+	cmd.Flags().StringVar(&config.ServiceName, "service-name", "", "Systemd service name recorded for the installer (default: convex-backend)")
+	cmd.Flags().StringVar(&config.HealthCheckPath, "health-check-path", "", "Endpoint the installer polls until the backend is ready (default: /version)")
+	cmd.Flags().DurationVar(&config.HealthCheckTimeout, "health-check-timeout", 0, "How long the installer waits for the backend to become ready, in whole seconds (default: 30s)")
+	cmd.Flags().BoolVar(&config.Reproducible, "reproducible", false, "Use a fixed timestamp (SOURCE_DATE_EPOCH or 1970-01-01) so identical bundles produce identical bytes")
+	cmd.Flags().Int64Var(&config.MaxSize, "max-size", 0, "Fail if the executable is larger than this many bytes (0 for no limit)")
+	cmd.Flags().BoolVar(&config.ParallelCompression, "parallel-compression", false, "Compress gzip bundles on all CPUs (output is standard gzip)")
+	cmd.Flags().BoolVar(&config.SidecarChecksum, "sidecar-checksum", false, "Also write <output>.sha256 with the executable's SHA256 checksum")
+	cmd.Flags().BoolVar(&config.OmitCredentials, "omit-credentials", false, "Leave credentials.json out of the embedded bundle; credentials must then be supplied at install time")
+	cmd.Flags().StringVar(&config.MinOpsVersion, "min-ops-version", "", "Oldest ops binary version (semver) allowed to install the bundle, recorded in the header")
+	cmd.Flags().StringVar(&config.MinBackendVersion, "min-backend-version", "", "Oldest backend version (semver) the bundle runs on, recorded in the header")
+	cmd.Flags().BoolVar(&config.RequireStatic, "require-static", false, "Fail if the bundle's backend binary is dynamically linked instead of only warning")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as a single JSON object instead of human-readable text")
+	addLogLevelFlags(cmd, &config.Verbose, &config.Quiet)
 
-	cmd.SetArgs(args[1:]) // Skip program name (or "selfhost" subcommand)
-	if err := cmd.Execute(); err != nil {
-		return nil, err
+	cmd.AddCommand(newRepackCommand(inv, parseOpts), newExtractDBCommand(inv, parseOpts))
+
+	return cmd
+}
+
+// newRepackCommand builds the selfhost repack subcommand.
+func newRepackCommand(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
+	config := &RepackConfig{}
+	cmd := &cobra.Command{
+		Use:   "repack --input <file> --compression <algorithm> [flags]",
+		Short: "Recompress the bundle in a self-extracting executable",
+		Long: `Recompress the bundle embedded in an existing self-extracting executable
+without rebuilding it. The ops binary, manifest and header metadata are kept;
+the header's compression, size and checksum are updated. Without --output the
+input is rewritten in place.`,
+		Example: `  # Switch an executable to brotli compression
+  convex-bundler selfhost repack --input ./my-backend-selfhost \
+    --compression brotli --output ./my-backend-selfhost-brotli`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.Input == "" {
+				return flagError("input", "", "--input is required")
+			}
+			if config.Compression == "" {
+				return flagError("compression", "", "--compression is required")
+			}
+			if err := validateCompression(config.Compression); err != nil {
+				return err
+			}
+			if !parseOpts.SkipValidation {
+				info, err := os.Stat(config.Input)
+				if os.IsNotExist(err) {
+					return flagError("input", config.Input, "input does not exist: %s", config.Input)
+				}
+				if err != nil {
+					return flagError("input", config.Input, "failed to access input: %v", err)
+				}
+				if info.IsDir() {
+					return flagError("input", config.Input, "input path is a directory: %s", config.Input)
+				}
+			}
+			inv.Command = CommandRepack
+			inv.Repack = config
+			return nil
+		},
 	}
 
+	cmd.Flags().StringVar(&config.Input, "input", "", "Self-extracting executable to recompress (required)")
+	cmd.Flags().StringVar(&config.Output, "output", "", "Write the repacked executable here instead of rewriting --input")
+	cmd.Flags().StringVarP(&config.Compression, "compression", "c", "", "New compression algorithm: gzip, zstd, brotli, or auto to pick the smallest (required)")
+	return cmd
+}
+
+// newExtractDBCommand builds the selfhost extract-db subcommand.
+func newExtractDBCommand(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
+	config := &ExtractDBConfig{}
+	cmd := &cobra.Command{
+		Use:   "extract-db --input <file> --output <db-path>",
+		Short: "Write only convex.db from a self-extracting executable",
+		Long: `Write the convex.db database embedded in a self-extracting executable to
+--output without extracting the rest of the bundle, e.g. to inspect or migrate
+it. The bundle checksum is verified and the result must be a SQLite database.`,
+		Example: `  # Copy the database out of an installer
+  convex-bundler selfhost extract-db --input ./my-backend-selfhost --output ./convex.db`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.Input == "" {
+				return flagError("input", "", "--input is required")
+			}
+			if config.Output == "" {
+				return flagError("output", "", "--output is required")
+			}
+			if !parseOpts.SkipValidation {
+				info, err := os.Stat(config.Input)
+				if os.IsNotExist(err) {
+					return flagError("input", config.Input, "input does not exist: %s", config.Input)
+				}
+				if err != nil {
+					return flagError("input", config.Input, "failed to access input: %v", err)
+				}
+				if info.IsDir() {
+					return flagError("input", config.Input, "input path is a directory: %s", config.Input)
+				}
+				if info, err := os.Stat(config.Output); err == nil && info.IsDir() {
+					return flagError("output", config.Output, "output path is a directory: %s", config.Output)
+				}
+			}
+			inv.Command = CommandExtractDB
+			inv.ExtractDB = config
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&config.Input, "input", "", "Self-extracting executable to read the database from (required)")
+	cmd.Flags().StringVar(&config.Output, "output", "", "Path to write convex.db to (required)")
+	return cmd
+}
+
+// selfHostCompressions are the compression values accepted by selfhost commands
+var selfHostCompressions = map[string]bool{
+	"gzip":   true,
+	"zstd":   true,
+	"brotli": true,
+	"auto":   true,
+}
+
+// validateCompression checks a selfhost compression flag value.
+func validateCompression(compression string) error {
+	if !selfHostCompressions[compression] {
+		return flagError("compression", compression, "invalid compression %q: must be gzip, zstd, brotli or auto", compression)
+	}
+	return nil
+}
+
+// validateSelfHostConfig checks required selfhost flags, their values and,
+// unless skipped, that the bundle directory and ops binary exist.
+func validateSelfHostConfig(config *SelfHostConfig, parseOpts ParseOptions) error {
 	// Validate required flags
 	if config.BundleDir == "" {
-		return nil, errors.New("--bundle is required")
+		return flagError("bundle", "", "--bundle is required")
+	}
+	if config.OpsBinary == "" && config.OpsBinaryURL == "" {
+		return flagError("ops-binary", "", "--ops-binary or --ops-binary-url is required")
+	}
+	if config.OpsBinary != "" && config.OpsBinaryURL != "" {
+		return flagError("ops-binary-url", config.OpsBinaryURL, "--ops-binary and --ops-binary-url cannot be used together")
 	}
-	if config.OpsBinary == "" {
-		return nil, errors.New("--ops-binary is required")
+	if config.OpsBinaryURL != "" {
+		if u, err := url.Parse(config.OpsBinaryURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return flagError("ops-binary-url", config.OpsBinaryURL, "invalid --ops-binary-url %q: must be an http or https URL", config.OpsBinaryURL)
+		}
+	}
+	if config.OpsBinarySHA256 != "" {
+		if config.OpsBinaryURL == "" {
+			return flagError("ops-binary-sha256", config.OpsBinarySHA256, "--ops-binary-sha256 requires --ops-binary-url")
+		}
+		if decoded, err := hex.DecodeString(config.OpsBinarySHA256); err != nil || len(decoded) != sha256.Size {
+			return flagError("ops-binary-sha256", config.OpsBinarySHA256, "invalid --ops-binary-sha256 %q: must be 64 hex characters", config.OpsBinarySHA256)
+		}
 	}
 	if config.Output == "" {
-		return nil, errors.New("--output is required")
+		return flagError("output", "", "--output is required")
 	}
 	if config.Platform == "" {
-		return nil, errors.New("--platform is required")
+		return flagError("platform", "", "--platform is required")
 	}
 
 	// Validate platform value
-	validPlatforms := map[string]bool{
-		"linux-x64":   true,
-		"linux-arm64": true,
-	}
-	if !validPlatforms[config.Platform] {
-		return nil, fmt.Errorf("invalid platform %q: must be linux-x64 or linux-arm64", config.Platform)
+	if !platform.IsSelfHostTarget(config.Platform) {
+		return flagError("platform", config.Platform, "invalid platform %q: must be one of %s", config.Platform, strings.Join(platform.SelfHostTargets(), ", "))
 	}
 
 	// Validate compression value
-	validCompressions := map[string]bool{
-		"gzip": true,
-		"zstd": true,
+	if err := validateCompression(config.Compression); err != nil {
+		return err
+	}
+
+	if config.MaxSize < 0 {
+		return flagError("max-size", strconv.FormatInt(config.MaxSize, 10), "invalid --max-size %d: must not be negative", config.MaxSize)
+	}
+	if config.OpsVersion != "" && !version.Valid(config.OpsVersion) {
+		return flagError("ops-version", config.OpsVersion, "invalid --ops-version %q: must be a semantic version", config.OpsVersion)
+	}
+	if config.MinOpsVersion != "" && !version.Valid(config.MinOpsVersion) {
+		return flagError("min-ops-version", config.MinOpsVersion, "invalid --min-ops-version %q: must be a semantic version", config.MinOpsVersion)
 	}
-	if !validCompressions[config.Compression] {
-		return nil, fmt.Errorf("invalid compression %q: must be gzip or zstd", config.Compression)
+	if config.MinBackendVersion != "" && !version.Valid(config.MinBackendVersion) {
+		return flagError("min-backend-version", config.MinBackendVersion, "invalid --min-backend-version %q: must be a semantic version", config.MinBackendVersion)
 	}
 
 	// Validate that bundle directory and ops binary exist (unless skipped)
 	if !parseOpts.SkipValidation {
-		info, err := os.Stat(config.BundleDir)
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("bundle directory does not exist: %s", config.BundleDir)
+		if err := validateBundleDir(config.BundleDir); err != nil {
+			return flagError("bundle", config.BundleDir, "%v", err)
 		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to access bundle directory: %w", err)
+
+		if config.OpsBinary != "" {
+			info, err := os.Stat(config.OpsBinary)
+			if os.IsNotExist(err) {
+				return flagError("ops-binary", config.OpsBinary, "ops binary does not exist: %s", config.OpsBinary)
+			}
+			if err != nil {
+				return flagError("ops-binary", config.OpsBinary, "failed to access ops binary: %v", err)
+			}
+			if info.IsDir() {
+				return flagError("ops-binary", config.OpsBinary, "ops binary path is a directory: %s", config.OpsBinary)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newInfoCommand builds the info subcommand.
+func newInfoCommand(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "info <bundle-dir> [flags]",
+		Short: "Display information about a bundle directory",
+		Long: `Display the manifest, credentials presence, database size and validity,
+and storage file count of an existing bundle directory. The admin key is
+redacted in the output.`,
+		Example: `  # Inspect a bundle
+  convex-bundler info ./bundle
+
+  # Machine-readable output
+  convex-bundler info ./bundle --json`,
+	}
+
+	return withBundleDirArg(cmd, parseOpts, func(bundleDir, format string) {
+		inv.Command = CommandInfo
+		inv.Info = &InfoConfig{BundleDir: bundleDir, OutputFormat: format}
+	})
+}
+
+// newValidateCommand builds the validate subcommand.
+func newValidateCommand(inv *Invocation, parseOpts ParseOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate <bundle-dir> [flags]",
+		Short: "Check that a bundle directory is complete and well-formed",
+		Long: `Check that a bundle directory contains a valid manifest, an executable
+backend binary, a SQLite database, a storage directory, and credentials.
+Exits non-zero and lists every problem found if the bundle is invalid.`,
+		Example: `  # Validate a bundle before packaging
+  convex-bundler validate ./bundle
+
+  # Machine-readable output for CI
+  convex-bundler validate ./bundle --json
+
+  # Also check the database for corruption
+  convex-bundler validate ./bundle --check-database
+
+  # Decrypt encrypted credentials to check the keys inside
+  convex-bundler validate ./bundle --credentials-passphrase-file ./passphrase`,
+	}
+
+	var checkDatabase bool
+	var passphraseFile string
+	cmd.Flags().BoolVar(&checkDatabase, "check-database", false, "Run a SQLite integrity check on convex.db (slower for large databases)")
+	cmd.Flags().StringVar(&passphraseFile, "credentials-passphrase-file", "", "File containing the passphrase of encrypted credentials.json, to check the keys inside")
+
+	return withBundleDirArg(cmd, parseOpts, func(bundleDir, format string) {
+		inv.Command = CommandValidate
+		inv.Validate = &ValidateConfig{
+			BundleDir:                 bundleDir,
+			OutputFormat:              format,
+			CheckDatabase:             checkDatabase,
+			CredentialsPassphraseFile: passphraseFile,
 		}
-		if !info.IsDir() {
-			return nil, fmt.Errorf("bundle path is not a directory: %s", config.BundleDir)
+	})
+}
+
+// withBundleDirArg configures cmd to take a single bundle directory argument and a
+// --json flag, calling record with the validated values when the command runs.
+func withBundleDirArg(cmd *cobra.Command, parseOpts ParseOptions, record func(bundleDir, format string)) *cobra.Command {
+	var jsonOutput bool
+	cmd.Args = cobra.ExactArgs(1)
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if !parseOpts.SkipValidation {
+			if err := validateBundleDir(args[0]); err != nil {
+				return err
+			}
 		}
+		record(args[0], outputFormat(jsonOutput))
+		return nil
+	}
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result as a single JSON object instead of human-readable text")
+	return cmd
+}
+
+// validateBundleDir checks that dir exists and is a directory.
+func validateBundleDir(dir string) error {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("bundle directory does not exist: %s", dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to access bundle directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("bundle path is not a directory: %s", dir)
+	}
+	return nil
+}
+
+// newKeyCommand builds the key subcommand.
+func newKeyCommand(inv *Invocation) *cobra.Command {
+	config := &KeyConfig{}
+	cmd := &cobra.Command{
+		Use:   "key --instance <name> (--secret <hex> | --secret-file <path>) [flags]",
+		Short: "Issue an admin key for an existing instance",
+		Long: `Issue an additional admin or system key from an instance secret, e.g. the
+instanceSecret in a bundle's credentials.json, without rebuilding the bundle.
+The key is printed to stdout. Prefer --secret-file (or "--secret-file -" to
+read stdin) so the secret does not end up in shell history.`,
+		Example: `  # Issue an admin key from the secret in a bundle
+  jq -r .instanceSecret ./bundle/credentials.json | convex-bundler key --instance my-app --secret-file -
+
+  # Issue a read-only key for member 42
+  convex-bundler key --instance my-app --secret-file ./secret --read-only --member-id 42`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if config.InstanceName == "" {
+				return flagError("instance", "", "--instance is required")
+			}
+			if err := credentials.ValidateInstanceName(config.InstanceName); err != nil {
+				return flagError("instance", config.InstanceName, "invalid --instance: %v", err)
+			}
+			if (config.Secret == "") == (config.SecretFile == "") {
+				return flagError("secret", "", "exactly one of --secret or --secret-file is required")
+			}
+			if config.System && (config.ReadOnly || config.MemberID != 0) {
+				return flagError("system", "true", "--system cannot be combined with --read-only or --member-id")
+			}
+			inv.Command = CommandKey
+			inv.Key = config
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&config.InstanceName, "instance", "", "Name of the Convex instance (required)")
+	cmd.Flags().StringVar(&config.Secret, "secret", "", "Hex-encoded instance secret")
+	cmd.Flags().StringVar(&config.SecretFile, "secret-file", "", "File containing the instance secret, or - to read it from stdin")
+	cmd.Flags().Uint64Var(&config.MemberID, "member-id", 0, "Member ID the admin key is issued for (default: 0, a generic admin key)")
+	cmd.Flags().BoolVar(&config.ReadOnly, "read-only", false, "Issue a key that can only run queries")
+	cmd.Flags().BoolVar(&config.System, "system", false, "Issue a system key instead of an admin key")
+	return cmd
+}
+
+// newVersionCommand builds the version subcommand.
+func newVersionCommand(inv *Invocation) *cobra.Command {
+	return &cobra.Command{
+		Use:   "version",
+		Short: "Print version information",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inv.Command = CommandVersion
+			return nil
+		},
+	}
+}
+
+// NewCompletionCommand returns a hidden command that writes a shell completion
+// script for root to the command's output stream.
+func NewCompletionCommand(root *cobra.Command) *cobra.Command {
+	return &cobra.Command{
+		Use:       "completion [bash|zsh|fish|powershell]",
+		Short:     "Generate a shell completion script",
+		Hidden:    true,
+		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out := cmd.OutOrStdout()
+			switch args[0] {
+			case "bash":
+				return root.GenBashCompletion(out)
+			case "zsh":
+				return root.GenZshCompletion(out)
+			case "fish":
+				return root.GenFishCompletion(out, true)
+			case "powershell":
+				return root.GenPowerShellCompletionWithDesc(out)
+			}
+			return fmt.Errorf("unsupported shell %q", args[0])
+		},
+	}
+}
+
+// WriteCompletion writes the completion script for the given shell to w.
+func WriteCompletion(w io.Writer, shell string) error {
+	_, err := ParseCommand([]string{"convex-bundler", "completion", shell}, ParseOptions{Output: w})
+	return err
+}
+
+// Parse parses command-line arguments for the main bundle command and returns a Config.
+//
+// Flag values are resolved with the following precedence (highest first):
+//  1. Explicit command-line flags
+//  2. CONVEX_BUNDLER_* environment variables (see EnvPrefix)
+//  3. Flag defaults
+func Parse(args []string, opts ...ParseOptions) (*Config, error) {
+	inv, err := ParseCommand(args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Command != CommandBundle {
+		return nil, fmt.Errorf("expected bundle command, got %s", inv.Command)
+	}
+	return inv.Bundle, nil
+}
+
+// ParseSelfHost parses command-line arguments for the selfhost subcommand.
+// args must start at the "selfhost" subcommand.
+func ParseSelfHost(args []string, opts ...ParseOptions) (*SelfHostConfig, error) {
+	inv, err := parseSubcommand(CommandSelfHost, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return inv.SelfHost, nil
+}
+
+// ParseRepack parses command-line arguments for the selfhost repack subcommand.
+// args must start at the "repack" subcommand.
+func ParseRepack(args []string, opts ...ParseOptions) (*RepackConfig, error) {
+	fullArgs := []string{"convex-bundler", string(CommandSelfHost), string(CommandRepack)}
+	if len(args) > 1 {
+		fullArgs = append(fullArgs, args[1:]...)
+	}
+
+	inv, err := ParseCommand(fullArgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Command != CommandRepack {
+		return nil, fmt.Errorf("expected %s command, got %s", CommandRepack, inv.Command)
+	}
+	return inv.Repack, nil
+}
+
+// ParseExtractDB parses command-line arguments for the selfhost extract-db
+// subcommand. args must start at the "extract-db" subcommand.
+func ParseExtractDB(args []string, opts ...ParseOptions) (*ExtractDBConfig, error) {
+	fullArgs := []string{"convex-bundler", string(CommandSelfHost), string(CommandExtractDB)}
+	if len(args) > 1 {
+		fullArgs = append(fullArgs, args[1:]...)
+	}
+
+	inv, err := ParseCommand(fullArgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Command != CommandExtractDB {
+		return nil, fmt.Errorf("expected %s command, got %s", CommandExtractDB, inv.Command)
+	}
+	return inv.ExtractDB, nil
+}
+
+// ParseInfo parses command-line arguments for the info subcommand.
+// args must start at the "info" subcommand.
+func ParseInfo(args []string, opts ...ParseOptions) (*InfoConfig, error) {
+	inv, err := parseSubcommand(CommandInfo, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return inv.Info, nil
+}
+
+// ParseValidate parses command-line arguments for the validate subcommand.
+// args must start at the "validate" subcommand.
+func ParseValidate(args []string, opts ...ParseOptions) (*ValidateConfig, error) {
+	inv, err := parseSubcommand(CommandValidate, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return inv.Validate, nil
+}
+
+// ParseKey parses command-line arguments for the key subcommand.
+// args must start at the "key" subcommand.
+func ParseKey(args []string, opts ...ParseOptions) (*KeyConfig, error) {
+	inv, err := parseSubcommand(CommandKey, args, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return inv.Key, nil
+}
+
+// parseSubcommand parses args for the named subcommand through the full command
+// tree. args[0] is replaced by the subcommand name.
+func parseSubcommand(name CommandName, args []string, opts ...ParseOptions) (*Invocation, error) {
+	fullArgs := []string{"convex-bundler", string(name)}
+	if len(args) > 1 {
+		fullArgs = append(fullArgs, args[1:]...)
+	}
 
-		info, err = os.Stat(config.OpsBinary)
-		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("ops binary does not exist: %s", config.OpsBinary)
+	inv, err := ParseCommand(fullArgs, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Command != name {
+		return nil, fmt.Errorf("expected %s command, got %s", name, inv.Command)
+	}
+	return inv, nil
+}
+
+// outputFormat maps the --json flag to an output format
+func outputFormat(jsonOutput bool) string {
+	if jsonOutput {
+		return OutputFormatJSON
+	}
+	return OutputFormatText
+}
+
+// envExcludedFlags are flags that never take a value from the environment
+var envExcludedFlags = map[string]bool{
+	"help":    true,
+	"version": true,
+}
+
+// applyEnvFallbacks sets every flag that was not given on the command line from
+// its corresponding environment variable, if present and non-empty.
+func applyEnvFallbacks(flags *pflag.FlagSet, prefix string) error {
+	var firstErr error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if firstErr != nil || f.Changed || envExcludedFlags[f.Name] {
+			return
 		}
-		if err != nil {
-			return nil, fmt.Errorf("failed to access ops binary: %w", err)
+		envName := EnvVarName(prefix, f.Name)
+		value, ok := os.LookupEnv(envName)
+		if !ok || value == "" {
+			return
 		}
-		if info.IsDir() {
-			return nil, fmt.Errorf("ops binary path is a directory: %s", config.OpsBinary)
+		if err := flags.Set(f.Name, value); err != nil {
+			firstErr = fmt.Errorf("invalid value for %s: %w", envName, err)
 		}
-	}
+	})
+	return firstErr
+}
 
-	return config, nil
+// EnvVarName returns the environment variable name for a flag with the given prefix.
+func EnvVarName(prefix, flagName string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
 }
 
 // IsSelfHostCommand checks if the args indicate the selfhost subcommand
@@ -1,10 +1,14 @@
 package cli
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -25,6 +29,8 @@ func TestParse_BasicFlags(t *testing.T) {
 	assert.Equal(t, "/tmp/backend", config.BackendBinary)
 	assert.Equal(t, "Convex Backend", config.Name) // default
 	assert.Equal(t, "linux-x64", config.Platform)  // default
+	assert.False(t, config.DryRun)                 // default
+	assert.Equal(t, OutputFormatText, config.OutputFormat)
 }
 
 func TestParse_AllFlags(t *testing.T) {
@@ -38,6 +44,8 @@ func TestParse_AllFlags(t *testing.T) {
 		"--bundle-version", "1.2.3",
 		"--platform", "linux-arm64",
 		"--docker-image", "custom:latest",
+		"--dry-run",
+		"--json",
 	}
 
 	config, err := Parse(args, ParseOptions{SkipValidation: true})
@@ -50,6 +58,26 @@ func TestParse_AllFlags(t *testing.T) {
 	assert.Equal(t, "1.2.3", config.Version)
 	assert.Equal(t, "linux-arm64", config.Platform)
 	assert.Equal(t, "custom:latest", config.DockerImage)
+	assert.True(t, config.DryRun)
+	assert.Equal(t, OutputFormatJSON, config.OutputFormat)
+}
+
+func TestParse_LogLevelFlags(t *testing.T) {
+	base := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(append(base, "--verbose"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.Verbose)
+	assert.False(t, config.Quiet)
+
+	config, err = Parse(append(base, "-q"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.Verbose)
+	assert.True(t, config.Quiet)
+
+	_, err = Parse(append(base, "--verbose", "--quiet"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "verbose")
 }
 
 func TestParse_ShortFlags(t *testing.T) {
@@ -147,19 +175,106 @@ func TestParse_Validation(t *testing.T) {
 }
 
 func TestParse_InvalidPlatform(t *testing.T) {
-	// Platform validation is currently lenient (no strict validation)
-	// This test documents that behavior
 	args := []string{
 		"convex-bundler",
 		"--app", "/tmp/app",
 		"--output", "/tmp/out",
 		"--backend-binary", "/tmp/backend",
-		"--platform", "windows-x64", // Invalid but not validated
+		"--platform", "solaris-sparc",
+	}
+
+	_, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid platform")
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "platform", validationErr.Flag)
+	assert.Equal(t, "solaris-sparc", validationErr.Value)
+}
+
+// TestParse_PlatformRegistry tests that the bundle command accepts every registered platform
+// and lists them in its help
+func TestParse_PlatformRegistry(t *testing.T) {
+	for _, p := range platform.All() {
+		args := []string{"convex-bundler", "--app", "/tmp/app", "--output", "/tmp/out", "--backend-binary", "/tmp/backend", "--platform", p.Name}
+		config, err := Parse(args, ParseOptions{SkipValidation: true})
+		require.NoError(t, err, p.Name)
+		assert.Equal(t, p.Name, config.Platform)
+	}
+
+	usage := newCommandTree(&Invocation{}, ParseOptions{}).Flags().Lookup("platform").Usage
+	for _, name := range platform.Names() {
+		assert.Contains(t, usage, name)
+	}
+}
+
+// TestParse_EnvFallbacks tests that environment variables fill in unset flags
+func TestParse_EnvFallbacks(t *testing.T) {
+	t.Setenv("CONVEX_BUNDLER_APP", "/env/app1,/env/app2")
+	t.Setenv("CONVEX_BUNDLER_OUTPUT", "/env/out")
+	t.Setenv("CONVEX_BUNDLER_BACKEND_BINARY", "/env/backend")
+	t.Setenv("CONVEX_BUNDLER_PLATFORM", "linux-arm64")
+	t.Setenv("CONVEX_BUNDLER_BUNDLE_VERSION", "3.2.1")
+	t.Setenv("CONVEX_BUNDLER_DOCKER_IMAGE", "env-image:latest")
+
+	config, err := Parse([]string{"convex-bundler"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/env/app1", "/env/app2"}, config.Apps)
+	assert.Equal(t, "/env/out", config.Output)
+	assert.Equal(t, "/env/backend", config.BackendBinary)
+	assert.Equal(t, "linux-arm64", config.Platform)
+	assert.Equal(t, "3.2.1", config.Version)
+	assert.Equal(t, "env-image:latest", config.DockerImage)
+	assert.Equal(t, "Convex Backend", config.Name) // default, no env set
+}
+
+// TestParse_FlagsOverrideEnv tests that explicit flags take precedence over environment variables
+func TestParse_FlagsOverrideEnv(t *testing.T) {
+	t.Setenv("CONVEX_BUNDLER_APP", "/env/app")
+	t.Setenv("CONVEX_BUNDLER_OUTPUT", "/env/out")
+	t.Setenv("CONVEX_BUNDLER_BACKEND_BINARY", "/env/backend")
+	t.Setenv("CONVEX_BUNDLER_PLATFORM", "linux-arm64")
+	t.Setenv("CONVEX_BUNDLER_NAME", "Env Name")
+
+	args := []string{
+		"convex-bundler",
+		"--app", "/flag/app",
+		"--output", "/flag/out",
+		"--platform", "linux-x64",
+	}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/flag/app"}, config.Apps)
+	assert.Equal(t, "/flag/out", config.Output)
+	assert.Equal(t, "linux-x64", config.Platform)
+	assert.Equal(t, "/env/backend", config.BackendBinary) // flag absent, env used
+	assert.Equal(t, "Env Name", config.Name)              // env wins over default
+}
+
+// TestParse_EmptyEnvIgnored tests that empty environment variables do not override defaults
+func TestParse_EmptyEnvIgnored(t *testing.T) {
+	t.Setenv("CONVEX_BUNDLER_PLATFORM", "")
+
+	args := []string{
+		"convex-bundler",
+		"--app", "/tmp/app",
+		"--output", "/tmp/out",
+		"--backend-binary", "/tmp/backend",
 	}
 
 	config, err := Parse(args, ParseOptions{SkipValidation: true})
 	require.NoError(t, err)
-	assert.Equal(t, "windows-x64", config.Platform)
+	assert.Equal(t, "linux-x64", config.Platform)
+}
+
+// TestEnvVarName tests the flag to environment variable name mapping
+func TestEnvVarName(t *testing.T) {
+	assert.Equal(t, "CONVEX_BUNDLER_BACKEND_BINARY", EnvVarName(EnvPrefix, "backend-binary"))
+	assert.Equal(t, "CONVEX_BUNDLER_OUTPUT", EnvVarName(EnvPrefix, "output"))
 }
 
 // TestParseSelfHost_AllFlags tests that all selfhost flags are parsed correctly
@@ -172,6 +287,7 @@ func TestParseSelfHost_AllFlags(t *testing.T) {
 		"--platform", "linux-arm64",
 		"--compression", "zstd",
 		"--ops-version", "1.5.0",
+		"--json",
 	}
 
 	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
@@ -183,9 +299,28 @@ func TestParseSelfHost_AllFlags(t *testing.T) {
 	assert.Equal(t, "linux-arm64", config.Platform)
 	assert.Equal(t, "zstd", config.Compression)
 	assert.Equal(t, "1.5.0", config.OpsVersion)
+	assert.Equal(t, OutputFormatJSON, config.OutputFormat)
 }
 
 // TestParseSelfHost_ShortFlags tests short flag variants
+func TestParseSelfHost_LogLevelFlags(t *testing.T) {
+	args := []string{
+		"selfhost",
+		"--bundle", "/tmp/bundle",
+		"--ops-binary", "/tmp/ops",
+		"--output", "/tmp/out",
+		"--platform", "linux-x64",
+		"--verbose",
+	}
+
+	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.Verbose)
+
+	_, err = ParseSelfHost(append(args, "--quiet"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+}
+
 func TestParseSelfHost_ShortFlags(t *testing.T) {
 	args := []string{
 		"selfhost",
@@ -221,7 +356,7 @@ func TestParseSelfHost_RequiredFlags(t *testing.T) {
 		{
 			name:    "missing --ops-binary",
 			args:    []string{"selfhost", "--bundle", "/bundle", "--output", "/out", "--platform", "linux-x64"},
-			wantErr: "--ops-binary is required",
+			wantErr: "--ops-binary or --ops-binary-url is required",
 		},
 		{
 			name:    "missing --output",
@@ -257,6 +392,25 @@ func TestParseSelfHost_InvalidPlatform(t *testing.T) {
 	_, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid platform")
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "platform", validationErr.Flag)
+	assert.Equal(t, "windows-x64", validationErr.Value)
+	assert.Equal(t, err.Error(), validationErr.Reason)
+}
+
+// TestParseSelfHost_PlatformRegistry tests that selfhost accepts exactly the registry's self-host targets
+func TestParseSelfHost_PlatformRegistry(t *testing.T) {
+	for _, p := range platform.All() {
+		args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", p.Name}
+		_, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+		if p.SelfHost {
+			assert.NoError(t, err, p.Name)
+		} else {
+			assert.Error(t, err, p.Name)
+		}
+	}
 }
 
 // TestParseSelfHost_InvalidCompression tests validation of compression value
@@ -273,6 +427,404 @@ func TestParseSelfHost_InvalidCompression(t *testing.T) {
 	_, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid compression")
+
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "compression", validationErr.Flag)
+	assert.Equal(t, "lz4", validationErr.Value)
+
+	// Missing flags are reported with an empty value
+	_, err = Parse([]string{"convex-bundler", "--app", "/tmp/app", "--backend-binary", "/tmp/backend"}, ParseOptions{SkipValidation: true})
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "output", validationErr.Flag)
+	assert.Empty(t, validationErr.Value)
+}
+
+// TestParseSelfHost_BrotliCompression tests that brotli is an accepted compression
+func TestParseSelfHost_BrotliCompression(t *testing.T) {
+	args := []string{
+		"selfhost",
+		"--bundle", "/bundle",
+		"--ops-binary", "/ops",
+		"--output", "/out",
+		"--platform", "linux-x64",
+		"--compression", "brotli",
+	}
+
+	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "brotli", config.Compression)
+
+	args[len(args)-1] = "auto"
+	config, err = ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "auto", config.Compression)
+}
+
+// TestParseSelfHost_SidecarChecksum tests the --sidecar-checksum flag
+func TestParseSelfHost_SidecarChecksum(t *testing.T) {
+	args := []string{
+		"selfhost",
+		"--bundle", "/bundle",
+		"--ops-binary", "/ops",
+		"--output", "/out",
+		"--platform", "linux-x64",
+		"--sidecar-checksum",
+	}
+
+	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.SidecarChecksum)
+}
+
+// TestParseSelfHost_OmitCredentials tests the --omit-credentials flag
+func TestParseSelfHost_OmitCredentials(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64"}
+
+	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.OmitCredentials)
+
+	config, err = ParseSelfHost(append(args, "--omit-credentials"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.OmitCredentials)
+}
+
+// TestParseSelfHost_MinVersions tests the --min-ops-version and --min-backend-version flags
+func TestParseSelfHost_MinVersions(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64"}
+
+	config, err := ParseSelfHost(append(args, "--min-ops-version", "1.2.0", "--min-backend-version", "v0.9.0-rc.1"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "1.2.0", config.MinOpsVersion)
+	assert.Equal(t, "v0.9.0-rc.1", config.MinBackendVersion)
+
+	_, err = ParseSelfHost(append(args, "--min-ops-version", "1.2"), ParseOptions{SkipValidation: true})
+	assert.ErrorContains(t, err, "invalid --min-ops-version")
+
+	_, err = ParseSelfHost(append(args, "--min-backend-version", "latest"), ParseOptions{SkipValidation: true})
+	assert.ErrorContains(t, err, "invalid --min-backend-version")
+}
+
+// TestParseSelfHost_OpsVersion tests that --ops-version must be semver when given
+func TestParseSelfHost_OpsVersion(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64"}
+
+	config, err := ParseSelfHost(append(args, "--ops-version", "v1.2.0"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.0", config.OpsVersion)
+
+	config, err = ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Empty(t, config.OpsVersion)
+
+	_, err = ParseSelfHost(append(args, "--ops-version", "latest"), ParseOptions{SkipValidation: true})
+	assert.ErrorContains(t, err, "invalid --ops-version")
+}
+
+// TestParseSelfHost_OpsBinaryURL tests the --ops-binary-url and --ops-binary-sha256 flags
+func TestParseSelfHost_OpsBinaryURL(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--output", "/out", "--platform", "linux-x64"}
+	sha := strings.Repeat("ab", 32)
+
+	config, err := ParseSelfHost(append(args, "--ops-binary-url", "https://example.com/ops", "--ops-binary-sha256", sha), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Empty(t, config.OpsBinary)
+	assert.Equal(t, "https://example.com/ops", config.OpsBinaryURL)
+	assert.Equal(t, sha, config.OpsBinarySHA256)
+
+	tests := []struct {
+		name    string
+		extra   []string
+		wantErr string
+	}{
+		{name: "both sources", extra: []string{"--ops-binary", "/ops", "--ops-binary-url", "https://example.com/ops"}, wantErr: "cannot be used together"},
+		{name: "not http", extra: []string{"--ops-binary-url", "file:///ops"}, wantErr: "invalid --ops-binary-url"},
+		{name: "no host", extra: []string{"--ops-binary-url", "https://"}, wantErr: "invalid --ops-binary-url"},
+		{name: "short checksum", extra: []string{"--ops-binary-url", "https://example.com/ops", "--ops-binary-sha256", "abc"}, wantErr: "invalid --ops-binary-sha256"},
+		{name: "checksum without url", extra: []string{"--ops-binary", "/ops", "--ops-binary-sha256", sha}, wantErr: "--ops-binary-sha256 requires --ops-binary-url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSelfHost(append(append([]string{}, args...), tt.extra...), ParseOptions{SkipValidation: true})
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	// The ops binary is not checked on disk when it is downloaded
+	_, err = ParseSelfHost([]string{"selfhost", "--bundle", t.TempDir(), "--ops-binary-url", "https://example.com/ops", "--output", "/out", "--platform", "linux-x64"})
+	require.NoError(t, err)
+}
+
+// TestParseSelfHost_ParallelCompression tests the --parallel-compression flag
+func TestParseSelfHost_ParallelCompression(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64"}
+
+	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.ParallelCompression)
+
+	config, err = ParseSelfHost(append(args, "--parallel-compression"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.ParallelCompression)
+}
+
+// TestParseSelfHost_MaxSize tests the --max-size flag
+func TestParseSelfHost_MaxSize(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64"}
+
+	config, err := ParseSelfHost(append(args, "--max-size", "52428800"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(52428800), config.MaxSize)
+
+	_, err = ParseSelfHost(append(args, "--max-size", "-1"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "max-size")
+}
+
+// TestParseSelfHost_HealthCheck tests the health check flags
+func TestParseSelfHost_HealthCheck(t *testing.T) {
+	args := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64"}
+
+	config, err := ParseSelfHost(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Empty(t, config.HealthCheckPath)
+	assert.Zero(t, config.HealthCheckTimeout)
+
+	config, err = ParseSelfHost(append(args, "--health-check-path", "/healthz", "--health-check-timeout", "2m"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/healthz", config.HealthCheckPath)
+	assert.Equal(t, 2*time.Minute, config.HealthCheckTimeout)
+}
+
+// TestParse_Reproducible tests the --reproducible flag on both commands
+func TestParse_Reproducible(t *testing.T) {
+	config, err := Parse([]string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend", "--reproducible"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.Reproducible)
+
+	selfHostConfig, err := ParseSelfHost([]string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64", "--reproducible"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, selfHostConfig.Reproducible)
+}
+
+// TestParse_AbsoluteAppPaths tests the --absolute-app-paths flag
+func TestParse_AbsoluteAppPaths(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.AbsoluteApps)
+
+	config, err = Parse(append(args, "--absolute-app-paths"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.AbsoluteApps)
+}
+
+// TestParse_Labels tests the repeatable --label flag
+func TestParse_Labels(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Nil(t, config.Labels)
+
+	config, err = Parse(append(args, "--label", "git.branch=main", "--label", "build.id=1,2", "--label", "environment=prod"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"git.branch":  "main",
+		"build.id":    "1,2",
+		"environment": "prod",
+	}, config.Labels)
+}
+
+// TestParse_LabelsInvalid tests that duplicate and malformed labels are rejected
+func TestParse_LabelsInvalid(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	_, err := Parse(append(args, "--label", "env=prod", "--label", "env=dev"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `duplicate label key "env"`)
+
+	_, err = Parse(append(args, "--label", "environment"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected key=value")
+
+	_, err = Parse(append(args, "--label", "bad key=x"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid label key")
+}
+
+// TestParse_InstanceName tests that the instance name embedded in the admin
+// key defaults to the slugified --name and is validated
+func TestParse_InstanceName(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "Convex Backend", config.Name)
+	assert.Equal(t, "convex-backend", config.InstanceName)
+
+	config, err = Parse(append(args, "--name", "my|backend"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "my|backend", config.Name)
+	assert.Equal(t, "my-backend", config.InstanceName)
+
+	config, err = Parse(append(args, "--name", "My Backend", "--instance-name", "prod_1"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "My Backend", config.Name)
+	assert.Equal(t, "prod_1", config.InstanceName)
+
+	_, err = Parse(append(args, "--instance-name", "my|backend"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --instance-name")
+
+	_, err = Parse(append(args, "--name", "!!!"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--instance-name is required")
+
+	_, err = Parse(append(args, "--name", ""), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--name is required")
+}
+
+// TestParse_EnvVars tests the repeatable --env flag
+func TestParse_EnvVars(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Nil(t, config.EnvVars)
+
+	config, err = Parse(append(args, "--env", "CONVEX_SITE_URL=https://example.com", "--env", "GREETING=hello world"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"CONVEX_SITE_URL": "https://example.com", "GREETING": "hello world"}, config.EnvVars)
+
+	_, err = Parse(append(args, "--env", "BAD-NAME=x"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid --env")
+}
+
+// TestParse_PrebuiltDatabase tests the --database and --storage flags
+func TestParse_PrebuiltDatabase(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(append(args, "--database", "/tmp/convex.db", "--storage", "/tmp/storage"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/convex.db", config.Database)
+	assert.Equal(t, "/tmp/storage", config.Storage)
+
+	_, err = Parse(append(args, "--storage", "/tmp/storage"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--storage requires --database")
+}
+
+// TestParse_KeepTemp tests the --keep-temp flag
+func TestParse_KeepTemp(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.KeepTemp)
+
+	config, err = Parse(append(args, "--keep-temp"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.KeepTemp)
+}
+
+// TestParse_Checksums tests the --checksums flag
+func TestParse_Checksums(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.Checksums)
+
+	config, err = Parse(append(args, "--checksums"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.Checksums)
+}
+
+// TestParse_RequireStatic tests the --require-static flag on bundle and selfhost
+func TestParse_RequireStatic(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.RequireStatic)
+
+	config, err = Parse(append(args, "--require-static"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.RequireStatic)
+
+	selfHostArgs := []string{"selfhost", "--bundle", "/bundle", "--ops-binary", "/ops", "--output", "/out", "--platform", "linux-x64", "--require-static"}
+	selfHostConfig, err := ParseSelfHost(selfHostArgs, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, selfHostConfig.RequireStatic)
+}
+
+// TestParse_TimeoutAndConcurrency tests the --timeout and --concurrency flags
+func TestParse_TimeoutAndConcurrency(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Zero(t, config.Timeout)
+	assert.Equal(t, 1, config.Concurrency)
+
+	config, err = Parse(append(args, "--timeout", "10m", "--concurrency", "8"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, config.Timeout)
+	assert.Equal(t, 8, config.Concurrency)
+
+	_, err = Parse(append(args, "--timeout", "-1s"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "--timeout must not be negative")
+
+	_, err = Parse(append(args, "--concurrency", "0"), ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, "concurrency", validationErr.Flag)
+}
+
+func TestParse_EncryptCredentials(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(append(args, "--encrypt-credentials", "--credentials-passphrase-file", "/tmp/passphrase"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.EncryptCredentials)
+	assert.Equal(t, "/tmp/passphrase", config.CredentialsPassphraseFile)
+
+	tests := []struct {
+		name string
+		args []string
+		flag string
+	}{
+		{name: "missing passphrase file", args: []string{"--encrypt-credentials"}, flag: "credentials-passphrase-file"},
+		{name: "passphrase file without encryption", args: []string{"--credentials-passphrase-file", "/tmp/passphrase"}, flag: "encrypt-credentials"},
+		{name: "with env file", args: []string{"--encrypt-credentials", "--credentials-passphrase-file", "/tmp/passphrase", "--env", "A=b"}, flag: "env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(append(append([]string{}, args...), tt.args...), ParseOptions{SkipValidation: true})
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.flag, validationErr.Flag)
+		})
+	}
+}
+
+func TestParse_IncludeAppSources(t *testing.T) {
+	args := []string{"convex-bundler", "--app", "/tmp/app", "-o", "/tmp/out", "--backend-binary", "/tmp/backend"}
+
+	config, err := Parse(args, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.False(t, config.IncludeAppSources)
+
+	config, err = Parse(append(args, "--include-app-sources"), ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.IncludeAppSources)
 }
 
 // TestParseSelfHost_Defaults tests default values
@@ -290,6 +842,7 @@ func TestParseSelfHost_Defaults(t *testing.T) {
 
 	assert.Equal(t, "gzip", config.Compression, "default compression should be gzip")
 	assert.Empty(t, config.OpsVersion, "ops version should be empty by default")
+	assert.Equal(t, OutputFormatText, config.OutputFormat, "output format should be text by default")
 }
 
 // TestParseSelfHost_Validation tests file existence validation
@@ -373,6 +926,82 @@ func TestParseSelfHost_Validation(t *testing.T) {
 	})
 }
 
+// TestParseRepack tests parsing of the selfhost repack subcommand
+func TestParseRepack(t *testing.T) {
+	config, err := ParseRepack([]string{"repack", "--input", "/in", "--compression", "brotli", "--output", "/out"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, &RepackConfig{Input: "/in", Output: "/out", Compression: "brotli"}, config)
+
+	inv, err := ParseCommand([]string{"convex-bundler", "selfhost", "repack", "--input", "/in", "-c", "auto"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, CommandRepack, inv.Command)
+	require.NotNil(t, inv.Repack)
+	assert.Empty(t, inv.Repack.Output)
+	assert.Nil(t, inv.SelfHost)
+}
+
+// TestParseRepack_Validation tests argument validation for the selfhost repack subcommand
+func TestParseRepack_Validation(t *testing.T) {
+	tmpDir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "missing input", args: []string{"repack", "--compression", "gzip"}, want: "--input is required"},
+		{name: "missing compression", args: []string{"repack", "--input", "/in"}, want: "--compression is required"},
+		{name: "invalid compression", args: []string{"repack", "--input", "/in", "--compression", "lzma"}, want: "invalid compression"},
+		{name: "input does not exist", args: []string{"repack", "--input", filepath.Join(tmpDir, "nonexistent"), "--compression", "gzip"}, want: "input does not exist"},
+		{name: "input is a directory", args: []string{"repack", "--input", tmpDir, "--compression", "gzip"}, want: "input path is a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRepack(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+// TestParseExtractDB tests parsing of the selfhost extract-db subcommand
+func TestParseExtractDB(t *testing.T) {
+	config, err := ParseExtractDB([]string{"extract-db", "--input", "/in", "--output", "/out.db"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, &ExtractDBConfig{Input: "/in", Output: "/out.db"}, config)
+
+	inv, err := ParseCommand([]string{"convex-bundler", "selfhost", "extract-db", "--input", "/in", "--output", "/out.db"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, CommandExtractDB, inv.Command)
+	require.NotNil(t, inv.ExtractDB)
+	assert.Nil(t, inv.SelfHost)
+}
+
+// TestParseExtractDB_Validation tests argument validation for the selfhost extract-db subcommand
+func TestParseExtractDB_Validation(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, os.WriteFile(input, []byte("binary"), 0755))
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "missing input", args: []string{"extract-db", "--output", "/out.db"}, want: "--input is required"},
+		{name: "missing output", args: []string{"extract-db", "--input", input}, want: "--output is required"},
+		{name: "input does not exist", args: []string{"extract-db", "--input", filepath.Join(tmpDir, "nonexistent"), "--output", "/out.db"}, want: "input does not exist"},
+		{name: "input is a directory", args: []string{"extract-db", "--input", tmpDir, "--output", "/out.db"}, want: "input path is a directory"},
+		{name: "output is a directory", args: []string{"extract-db", "--input", input, "--output", tmpDir}, want: "output path is a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseExtractDB(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
 // TestIsSelfHostCommand tests the selfhost command detection
 func TestIsSelfHostCommand(t *testing.T) {
 	tests := []struct {
@@ -414,3 +1043,191 @@ func TestIsSelfHostCommand(t *testing.T) {
 		})
 	}
 }
+
+// TestParseInfo tests parsing of the info subcommand
+func TestParseInfo(t *testing.T) {
+	config, err := ParseInfo([]string{"info", "/path/to/bundle"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/path/to/bundle", config.BundleDir)
+	assert.Equal(t, OutputFormatText, config.OutputFormat)
+
+	config, err = ParseInfo([]string{"info", "/path/to/bundle", "--json"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, OutputFormatJSON, config.OutputFormat)
+}
+
+// TestParseInfo_Validation tests argument and directory validation for the info subcommand
+func TestParseInfo_Validation(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "file")
+	require.NoError(t, os.WriteFile(filePath, []byte("x"), 0644))
+
+	_, err := ParseInfo([]string{"info"})
+	require.Error(t, err)
+
+	_, err = ParseInfo([]string{"info", tmpDir})
+	require.NoError(t, err)
+
+	_, err = ParseInfo([]string{"info", filepath.Join(tmpDir, "nonexistent")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle directory does not exist")
+
+	_, err = ParseInfo([]string{"info", filePath})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle path is not a directory")
+}
+
+// TestParseValidate tests parsing of the validate subcommand
+func TestParseValidate(t *testing.T) {
+	config, err := ParseValidate([]string{"validate", "/path/to/bundle", "--json"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/path/to/bundle", config.BundleDir)
+	assert.Equal(t, OutputFormatJSON, config.OutputFormat)
+	assert.False(t, config.CheckDatabase)
+
+	config, err = ParseValidate([]string{"validate", "/path/to/bundle", "--check-database"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.True(t, config.CheckDatabase)
+
+	config, err = ParseValidate([]string{"validate", "/path/to/bundle", "--credentials-passphrase-file", "/tmp/passphrase"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/passphrase", config.CredentialsPassphraseFile)
+
+	_, err = ParseValidate([]string{"validate"}, ParseOptions{SkipValidation: true})
+	require.Error(t, err)
+
+	_, err = ParseValidate([]string{"validate", filepath.Join(t.TempDir(), "nonexistent")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle directory does not exist")
+}
+
+func TestParseKey(t *testing.T) {
+	config, err := ParseKey([]string{"key", "--instance", "my-app", "--secret", "abcd", "--member-id", "42", "--read-only"})
+	require.NoError(t, err)
+	assert.Equal(t, &KeyConfig{Secret: "abcd", InstanceName: "my-app", MemberID: 42, ReadOnly: true}, config)
+
+	config, err = ParseKey([]string{"key", "--instance", "my-app", "--secret-file", "-", "--system"})
+	require.NoError(t, err)
+	assert.Equal(t, "-", config.SecretFile)
+	assert.True(t, config.System)
+}
+
+func TestParseKey_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "missing instance", args: []string{"key", "--secret", "abcd"}, want: "--instance is required"},
+		{name: "missing secret", args: []string{"key", "--instance", "my-app"}, want: "exactly one of --secret or --secret-file"},
+		{name: "both secrets", args: []string{"key", "--instance", "my-app", "--secret", "abcd", "--secret-file", "-"}, want: "exactly one of --secret or --secret-file"},
+		{name: "read-only system key", args: []string{"key", "--instance", "my-app", "--secret", "abcd", "--system", "--read-only"}, want: "--system cannot be combined"},
+		{name: "instance with pipe", args: []string{"key", "--instance", "my|app", "--secret", "abcd"}, want: "invalid --instance"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseKey(tt.args)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+// TestWriteCompletion tests shell completion generation for the root command
+func TestWriteCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCompletion(&buf, "bash"))
+	assert.NotEmpty(t, buf.String())
+	assert.Contains(t, buf.String(), "--app")
+
+	for _, shell := range []string{"zsh", "fish", "powershell"} {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WriteCompletion(&buf, shell))
+			assert.NotEmpty(t, buf.String())
+		})
+	}
+}
+
+// TestWriteCompletion_InvalidShell tests that unknown shells are rejected
+func TestWriteCompletion_InvalidShell(t *testing.T) {
+	var buf bytes.Buffer
+	require.Error(t, WriteCompletion(&buf, "tcsh"))
+}
+
+// TestCompletionCommand_Hidden tests that the completion command is hidden from help
+func TestCompletionCommand_Hidden(t *testing.T) {
+	root := NewRootCommand()
+	assert.True(t, NewCompletionCommand(root).Hidden)
+}
+
+// TestParseCommand_Dispatch tests that ParseCommand selects the right command and config
+func TestParseCommand_Dispatch(t *testing.T) {
+	inv, err := ParseCommand([]string{"convex-bundler", "--app", "/app", "-o", "/out", "--backend-binary", "/bin"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, CommandBundle, inv.Command)
+	require.NotNil(t, inv.Bundle)
+	assert.Equal(t, "/out", inv.Bundle.Output)
+	assert.Nil(t, inv.SelfHost)
+
+	inv, err = ParseCommand([]string{"convex-bundler", "selfhost", "-b", "/bundle", "-o", "/ops", "--output", "/out", "-p", "linux-x64"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, CommandSelfHost, inv.Command)
+	require.NotNil(t, inv.SelfHost)
+	assert.Equal(t, "/ops", inv.SelfHost.OpsBinary)
+	assert.Nil(t, inv.Bundle)
+
+	inv, err = ParseCommand([]string{"convex-bundler", "info", "/bundle"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, CommandInfo, inv.Command)
+
+	inv, err = ParseCommand([]string{"convex-bundler", "validate", "/bundle"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, CommandValidate, inv.Command)
+
+	for _, args := range [][]string{{"convex-bundler", "version"}, {"convex-bundler", "--version"}, {"convex-bundler", "-v"}} {
+		inv, err = ParseCommand(args)
+		require.NoError(t, err)
+		assert.Equal(t, CommandVersion, inv.Command, "args: %v", args)
+	}
+
+	_, err = ParseCommand([]string{"convex-bundler", "unknown-command"})
+	require.Error(t, err)
+}
+
+// TestParseCommand_RootHelp tests that --help lists all subcommands
+func TestParseCommand_RootHelp(t *testing.T) {
+	var buf bytes.Buffer
+	inv, err := ParseCommand([]string{"convex-bundler", "--help"}, ParseOptions{Output: &buf})
+	require.NoError(t, err)
+	assert.Equal(t, CommandHelp, inv.Command)
+
+	help := buf.String()
+	for _, sub := range []string{"selfhost", "info", "validate", "version"} {
+		assert.Contains(t, help, sub)
+	}
+	assert.Contains(t, help, "--app")
+	assert.NotContains(t, help, "completion", "completion command should be hidden")
+}
+
+// TestParseCommand_SelfHostHelp tests that selfhost --help shows its flags
+func TestParseCommand_SelfHostHelp(t *testing.T) {
+	var buf bytes.Buffer
+	inv, err := ParseCommand([]string{"convex-bundler", "selfhost", "--help"}, ParseOptions{Output: &buf})
+	require.NoError(t, err)
+	assert.Equal(t, CommandHelp, inv.Command)
+
+	help := buf.String()
+	for _, flag := range []string{"--bundle", "--ops-binary", "--output", "--platform", "--compression", "--ops-version"} {
+		assert.Contains(t, help, flag)
+	}
+}
+
+// TestParse_VersionEnvIgnored tests that CONVEX_BUNDLER_VERSION does not toggle --version
+func TestParse_VersionEnvIgnored(t *testing.T) {
+	t.Setenv("CONVEX_BUNDLER_VERSION", "1.0.0")
+
+	config, err := Parse([]string{"convex-bundler", "--app", "/app", "-o", "/out", "--backend-binary", "/bin"}, ParseOptions{SkipValidation: true})
+	require.NoError(t, err)
+	assert.Equal(t, "", config.Version)
+}
@@ -0,0 +1,120 @@
+package credentials
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	adminkey "github.com/ozanturksever/convex-admin-key"
+	siv "github.com/secure-io/siv-go"
+)
+
+// Admin key encryption parameters, copied from crypto.go and kbkdf.go of
+// github.com/ozanturksever/convex-admin-key v0.1.0 (the version in go.mod),
+// which ports the keybroker of github.com/get-convex/convex-backend.
+// TestOpenAdminKey_UpstreamKeys decrypts keys issued by that module, so a
+// dependency bump that changes the format fails there.
+const (
+	adminKeyVersion = 1
+	adminKeyLen     = 16 // AES-128
+	adminKeyNonce   = 12
+	adminKeyTag     = 16
+	adminKeyPurpose = "admin key"
+)
+
+// IssueAdminKeyLegacy is like adminkey.IssueAdminKey, but also encodes
+// instanceName in the encrypted key (protobuf field 1). The default format
+// leaves it out and relies on the "instanceName|" prefix; older backends
+// that check the embedded name reject such keys, and need this format.
+// Both formats are "instanceName|<hex>" and work with current backends.
+func IssueAdminKeyLegacy(secret adminkey.Secret, instanceName string, memberID uint64, isReadOnly bool) (string, error) {
+	if err := ValidateInstanceName(instanceName); err != nil {
+		return "", err
+	}
+
+	// AdminKeyProto fields: instance_name = 1, issued_s = 2, member_id = 3, is_read_only = 5
+	var proto []byte
+	proto = binary.AppendUvarint(proto, 1<<3|2)
+	proto = binary.AppendUvarint(proto, uint64(len(instanceName)))
+	proto = append(proto, instanceName...)
+	proto = binary.AppendUvarint(proto, 2<<3)
+	proto = binary.AppendUvarint(proto, uint64(time.Now().Unix()))
+	proto = binary.AppendUvarint(proto, 3<<3)
+	proto = binary.AppendUvarint(proto, memberID)
+	if isReadOnly {
+		proto = binary.AppendUvarint(proto, 5<<3)
+		proto = binary.AppendUvarint(proto, 1)
+	}
+
+	encrypted, err := sealAdminKey(secret, proto)
+	if err != nil {
+		return "", fmt.Errorf("failed to issue admin key: %w", err)
+	}
+	return instanceName + "|" + encrypted, nil
+}
+
+// sealAdminKey encrypts an encoded AdminKeyProto into the hex-encoded part of
+// an admin key: version || nonce || ciphertext and tag.
+func sealAdminKey(secret adminkey.Secret, proto []byte) (string, error) {
+	aead, err := siv.NewGCM(deriveAdminKeyCipherKey(secret[:]))
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+	nonce := make([]byte, adminKeyNonce)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	version := []byte{adminKeyVersion}
+	data := append(append(version, nonce...), aead.Seal(nil, nonce, proto, version)...)
+	return hex.EncodeToString(data), nil
+}
+
+// openAdminKey decrypts adminKey ("instanceName|<hex>") with secret and
+// returns the encoded AdminKeyProto.
+func openAdminKey(secret adminkey.Secret, adminKey string) ([]byte, error) {
+	_, encrypted, ok := strings.Cut(adminKey, "|")
+	if !ok {
+		return nil, fmt.Errorf("admin key is not in the form <instance>|<key>")
+	}
+	data, err := hex.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("admin key is not hex-encoded: %w", err)
+	}
+	if len(data) < 1+adminKeyNonce+adminKeyTag {
+		return nil, fmt.Errorf("admin key is too short")
+	}
+	if data[0] != adminKeyVersion {
+		return nil, fmt.Errorf("unsupported admin key version: %d", data[0])
+	}
+
+	aead, err := siv.NewGCM(deriveAdminKeyCipherKey(secret[:]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	nonce := data[1 : 1+adminKeyNonce]
+	// siv-go's amd64 assembly faults on ciphertexts of a block or more that
+	// start at an unaligned offset, as one at offset 13 of data does, so it
+	// gets its own allocation
+	ciphertext := append([]byte(nil), data[1+adminKeyNonce:]...)
+	proto, err := aead.Open(nil, nonce, ciphertext, data[:1])
+	if err != nil {
+		return nil, fmt.Errorf("admin key was not issued with this instance secret")
+	}
+	return proto, nil
+}
+
+// deriveAdminKeyCipherKey derives the admin key encryption key from the
+// instance secret with the counter-mode HMAC-SHA256 KBKDF of
+// convex-admin-key's kbkdfCTRHMAC: HMAC(secret, counter || purpose), with a
+// 32-bit big-endian counter from 1. One HMAC block covers the 16-byte key.
+func deriveAdminKeyCipherKey(secret []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte{0, 0, 0, 1})
+	h.Write([]byte(adminKeyPurpose))
+	return h.Sum(nil)[:adminKeyLen]
+}
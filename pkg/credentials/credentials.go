@@ -3,6 +3,8 @@ package credentials
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strings"
 
 	adminkey "github.com/ozanturksever/convex-admin-key"
 )
@@ -13,8 +15,65 @@ type Credentials struct {
 	InstanceSecret string `json:"instanceSecret"`
 }
 
+// MaxInstanceNameLength is the longest allowed instance name
+const MaxInstanceNameLength = 64
+
+// instanceNamePattern matches names made of letters, digits, spaces, '.',
+// '-' and '_' that start and end with a letter or digit. Spaces are allowed
+// because older bundles used the display name (e.g. "Convex Backend") as the
+// instance name.
+var instanceNamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9 ._-]*[A-Za-z0-9])?$`)
+
+// ValidateInstanceName returns an error if name cannot be embedded in an
+// admin key. Keys have the form "instanceName|...", so a name containing
+// '|' would be split at the wrong place when the key is parsed.
+func ValidateInstanceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("instance name is required")
+	}
+	if strings.Contains(name, "|") {
+		return fmt.Errorf("invalid instance name %q: must not contain '|'", name)
+	}
+	if len(name) > MaxInstanceNameLength {
+		return fmt.Errorf("instance name %q is longer than %d characters", name, MaxInstanceNameLength)
+	}
+	if !instanceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid instance name %q: must contain only letters, digits, spaces, '.', '-' or '_' and start and end with a letter or digit", name)
+	}
+	return nil
+}
+
+// SlugifyInstanceName derives an instance name from a display name: letters
+// are lower-cased, every run of other characters becomes a single '-' and the
+// result is trimmed to MaxInstanceNameLength. It returns "" if name has no
+// letters or digits.
+func SlugifyInstanceName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	slug := b.String()
+	if len(slug) > MaxInstanceNameLength {
+		slug = strings.TrimRight(slug[:MaxInstanceNameLength], "-")
+	}
+	return slug
+}
+
 // Generate creates new secure admin credentials using the convex-admin-key library
 func Generate(instanceName string) (*Credentials, error) {
+	if err := ValidateInstanceName(instanceName); err != nil {
+		return nil, err
+	}
+
 	// Generate a new cryptographically secure instance secret
 	secret, err := adminkey.GenerateSecret()
 	if err != nil {
@@ -34,7 +93,72 @@ func Generate(instanceName string) (*Credentials, error) {
 	}, nil
 }
 
+// KeyOptions configures IssueKey
+type KeyOptions struct {
+	MemberID uint64 // Member the admin key is issued for (0 for a generic admin key)
+	ReadOnly bool   // Issue a key that can only run queries
+	System   bool   // Issue a system key for internal operations instead of an admin key
+}
+
+// IssueKey mints an additional key for an existing instance from its
+// hex-encoded instance secret, e.g. the instanceSecret in credentials.json.
+func IssueKey(instanceSecret, instanceName string, opts KeyOptions) (string, error) {
+	if err := ValidateInstanceName(instanceName); err != nil {
+		return "", err
+	}
+	if opts.System && (opts.ReadOnly || opts.MemberID != 0) {
+		return "", fmt.Errorf("system keys cannot be read-only or issued for a member")
+	}
+
+	secret, err := adminkey.ParseSecret(strings.TrimSpace(instanceSecret))
+	if err != nil {
+		return "", fmt.Errorf("invalid instance secret: %w", err)
+	}
+
+	var key string
+	if opts.System {
+		key, err = adminkey.IssueSystemKey(secret, instanceName)
+	} else {
+		key, err = adminkey.IssueAdminKey(secret, instanceName, opts.MemberID, opts.ReadOnly)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to issue key: %w", err)
+	}
+	return key, nil
+}
+
+// Rotate returns credentials with the same instance secret as existing and a
+// freshly issued admin key, so the old key can be retired without
+// reinitializing the instance.
+func Rotate(existing *Credentials, instanceName string) (*Credentials, error) {
+	if existing == nil {
+		return nil, fmt.Errorf("existing credentials are required")
+	}
+
+	adminKey, err := IssueKey(existing.InstanceSecret, instanceName, KeyOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate admin key: %w", err)
+	}
+
+	return &Credentials{
+		AdminKey:       adminKey,
+		InstanceSecret: existing.InstanceSecret,
+	}, nil
+}
+
 // ToJSON serializes the credentials to JSON
 func (c *Credentials) ToJSON() ([]byte, error) {
 	return json.MarshalIndent(c, "", "  ")
 }
+
+// redactedVisibleChars is the number of leading characters kept by Redact
+const redactedVisibleChars = 4
+
+// Redact masks a secret for display, keeping only a short prefix so that
+// different keys can still be told apart.
+func Redact(secret string) string {
+	if len(secret) <= redactedVisibleChars*2 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:redactedVisibleChars] + strings.Repeat("*", 8)
+}
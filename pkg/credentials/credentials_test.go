@@ -1,9 +1,15 @@
 package credentials
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	adminkey "github.com/ozanturksever/convex-admin-key"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -75,3 +81,374 @@ func TestCredentials_ToJSON_Formatting(t *testing.T) {
 	assert.Contains(t, string(data), "\n")
 	assert.Contains(t, string(data), "  ")
 }
+
+func TestRedact(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	redacted := Redact(creds.AdminKey)
+	assert.NotEqual(t, creds.AdminKey, redacted)
+	assert.NotContains(t, redacted, creds.AdminKey[redactedVisibleChars:])
+	assert.Equal(t, creds.AdminKey[:redactedVisibleChars], redacted[:redactedVisibleChars])
+
+	assert.Equal(t, "", Redact(""))
+	assert.Equal(t, "*****", Redact("short"))
+}
+
+func TestIssueKey(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		opts KeyOptions
+	}{
+		{name: "admin", opts: KeyOptions{}},
+		{name: "read-only member", opts: KeyOptions{MemberID: 42, ReadOnly: true}},
+		{name: "system", opts: KeyOptions{System: true}},
+	}
+	var keys []string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := IssueKey(creds.InstanceSecret, "test-instance", tt.opts)
+			require.NoError(t, err)
+			assert.Regexp(t, `^test-instance\|[0-9a-f]+$`, key)
+			keys = append(keys, key)
+		})
+	}
+	assert.Len(t, keys, 3)
+	assert.NotEqual(t, keys[0], keys[1])
+	assert.NotEqual(t, keys[1], keys[2])
+}
+
+func TestIssueKey_Errors(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	_, err = IssueKey("not-hex", "test-instance", KeyOptions{})
+	assert.ErrorContains(t, err, "invalid instance secret")
+
+	_, err = IssueKey(creds.InstanceSecret, "", KeyOptions{})
+	assert.ErrorContains(t, err, "instance name is required")
+
+	_, err = IssueKey(creds.InstanceSecret, "test|instance", KeyOptions{})
+	assert.ErrorContains(t, err, "must not contain '|'")
+
+	_, err = IssueKey(creds.InstanceSecret, "test|instance", KeyOptions{System: true})
+	assert.ErrorContains(t, err, "must not contain '|'")
+
+	_, err = IssueKey(creds.InstanceSecret, "test-instance", KeyOptions{System: true, ReadOnly: true})
+	assert.ErrorContains(t, err, "system keys")
+}
+
+func TestRotate(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	rotated, err := Rotate(creds, "test-instance")
+	require.NoError(t, err)
+	assert.Equal(t, creds.InstanceSecret, rotated.InstanceSecret)
+	assert.NotEqual(t, creds.AdminKey, rotated.AdminKey)
+	assert.Regexp(t, `^test-instance\|[0-9a-f]+$`, rotated.AdminKey)
+	require.NoError(t, VerifyConsistency(rotated))
+
+	// The existing credentials are left untouched
+	require.NoError(t, VerifyConsistency(creds))
+}
+
+func TestRotate_Errors(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	_, err = Rotate(nil, "test-instance")
+	assert.ErrorContains(t, err, "existing credentials are required")
+
+	_, err = Rotate(&Credentials{InstanceSecret: "not-hex"}, "test-instance")
+	assert.ErrorContains(t, err, "invalid instance secret")
+
+	_, err = Rotate(creds, "test|instance")
+	assert.ErrorContains(t, err, "must not contain '|'")
+}
+
+func TestValidateInstanceName(t *testing.T) {
+	for _, name := range []string{"test", "test-instance", "my_app.prod", "Convex Backend", "a", strings.Repeat("a", MaxInstanceNameLength)} {
+		assert.NoError(t, ValidateInstanceName(name), name)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "", want: "instance name is required"},
+		{name: "my|app", want: "must not contain '|'"},
+		{name: "|", want: "must not contain '|'"},
+		{name: strings.Repeat("a", MaxInstanceNameLength+1), want: "longer than 64 characters"},
+		{name: "-app", want: "must contain only"},
+		{name: "app ", want: "must contain only"},
+		{name: "app/prod", want: "must contain only"},
+		{name: "app\nprod", want: "must contain only"},
+	}
+	for _, tt := range tests {
+		assert.ErrorContains(t, ValidateInstanceName(tt.name), tt.want, "%q", tt.name)
+	}
+}
+
+func TestSlugifyInstanceName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Convex Backend", want: "convex-backend"},
+		{name: "my-app", want: "my-app"},
+		{name: "  My  App!! v2 ", want: "my-app-v2"},
+		{name: "my|app", want: "my-app"},
+		{name: "Ünïcode App", want: "n-code-app"},
+		{name: "!!!", want: ""},
+		{name: "", want: ""},
+		{name: strings.Repeat("a", MaxInstanceNameLength-1) + " b", want: strings.Repeat("a", MaxInstanceNameLength-1)},
+	}
+	for _, tt := range tests {
+		slug := SlugifyInstanceName(tt.name)
+		assert.Equal(t, tt.want, slug, "%q", tt.name)
+		if slug != "" {
+			assert.NoError(t, ValidateInstanceName(slug), "%q", tt.name)
+		}
+	}
+}
+
+func TestGenerate_InvalidInstanceName(t *testing.T) {
+	_, err := Generate("my|app")
+	assert.ErrorContains(t, err, "must not contain '|'")
+
+	_, err = Generate("")
+	assert.ErrorContains(t, err, "instance name is required")
+}
+
+func TestVerifyConsistency(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+	require.NoError(t, VerifyConsistency(creds))
+
+	// Keys minted later from the same secret also match
+	readOnly, err := IssueKey(creds.InstanceSecret, "test-instance", KeyOptions{ReadOnly: true})
+	require.NoError(t, err)
+	require.NoError(t, VerifyConsistency(&Credentials{AdminKey: readOnly, InstanceSecret: creds.InstanceSecret}))
+}
+
+func TestVerifyConsistency_Mismatch(t *testing.T) {
+	creds1, err := Generate("test-instance")
+	require.NoError(t, err)
+	creds2, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	err = VerifyConsistency(&Credentials{AdminKey: creds1.AdminKey, InstanceSecret: creds2.InstanceSecret})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "admin key was not issued with this instance secret")
+
+	tests := []struct {
+		name     string
+		adminKey string
+		want     string
+	}{
+		{name: "no instance", adminKey: "deadbeef", want: "<instance>|<key>"},
+		{name: "not hex", adminKey: "test-instance|zz", want: "not hex-encoded"},
+		{name: "too short", adminKey: "test-instance|01", want: "too short"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyConsistency(&Credentials{AdminKey: tt.adminKey, InstanceSecret: creds1.InstanceSecret})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+// protoFields decodes the varint and length-delimited fields of a protobuf
+// message, keyed by field number
+func protoFields(t *testing.T, data []byte) map[uint64][]byte {
+	t.Helper()
+	fields := map[uint64][]byte{}
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		require.Positive(t, n, "invalid tag")
+		data = data[n:]
+		value, n := binary.Uvarint(data)
+		require.Positive(t, n, "invalid value of field %d", tag>>3)
+		data = data[n:]
+		switch tag & 7 {
+		case 0:
+			fields[tag>>3] = binary.AppendUvarint(nil, value)
+		case 2:
+			require.LessOrEqual(t, value, uint64(len(data)))
+			fields[tag>>3] = data[:value]
+			data = data[value:]
+		default:
+			require.Fail(t, fmt.Sprintf("unexpected wire type %d", tag&7))
+		}
+	}
+	return fields
+}
+
+// TestOpenAdminKey_UpstreamKeys decrypts keys issued by convex-admin-key
+// with the local copy of its crypto, catching format changes on upgrade
+func TestOpenAdminKey_UpstreamKeys(t *testing.T) {
+	secret, err := adminkey.GenerateSecret()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		issue    func() (string, error)
+		memberID []byte
+		readOnly bool
+		system   bool
+	}{
+		{name: "admin", issue: func() (string, error) { return adminkey.IssueAdminKey(secret, "test-instance", 0, false) }, memberID: []byte{0}},
+		{name: "read-only member", issue: func() (string, error) { return adminkey.IssueAdminKey(secret, "test-instance", 42, true) }, memberID: []byte{42}, readOnly: true},
+		{name: "large member", issue: func() (string, error) { return adminkey.IssueAdminKey(secret, "test-instance", 1<<62, false) }, memberID: binary.AppendUvarint(nil, 1<<62)},
+		{name: "system", issue: func() (string, error) { return adminkey.IssueSystemKey(secret, "test-instance") }, system: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.issue()
+			require.NoError(t, err)
+			require.NoError(t, VerifyConsistency(&Credentials{AdminKey: key, InstanceSecret: secret.String()}))
+
+			proto, err := openAdminKey(secret, key)
+			require.NoError(t, err)
+			fields := protoFields(t, proto)
+			assert.Contains(t, fields, uint64(2), "issued_s")
+			if tt.system {
+				assert.Equal(t, []byte{}, fields[4])
+				assert.NotContains(t, fields, uint64(3))
+			} else {
+				assert.Equal(t, tt.memberID, fields[3])
+			}
+			if tt.readOnly {
+				assert.Equal(t, []byte{1}, fields[5])
+			} else {
+				assert.NotContains(t, fields, uint64(5))
+			}
+		})
+	}
+}
+
+func TestIssueAdminKeyLegacy(t *testing.T) {
+	secret, err := adminkey.GenerateSecret()
+	require.NoError(t, err)
+
+	legacy, err := IssueAdminKeyLegacy(secret, "test-instance", 42, true)
+	require.NoError(t, err)
+	standard, err := adminkey.IssueAdminKey(secret, "test-instance", 42, true)
+	require.NoError(t, err)
+
+	for _, key := range []string{legacy, standard} {
+		name, encrypted, ok := strings.Cut(key, "|")
+		require.True(t, ok, key)
+		assert.Equal(t, "test-instance", name)
+		assert.Regexp(t, `^[0-9a-f]+$`, encrypted)
+		require.NoError(t, VerifyConsistency(&Credentials{AdminKey: key, InstanceSecret: secret.String()}))
+	}
+
+	proto, err := openAdminKey(secret, legacy)
+	require.NoError(t, err)
+	assert.Equal(t, byte(1<<3|2), proto[0], "legacy keys start with the field-1 tag")
+	fields := protoFields(t, proto)
+	assert.Equal(t, "test-instance", string(fields[1]))
+	assert.Equal(t, []byte{42}, fields[3])
+	assert.Equal(t, []byte{1}, fields[5])
+
+	proto, err = openAdminKey(secret, standard)
+	require.NoError(t, err)
+	assert.NotContains(t, protoFields(t, proto), uint64(1), "the default format has no instance name")
+
+	_, err = IssueAdminKeyLegacy(secret, "bad|name", 0, false)
+	assert.ErrorContains(t, err, "must not contain '|'")
+}
+
+func TestToEncryptedJSON_RoundTrip(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+
+	data, err := creds.ToEncryptedJSON("correct horse")
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(data))
+	assert.NoError(t, ValidateEncrypted(data))
+	assert.NotContains(t, string(data), creds.AdminKey)
+	assert.NotContains(t, string(data), creds.InstanceSecret)
+
+	decrypted, err := DecryptJSON(data, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, creds, decrypted)
+
+	// A fresh salt and nonce make every encryption different
+	again, err := creds.ToEncryptedJSON("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, data, again)
+
+	plain, err := creds.ToJSON()
+	require.NoError(t, err)
+	assert.False(t, IsEncrypted(plain))
+
+	_, err = creds.ToEncryptedJSON("")
+	assert.Error(t, err)
+}
+
+func TestDecryptJSON_WrongPassphrase(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+	data, err := creds.ToEncryptedJSON("correct horse")
+	require.NoError(t, err)
+
+	_, err = DecryptJSON(data, "battery staple")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	// Tampering with the ciphertext is caught the same way
+	var enc map[string]any
+	require.NoError(t, json.Unmarshal(data, &enc))
+	enc["ciphertext"] = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	tampered, err := json.Marshal(enc)
+	require.NoError(t, err)
+	_, err = DecryptJSON(tampered, "correct horse")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestDecryptJSON_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "not JSON", data: "nope", want: "invalid encrypted credentials"},
+		{name: "unknown scheme", data: `{"encryption":"rot13"}`, want: "unsupported credentials encryption"},
+		{name: "huge scryptN", data: `{"encryption":"scrypt-aes256gcm","scryptN":1073741824,"scryptR":8,"scryptP":1}`, want: "scryptN"},
+		{name: "missing salt", data: `{"encryption":"scrypt-aes256gcm","scryptN":32768,"scryptR":8,"scryptP":1}`, want: "salt, nonce and ciphertext are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecryptJSON([]byte(tt.data), "passphrase")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.NotErrorIs(t, err, ErrWrongPassphrase)
+		})
+	}
+}
+
+func TestLoadEncrypted(t *testing.T) {
+	creds, err := Generate("test-instance")
+	require.NoError(t, err)
+	data, err := creds.ToEncryptedJSON("correct horse")
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, data, 0600))
+
+	loaded, err := LoadEncrypted(path, "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, creds, loaded)
+
+	_, err = LoadEncrypted(path, "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = LoadEncrypted(filepath.Join(t.TempDir(), "missing.json"), "correct horse")
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptionScheme identifies the key derivation and cipher of credentials
+// written by ToEncryptedJSON
+const EncryptionScheme = "scrypt-aes256gcm"
+
+// scrypt parameters used by ToEncryptedJSON
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptSaltLen = 16
+	encryptionKey = 32 // AES-256
+)
+
+// Upper bounds on the scrypt parameters accepted when decrypting, so a
+// tampered file cannot make decryption use unbounded memory or time
+const (
+	maxScryptN = 1 << 20
+	maxScryptR = 32
+	maxScryptP = 16
+)
+
+// ErrWrongPassphrase is returned when encrypted credentials fail to decrypt,
+// either because the passphrase is wrong or because the data was modified.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted credentials")
+
+// encryptedCredentials is the JSON form written by ToEncryptedJSON. Binary
+// fields are base64-encoded.
+type encryptedCredentials struct {
+	Encryption string `json:"encryption"`
+	ScryptN    int    `json:"scryptN"`
+	ScryptR    int    `json:"scryptR"`
+	ScryptP    int    `json:"scryptP"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ToEncryptedJSON serializes the credentials to JSON encrypted with
+// AES-256-GCM under a key derived from passphrase with scrypt. The result
+// can be stored in place of credentials.json and read with LoadEncrypted or
+// DecryptJSON.
+func (c *Credentials) ToEncryptedJSON(passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is required")
+	}
+	plaintext, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize credentials: %w", err)
+	}
+
+	enc := &encryptedCredentials{
+		Encryption: EncryptionScheme,
+		ScryptN:    scryptN,
+		ScryptR:    scryptR,
+		ScryptP:    scryptP,
+		Salt:       make([]byte, scryptSaltLen),
+	}
+	if _, err := rand.Read(enc.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	aead, err := enc.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	enc.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(enc.Nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	enc.Ciphertext = aead.Seal(nil, enc.Nonce, plaintext, []byte(EncryptionScheme))
+
+	return json.MarshalIndent(enc, "", "  ")
+}
+
+// IsEncrypted reports whether data is in the form written by ToEncryptedJSON
+// rather than plaintext credentials JSON.
+func IsEncrypted(data []byte) bool {
+	var probe struct {
+		Encryption *string `json:"encryption"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.Encryption != nil
+}
+
+// ValidateEncrypted checks that data is well-formed encrypted credentials
+// without decrypting it.
+func ValidateEncrypted(data []byte) error {
+	_, err := parseEncrypted(data)
+	return err
+}
+
+// DecryptJSON decrypts credentials written by ToEncryptedJSON. It returns an
+// error wrapping ErrWrongPassphrase if they do not decrypt with passphrase.
+func DecryptJSON(data []byte, passphrase string) (*Credentials, error) {
+	enc, err := parseEncrypted(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := enc.cipher(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(enc.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted credentials: nonce must be %d bytes", aead.NonceSize())
+	}
+	plaintext, err := aead.Open(nil, enc.Nonce, enc.Ciphertext, []byte(EncryptionScheme))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", ErrWrongPassphrase)
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse decrypted credentials: %w", err)
+	}
+	return &creds, nil
+}
+
+// LoadEncrypted reads and decrypts the encrypted credentials file at path.
+func LoadEncrypted(path, passphrase string) (*Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+	return DecryptJSON(data, passphrase)
+}
+
+// parseEncrypted parses and checks the fields of encrypted credentials.
+func parseEncrypted(data []byte) (*encryptedCredentials, error) {
+	var enc encryptedCredentials
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return nil, fmt.Errorf("invalid encrypted credentials: %w", err)
+	}
+	if enc.Encryption != EncryptionScheme {
+		return nil, fmt.Errorf("unsupported credentials encryption %q (expected %q)", enc.Encryption, EncryptionScheme)
+	}
+	if enc.ScryptN < 2 || enc.ScryptN > maxScryptN || enc.ScryptN&(enc.ScryptN-1) != 0 {
+		return nil, fmt.Errorf("invalid encrypted credentials: scryptN must be a power of two up to %d", maxScryptN)
+	}
+	if enc.ScryptR < 1 || enc.ScryptR > maxScryptR || enc.ScryptP < 1 || enc.ScryptP > maxScryptP {
+		return nil, fmt.Errorf("invalid encrypted credentials: scryptR must be 1-%d and scryptP 1-%d", maxScryptR, maxScryptP)
+	}
+	if len(enc.Salt) == 0 || len(enc.Nonce) == 0 || len(enc.Ciphertext) == 0 {
+		return nil, fmt.Errorf("invalid encrypted credentials: salt, nonce and ciphertext are required")
+	}
+	return &enc, nil
+}
+
+// cipher derives the key for passphrase and returns the AES-GCM cipher.
+func (e *encryptedCredentials) cipher(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), e.Salt, e.ScryptN, e.ScryptR, e.ScryptP, encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,20 @@
+package credentials
+
+import (
+	"fmt"
+
+	adminkey "github.com/ozanturksever/convex-admin-key"
+)
+
+// VerifyConsistency checks that AdminKey was issued with InstanceSecret by
+// decrypting it and validating its authentication tag. It catches bundles
+// whose admin key and instance secret were generated separately, which the
+// backend would reject at runtime.
+func VerifyConsistency(creds *Credentials) error {
+	secret, err := adminkey.ParseSecret(creds.InstanceSecret)
+	if err != nil {
+		return fmt.Errorf("invalid instance secret: %w", err)
+	}
+	_, err = openAdminKey(secret, creds.AdminKey)
+	return err
+}
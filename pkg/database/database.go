@@ -0,0 +1,67 @@
+// Package database checks the SQLite databases shipped in bundles.
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Magic is the header every SQLite 3 database file starts with
+var Magic = []byte("SQLite format 3\x00")
+
+// HasSQLiteHeader reports whether data begins with the SQLite header.
+func HasSQLiteHeader(data []byte) bool {
+	return bytes.HasPrefix(data, Magic)
+}
+
+// CheckIntegrity opens the SQLite database at path read-only and runs
+// PRAGMA integrity_check, returning an error unless it reports "ok".
+func CheckIntegrity(path string) error {
+	db, err := OpenReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var results []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to read integrity check result: %w", err)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(results, "; "))
+	}
+	return nil
+}
+
+// OpenReadOnly opens the SQLite database at path read-only.
+func OpenReadOnly(path string) (*sql.DB, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve database path: %w", err)
+	}
+	dsn := (&url.URL{Scheme: "file", Path: filepath.ToSlash(absPath), RawQuery: "mode=ro"}).String()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "convex.db")
+	createTestDatabase(t, dbPath)
+
+	require.NoError(t, CheckIntegrity(dbPath))
+}
+
+func TestCheckIntegrity_CorruptedPage(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "convex.db")
+	createTestDatabase(t, dbPath)
+
+	// Overwrite the second page; the header still identifies the file as SQLite
+	data, err := os.ReadFile(dbPath)
+	require.NoError(t, err)
+	pageSize := int(data[16])<<8 | int(data[17])
+	require.Greater(t, len(data), 3*pageSize)
+	for i := pageSize; i < 2*pageSize; i++ {
+		data[i] = 0xff
+	}
+	require.NoError(t, os.WriteFile(dbPath, data, 0644))
+
+	assert.Error(t, CheckIntegrity(dbPath))
+}
+
+func TestCheckIntegrity_NotADatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "convex.db")
+	require.NoError(t, os.WriteFile(dbPath, []byte(strings.Repeat("garbage", 100)), 0644))
+
+	assert.Error(t, CheckIntegrity(dbPath))
+}
+
+func TestHasSQLiteHeader(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "convex.db")
+	createTestDatabase(t, dbPath)
+	data, err := os.ReadFile(dbPath)
+	require.NoError(t, err)
+
+	assert.True(t, HasSQLiteHeader(data))
+	assert.False(t, HasSQLiteHeader([]byte("SQLite format")))
+	assert.False(t, HasSQLiteHeader(nil))
+}
+
+// createTestDatabase writes a SQLite database spanning several pages
+func createTestDatabase(t *testing.T, path string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY, body TEXT)")
+	require.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		_, err = db.Exec("INSERT INTO documents (body) VALUES (?)", strings.Repeat("x", 100))
+		require.NoError(t, err)
+	}
+}
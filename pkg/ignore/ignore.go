@@ -0,0 +1,151 @@
+package ignore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the ignore file read from the root of a storage directory.
+// The file itself is never bundled.
+const FileName = ".convexbundleignore"
+
+// Matcher matches slash-separated paths against gitignore-style patterns.
+// A nil Matcher matches nothing.
+type Matcher struct {
+	patterns []pattern
+}
+
+// pattern is one parsed line of an ignore file
+type pattern struct {
+	// segments are the slash-separated parts of the pattern, where "**"
+	// matches any number of path segments
+	segments []string
+
+	// negate re-includes paths matched by an earlier pattern ("!pattern")
+	negate bool
+
+	// dirOnly matches only directories ("pattern/")
+	dirOnly bool
+}
+
+// Parse reads gitignore-style patterns from r. Blank lines and lines starting
+// with "#" are skipped, "!" negates a pattern, a trailing "/" matches only
+// directories, and a pattern containing any other "/" is anchored to the
+// root instead of matching a name at any depth. "*", "?", "[...]" and "**"
+// work as in gitignore; the last matching pattern wins.
+func Parse(r io.Reader) (*Matcher, error) {
+	m := &Matcher{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var p pattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			return nil, fmt.Errorf("invalid pattern on line %d: empty pattern", lineNo)
+		}
+
+		p.segments = strings.Split(line, "/")
+		if !anchored {
+			p.segments = append([]string{"**"}, p.segments...)
+		}
+		for _, seg := range p.segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern on line %d: %q", lineNo, scanner.Text())
+			}
+		}
+		m.patterns = append(m.patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ignore patterns: %w", err)
+	}
+	return m, nil
+}
+
+// Load parses the FileName file in dir, returning a nil Matcher if dir has
+// none.
+func Load(dir string) (*Matcher, error) {
+	f, err := os.Open(filepath.Join(dir, FileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", FileName, err)
+	}
+	defer f.Close()
+
+	m, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", FileName, err)
+	}
+	return m, nil
+}
+
+// Match reports whether name, a slash-separated path relative to the ignore
+// file's directory, is excluded. Callers walking a tree should skip excluded
+// directories entirely; as in gitignore, files inside an excluded directory
+// cannot be re-included.
+func (m *Matcher) Match(name string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	if name == FileName {
+		return true
+	}
+
+	segments := strings.Split(name, "/")
+	excluded := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, segments) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// matchSegments reports whether the pattern segments match the whole of name.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,97 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	m, err := Parse(strings.NewReader(`
+# temporary files
+*.tmp
+!keep.tmp
+cache/
+/build
+logs/**/*.log
+\#literal
+`))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{"a.tmp", false, true},
+		{"nested/deep/b.tmp", false, true},
+		{"keep.tmp", false, false},
+		{"nested/keep.tmp", false, false},
+		{"a.txt", false, false},
+		{"cache", true, true},
+		{"nested/cache", true, true},
+		{"cache", false, false}, // directory patterns do not match files
+		{"build", true, true},
+		{"build", false, true},
+		{"nested/build", true, false}, // anchored to the root
+		{"logs/app.log", false, true},
+		{"logs/2024/01/app.log", false, true},
+		{"logs/app.txt", false, false},
+		{"#literal", false, true},
+		{FileName, false, true},
+		{"nested/" + FileName, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, m.Match(tt.name, tt.isDir))
+		})
+	}
+}
+
+func TestMatcher_LastPatternWins(t *testing.T) {
+	m, err := Parse(strings.NewReader("!keep.txt\n*.txt\n"))
+	require.NoError(t, err)
+	assert.True(t, m.Match("keep.txt", false))
+
+	m, err = Parse(strings.NewReader("*.txt\n!keep.txt\n"))
+	require.NoError(t, err)
+	assert.False(t, m.Match("keep.txt", false))
+	assert.True(t, m.Match("other.txt", false))
+}
+
+func TestMatcher_Nil(t *testing.T) {
+	var m *Matcher
+	assert.False(t, m.Match("anything", false))
+}
+
+func TestParse_Invalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("ok\n[unclosed\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+
+	_, err = Parse(strings.NewReader("/\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "empty pattern")
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	m, err := Load(dir)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte("*.tmp\n"), 0644))
+	m, err = Load(dir)
+	require.NoError(t, err)
+	assert.True(t, m.Match("x.tmp", false))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte("[\n"), 0644))
+	_, err = Load(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse "+FileName)
+}
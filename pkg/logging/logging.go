@@ -0,0 +1,90 @@
+// Package logging provides the minimal leveled logger used to report progress
+// from the bundler packages. Messages are written as plain lines so that the
+// default output reads the same as direct fmt.Printf calls.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Level controls which messages a Logger writes
+type Level int
+
+const (
+	// LevelDebug writes all messages, including detailed diagnostics (--verbose)
+	LevelDebug Level = iota
+
+	// LevelInfo writes progress and warning messages (default)
+	LevelInfo
+
+	// LevelWarn writes only warnings (--quiet)
+	LevelWarn
+)
+
+// Logger receives progress messages from long-running operations
+type Logger interface {
+	// Debugf logs detailed diagnostics, shown only in verbose mode
+	Debugf(format string, args ...interface{})
+
+	// Infof logs normal progress messages
+	Infof(format string, args ...interface{})
+
+	// Warnf logs recoverable problems, shown even in quiet mode
+	Warnf(format string, args ...interface{})
+}
+
+// New returns a Logger that writes messages at or above level to w, one per line.
+// Warnings are prefixed with "Warning: ".
+func New(w io.Writer, level Level) Logger {
+	return &writerLogger{w: w, level: level}
+}
+
+// Nop returns a Logger that discards all messages
+func Nop() Logger {
+	return nopLogger{}
+}
+
+// OrNop returns l, or a no-op Logger if l is nil
+func OrNop(l Logger) Logger {
+	if l == nil {
+		return Nop()
+	}
+	return l
+}
+
+// writerLogger writes plain-text lines to an io.Writer
+type writerLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+func (l *writerLogger) Debugf(format string, args ...interface{}) {
+	l.logf(LevelDebug, "", format, args...)
+}
+
+func (l *writerLogger) Infof(format string, args ...interface{}) {
+	l.logf(LevelInfo, "", format, args...)
+}
+
+func (l *writerLogger) Warnf(format string, args ...interface{}) {
+	l.logf(LevelWarn, "Warning: ", format, args...)
+}
+
+func (l *writerLogger) logf(level Level, prefix, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(l.w, prefix+format+"\n", args...)
+}
+
+// nopLogger discards all messages
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Warnf(string, ...interface{})  {}
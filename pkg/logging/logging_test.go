@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew_Levels(t *testing.T) {
+	tests := []struct {
+		name  string
+		level Level
+		want  string
+	}{
+		{
+			name:  "debug",
+			level: LevelDebug,
+			want:  "debug 1\ninfo 2\nWarning: warn 3\n",
+		},
+		{
+			name:  "info",
+			level: LevelInfo,
+			want:  "info 2\nWarning: warn 3\n",
+		},
+		{
+			name:  "warn",
+			level: LevelWarn,
+			want:  "Warning: warn 3\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			log := New(&buf, tt.level)
+
+			log.Debugf("debug %d", 1)
+			log.Infof("info %d", 2)
+			log.Warnf("warn %d", 3)
+
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
+
+func TestNop(t *testing.T) {
+	log := Nop()
+	// Must not panic
+	log.Debugf("x")
+	log.Infof("x")
+	log.Warnf("x")
+}
+
+func TestOrNop(t *testing.T) {
+	assert.Equal(t, Nop(), OrNop(nil))
+
+	var buf bytes.Buffer
+	log := New(&buf, LevelInfo)
+	assert.Equal(t, log, OrNop(log))
+}
@@ -0,0 +1,97 @@
+package manifest
+
+import (
+	"sort"
+)
+
+// ManifestDiff describes how a manifest differs from an earlier one. The
+// creation time and storage checksums are not compared.
+type ManifestDiff struct {
+	// Fields lists the changed fields, in manifest order, followed by the
+	// changed labels as "labels.<key>" sorted by key
+	Fields []FieldChange `json:"fields"`
+
+	// AppsAdded lists the apps only in the newer manifest, sorted
+	AppsAdded []string `json:"appsAdded"`
+
+	// AppsRemoved lists the apps only in the earlier manifest, sorted
+	AppsRemoved []string `json:"appsRemoved"`
+}
+
+// FieldChange is a manifest field whose value changed. An added or removed
+// label has an empty Old or New value.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Empty reports whether the manifests compared the same.
+func (d *ManifestDiff) Empty() bool {
+	return len(d.Fields) == 0 && len(d.AppsAdded) == 0 && len(d.AppsRemoved) == 0
+}
+
+// Diff returns how other differs from m. A nil manifest compares like an
+// empty one.
+func (m *Manifest) Diff(other *Manifest) *ManifestDiff {
+	if m == nil {
+		m = &Manifest{}
+	}
+	if other == nil {
+		other = &Manifest{}
+	}
+
+	diff := &ManifestDiff{Fields: []FieldChange{}}
+	addField := func(field, old, new string) {
+		if old != new {
+			diff.Fields = append(diff.Fields, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+	addField("name", m.Name, other.Name)
+	addField("version", m.Version, other.Version)
+	addField("platform", m.Platform, other.Platform)
+	addField("convexCliVersion", m.ConvexCLIVersion, other.ConvexCLIVersion)
+	addField("backendVersion", m.BackendVersion, other.BackendVersion)
+	addField("packageManager", m.PackageManager, other.PackageManager)
+
+	for _, key := range unionKeys(m.Labels, other.Labels) {
+		addField("labels."+key, m.Labels[key], other.Labels[key])
+	}
+
+	diff.AppsAdded = setDifference(other.Apps, m.Apps)
+	diff.AppsRemoved = setDifference(m.Apps, other.Apps)
+	return diff
+}
+
+// setDifference returns the sorted, distinct values of a that are not in b.
+func setDifference(a, b []string) []string {
+	exclude := make(map[string]bool, len(b))
+	for _, v := range b {
+		exclude[v] = true
+	}
+	result := []string{}
+	for _, v := range a {
+		if !exclude[v] {
+			result = append(result, v)
+			exclude[v] = true
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// unionKeys returns the keys of a and b, sorted.
+func unionKeys(a, b map[string]string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var keys []string
+	for _, m := range []map[string]string{a, b} {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
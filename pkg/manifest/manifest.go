@@ -2,38 +2,159 @@ package manifest
 
 import (
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// SourceDateEpochEnv names the environment variable that sets the timestamp
+// used by reproducible builds (see https://reproducible-builds.org/specs/source-date-epoch/).
+const SourceDateEpochEnv = "SOURCE_DATE_EPOCH"
+
 // Manifest represents the bundle manifest
 type Manifest struct {
-	Name      string   `json:"name"`
-	Version   string   `json:"version"`
-	Apps      []string `json:"apps"`
-	Platform  string   `json:"platform"`
-	CreatedAt string   `json:"createdAt"`
+	Name             string   `json:"name"`
+	Version          string   `json:"version"`
+	Apps             []string `json:"apps"`
+	Platform         string   `json:"platform"`
+	CreatedAt        string   `json:"createdAt"`
+	ConvexCLIVersion string   `json:"convexCliVersion,omitempty"` // Convex CLI that deployed the apps
+	BackendVersion   string   `json:"backendVersion,omitempty"`   // Version of the bundled backend binary
+	PackageManager   string   `json:"packageManager,omitempty"`   // Package manager that installed app dependencies
+
+	// StorageChecksums maps each storage file, relative to storage/ with
+	// forward slashes, to its "sha256:<hex>" checksum (optional)
+	StorageChecksums map[string]string `json:"storageChecksums,omitempty"`
+
+	// AppSources are the slash-separated bundle paths (e.g. "apps/my-app")
+	// of the app source trees copied into the bundle, in the order of Apps
+	// (optional, see bundle.Options.IncludeAppSources)
+	AppSources []string `json:"appSources,omitempty"`
+
+	// Labels are arbitrary key/value tags such as "git.branch" or
+	// "environment" (optional, see ValidateLabelKey)
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // Options for creating a new manifest
 type Options struct {
-	Name     string
-	Version  string
-	Apps     []string
-	Platform string
+	Name             string
+	Version          string
+	Apps             []string
+	Platform         string
+	ConvexCLIVersion string
+	BackendVersion   string
+	PackageManager   string
+	Labels           map[string]string
 }
 
 // New creates a new Manifest with the given options
 func New(opts Options) *Manifest {
 	return &Manifest{
-		Name:      opts.Name,
-		Version:   opts.Version,
-		Apps:      opts.Apps,
-		Platform:  opts.Platform,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Name:             opts.Name,
+		Version:          opts.Version,
+		Apps:             opts.Apps,
+		Platform:         opts.Platform,
+		CreatedAt:        time.Now().UTC().Format(time.RFC3339),
+		ConvexCLIVersion: opts.ConvexCLIVersion,
+		BackendVersion:   opts.BackendVersion,
+		PackageManager:   opts.PackageManager,
+		Labels:           opts.Labels,
+	}
+}
+
+// MaxLabelKeyLength is the longest allowed label key
+const MaxLabelKeyLength = 63
+
+// labelKeyPattern matches keys made of letters, digits, '.', '-' and '_'
+// that start and end with a letter or digit
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?$`)
+
+// ValidateLabelKey returns an error if key is not a valid label key: 1 to
+// MaxLabelKeyLength letters, digits, '.', '-' or '_', starting and ending
+// with a letter or digit.
+func ValidateLabelKey(key string) error {
+	if len(key) > MaxLabelKeyLength {
+		return fmt.Errorf("label key %q is longer than %d characters", key, MaxLabelKeyLength)
+	}
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid label key %q: must contain only letters, digits, '.', '-' or '_' and start and end with a letter or digit", key)
+	}
+	return nil
+}
+
+// ParseLabels parses "key=value" pairs into a label map. Keys must be valid
+// (see ValidateLabelKey) and unique; values may be empty. Returns nil for no
+// pairs.
+func ParseLabels(pairs []string) (map[string]string, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", pair)
+		}
+		if err := ValidateLabelKey(key); err != nil {
+			return nil, err
+		}
+		if _, dup := labels[key]; dup {
+			return nil, fmt.Errorf("duplicate label key %q", key)
+		}
+		labels[key] = value
 	}
+	return labels, nil
+}
+
+// NormalizeApps returns app paths suitable for recording in a manifest, so it
+// does not leak the build machine's filesystem layout. Paths inside baseDir
+// become "./"-prefixed relative paths with forward slashes; absolute paths
+// outside baseDir are recorded by their base name. Relative paths that climb
+// out of baseDir with ".." are rejected.
+func NormalizeApps(apps []string, baseDir string) ([]string, error) {
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base directory %s: %w", baseDir, err)
+	}
+
+	normalized := make([]string, 0, len(apps))
+	for _, app := range apps {
+		abs := app
+		if !filepath.IsAbs(app) {
+			abs = filepath.Join(absBase, app)
+		}
+		rel, err := filepath.Rel(absBase, abs)
+		if err != nil || !filepath.IsLocal(rel) {
+			if !filepath.IsAbs(app) {
+				return nil, fmt.Errorf("app path %s is outside %s", app, absBase)
+			}
+			rel = filepath.Base(filepath.Clean(app))
+		}
+		if rel == "." {
+			rel = filepath.Base(absBase)
+		}
+		normalized = append(normalized, "./"+filepath.ToSlash(rel))
+	}
+	return normalized, nil
 }
 
 // ToJSON serializes the manifest to JSON
 func (m *Manifest) ToJSON() ([]byte, error) {
 	return json.MarshalIndent(m, "", "  ")
 }
+
+// ReproducibleTime returns the fixed timestamp used by reproducible builds:
+// SOURCE_DATE_EPOCH if set to a valid Unix time, otherwise the Unix epoch.
+func ReproducibleTime() time.Time {
+	if v := os.Getenv(SourceDateEpochEnv); v != "" {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(secs, 0).UTC()
+		}
+	}
+	return time.Unix(0, 0).UTC()
+}
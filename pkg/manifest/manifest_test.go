@@ -1,10 +1,15 @@
 package manifest
 
 import (
+	"bytes"
 	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -89,3 +94,270 @@ func TestManifest_ToJSON_Formatting(t *testing.T) {
 	assert.Contains(t, string(data), "\n")
 	assert.Contains(t, string(data), "  ")
 }
+
+func TestManifest_ToJSON_Toolchain(t *testing.T) {
+	mf := New(Options{
+		Name:             "Audited",
+		Version:          "1.0.0",
+		Apps:             []string{"/app"},
+		Platform:         "linux-x64",
+		ConvexCLIVersion: "1.17.4",
+		PackageManager:   "npm",
+	})
+
+	data, err := mf.ToJSON()
+	require.NoError(t, err)
+
+	var parsed map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, "1.17.4", parsed["convexCliVersion"])
+	assert.Equal(t, "npm", parsed["packageManager"])
+}
+
+func TestManifest_ToJSON_ToolchainOmitted(t *testing.T) {
+	mf := New(Options{
+		Name:     "Plain",
+		Version:  "1.0.0",
+		Apps:     []string{"/app"},
+		Platform: "linux-x64",
+	})
+
+	data, err := mf.ToJSON()
+	require.NoError(t, err)
+
+	var parsed map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.NotContains(t, parsed, "convexCliVersion")
+	assert.NotContains(t, parsed, "packageManager")
+}
+
+func TestReproducibleTime(t *testing.T) {
+	t.Setenv(SourceDateEpochEnv, "")
+	assert.Equal(t, time.Unix(0, 0).UTC(), ReproducibleTime())
+
+	t.Setenv(SourceDateEpochEnv, "1700000000")
+	assert.Equal(t, time.Unix(1700000000, 0).UTC(), ReproducibleTime())
+
+	t.Setenv(SourceDateEpochEnv, "not-a-number")
+	assert.Equal(t, time.Unix(0, 0).UTC(), ReproducibleTime())
+}
+
+func TestNormalizeApps(t *testing.T) {
+	base := t.TempDir()
+
+	apps, err := NormalizeApps([]string{
+		filepath.Join(base, "apps", "web"),
+		"test-app",
+		"./nested/../other-app/",
+		"/Users/me/app",
+	}, base)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"./apps/web", "./test-app", "./other-app", "./app"}, apps)
+
+	_, err = NormalizeApps([]string{"../outside"}, base)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "outside")
+
+	_, err = NormalizeApps([]string{"app/../../outside"}, base)
+	assert.Error(t, err)
+}
+
+func TestManifest_Labels_RoundTrip(t *testing.T) {
+	mf := New(Options{
+		Name:     "Labelled",
+		Version:  "1.0.0",
+		Apps:     []string{"./app"},
+		Platform: "linux-x64",
+		Labels:   map[string]string{"git.branch": "main", "environment": "prod", "empty": ""},
+	})
+
+	data, err := mf.ToJSON()
+	require.NoError(t, err)
+
+	var parsed Manifest
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, mf.Labels, parsed.Labels)
+
+	// Labels are omitted when unset
+	plain, err := New(Options{Name: "Plain", Version: "1.0.0", Platform: "linux-x64"}).ToJSON()
+	require.NoError(t, err)
+	assert.NotContains(t, string(plain), "labels")
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"git.branch=feature/x", "build.id=42", "note=a=b", "empty="})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"git.branch": "feature/x",
+		"build.id":   "42",
+		"note":       "a=b",
+		"empty":      "",
+	}, labels)
+
+	labels, err = ParseLabels(nil)
+	require.NoError(t, err)
+	assert.Nil(t, labels)
+}
+
+func TestParseLabels_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs []string
+		want  string
+	}{
+		{"missing separator", []string{"environment"}, "expected key=value"},
+		{"empty key", []string{"=prod"}, "invalid label key"},
+		{"bad character", []string{"git branch=main"}, "invalid label key"},
+		{"leading dot", []string{".hidden=1"}, "invalid label key"},
+		{"too long", []string{strings.Repeat("a", MaxLabelKeyLength+1) + "=x"}, "longer than"},
+		{"duplicate", []string{"env=prod", "env=dev"}, `duplicate label key "env"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLabels(tt.pairs)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestManifest_Diff(t *testing.T) {
+	old := &Manifest{
+		Name:     "Backend",
+		Version:  "1.0.0",
+		Apps:     []string{"./app", "./admin"},
+		Platform: "linux-x64",
+		Labels:   map[string]string{"environment": "prod", "git.branch": "main"},
+	}
+
+	t.Run("identical", func(t *testing.T) {
+		same := *old
+		same.CreatedAt = "2024-01-01T00:00:00Z"
+		diff := old.Diff(&same)
+		assert.True(t, diff.Empty())
+		assert.Empty(t, diff.Fields)
+	})
+
+	t.Run("version change", func(t *testing.T) {
+		changed := *old
+		changed.Version = "1.1.0"
+		diff := old.Diff(&changed)
+		assert.False(t, diff.Empty())
+		assert.Equal(t, []FieldChange{{Field: "version", Old: "1.0.0", New: "1.1.0"}}, diff.Fields)
+		assert.Empty(t, diff.AppsAdded)
+		assert.Empty(t, diff.AppsRemoved)
+	})
+
+	t.Run("platform change", func(t *testing.T) {
+		changed := *old
+		changed.Platform = "linux-arm64"
+		diff := old.Diff(&changed)
+		assert.Equal(t, []FieldChange{{Field: "platform", Old: "linux-x64", New: "linux-arm64"}}, diff.Fields)
+	})
+
+	t.Run("backend version change", func(t *testing.T) {
+		changed := *old
+		changed.BackendVersion = "0.2.0"
+		diff := old.Diff(&changed)
+		assert.Equal(t, []FieldChange{{Field: "backendVersion", Old: "", New: "0.2.0"}}, diff.Fields)
+	})
+
+	t.Run("apps added and removed", func(t *testing.T) {
+		changed := *old
+		changed.Apps = []string{"./worker", "./app", "./api"}
+		diff := old.Diff(&changed)
+		assert.Empty(t, diff.Fields)
+		assert.Equal(t, []string{"./api", "./worker"}, diff.AppsAdded)
+		assert.Equal(t, []string{"./admin"}, diff.AppsRemoved)
+	})
+
+	t.Run("app order is ignored", func(t *testing.T) {
+		changed := *old
+		changed.Apps = []string{"./admin", "./app"}
+		assert.True(t, old.Diff(&changed).Empty())
+	})
+
+	t.Run("labels", func(t *testing.T) {
+		changed := *old
+		changed.Labels = map[string]string{"environment": "staging", "build.id": "42"}
+		diff := old.Diff(&changed)
+		assert.Equal(t, []FieldChange{
+			{Field: "labels.build.id", Old: "", New: "42"},
+			{Field: "labels.environment", Old: "prod", New: "staging"},
+			{Field: "labels.git.branch", Old: "main", New: ""},
+		}, diff.Fields)
+	})
+
+	t.Run("nil manifest", func(t *testing.T) {
+		diff := old.Diff(nil)
+		assert.Contains(t, diff.Fields, FieldChange{Field: "version", Old: "1.0.0", New: ""})
+		assert.Equal(t, []string{"./admin", "./app"}, diff.AppsRemoved)
+	})
+}
+
+// compileSchema compiles a JSON Schema document for validating test instances
+func compileSchema(t *testing.T, schema []byte) *jsonschema.Schema {
+	t.Helper()
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema))
+	require.NoError(t, err)
+	compiler := jsonschema.NewCompiler()
+	require.NoError(t, compiler.AddResource("schema.json", doc))
+	compiled, err := compiler.Compile("schema.json")
+	require.NoError(t, err)
+	return compiled
+}
+
+// validateJSON validates data against schema
+func validateJSON(t *testing.T, schema *jsonschema.Schema, data []byte) error {
+	t.Helper()
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	require.NoError(t, err)
+	return schema.Validate(inst)
+}
+
+func TestJSONSchema_ValidatesManifest(t *testing.T) {
+	schema := compileSchema(t, JSONSchema())
+
+	mf := New(Options{
+		Name:             "Test Backend",
+		Version:          "1.0.0",
+		Apps:             []string{"./app1"},
+		Platform:         "linux-x64",
+		ConvexCLIVersion: "1.17.0",
+		PackageManager:   "npm",
+		Labels:           map[string]string{"git.branch": "main"},
+	})
+	mf.StorageChecksums = map[string]string{"a/b.bin": "sha256:" + strings.Repeat("ab", 32)}
+	data, err := mf.ToJSON()
+	require.NoError(t, err)
+	assert.NoError(t, validateJSON(t, schema, data))
+
+	// A minimal manifest without apps is valid too
+	data, err = New(Options{Name: "Empty", Version: "0.1.0", Platform: "linux-arm64"}).ToJSON()
+	require.NoError(t, err)
+	assert.NoError(t, validateJSON(t, schema, data))
+
+	for name, doc := range map[string]string{
+		"missing name":       `{"version": "1", "apps": [], "platform": "linux-x64", "createdAt": "2024-01-01T00:00:00Z"}`,
+		"apps not strings":   `{"name": "x", "version": "1", "apps": [1], "platform": "linux-x64", "createdAt": "2024-01-01T00:00:00Z"}`,
+		"invalid label key":  `{"name": "x", "version": "1", "apps": [], "platform": "linux-x64", "createdAt": "2024-01-01T00:00:00Z", "labels": {"-bad": "v"}}`,
+		"invalid checksum":   `{"name": "x", "version": "1", "apps": [], "platform": "linux-x64", "createdAt": "2024-01-01T00:00:00Z", "storageChecksums": {"a": "md5:00"}}`,
+		"version not string": `{"name": "x", "version": 1, "apps": [], "platform": "linux-x64", "createdAt": "2024-01-01T00:00:00Z"}`,
+	} {
+		assert.Error(t, validateJSON(t, schema, []byte(doc)), name)
+	}
+}
+
+func TestJSONSchema_CoversAllFields(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	require.NoError(t, json.Unmarshal(JSONSchema(), &schema))
+
+	typ := reflect.TypeOf(Manifest{})
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		assert.Contains(t, schema.Properties, name, "schema is missing Manifest.%s", typ.Field(i).Name)
+	}
+	assert.Len(t, schema.Properties, typ.NumField())
+}
@@ -0,0 +1,14 @@
+package manifest
+
+import (
+	_ "embed"
+)
+
+//go:embed schema.json
+var jsonSchema []byte
+
+// JSONSchema returns a JSON Schema (draft 2020-12) describing manifest.json,
+// for tools that read bundles without this package.
+func JSONSchema() []byte {
+	return append([]byte(nil), jsonSchema...)
+}
@@ -0,0 +1,110 @@
+package platform
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Default is the platform used when none is specified.
+const Default = "linux-x64"
+
+// Platform describes a platform known to convex-bundler.
+type Platform struct {
+	// Name is the canonical platform name used in flags and manifests (e.g., "linux-x64")
+	Name string
+
+	// GOOS and GOARCH identify the platform to the Go toolchain
+	GOOS   string
+	GOARCH string
+
+	// BackendArtifact is the target triple of the convex-local-backend release
+	// artifact, or empty if no backend is published for the platform
+	BackendArtifact string
+
+	// SelfHost is true if self-extracting executables can target the platform
+	SelfHost bool
+}
+
+// registry lists every known platform. Adding a platform here makes it
+// available to the CLI, predeploy and selfhost.
+var registry = []Platform{
+	{Name: "linux-x64", GOOS: "linux", GOARCH: "amd64", BackendArtifact: "x86_64-unknown-linux-gnu", SelfHost: true},
+	{Name: "linux-arm64", GOOS: "linux", GOARCH: "arm64", BackendArtifact: "aarch64-unknown-linux-gnu", SelfHost: true},
+	{Name: "darwin-x64", GOOS: "darwin", GOARCH: "amd64", BackendArtifact: "x86_64-apple-darwin"},
+	{Name: "darwin-arm64", GOOS: "darwin", GOARCH: "arm64", BackendArtifact: "aarch64-apple-darwin"},
+	{Name: "windows-x64", GOOS: "windows", GOARCH: "amd64", BackendArtifact: "x86_64-pc-windows-msvc"},
+	{Name: "wasip1-wasm", GOOS: "wasip1", GOARCH: "wasm"},
+}
+
+// All returns every known platform.
+func All() []Platform {
+	return append([]Platform(nil), registry...)
+}
+
+// Names returns the canonical names of every known platform.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for _, p := range registry {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Lookup returns the platform with the given canonical name.
+func Lookup(name string) (Platform, bool) {
+	for _, p := range registry {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Platform{}, false
+}
+
+// FromGo returns the platform with the given GOOS and GOARCH.
+func FromGo(goos, goarch string) (Platform, bool) {
+	for _, p := range registry {
+		if p.GOOS == goos && p.GOARCH == goarch {
+			return p, true
+		}
+	}
+	return Platform{}, false
+}
+
+// FromLinuxArch returns the Linux platform for an architecture as reported
+// by `uname -m` (e.g., "x86_64", "aarch64") or Go (e.g., "amd64", "arm64").
+func FromLinuxArch(arch string) (Platform, bool) {
+	switch strings.TrimSpace(arch) {
+	case "x86_64", "amd64":
+		return FromGo("linux", "amd64")
+	case "aarch64", "arm64":
+		return FromGo("linux", "arm64")
+	}
+	return Platform{}, false
+}
+
+// Host returns the canonical name of the platform this program runs on, or
+// "<GOOS>-<GOARCH>" if it is not in the registry.
+func Host() string {
+	if p, ok := FromGo(runtime.GOOS, runtime.GOARCH); ok {
+		return p.Name
+	}
+	return runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// SelfHostTargets returns the names of the platforms that self-extracting
+// executables can target.
+func SelfHostTargets() []string {
+	var names []string
+	for _, p := range registry {
+		if p.SelfHost {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+// IsSelfHostTarget reports whether self-extracting executables can target the named platform.
+func IsSelfHostTarget(name string) bool {
+	p, ok := Lookup(name)
+	return ok && p.SelfHost
+}
@@ -0,0 +1,102 @@
+package platform
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	p, ok := Lookup("linux-x64")
+	require.True(t, ok)
+	assert.Equal(t, "linux", p.GOOS)
+	assert.Equal(t, "amd64", p.GOARCH)
+	assert.Equal(t, "x86_64-unknown-linux-gnu", p.BackendArtifact)
+	assert.True(t, p.SelfHost)
+
+	p, ok = Lookup("windows-x64")
+	require.True(t, ok)
+	assert.Equal(t, "windows", p.GOOS)
+	assert.False(t, p.SelfHost)
+
+	p, ok = Lookup("wasip1-wasm")
+	require.True(t, ok)
+	assert.Equal(t, "wasm", p.GOARCH)
+	assert.Empty(t, p.BackendArtifact)
+
+	_, ok = Lookup("solaris-sparc")
+	assert.False(t, ok)
+
+	_, ok = Lookup(Default)
+	assert.True(t, ok, "default platform must be registered")
+}
+
+func TestFromGo(t *testing.T) {
+	p, ok := FromGo("darwin", "arm64")
+	require.True(t, ok)
+	assert.Equal(t, "darwin-arm64", p.Name)
+
+	_, ok = FromGo("plan9", "386")
+	assert.False(t, ok)
+}
+
+func TestFromLinuxArch(t *testing.T) {
+	tests := map[string]string{
+		"x86_64":    "linux-x64",
+		"amd64":     "linux-x64",
+		"aarch64":   "linux-arm64",
+		"arm64":     "linux-arm64",
+		"aarch64\n": "linux-arm64",
+	}
+	for arch, expected := range tests {
+		p, ok := FromLinuxArch(arch)
+		require.True(t, ok, arch)
+		assert.Equal(t, expected, p.Name, arch)
+	}
+
+	_, ok := FromLinuxArch("riscv64")
+	assert.False(t, ok)
+}
+
+func TestHost(t *testing.T) {
+	if p, ok := FromGo(runtime.GOOS, runtime.GOARCH); ok {
+		assert.Equal(t, p.Name, Host())
+	} else {
+		assert.Equal(t, runtime.GOOS+"-"+runtime.GOARCH, Host())
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	assert.Len(t, names, len(All()))
+	assert.Contains(t, names, Default)
+	assert.Contains(t, names, "windows-x64")
+	assert.Contains(t, names, "wasip1-wasm")
+}
+
+func TestSelfHostTargets(t *testing.T) {
+	assert.Equal(t, []string{"linux-x64", "linux-arm64"}, SelfHostTargets())
+	assert.True(t, IsSelfHostTarget("linux-arm64"))
+	assert.False(t, IsSelfHostTarget("darwin-arm64"))
+	assert.False(t, IsSelfHostTarget("unknown"))
+}
+
+func TestRegistryIsConsistent(t *testing.T) {
+	names := map[string]bool{}
+	goPairs := map[string]bool{}
+	for _, p := range All() {
+		assert.False(t, names[p.Name], "duplicate platform name %s", p.Name)
+		names[p.Name] = true
+
+		pair := p.GOOS + "/" + p.GOARCH
+		assert.False(t, goPairs[pair], "duplicate GOOS/GOARCH %s", pair)
+		goPairs[pair] = true
+
+		if p.SelfHost {
+			assert.Equal(t, "linux", p.GOOS, "self-host targets must be Linux: %s", p.Name)
+			assert.NotEmpty(t, p.BackendArtifact, "self-host targets need a backend: %s", p.Name)
+		}
+	}
+}
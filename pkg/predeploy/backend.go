@@ -0,0 +1,184 @@
+package predeploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Backend is a running convex-local-backend that apps are deployed to.
+type Backend interface {
+	// URL is the address the Convex CLI deploys to
+	URL() string
+
+	// AdminKey authorizes deployments to the backend
+	AdminKey() string
+
+	// ExportDatabase writes the backend's SQLite database to dest
+	ExportDatabase(dest string) error
+}
+
+// StorageExporter is implemented by backends that can also export their file storage.
+type StorageExporter interface {
+	// ExportStorage copies the backend's file storage into the directory dest
+	ExportStorage(dest string) error
+}
+
+// appDeployer deploys apps to a backend and reports the Convex CLI version used.
+type appDeployer interface {
+	installDeps(ctx context.Context, index int, app string) error
+	deployApp(ctx context.Context, index int, app string, backend Backend) error
+	cliVersion(ctx context.Context, index int, app string) (string, error)
+}
+
+// ExternalBackend is an already running convex-local-backend, e.g. a local
+// process or a remote host. Apps are deployed to it with the npm and npx
+// found on this machine's PATH.
+type ExternalBackend struct {
+	url      string
+	adminKey string
+
+	// DatabasePath is the backend's SQLite database on this machine, copied
+	// by ExportDatabase. Stop the backend first so the copy is consistent
+	DatabasePath string
+
+	// StoragePath is the backend's local storage directory on this machine,
+	// copied by ExportStorage (optional)
+	StoragePath string
+}
+
+// NewExternalBackend returns an ExternalBackend for the backend at url.
+func NewExternalBackend(url, adminKey string) *ExternalBackend {
+	return &ExternalBackend{url: url, adminKey: adminKey}
+}
+
+// URL returns the backend URL.
+func (b *ExternalBackend) URL() string {
+	return b.url
+}
+
+// AdminKey returns the admin key for the backend.
+func (b *ExternalBackend) AdminKey() string {
+	return b.adminKey
+}
+
+// ExportDatabase copies DatabasePath to dest.
+func (b *ExternalBackend) ExportDatabase(dest string) error {
+	if b.DatabasePath == "" {
+		return fmt.Errorf("external backend at %s has no database path to export", b.url)
+	}
+	if err := copyFile(b.DatabasePath, dest); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	return nil
+}
+
+// ExportStorage copies the files under StoragePath into dest. It does nothing
+// if StoragePath is empty.
+func (b *ExternalBackend) ExportStorage(dest string) error {
+	if b.StoragePath == "" {
+		return nil
+	}
+	return filepath.Walk(b.StoragePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(b.StoragePath, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		target := filepath.Join(dest, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if err := copyFile(path, target); err != nil {
+			return fmt.Errorf("failed to copy storage file %s: %w", relPath, err)
+		}
+		return nil
+	})
+}
+
+// hostDeployer deploys apps by running the Convex CLI on this machine.
+type hostDeployer struct {
+	deployArgs      []string // Appended to each convex deploy
+	strictTypecheck bool     // Fail deploys whose output reports TypeScript errors
+}
+
+func (hostDeployer) installDeps(ctx context.Context, _ int, app string) error {
+	if output, err := runHostCommand(ctx, app, "npm", "install", "--silent"); err != nil {
+		return fmt.Errorf("failed to install dependencies: %w (output: %s)", err, output)
+	}
+	return nil
+}
+
+func (d hostDeployer) deployApp(ctx context.Context, _ int, app string, backend Backend) error {
+	args := append([]string{"convex", "deploy", "--admin-key", backend.AdminKey(), "--url", backend.URL(), "--yes"}, d.deployArgs...)
+	output, err := runHostCommand(ctx, app, "npx", args...)
+	if err != nil {
+		if typecheckErr := typecheckError(output); typecheckErr != nil {
+			return typecheckErr
+		}
+		return fmt.Errorf("%w (output: %s)", err, output)
+	}
+	if d.strictTypecheck {
+		return typecheckError(output)
+	}
+	return nil
+}
+
+func (hostDeployer) cliVersion(ctx context.Context, _ int, app string) (string, error) {
+	output, err := runHostCommand(ctx, app, "npx", "convex", "--version")
+	if err != nil {
+		return "", err
+	}
+	return parseCLIVersion(output), nil
+}
+
+// runHostCommand runs name with args in dir and returns its combined output.
+func runHostCommand(ctx context.Context, dir string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+// copyFile copies the regular file src to dst, creating dst's parent directory.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// absPaths returns the absolute form of each app path.
+func absPaths(apps []string) ([]string, error) {
+	var absApps []string
+	for _, app := range apps {
+		absApp, err := filepath.Abs(app)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for app %s: %w", app, err)
+		}
+		absApps = append(absApps, absApp)
+	}
+	return absApps, nil
+}
@@ -0,0 +1,486 @@
+package predeploy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
+	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// dockerBackendURL is where the backend listens, as seen from inside its container
+const dockerBackendURL = "http://localhost:3210"
+
+// dockerInstanceName is the instance name of the pre-deployment backend
+const dockerInstanceName = "test"
+
+// startContainer creates and starts a container. It is a variable so tests
+// can simulate Docker failures.
+var startContainer = testcontainers.GenericContainer
+
+// DockerBackend is a convex-local-backend running in a Docker container with
+// the apps bind-mounted at /app0, /app1, ... and git apps cloned to
+// /git-app<n>. Apps are deployed from inside the container, so URL is only
+// reachable there.
+type DockerBackend struct {
+	ctx             context.Context
+	container       testcontainers.Container
+	adminKey        string
+	log             logging.Logger
+	apps            []containerApp
+	deployArgs      []string // Appended to each convex deploy
+	strictTypecheck bool     // Fail deploys whose output reports TypeScript errors
+}
+
+// containerApp is an app as seen from inside the container.
+type containerApp struct {
+	dir   string // App directory
+	clone string // Command that clones a git app before its dependencies are installed (empty for mounted apps)
+}
+
+// containerApps lays out the mounted apps at /app<i> followed by the git
+// apps, each cloned to /git-app<i>.
+func containerApps(localApps int, gitApps []GitApp) []containerApp {
+	apps := make([]containerApp, 0, localApps+len(gitApps))
+	for i := 0; i < localApps; i++ {
+		apps = append(apps, containerApp{dir: fmt.Sprintf("/app%d", i)})
+	}
+	for _, app := range gitApps {
+		cloneDir := fmt.Sprintf("/git-app%d", len(apps))
+		apps = append(apps, containerApp{
+			dir:   path.Join(cloneDir, app.Subdir),
+			clone: gitCloneCommand(app, cloneDir),
+		})
+	}
+	return apps
+}
+
+// StartDockerBackend starts a container from opts.DockerImage with opts.Apps
+// mounted (opts.GitApps are cloned when their dependencies are installed),
+// installs the backend if needed and waits for it to be ready.
+// Container startup and setup are retried according to opts.MaxRetries.
+// The caller must call Terminate when done.
+func StartDockerBackend(ctx context.Context, opts Options) (*DockerBackend, error) {
+	log := logging.OrNop(opts.Logger)
+
+	absApps, err := absPaths(opts.Apps)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateGitApps(opts.GitApps); err != nil {
+		return nil, err
+	}
+	extraArgs, err := deployArgs(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if a backend binary was provided and exists
+	var useProvidedBinary bool
+	var absBackendBinary string
+	if opts.BackendBinary != "" {
+		var absErr error
+		absBackendBinary, absErr = filepath.Abs(opts.BackendBinary)
+		if absErr != nil {
+			return nil, fmt.Errorf("failed to get absolute path for backend binary: %w", absErr)
+		}
+		if _, statErr := os.Stat(absBackendBinary); statErr == nil {
+			useProvidedBinary = true
+		}
+	}
+
+	// Create bind mounts for apps
+	var mounts testcontainers.ContainerMounts
+	for i, app := range absApps {
+		mounts = append(mounts,
+			testcontainers.BindMount(app, testcontainers.ContainerMountTarget(fmt.Sprintf("/app%d", i))),
+		)
+	}
+
+	// If backend binary is provided, mount it into the container
+	if useProvidedBinary {
+		mounts = append(mounts,
+			testcontainers.BindMount(absBackendBinary, testcontainers.ContainerMountTarget("/usr/local/bin/convex-local-backend")),
+		)
+	}
+
+	// Share the package manager caches with the host
+	var env map[string]string
+	if opts.DependencyCacheDir != "" {
+		cacheDir, err := prepareDependencyCacheDir(opts.DependencyCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		log.Debugf("Using dependency cache %s", cacheDir)
+		mounts = append(mounts,
+			testcontainers.BindMount(cacheDir, testcontainers.ContainerMountTarget(containerCacheDir)),
+		)
+		env = dependencyCacheEnv
+	}
+
+	// Determine which Docker image to use
+	dockerImage := opts.DockerImage
+	if dockerImage == "" {
+		dockerImage = DefaultPredeployImage
+	}
+	usePredeployImage := isPredeployImage(dockerImage)
+
+	// Create container request
+	req := testcontainers.ContainerRequest{
+		Image:        dockerImage,
+		ExposedPorts: []string{"3210/tcp"},
+		Cmd:          []string{"sh", "-c", "sleep infinity"},
+		WaitingFor:   wait.ForExec([]string{"true"}).WithStartupTimeout(60 * time.Second),
+		Mounts:       mounts,
+		Env:          env,
+		Labels:       map[string]string{containerLabel: "true"},
+	}
+
+	// Start and prepare the container, recreating it if a step fails and retries are enabled
+	var container testcontainers.Container
+	err = retry(ctx, opts.MaxRetries, opts.RetryBackoff, log, func() error {
+		log.Debugf("Starting pre-deployment container from image %s", dockerImage)
+		c, err := startContainer(ctx, testcontainers.GenericContainerRequest{
+			ContainerRequest: req,
+			Started:          true,
+		})
+		if err != nil {
+			if c != nil {
+				c.Terminate(context.WithoutCancel(ctx))
+			}
+			return classifyStartError(fmt.Errorf("failed to start container: %w", err), dockerImage)
+		}
+		if err := prepareContainer(ctx, c, opts.Platform, usePredeployImage, useProvidedBinary, len(opts.GitApps) > 0); err != nil {
+			c.Terminate(context.WithoutCancel(ctx))
+			return err
+		}
+		container = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &DockerBackend{ctx: ctx, container: container, log: log, apps: containerApps(len(absApps), opts.GitApps), deployArgs: extraArgs, strictTypecheck: opts.StrictTypecheck}
+	if err := backend.start(ctx); err != nil {
+		container.Terminate(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	return backend, nil
+}
+
+// prepareDependencyCacheDir returns the absolute path of dir, creating it
+// if it does not exist. It is not opened to other users: the container runs
+// as root, which can write to the bind mount regardless.
+func prepareDependencyCacheDir(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path for dependency cache: %w", err)
+	}
+	info, err := os.Stat(absDir)
+	switch {
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(absDir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create dependency cache: %w", err)
+		}
+	case err != nil:
+		return "", fmt.Errorf("failed to access dependency cache: %w", err)
+	case !info.IsDir():
+		return "", fmt.Errorf("dependency cache is not a directory: %s", absDir)
+	}
+	return absDir, nil
+}
+
+// start launches convex-local-backend in the container and generates its admin key.
+func (b *DockerBackend) start(ctx context.Context) error {
+	// Create data directory in container
+	exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("mkdir -p %s %s", containerDataDir, containerStoragePath)})
+	if err != nil || exitCode != 0 {
+		return fmt.Errorf("failed to create data directory: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+	}
+
+	// Start the backend and wait for it to be ready in a single exec call
+	// Using sh -c with & and a polling loop ensures the process stays running
+	// Note: instance-secret must be a valid 64-character hex string (32 bytes)
+	// The admin key format for local backend is: instanceName|deployKeySecret
+	const instanceSecret = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	startAndWaitCmd := fmt.Sprintf(`/usr/local/bin/convex-local-backend %s --port 3210 --instance-name %s --instance-secret %s --local-storage %s > /tmp/backend.log 2>&1 &
+for i in $(seq 1 30); do
+  # Check if curl can reach the backend (any response means it's ready)
+  if curl -sf %s/version > /dev/null 2>&1; then
+    echo "Backend is ready"
+    exit 0
+  fi
+  sleep 1
+done
+echo "Backend failed to start"
+cat /tmp/backend.log 2>/dev/null || true
+exit 1`, containerDBPath, dockerInstanceName, instanceSecret, containerStoragePath, dockerBackendURL)
+	exitCode, output, err = b.container.Exec(ctx, []string{"sh", "-c", startAndWaitCmd})
+	if err != nil || exitCode != 0 {
+		return fmt.Errorf("failed to start backend: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+	}
+
+	// Generate the admin key for the instance started above
+	b.adminKey, err = credentials.IssueKey(instanceSecret, dockerInstanceName, credentials.KeyOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to generate admin key: %w", err)
+	}
+	return nil
+}
+
+// URL returns the backend URL as seen from inside the container.
+func (b *DockerBackend) URL() string {
+	return dockerBackendURL
+}
+
+// AdminKey returns the admin key for the backend.
+func (b *DockerBackend) AdminKey() string {
+	return b.adminKey
+}
+
+// Terminate stops and removes the container.
+func (b *DockerBackend) Terminate(ctx context.Context) error {
+	return b.container.Terminate(ctx)
+}
+
+// installDeps clones the app at index if it is a git app and installs its dependencies.
+func (b *DockerBackend) installDeps(ctx context.Context, index int, _ string) error {
+	app := b.apps[index]
+	if app.clone != "" {
+		exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", app.clone})
+		if err != nil || exitCode != 0 {
+			return fmt.Errorf("failed to clone app: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+		}
+	}
+	exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("cd %s && npm install --silent", shellQuote(app.dir))})
+	if err != nil || exitCode != 0 {
+		return fmt.Errorf("failed to install dependencies: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+	}
+	return nil
+}
+
+// deployApp deploys the app at index.
+func (b *DockerBackend) deployApp(ctx context.Context, index int, _ string, backend Backend) error {
+	deployCmd := deployCommand(b.apps[index].dir, backend.AdminKey(), backend.URL(), b.deployArgs)
+	exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", deployCmd}, tcexec.Multiplexed())
+	if err != nil || exitCode != 0 {
+		out := readOutput(output)
+		if typecheckErr := typecheckError(out); typecheckErr != nil {
+			return typecheckErr
+		}
+		return fmt.Errorf("%v (exit code: %d, output: %s)", err, exitCode, out)
+	}
+	if b.strictTypecheck {
+		return typecheckError(readOutput(output))
+	}
+	return nil
+}
+
+// deployCommand returns the shell command that deploys the app in dir, with
+// every argument quoted so extraArgs cannot break out of the invocation.
+func deployCommand(dir, adminKey, url string, extraArgs []string) string {
+	cmd := fmt.Sprintf("cd %s && npx convex deploy --admin-key %s --url %s --yes", shellQuote(dir), shellQuote(adminKey), shellQuote(url))
+	for _, arg := range extraArgs {
+		cmd += " " + shellQuote(arg)
+	}
+	return cmd
+}
+
+// cliVersion returns the Convex CLI version used for the app at index.
+func (b *DockerBackend) cliVersion(ctx context.Context, index int, _ string) (string, error) {
+	exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("cd %s && npx convex --version", shellQuote(b.apps[index].dir))}, tcexec.Multiplexed())
+	if err != nil || exitCode != 0 {
+		return "", fmt.Errorf("%v (exit code: %d)", err, exitCode)
+	}
+	return parseCLIVersion(readOutput(output)), nil
+}
+
+// ExportDatabase copies the backend's SQLite database out of the container to dest.
+func (b *DockerBackend) ExportDatabase(dest string) error {
+	ctx := b.ctx
+
+	// Verify the database file exists in the container and get its size
+	exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("ls -la %s && stat -c %%s %s", containerDBPath, containerDBPath)})
+	if err != nil || exitCode != 0 {
+		return fmt.Errorf("database file not found at %s: %v (exit code: %d, output: %s)", containerDBPath, err, exitCode, readOutput(output))
+	}
+
+	// Use CopyFileFromContainer to get the database
+	// This is more reliable than base64 encoding through exec
+	reader, err := b.container.CopyFileFromContainer(ctx, containerDBPath)
+	if err != nil {
+		return fmt.Errorf("failed to copy database from container: %w", err)
+	}
+	defer reader.Close()
+
+	// Read the tar stream
+	tarData, err := io.ReadAll(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read tar data: %w", err)
+	}
+
+	if len(tarData) == 0 {
+		return fmt.Errorf("received empty tar data from container")
+	}
+
+	// Extract the database from the tar archive
+	if err := extractTarFile(bytes.NewReader(tarData), dest); err != nil {
+		return fmt.Errorf("failed to extract database from tar: %w", err)
+	}
+	return nil
+}
+
+// ExportStorage copies the backend's file storage out of the container into dest.
+func (b *DockerBackend) ExportStorage(dest string) error {
+	ctx := b.ctx
+
+	// First list what files exist in storage
+	exitCode, listOutput, _ := b.container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("find %s -type f 2>/dev/null", containerStoragePath)})
+	if exitCode != 0 {
+		return nil
+	}
+	fileList := strings.TrimSpace(readOutput(listOutput))
+	// Remove docker control characters
+	fileList = strings.Map(func(r rune) rune {
+		if r < 32 && r != '\n' {
+			return -1
+		}
+		return r
+	}, fileList)
+	if fileList == "" {
+		return nil
+	}
+
+	fileCount := strings.Count(fileList, "\n") + 1
+	b.log.Infof("Storage files in container: %d files", fileCount)
+
+	// Create tar of storage directory inside container
+	const storageTarPath = "/tmp/storage.tar"
+	exitCode, output, err := b.container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf(
+		"cd %s && tar -cf %s .",
+		containerStoragePath, storageTarPath,
+	)})
+	if err != nil || exitCode != 0 {
+		return fmt.Errorf("failed to create storage tar: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+	}
+
+	// Copy the tar file from container
+	// CopyFileFromContainer returns the tar file content directly as a tar stream
+	// (not wrapped in another tar) - this is the actual storage.tar we created
+	tarReader, err := b.container.CopyFileFromContainer(ctx, storageTarPath)
+	if err != nil {
+		return fmt.Errorf("failed to copy storage tar: %w", err)
+	}
+	tarData, err := io.ReadAll(tarReader)
+	tarReader.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read storage tar: %w", err)
+	}
+	if len(tarData) == 0 {
+		return nil
+	}
+
+	// The tarData IS the storage.tar content directly
+	if err := extractTarDirectoryNoStrip(bytes.NewReader(tarData), dest); err != nil {
+		return fmt.Errorf("failed to extract storage contents: %w", err)
+	}
+	return nil
+}
+
+// requiredPackages returns the apt packages a base image needs: curl and
+// unzip to download the backend binary, and git to clone git apps.
+func requiredPackages(useProvidedBinary, cloneGitApps bool) []string {
+	var packages []string
+	if !useProvidedBinary {
+		packages = append(packages, "curl", "unzip")
+	}
+	if cloneGitApps {
+		packages = append(packages, "git")
+	}
+	return packages
+}
+
+// prepareContainer installs the tools and backend binary that the container
+// needs before the backend can be started. It is safe to retry on a fresh container.
+func prepareContainer(ctx context.Context, container testcontainers.Container, platform string, usePredeployImage, useProvidedBinary, cloneGitApps bool) error {
+	var exitCode int
+	var output io.Reader
+	var err error
+
+	// If not using pre-deploy image, install dependencies manually
+	if !usePredeployImage {
+		// Install required tools - only needed to download the binary or clone apps
+		if packages := requiredPackages(useProvidedBinary, cloneGitApps); len(packages) > 0 {
+			exitCode, output, err = container.Exec(ctx, []string{
+				"sh", "-c", "apt-get update && apt-get install -y " + strings.Join(packages, " "),
+			})
+			if err != nil || exitCode != 0 {
+				return fmt.Errorf("failed to install required tools: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+			}
+		}
+
+		// Install convex CLI
+		exitCode, output, err = container.Exec(ctx, []string{
+			"sh", "-c", "npm install -g convex",
+		})
+		if err != nil || exitCode != 0 {
+			return fmt.Errorf("failed to install convex CLI: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+		}
+
+		// Download the backend binary only if not provided via mount
+		if !useProvidedBinary {
+			// Detect container architecture using shell command to capture output properly
+			exitCode, archOutput, err := container.Exec(ctx, []string{"sh", "-c", "uname -m"})
+			var containerArch string
+			if err == nil && exitCode == 0 {
+				archStr := readOutput(archOutput)
+				// Clean up the output - remove control characters and whitespace
+				containerArch = strings.TrimSpace(archStr)
+				// Handle common arch strings
+				if strings.Contains(containerArch, "aarch64") {
+					containerArch = "aarch64"
+				} else if strings.Contains(containerArch, "x86_64") {
+					containerArch = "x86_64"
+				}
+			}
+
+			// Download the Linux backend binary inside the container
+			platformStr := getPlatformString(platform, containerArch)
+			downloadURL := fmt.Sprintf(backendDownloadURL, backendReleaseTag, platformStr)
+			downloadCmd := fmt.Sprintf(
+				"curl -L -o /tmp/convex-local-backend.zip '%s' && "+
+					"unzip -o /tmp/convex-local-backend.zip -d /usr/local/bin && "+
+					"chmod +x /usr/local/bin/convex-local-backend && "+
+					"rm /tmp/convex-local-backend.zip",
+				downloadURL,
+			)
+			exitCode, output, err = container.Exec(ctx, []string{"sh", "-c", downloadCmd})
+			if err != nil || exitCode != 0 {
+				return fmt.Errorf("failed to download backend binary: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+			}
+		}
+	}
+
+	// If using provided binary, make sure it's executable in the container
+	if useProvidedBinary {
+		exitCode, output, err = container.Exec(ctx, []string{
+			"sh", "-c", "chmod +x /usr/local/bin/convex-local-backend",
+		})
+		if err != nil || exitCode != 0 {
+			return fmt.Errorf("failed to make backend binary executable: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package predeploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
+)
+
+// DownloadBackend downloads the convex-local-backend release zip for tag (the
+// default release if empty) and the named platform (e.g. "linux-x64") to dest
+// with DownloadFile.
+func DownloadBackend(ctx context.Context, tag, platformName, dest string) error {
+	p, ok := platform.Lookup(platformName)
+	if !ok || p.BackendArtifact == "" {
+		return fmt.Errorf("no backend release for platform: %s", platformName)
+	}
+	if tag == "" {
+		tag = backendReleaseTag
+	}
+	return DownloadFile(ctx, fmt.Sprintf(backendDownloadURL, tag, p.BackendArtifact), dest)
+}
+
+// DownloadFile downloads url to dest.
+//
+// The download is written to dest + ".part" and renamed when complete, so an
+// interrupted download resumes with a Range request on the next call. The
+// response ETag is kept in dest + ".etag"; if dest already exists with the
+// size and ETag the server reports, the download is skipped.
+func DownloadFile(ctx context.Context, url, dest string) error {
+	etagPath := dest + ".etag"
+	partPath := dest + ".part"
+	etag := readETag(etagPath)
+
+	if info, err := os.Stat(dest); err == nil {
+		current, err := isDownloadCurrent(ctx, url, info.Size(), etag)
+		if err != nil {
+			return err
+		}
+		if current {
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 && etag != "" {
+		// If-Range makes the server send the whole file if it changed since the partial download
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", etag)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	var total int64 = -1
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+		total = contentRangeTotal(resp.Header.Get("Content-Range"))
+	case http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+		total = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is not a prefix of the current release; start over
+		if err := os.Remove(partPath); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", partPath, err)
+		}
+		return DownloadFile(ctx, url, dest)
+	default:
+		return fmt.Errorf("failed to download: %s returned %s", url, resp.Status)
+	}
+
+	if err := os.WriteFile(etagPath, []byte(resp.Header.Get("ETag")), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", etagPath, err)
+	}
+
+	part, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", partPath, err)
+	}
+	written, copyErr := io.Copy(part, resp.Body)
+	if err := part.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return fmt.Errorf("failed to download %s (%d bytes saved in %s, rerun to resume): %w", url, offset+written, partPath, copyErr)
+	}
+	if total >= 0 && offset+written != total {
+		return fmt.Errorf("incomplete download of %s: got %d of %d bytes", url, offset+written, total)
+	}
+
+	if err := os.Rename(partPath, dest); err != nil {
+		return fmt.Errorf("failed to move download into place: %w", err)
+	}
+	return nil
+}
+
+// isDownloadCurrent reports whether a completed download of size bytes with
+// the given ETag matches what the server currently serves at url.
+func isDownloadCurrent(ctx context.Context, url string, size int64, etag string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check download of %s: %w", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to check download: %s returned %s", url, resp.Status)
+	}
+	return resp.ContentLength == size && resp.Header.Get("ETag") == etag, nil
+}
+
+// readETag returns the ETag saved at path, or "" if there is none.
+func readETag(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// contentRangeTotal returns the complete length from a Content-Range header
+// such as "bytes 100-199/200", or -1 if it is unknown.
+func contentRangeTotal(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+	total, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return total
+}
@@ -0,0 +1,88 @@
+package predeploy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrDockerUnavailable is returned when the pre-deployment container cannot
+// be started because Docker is not installed or its daemon is not running.
+var ErrDockerUnavailable = errors.New("docker is not available")
+
+// ErrImagePullFailed is returned when the pre-deployment image cannot be
+// found locally or pulled from its registry.
+var ErrImagePullFailed = errors.New("failed to pull pre-deployment image")
+
+// ErrTypecheckFailed is returned when an app's Convex functions have
+// TypeScript errors. The error message lists the compiler diagnostics.
+var ErrTypecheckFailed = errors.New("convex functions failed to typecheck")
+
+// tsDiagnostic matches a TypeScript compiler error such as
+// "convex/messages.ts:3:7 - error TS2322: Type 'string' is not assignable to type 'number'."
+var tsDiagnostic = regexp.MustCompile(`\berror TS\d+:`)
+
+// ansiEscape matches the color codes tsc adds to its diagnostics
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// dockerUnavailableMessages are lower-cased fragments of the errors Docker
+// clients return when no daemon can be reached
+var dockerUnavailableMessages = []string{
+	"cannot connect to the docker daemon",
+	"is the docker daemon running",
+	"docker not found",
+	"failed to create docker provider",
+	"error during connect",
+}
+
+// imagePullMessages are lower-cased fragments of the errors returned when an
+// image cannot be pulled
+var imagePullMessages = []string{
+	"pull access denied",
+	"manifest unknown",
+	"repository does not exist",
+	"no such image",
+	"failed to pull image",
+	"not found: manifest",
+}
+
+// classifyStartError wraps err, returned while starting a container from
+// image, in ErrDockerUnavailable or ErrImagePullFailed with guidance on how
+// to fix it. Other errors are returned unchanged. The result still wraps err.
+func classifyStartError(err error, image string) error {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case containsAny(msg, dockerUnavailableMessages):
+		return fmt.Errorf("%w: pre-deployment runs the apps in a Docker container; start Docker (e.g. `sudo systemctl start docker` or Docker Desktop) and check that `docker info` works, or deploy to an already running backend with predeploy.Options.Backend: %w", ErrDockerUnavailable, err)
+	case containsAny(msg, imagePullMessages):
+		return fmt.Errorf("%w %s: build it with docker/convex-predeploy/build.sh, log in to its registry, or choose another image with --docker-image: %w", ErrImagePullFailed, image, err)
+	default:
+		return err
+	}
+}
+
+// containsAny reports whether s contains any of substrs
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// typecheckError returns an error wrapping ErrTypecheckFailed that lists the
+// TypeScript diagnostics in convex deploy output, or nil if it has none.
+func typecheckError(output string) error {
+	var diagnostics []string
+	for _, line := range strings.Split(ansiEscape.ReplaceAllString(output, ""), "\n") {
+		if tsDiagnostic.MatchString(line) {
+			diagnostics = append(diagnostics, strings.TrimSpace(line))
+		}
+	}
+	if len(diagnostics) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w:\n  %s", ErrTypecheckFailed, strings.Join(diagnostics, "\n  "))
+}
@@ -0,0 +1,120 @@
+package predeploy
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// GitApp is an app deployed from a git repository cloned inside the
+// pre-deployment container, e.g. a released tag in CI, instead of a local
+// directory.
+type GitApp struct {
+	// URL is the repository to clone (https, http, ssh or git URL, or
+	// scp-like "git@host:owner/repo.git")
+	URL string
+
+	// Ref is the branch, tag or commit to check out
+	Ref string
+
+	// Subdir is the app directory within the repository, as a
+	// slash-separated relative path (optional, defaults to the root)
+	Subdir string
+}
+
+// String describes the app as "URL@Ref" or "URL@Ref:Subdir".
+func (a GitApp) String() string {
+	s := a.URL + "@" + a.Ref
+	if a.Subdir != "" {
+		s += ":" + a.Subdir
+	}
+	return s
+}
+
+// gitURLSchemes are the URL schemes git can clone from in the container
+var gitURLSchemes = map[string]bool{
+	"https": true,
+	"http":  true,
+	"ssh":   true,
+	"git":   true,
+}
+
+// scpLikeURLPattern matches scp-like git URLs such as "git@github.com:owner/repo.git"
+var scpLikeURLPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[A-Za-z0-9._/~-]+$`)
+
+// Validate checks that the URL, ref and subdirectory are well formed, so
+// they can be passed to git without being mistaken for options.
+func (a GitApp) Validate() error {
+	if a.URL == "" {
+		return fmt.Errorf("git URL is required")
+	}
+	if strings.ContainsFunc(a.URL, isSpaceOrControl) {
+		return fmt.Errorf("invalid git URL %q: must not contain whitespace or control characters", a.URL)
+	}
+	if !scpLikeURLPattern.MatchString(a.URL) {
+		u, err := url.Parse(a.URL)
+		if err != nil || !gitURLSchemes[u.Scheme] || u.Host == "" {
+			return fmt.Errorf("invalid git URL %q: must be an https, http, ssh or git URL, or user@host:path", a.URL)
+		}
+	}
+
+	if err := validateGitRef(a.Ref); err != nil {
+		return err
+	}
+
+	if a.Subdir != "" && (!fs.ValidPath(a.Subdir) || a.Subdir == "." || strings.Contains(a.Subdir, `\`)) {
+		return fmt.Errorf("invalid git app subdirectory %q: must be a relative slash-separated path inside the repository", a.Subdir)
+	}
+	return nil
+}
+
+// validateGitApps validates each app, naming the first invalid one.
+func validateGitApps(apps []GitApp) error {
+	for i, app := range apps {
+		if err := app.Validate(); err != nil {
+			return fmt.Errorf("invalid git app %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateGitRef checks ref against the rules of git check-ref-format that
+// apply to branch, tag and commit names.
+func validateGitRef(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("git ref is required")
+	}
+	switch {
+	case strings.HasPrefix(ref, "-"),
+		strings.HasPrefix(ref, "/"),
+		strings.HasSuffix(ref, "/"),
+		strings.HasSuffix(ref, "."),
+		strings.HasSuffix(ref, ".lock"),
+		strings.Contains(ref, ".."),
+		strings.Contains(ref, "//"),
+		strings.Contains(ref, "@{"),
+		strings.ContainsAny(ref, `~^:?*[\`),
+		strings.ContainsFunc(ref, isSpaceOrControl):
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	return nil
+}
+
+func isSpaceOrControl(r rune) bool {
+	return r <= ' ' || r == 0x7f
+}
+
+// gitCloneCommand returns a shell command that fetches app.Ref from app.URL
+// into dir and checks it out. Only the one commit is fetched, which works
+// for branches, tags and commit IDs alike.
+func gitCloneCommand(app GitApp, dir string) string {
+	return fmt.Sprintf("git init --quiet %s && cd %s && git remote add origin %s && git fetch --quiet --depth 1 origin %s && git checkout --quiet FETCH_HEAD",
+		shellQuote(dir), shellQuote(dir), shellQuote(app.URL), shellQuote(app.Ref))
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -4,16 +4,17 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
-	adminkey "github.com/ozanturksever/convex-admin-key"
-	"github.com/testcontainers/testcontainers-go"
-	"github.com/testcontainers/testcontainers-go/wait"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
 )
 
 // Options for running pre-deployment
@@ -21,19 +22,70 @@ type Options struct {
 	Apps          []string
 	BackendBinary string
 	OutputDir     string
-	Platform      string // Target platform for the backend binary (e.g., "linux-x64", "linux-arm64")
-	DockerImage   string // Custom Docker image to use (default: convex-predeploy:latest)
+	Platform      string         // Target platform for the backend binary (e.g., "linux-x64", "linux-arm64")
+	DockerImage   string         // Custom Docker image to use (default: convex-predeploy:latest)
+	Logger        logging.Logger // Receives progress messages (default: discard)
+	MaxRetries    int            // Extra attempts at starting and preparing the container (default: 0, no retries)
+	RetryBackoff  time.Duration  // Wait before the first retry, doubled for each later one
+	Backend       Backend        // Deploy to this running backend instead of starting one in Docker (optional)
+	KeepTemp      bool           // Keep the temporary output directory when Result.Cleanup is called or Run fails, for debugging
+	Progress      ProgressFunc   // Called as each app moves through the deploy phases (optional)
+
+	// DependencyCacheDir is a host directory mounted into the pre-deployment
+	// container as the npm, pnpm and yarn cache, so later runs reuse the
+	// packages earlier ones downloaded. It is created, writable by the
+	// container user, if missing. Ignored when deploying to Backend, which
+	// uses the host's own caches (optional)
+	DependencyCacheDir string
+
+	// GitApps are deployed after Apps from a clone of a git repository made
+	// inside the pre-deployment container, instead of a mounted local
+	// directory. The Docker image must provide git. Not supported with
+	// Backend (optional)
+	GitApps []GitApp
+
+	// DeployArgs are extra arguments appended to each "convex deploy", e.g.
+	// "--typecheck=disable". Each is passed as a single argument, quoted for
+	// the container's shell. They may not set --admin-key or --url, which
+	// the bundler provides (optional)
+	DeployArgs []string
+
+	// StrictTypecheck deploys with "--typecheck=enable", so an app whose
+	// functions have TypeScript errors fails with ErrTypecheckFailed listing
+	// the compiler diagnostics, even if convex deploy itself succeeds. It
+	// cannot be combined with a --typecheck flag in DeployArgs.
+	StrictTypecheck bool
+
+	// ContinueOnError deploys the remaining apps when one fails instead of
+	// stopping at the first failure. Failures are reported in
+	// Result.AppResults; Run only fails if no app could be deployed.
+	ContinueOnError bool
 }
 
+// ProgressFunc reports that the app at appPath, the zero-based appIndex of
+// appTotal apps, entered phase (PhaseInstalling, PhaseDeploying or PhaseDone).
+type ProgressFunc func(appIndex, appTotal int, appPath, phase string)
+
+// Deploy phases reported to Options.Progress, in order, for each app
+const (
+	PhaseInstalling = "installing" // Installing the app's dependencies
+	PhaseDeploying  = "deploying"  // Deploying the app to the backend
+	PhaseDone       = "done"       // The app was deployed
+)
+
 // Default Docker image for pre-deployment
 // This image has all dependencies pre-installed (curl, unzip, convex CLI, convex-local-backend)
 const DefaultPredeployImage = "convex-predeploy:latest"
 
 // Backend release information (used when building the Docker image)
-const (
-	backendReleaseTag  = "precompiled-2025-12-12-73e805a"
-	backendDownloadURL = "https://github.com/get-convex/convex-backend/releases/download/%s/convex-local-backend-%s.zip"
-)
+const backendReleaseTag = "precompiled-2025-12-12-73e805a"
+
+// backendDownloadURL is formatted with a release tag and artifact triple. It is
+// a variable so tests can point DownloadBackend at a local server.
+var backendDownloadURL = "https://github.com/get-convex/convex-backend/releases/download/%s/convex-local-backend-%s.zip"
+
+// containerLabel marks pre-deployment containers so they can be found and cleaned up
+const containerLabel = "convex-bundler.predeploy"
 
 // Container paths for database and storage
 const (
@@ -42,28 +94,75 @@ const (
 	containerStoragePath = "/convex-data/storage"
 )
 
-// getPlatformString converts our platform names to the release artifact platform strings
-// This is used when the custom image is not available and we need to download the binary
-func getPlatformString(platform string, containerArch string) string {
-	// If container architecture is detected, use it
-	if containerArch != "" {
-		switch containerArch {
-		case "aarch64", "arm64":
-			return "aarch64-unknown-linux-gnu"
-		case "x86_64", "amd64":
-			return "x86_64-unknown-linux-gnu"
+// containerCacheDir is where Options.DependencyCacheDir is mounted
+const containerCacheDir = "/convex-cache"
+
+// dependencyCacheEnv points the package managers at containerCacheDir
+var dependencyCacheEnv = map[string]string{
+	"npm_config_cache":     containerCacheDir + "/npm",
+	"npm_config_store_dir": containerCacheDir + "/pnpm-store",
+	"YARN_CACHE_FOLDER":    containerCacheDir + "/yarn",
+}
+
+// getPlatformString returns the release artifact for the Linux backend that
+// runs in the container. The detected container architecture wins; otherwise
+// the architecture of the target platform is used, defaulting to x64.
+func getPlatformString(targetPlatform string, containerArch string) string {
+	if p, ok := platform.FromLinuxArch(containerArch); ok {
+		return p.BackendArtifact
+	}
+
+	// The container always runs Linux, so only the target's architecture matters
+	if target, ok := platform.Lookup(targetPlatform); ok {
+		if p, ok := platform.FromGo("linux", target.GOARCH); ok {
+			return p.BackendArtifact
 		}
 	}
 
-	// Fall back to platform flag
-	switch platform {
-	case "linux-arm64":
-		return "aarch64-unknown-linux-gnu"
-	case "linux-x64", "":
-		return "x86_64-unknown-linux-gnu"
-	default:
-		return "x86_64-unknown-linux-gnu"
+	p, _ := platform.Lookup(platform.Default)
+	return p.BackendArtifact
+}
+
+// reservedDeployFlags are the convex deploy flags the bundler sets itself
+var reservedDeployFlags = []string{"--admin-key", "--url"}
+
+// strictTypecheckFlag makes convex deploy typecheck the functions and fail on errors
+const strictTypecheckFlag = "--typecheck=enable"
+
+// deployArgs validates opts.DeployArgs and returns them with the
+// StrictTypecheck flag appended if it is set.
+func deployArgs(opts Options) ([]string, error) {
+	if err := validateDeployArgs(opts.DeployArgs); err != nil {
+		return nil, err
+	}
+	if !opts.StrictTypecheck {
+		return opts.DeployArgs, nil
+	}
+	for _, arg := range opts.DeployArgs {
+		if arg == "--typecheck" || strings.HasPrefix(arg, "--typecheck=") {
+			return nil, fmt.Errorf("invalid deploy argument %q: strict typechecking sets %s", arg, strictTypecheckFlag)
+		}
+	}
+	return append(append([]string{}, opts.DeployArgs...), strictTypecheckFlag), nil
+}
+
+// validateDeployArgs rejects extra deploy arguments that are empty, contain
+// control characters, or override a flag in reservedDeployFlags.
+func validateDeployArgs(args []string) error {
+	for _, arg := range args {
+		if arg == "" {
+			return fmt.Errorf("invalid deploy argument: must not be empty")
+		}
+		if strings.ContainsFunc(arg, unicode.IsControl) {
+			return fmt.Errorf("invalid deploy argument %q: must not contain control characters", arg)
+		}
+		for _, flag := range reservedDeployFlags {
+			if arg == flag || strings.HasPrefix(arg, flag+"=") {
+				return fmt.Errorf("invalid deploy argument %q: %s is set by the bundler", arg, flag)
+			}
+		}
 	}
+	return nil
 }
 
 // isPredeployImage checks if the image is our custom pre-deploy image with dependencies pre-installed
@@ -73,13 +172,46 @@ func isPredeployImage(image string) bool {
 
 // Result from pre-deployment
 type Result struct {
-	DatabasePath string
-	StoragePath  string
+	DatabasePath     string
+	StoragePath      string      // Exported file storage; always an existing directory, empty if the apps stored no files
+	ConvexCLIVersion string      // Version reported by `npx convex --version` (empty if it could not be determined)
+	PackageManager   string      // Package manager used to install app dependencies
+	AppResults       []AppResult // Outcome of each app, in the order of Options.Apps
+
+	// Cleanup removes the temporary directory holding DatabasePath and
+	// StoragePath (unless Options.KeepTemp is set). Call it once the files
+	// have been copied, e.g. after bundle.Create.
+	Cleanup func() error
+}
+
+// AppResult is the outcome of deploying one app.
+type AppResult struct {
+	Path    string // The app path as given in Options.Apps, or GitApp.String() for Options.GitApps
+	Success bool   // Whether the app was deployed
+	Err     error  // Why the app failed to deploy (nil on success)
+}
+
+// packageManager is the package manager used to install app dependencies
+const packageManager = "npm"
+
+// Run executes the pre-deployment process, using opts.Backend if set or a
+// backend started in Docker otherwise.
+// Cancelling ctx aborts the current container operation and terminates the container.
+func Run(ctx context.Context, opts Options) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("pre-deployment cancelled: %w", err)
+	}
+
+	result, err := run(ctx, opts)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("pre-deployment cancelled: %w: %w", ctx.Err(), err)
+	}
+	return result, err
 }
 
-// Run executes the pre-deployment process using Docker
-func Run(opts Options) (*Result, error) {
-	ctx := context.Background()
+// run performs the pre-deployment steps for Run.
+func run(ctx context.Context, opts Options) (result *Result, err error) {
+	log := logging.OrNop(opts.Logger)
 
 	// Create a temporary directory for pre-deployment output
 	// We use a temp directory because bundle.Create will copy from here to the final location
@@ -87,8 +219,22 @@ func Run(opts Options) (*Result, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
-	// Note: We don't clean up tempDir here because the caller needs the files
-	// The caller should clean up after copying the files
+	// On success the caller removes tempDir with Result.Cleanup after copying the files
+	cleanup := func() error {
+		if opts.KeepTemp {
+			log.Infof("Keeping pre-deployment files in %s", tempDir)
+			return nil
+		}
+		if err := os.RemoveAll(tempDir); err != nil {
+			return fmt.Errorf("failed to remove temp directory: %w", err)
+		}
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
 
 	databasePath := filepath.Join(tempDir, "convex.db")
 	storagePath := filepath.Join(tempDir, "storage")
@@ -97,218 +243,88 @@ func Run(opts Options) (*Result, error) {
 		return nil, fmt.Errorf("failed to create storage directory: %w", err)
 	}
 
-	// Get absolute paths for apps
-	var absApps []string
-	for _, app := range opts.Apps {
-		absApp, err := filepath.Abs(app)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get absolute path for app %s: %w", app, err)
-		}
-		absApps = append(absApps, absApp)
+	absApps, err := absPaths(opts.Apps)
+	if err != nil {
+		return nil, err
 	}
-
-	// Check if a backend binary was provided and exists
-	var useProvidedBinary bool
-	var absBackendBinary string
-	if opts.BackendBinary != "" {
-		var absErr error
-		absBackendBinary, absErr = filepath.Abs(opts.BackendBinary)
-		if absErr != nil {
-			return nil, fmt.Errorf("failed to get absolute path for backend binary: %w", absErr)
-		}
-		if _, statErr := os.Stat(absBackendBinary); statErr == nil {
-			useProvidedBinary = true
-		}
+	if err := validateGitApps(opts.GitApps); err != nil {
+		return nil, err
 	}
-
-	// Create bind mounts for apps
-	var mounts testcontainers.ContainerMounts
-	for i, app := range absApps {
-		mounts = append(mounts,
-			testcontainers.BindMount(app, testcontainers.ContainerMountTarget(fmt.Sprintf("/app%d", i))),
-		)
+	extraArgs, err := deployArgs(opts)
+	if err != nil {
+		return nil, err
 	}
-
-	// If backend binary is provided, mount it into the container
-	if useProvidedBinary {
-		mounts = append(mounts,
-			testcontainers.BindMount(absBackendBinary, testcontainers.ContainerMountTarget("/usr/local/bin/convex-local-backend")),
-		)
+	if len(opts.GitApps) > 0 && opts.Backend != nil {
+		return nil, fmt.Errorf("git apps can only be deployed with the Docker backend")
 	}
-
-	// Determine which Docker image to use
-	dockerImage := opts.DockerImage
-	if dockerImage == "" {
-		dockerImage = DefaultPredeployImage
+	// Git apps follow the local ones and are identified by their description
+	appPaths := append([]string{}, opts.Apps...)
+	for _, app := range opts.GitApps {
+		appPaths = append(appPaths, app.String())
+		absApps = append(absApps, app.String())
 	}
-	usePredeployImage := isPredeployImage(dockerImage)
-
-	// Create container request
-	req := testcontainers.ContainerRequest{
-		Image:        dockerImage,
-		ExposedPorts: []string{"3210/tcp"},
-		Cmd:          []string{"sh", "-c", "sleep infinity"},
-		WaitingFor:   wait.ForExec([]string{"true"}).WithStartupTimeout(60 * time.Second),
-		Mounts:       mounts,
+	if len(absApps) == 0 {
+		return nil, fmt.Errorf("no apps to deploy")
 	}
 
-	// Start container
-	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: req,
-		Started:          true,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to start container: %w", err)
-	}
-	defer container.Terminate(ctx)
-
-	var exitCode int
-	var output io.Reader
-
-	// If not using pre-deploy image, install dependencies manually
-	if !usePredeployImage {
-		// Install required tools (curl, unzip) - only needed if we need to download
-		if !useProvidedBinary {
-			exitCode, output, err = container.Exec(ctx, []string{
-				"sh", "-c", "apt-get update && apt-get install -y curl unzip",
-			})
-			if err != nil || exitCode != 0 {
-				return nil, fmt.Errorf("failed to install required tools: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
-			}
-		}
-
-		// Install convex CLI
-		exitCode, output, err = container.Exec(ctx, []string{
-			"sh", "-c", "npm install -g convex",
-		})
-		if err != nil || exitCode != 0 {
-			return nil, fmt.Errorf("failed to install convex CLI: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
-		}
-
-		// Download the backend binary only if not provided via mount
-		if !useProvidedBinary {
-			// Detect container architecture using shell command to capture output properly
-			exitCode, archOutput, err := container.Exec(ctx, []string{"sh", "-c", "uname -m"})
-			var containerArch string
-			if err == nil && exitCode == 0 {
-				archStr := readOutput(archOutput)
-				// Clean up the output - remove control characters and whitespace
-				containerArch = strings.TrimSpace(archStr)
-				// Handle common arch strings
-				if strings.Contains(containerArch, "aarch64") {
-					containerArch = "aarch64"
-				} else if strings.Contains(containerArch, "x86_64") {
-					containerArch = "x86_64"
-				}
-			}
-
-			// Download the Linux backend binary inside the container
-			platformStr := getPlatformString(opts.Platform, containerArch)
-			downloadURL := fmt.Sprintf(backendDownloadURL, backendReleaseTag, platformStr)
-			downloadCmd := fmt.Sprintf(
-				"curl -L -o /tmp/convex-local-backend.zip '%s' && "+
-					"unzip -o /tmp/convex-local-backend.zip -d /usr/local/bin && "+
-					"chmod +x /usr/local/bin/convex-local-backend && "+
-					"rm /tmp/convex-local-backend.zip",
-				downloadURL,
-			)
-			exitCode, output, err = container.Exec(ctx, []string{"sh", "-c", downloadCmd})
-			if err != nil || exitCode != 0 {
-				return nil, fmt.Errorf("failed to download backend binary: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
-			}
+	// Deploy against the provided backend, or start one in Docker
+	backend := opts.Backend
+	var deployer appDeployer
+	if backend != nil {
+		log.Debugf("Using external backend at %s", backend.URL())
+		deployer = hostDeployer{deployArgs: extraArgs, strictTypecheck: opts.StrictTypecheck}
+	} else {
+		dockerBackend, err := StartDockerBackend(ctx, opts)
+		if err != nil {
+			return nil, err
 		}
+		// Terminate with a context that outlives cancellation so the container is
+		// still torn down when ctx is cancelled mid-run
+		defer dockerBackend.Terminate(context.WithoutCancel(ctx))
+		backend = dockerBackend
+		deployer = dockerBackend
 	}
 
-	// If using provided binary, make sure it's executable in the container
-	if useProvidedBinary {
-		exitCode, output, err = container.Exec(ctx, []string{
-			"sh", "-c", "chmod +x /usr/local/bin/convex-local-backend",
-		})
-		if err != nil || exitCode != 0 {
-			return nil, fmt.Errorf("failed to make backend binary executable: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
+	// Deploy each app
+	progress := func(i int, phase string) {
+		if opts.Progress != nil {
+			opts.Progress(i, len(absApps), appPaths[i], phase)
 		}
 	}
-
-	// Create data directory in container
-	exitCode, output, err = container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("mkdir -p %s %s", containerDataDir, containerStoragePath)})
-	if err != nil || exitCode != 0 {
-		return nil, fmt.Errorf("failed to create data directory: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
-	}
-
-	// Start the backend and wait for it to be ready in a single exec call
-	// Using sh -c with & and a polling loop ensures the process stays running
-	// Note: instance-secret must be a valid 64-character hex string (32 bytes)
-	// The admin key format for local backend is: instanceName|deployKeySecret
-	const instanceSecret = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
-	startAndWaitCmd := fmt.Sprintf(`/usr/local/bin/convex-local-backend %s --port 3210 --instance-name test --instance-secret %s --local-storage %s > /tmp/backend.log 2>&1 &
-for i in $(seq 1 30); do
-  # Check if curl can reach the backend (any response means it's ready)
-  if curl -sf http://localhost:3210/version > /dev/null 2>&1; then
-    echo "Backend is ready"
-    exit 0
-  fi
-  sleep 1
-done
-echo "Backend failed to start"
-cat /tmp/backend.log 2>/dev/null || true
-exit 1`, containerDBPath, instanceSecret, containerStoragePath)
-	exitCode, output, err = container.Exec(ctx, []string{"sh", "-c", startAndWaitCmd})
-	if err != nil || exitCode != 0 {
-		return nil, fmt.Errorf("failed to start backend: %v (exit code: %d, output: %s)", err, exitCode, readOutput(output))
-	}
-
-	// Deploy each app using the convex-admin-key library to generate a proper admin key
-	for i := range absApps {
-		appDir := fmt.Sprintf("/app%d", i)
-		// Generate admin key using the convex-admin-key library
-		secret, err := adminkey.ParseSecret(instanceSecret)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse instance secret: %w", err)
-		}
-		adminKey, err := adminkey.IssueAdminKey(secret, "test", 0, false)
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate admin key: %w", err)
+	appResults := make([]AppResult, len(absApps))
+	deployed := -1 // Index of the first deployed app
+	var deployErrs []error
+	for i, app := range absApps {
+		appResults[i] = AppResult{Path: appPaths[i]}
+		if err := deployOne(ctx, deployer, backend, log, i, app, appPaths[i], progress); err != nil {
+			err = fmt.Errorf("failed to deploy app %d: %w", i, err)
+			if !opts.ContinueOnError || ctx.Err() != nil {
+				return nil, err
+			}
+			log.Warnf("Skipping app %d (%s): %v", i, appPaths[i], err)
+			appResults[i].Err = err
+			deployErrs = append(deployErrs, err)
+			continue
 		}
-
-		// Install app dependencies first, then deploy
-		deployCmd := fmt.Sprintf(
-			"cd %s && npm install --silent && npx convex deploy --admin-key '%s' --url http://localhost:3210 --yes",
-			appDir,
-			adminKey,
-		)
-		exitCode, output, err = container.Exec(ctx, []string{"sh", "-c", deployCmd})
-		if err != nil || exitCode != 0 {
-			return nil, fmt.Errorf("failed to deploy app %d: %v (exit code: %d, output: %s)", i, err, exitCode, readOutput(output))
+		appResults[i].Success = true
+		if deployed < 0 {
+			deployed = i
 		}
 	}
-
-	// Verify the database file exists in the container and get its size
-	exitCode, output, err = container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("ls -la %s && stat -c %%s %s", containerDBPath, containerDBPath)})
-	if err != nil || exitCode != 0 {
-		return nil, fmt.Errorf("database file not found at %s: %v (exit code: %d, output: %s)", containerDBPath, err, exitCode, readOutput(output))
+	if deployed < 0 {
+		return nil, fmt.Errorf("no app could be deployed: %w", errors.Join(deployErrs...))
 	}
 
-	// Use CopyFileFromContainer to get the database
-	// This is more reliable than base64 encoding through exec
-	reader, err := container.CopyFileFromContainer(ctx, containerDBPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to copy database from container: %w", err)
+	// Record the Convex CLI version that deployed the apps
+	convexCLIVersion, err := deployer.cliVersion(ctx, deployed, absApps[deployed])
+	if err == nil {
+		log.Debugf("Convex CLI version: %s", convexCLIVersion)
+	} else {
+		log.Warnf("Failed to determine Convex CLI version: %v", err)
 	}
-	defer reader.Close()
 
-	// Read the tar stream
-	tarData, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read tar data: %w", err)
-	}
-
-	if len(tarData) == 0 {
-		return nil, fmt.Errorf("received empty tar data from container")
-	}
-
-	// Extract the database from the tar archive
-	if err := extractTarFile(bytes.NewReader(tarData), databasePath); err != nil {
-		return nil, fmt.Errorf("failed to extract database from tar: %w", err)
+	if err := backend.ExportDatabase(databasePath); err != nil {
+		return nil, fmt.Errorf("failed to export database: %w", err)
 	}
 
 	// Verify the extracted database
@@ -320,70 +336,84 @@ exit 1`, containerDBPath, instanceSecret, containerStoragePath)
 		return nil, fmt.Errorf("extracted database is empty")
 	}
 
-	// Copy storage files from container
-	// First list what files exist in storage
-	exitCode, listOutput, _ := container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf("find %s -type f 2>/dev/null", containerStoragePath)})
-	if exitCode == 0 {
-		fileList := strings.TrimSpace(readOutput(listOutput))
-		// Remove docker control characters
-		fileList = strings.Map(func(r rune) rune {
-			if r < 32 && r != '\n' {
-				return -1
-			}
-			return r
-		}, fileList)
-		
-		if fileList != "" {
-			fileCount := strings.Count(fileList, "\n") + 1
-			fmt.Printf("Storage files in container: %d files\n", fileCount)
-			
-			// Create tar of storage directory inside container
-			const storageTarPath = "/tmp/storage.tar"
-			exitCode, _, _ := container.Exec(ctx, []string{"sh", "-c", fmt.Sprintf(
-				"cd %s && tar -cf %s .",
-				containerStoragePath, storageTarPath,
-			)})
-			if exitCode == 0 {
-				// Copy the tar file from container
-				// CopyFileFromContainer returns the tar file content directly as a tar stream
-				// (not wrapped in another tar) - this is the actual storage.tar we created
-				tarReader, tarErr := container.CopyFileFromContainer(ctx, storageTarPath)
-				if tarErr != nil {
-					fmt.Printf("Warning: Failed to copy storage tar: %v\n", tarErr)
-				} else {
-					tarData, readErr := io.ReadAll(tarReader)
-					tarReader.Close()
-					
-					if readErr != nil {
-						fmt.Printf("Warning: Failed to read storage tar: %v\n", readErr)
-					} else if len(tarData) > 0 {
-						// The tarData IS the storage.tar content directly
-						// Extract the storage contents
-						if extractErr := extractTarDirectoryNoStrip(bytes.NewReader(tarData), storagePath); extractErr != nil {
-							fmt.Printf("Warning: Failed to extract storage contents: %v\n", extractErr)
-						} else {
-							// Count extracted files
-							var extractedCount int
-							filepath.Walk(storagePath, func(path string, info os.FileInfo, err error) error {
-								if err == nil && !info.IsDir() {
-									extractedCount++
-								}
-								return nil
-							})
-							fmt.Printf("Extracted %d storage files\n", extractedCount)
-						}
-					}
+	// Copy storage files, if the backend can export them
+	if exporter, ok := backend.(StorageExporter); ok {
+		if err := exporter.ExportStorage(storagePath); err != nil {
+			log.Warnf("Failed to export storage: %v", err)
+		} else {
+			// Count extracted files
+			var extractedCount int
+			filepath.Walk(storagePath, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					extractedCount++
 				}
-			}
+				return nil
+			})
+			log.Infof("Extracted %d storage files", extractedCount)
 		}
 	}
 
+	// The bundle always gets a storage/ directory, so recreate it in case
+	// a failed export removed it
+	if err := os.MkdirAll(storagePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
 	return &Result{
-		DatabasePath: databasePath,
-		StoragePath:  storagePath,
+		DatabasePath:     databasePath,
+		StoragePath:      storagePath,
+		ConvexCLIVersion: convexCLIVersion,
+		PackageManager:   packageManager,
+		AppResults:       appResults,
+		Cleanup:          cleanup,
 	}, nil
 }
 
+// deployOne installs the dependencies of the app at the absolute path app
+// and deploys it to backend, reporting each phase to progress.
+func deployOne(ctx context.Context, deployer appDeployer, backend Backend, log logging.Logger, i int, app, appPath string, progress func(int, string)) error {
+	log.Debugf("Installing dependencies of app %d from %s", i, appPath)
+	progress(i, PhaseInstalling)
+	if err := deployer.installDeps(ctx, i, app); err != nil {
+		return err
+	}
+
+	log.Debugf("Deploying app %d from %s", i, appPath)
+	progress(i, PhaseDeploying)
+	if err := deployer.deployApp(ctx, i, app, backend); err != nil {
+		return err
+	}
+	progress(i, PhaseDone)
+	return nil
+}
+
+// retry calls op, retrying up to maxRetries more times while it fails. The
+// wait before each retry starts at backoff and doubles every attempt. It
+// stops early and returns the last error if ctx is cancelled.
+func retry(ctx context.Context, maxRetries int, backoff time.Duration, log logging.Logger, op func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		wait := backoff << attempt
+		log.Warnf("Attempt %d of %d failed, retrying in %s: %v", attempt+1, maxRetries+1, wait, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// parseCLIVersion extracts the version from `convex --version` output.
+// The version is the last line, since npx may print notices first.
+func parseCLIVersion(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
 func readOutput(reader io.Reader) string {
 	if reader == nil {
 		return ""
@@ -403,7 +433,7 @@ func extractTarDirectoryNoStrip(reader io.Reader, destDir string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read tar data: %w", err)
 	}
-	
+
 	// Tar files are padded to 512-byte blocks, and may have trailing zeros
 	// Find the actual content by looking for the tar header magic
 	tr := tar.NewReader(bytes.NewReader(data))
@@ -462,6 +492,7 @@ func extractTarDirectoryNoStrip(reader io.Reader, destDir string) error {
 
 	return nil
 }
+
 // extractTarFile extracts a single file from a tar stream and writes it to destPath
 func extractTarFile(reader io.Reader, destPath string) error {
 	// Read all data from the reader
@@ -1,13 +1,37 @@
 package predeploy
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/ozanturksever/convex-bundler/pkg/bundle"
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+	"github.com/testcontainers/testcontainers-go/wait"
 	_ "modernc.org/sqlite" // SQLite driver for database validation
 )
 
@@ -23,7 +47,7 @@ func TestRun_Integration(t *testing.T) {
 
 	tmpDir := t.TempDir()
 
-	result, err := Run(Options{
+	result, err := Run(context.Background(), Options{
 		Apps:          []string{"../../testdata/sample-app"},
 		BackendBinary: "", // Not needed for pre-deployment, downloaded in container
 		OutputDir:     tmpDir,
@@ -47,7 +71,7 @@ func TestRun_Integration_ValidSQLiteDatabase(t *testing.T) {
 
 	tmpDir := t.TempDir()
 
-	result, err := Run(Options{
+	result, err := Run(context.Background(), Options{
 		Apps:          []string{"../../testdata/sample-app"},
 		BackendBinary: "",
 		OutputDir:     tmpDir,
@@ -207,9 +231,962 @@ func TestRun_StorageDirectoryCreation(t *testing.T) {
 	}
 
 	// This will fail because the app doesn't exist, but the directory should be created
-	_, _ = Run(opts)
+	_, _ = Run(context.Background(), opts)
 
 	// Storage directory should have been created even if the rest failed
 	_, err = os.Stat(storagePath)
 	assert.NoError(t, err)
 }
+
+func TestRun_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := Run(ctx, Options{
+		Apps:      []string{"/nonexistent"},
+		OutputDir: t.TempDir(),
+	})
+	require.Error(t, err)
+	assert.Nil(t, result)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRun_CancelTerminatesContainer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping container test in short mode")
+	}
+
+	// Installing tools with apt-get in the base image takes far longer than the
+	// timeout, so the run is aborted mid-exec
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	_, err := Run(ctx, Options{
+		Apps:        []string{"../../testdata/sample-app"},
+		OutputDir:   t.TempDir(),
+		Platform:    "linux-x64",
+		DockerImage: "node:20-slim",
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The deferred Terminate must have removed the container
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	require.NoError(t, err)
+	defer cli.Close()
+
+	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", containerLabel+"=true")),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, containers, "pre-deployment container should be terminated after cancellation")
+}
+
+func TestParseCLIVersion(t *testing.T) {
+	assert.Equal(t, "1.17.4", parseCLIVersion("1.17.4\n"))
+	assert.Equal(t, "1.17.4", parseCLIVersion("npm notice New version available\r\n1.17.4\r\n"))
+	assert.Equal(t, "", parseCLIVersion(""))
+}
+
+func TestRetry(t *testing.T) {
+	// failingExec simulates a container exec that fails the first n calls
+	failingExec := func(n int) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= n {
+				return fmt.Errorf("failed to download backend binary: exit code 1")
+			}
+			return nil
+		}, &calls
+	}
+
+	t.Run("no retries by default", func(t *testing.T) {
+		op, calls := failingExec(1)
+		err := retry(context.Background(), 0, time.Millisecond, logging.Nop(), op)
+		require.Error(t, err)
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("succeeds after transient failures", func(t *testing.T) {
+		op, calls := failingExec(2)
+		err := retry(context.Background(), 3, time.Millisecond, logging.Nop(), op)
+		require.NoError(t, err)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		op, calls := failingExec(10)
+		err := retry(context.Background(), 2, time.Millisecond, logging.Nop(), op)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to download backend binary")
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("stops when cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := retry(ctx, 5, time.Hour, logging.Nop(), func() error {
+			calls++
+			cancel()
+			return fmt.Errorf("failed to start container")
+		})
+		require.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("backoff doubles", func(t *testing.T) {
+		op, _ := failingExec(2)
+		start := time.Now()
+		require.NoError(t, retry(context.Background(), 2, 20*time.Millisecond, logging.Nop(), op))
+		assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	})
+}
+
+// fakeConvexCLI puts npm and npx scripts on PATH that stand in for the real
+// CLI: `npx convex deploy` POSTs the app directory to <url>/api/deploy.
+func fakeConvexCLI(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is required for the fake Convex CLI")
+	}
+
+	binDir := t.TempDir()
+	npx := `#!/bin/sh
+if [ "$1" = "convex" ] && [ "$2" = "--version" ]; then
+  echo "1.2.3"
+  exit 0
+fi
+if [ "$1" = "convex" ] && [ "$2" = "deploy" ]; then
+  shift 2
+  while [ $# -gt 0 ]; do
+    case "$1" in
+      --admin-key) key="$2"; shift 2 ;;
+      --url) url="$2"; shift 2 ;;
+      *) shift ;;
+    esac
+  done
+  exec curl -sf -X POST -H "Authorization: Convex $key" --data "$(pwd)" "$url/api/deploy"
+fi
+exit 1
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "npx"), []byte(npx), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "npm"), []byte("#!/bin/sh\nexit 0\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRun_ExternalBackend(t *testing.T) {
+	fakeConvexCLI(t)
+
+	type deployCall struct {
+		auth string
+		app  string
+	}
+	var mu sync.Mutex
+	var calls []deployCall
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, deployCall{auth: r.Header.Get("Authorization"), app: string(body)})
+		mu.Unlock()
+		assert.Equal(t, "/api/deploy", r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	app1 := filepath.Join(tmpDir, "app1")
+	app2 := filepath.Join(tmpDir, "app2")
+	require.NoError(t, os.MkdirAll(app1, 0755))
+	require.NoError(t, os.MkdirAll(app2, 0755))
+
+	databasePath := filepath.Join(tmpDir, "backend.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("external database"), 0644))
+	storageDir := filepath.Join(tmpDir, "backend-storage")
+	require.NoError(t, os.MkdirAll(filepath.Join(storageDir, "nested"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, "nested", "file.txt"), []byte("stored"), 0644))
+
+	backend := NewExternalBackend(server.URL, "admin-key-123")
+	backend.DatabasePath = databasePath
+	backend.StoragePath = storageDir
+
+	result, err := Run(context.Background(), Options{
+		Apps:      []string{app1, app2},
+		OutputDir: tmpDir,
+		Backend:   backend,
+	})
+	require.NoError(t, err)
+	defer os.RemoveAll(filepath.Dir(result.DatabasePath))
+
+	assert.Equal(t, []deployCall{
+		{auth: "Convex admin-key-123", app: app1},
+		{auth: "Convex admin-key-123", app: app2},
+	}, calls)
+	assert.Equal(t, "1.2.3", result.ConvexCLIVersion)
+
+	data, err := os.ReadFile(result.DatabasePath)
+	require.NoError(t, err)
+	assert.Equal(t, "external database", string(data))
+
+	data, err = os.ReadFile(filepath.Join(result.StoragePath, "nested", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "stored", string(data))
+}
+
+func TestRun_ExternalBackendErrors(t *testing.T) {
+	fakeConvexCLI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	app := t.TempDir()
+
+	_, err := Run(context.Background(), Options{
+		Apps:    []string{app},
+		Backend: NewExternalBackend(server.URL, "admin-key"),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to deploy app 0")
+
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer okServer.Close()
+
+	_, err = Run(context.Background(), Options{
+		Apps:    []string{app},
+		Backend: NewExternalBackend(okServer.URL, "admin-key"),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no database path")
+}
+
+func TestRun_Progress(t *testing.T) {
+	fakeConvexCLI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	app1 := filepath.Join(tmpDir, "app1")
+	app2 := filepath.Join(tmpDir, "app2")
+	require.NoError(t, os.MkdirAll(app1, 0755))
+	require.NoError(t, os.MkdirAll(app2, 0755))
+	databasePath := filepath.Join(tmpDir, "backend.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("external database"), 0644))
+
+	backend := NewExternalBackend(server.URL, "admin-key")
+	backend.DatabasePath = databasePath
+
+	var events []string
+	result, err := Run(context.Background(), Options{
+		Apps:    []string{app1, app2},
+		Backend: backend,
+		Progress: func(appIndex, appTotal int, appPath, phase string) {
+			events = append(events, fmt.Sprintf("%d/%d %s %s", appIndex+1, appTotal, filepath.Base(appPath), phase))
+		},
+	})
+	require.NoError(t, err)
+	defer result.Cleanup()
+
+	assert.Equal(t, []string{
+		"1/2 app1 installing",
+		"1/2 app1 deploying",
+		"1/2 app1 done",
+		"2/2 app2 installing",
+		"2/2 app2 deploying",
+		"2/2 app2 done",
+	}, events)
+
+	// A nil Progress is allowed
+	result, err = Run(context.Background(), Options{Apps: []string{app1}, Backend: backend})
+	require.NoError(t, err)
+	result.Cleanup()
+}
+
+func TestRun_ProgressStopsAtFailedApp(t *testing.T) {
+	fakeConvexCLI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	var phases []string
+	_, err := Run(context.Background(), Options{
+		Apps:    []string{t.TempDir()},
+		Backend: NewExternalBackend(server.URL, "admin-key"),
+		Progress: func(_, _ int, _, phase string) {
+			phases = append(phases, phase)
+		},
+	})
+	require.Error(t, err)
+	assert.Equal(t, []string{PhaseInstalling, PhaseDeploying}, phases)
+}
+
+func TestRun_ContinueOnError(t *testing.T) {
+	fakeConvexCLI(t)
+
+	var mu sync.Mutex
+	var deployed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if filepath.Base(string(body)) == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		deployed = append(deployed, filepath.Base(string(body)))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	apps := []string{filepath.Join(tmpDir, "app1"), filepath.Join(tmpDir, "broken"), filepath.Join(tmpDir, "app3")}
+	for _, app := range apps {
+		require.NoError(t, os.MkdirAll(app, 0755))
+	}
+	databasePath := filepath.Join(tmpDir, "backend.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("external database"), 0644))
+	backend := NewExternalBackend(server.URL, "admin-key")
+	backend.DatabasePath = databasePath
+
+	// Fail-fast by default
+	_, err := Run(context.Background(), Options{Apps: apps, Backend: backend})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to deploy app 1")
+	assert.Equal(t, []string{"app1"}, deployed)
+
+	deployed = nil
+	result, err := Run(context.Background(), Options{Apps: apps, Backend: backend, ContinueOnError: true})
+	require.NoError(t, err)
+	defer result.Cleanup()
+	assert.Equal(t, []string{"app1", "app3"}, deployed)
+
+	require.Len(t, result.AppResults, 3)
+	assert.Equal(t, AppResult{Path: apps[0], Success: true}, result.AppResults[0])
+	assert.Equal(t, apps[1], result.AppResults[1].Path)
+	assert.False(t, result.AppResults[1].Success)
+	require.Error(t, result.AppResults[1].Err)
+	assert.Contains(t, result.AppResults[1].Err.Error(), "failed to deploy app 1")
+	assert.Equal(t, AppResult{Path: apps[2], Success: true}, result.AppResults[2])
+
+	// A run where every app fails is still an error
+	_, err = Run(context.Background(), Options{Apps: apps[1:2], Backend: backend, ContinueOnError: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no app could be deployed")
+}
+
+func TestRun_Cleanup(t *testing.T) {
+	fakeConvexCLI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	app := t.TempDir()
+	databasePath := filepath.Join(t.TempDir(), "backend.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("external database"), 0644))
+
+	runWith := func(keepTemp bool) *Result {
+		backend := NewExternalBackend(server.URL, "admin-key")
+		backend.DatabasePath = databasePath
+		result, err := Run(context.Background(), Options{Apps: []string{app}, Backend: backend, KeepTemp: keepTemp})
+		require.NoError(t, err)
+		require.FileExists(t, result.DatabasePath)
+		return result
+	}
+
+	result := runWith(false)
+	require.NoError(t, result.Cleanup())
+	assert.NoDirExists(t, filepath.Dir(result.DatabasePath))
+
+	result = runWith(true)
+	defer os.RemoveAll(filepath.Dir(result.DatabasePath))
+	require.NoError(t, result.Cleanup())
+	assert.FileExists(t, result.DatabasePath)
+}
+
+func TestRun_FailureRemovesTempDir(t *testing.T) {
+	fakeConvexCLI(t)
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// No database path, so the export fails after the temp directory is created
+	_, err := Run(context.Background(), Options{Apps: []string{t.TempDir()}, Backend: NewExternalBackend(server.URL, "admin-key")})
+	require.Error(t, err)
+
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), "convex-predeploy-")
+	}
+}
+
+func TestGetPlatformString_MatchesRegistry(t *testing.T) {
+	for _, p := range platform.All() {
+		if p.GOOS != "linux" {
+			continue
+		}
+		assert.Equal(t, p.BackendArtifact, getPlatformString(p.Name, ""), p.Name)
+	}
+
+	// The container runs Linux, so other targets use the Linux build for their architecture
+	assert.Equal(t, "aarch64-unknown-linux-gnu", getPlatformString("darwin-arm64", ""))
+	assert.Equal(t, "x86_64-unknown-linux-gnu", getPlatformString("windows-x64", ""))
+}
+
+// releaseServer serves data as a backend release zip with Range support. The
+// first interruptAt bytes of the first GET are sent before the connection is
+// dropped, if interruptAt is positive.
+func releaseServer(t *testing.T, data []byte, etag string, interruptAt int) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Clone(context.Background()))
+		first := len(requests) == 1
+		mu.Unlock()
+
+		w.Header().Set("ETag", etag)
+		if first && interruptAt > 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(data[:interruptAt])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "backend.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+
+	original := backendDownloadURL
+	backendDownloadURL = server.URL + "/%s/convex-local-backend-%s.zip"
+	t.Cleanup(func() { backendDownloadURL = original })
+
+	return server, &requests
+}
+
+func TestDownloadBackend_ResumesInterruptedDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("convex-local-backend"), 4096)
+	_, requests := releaseServer(t, data, `"v1"`, 1000)
+	dest := filepath.Join(t.TempDir(), "cache", "backend.zip")
+
+	err := DownloadBackend(context.Background(), "test-tag", "linux-arm64", dest)
+	require.Error(t, err)
+	assert.NoFileExists(t, dest)
+	part, err := os.ReadFile(dest + ".part")
+	require.NoError(t, err)
+	assert.Equal(t, data[:len(part)], part)
+
+	require.NoError(t, DownloadBackend(context.Background(), "test-tag", "linux-arm64", dest))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.NoFileExists(t, dest+".part")
+
+	require.Len(t, *requests, 2)
+	assert.Equal(t, "/test-tag/convex-local-backend-aarch64-unknown-linux-gnu.zip", (*requests)[0].URL.Path)
+	assert.Equal(t, fmt.Sprintf("bytes=%d-", len(part)), (*requests)[1].Header.Get("Range"))
+	assert.Equal(t, `"v1"`, (*requests)[1].Header.Get("If-Range"))
+}
+
+func TestDownloadBackend_SkipsCurrentDownload(t *testing.T) {
+	data := []byte("backend zip")
+	_, requests := releaseServer(t, data, `"v1"`, 0)
+	dest := filepath.Join(t.TempDir(), "backend.zip")
+
+	require.NoError(t, DownloadBackend(context.Background(), "", "linux-x64", dest))
+	require.NoError(t, DownloadBackend(context.Background(), "", "linux-x64", dest))
+
+	require.Len(t, *requests, 2)
+	assert.Equal(t, http.MethodGet, (*requests)[0].Method)
+	assert.Contains(t, (*requests)[0].URL.Path, backendReleaseTag)
+	assert.Equal(t, http.MethodHead, (*requests)[1].Method)
+
+	// A changed ETag triggers a fresh download
+	require.NoError(t, os.WriteFile(dest+".etag", []byte(`"v0"`), 0644))
+	require.NoError(t, DownloadBackend(context.Background(), "", "linux-x64", dest))
+	require.Len(t, *requests, 4)
+	assert.Equal(t, http.MethodGet, (*requests)[3].Method)
+	assert.Empty(t, (*requests)[3].Header.Get("Range"))
+}
+
+func TestDownloadBackend_RestartsWhenReleaseChanged(t *testing.T) {
+	data := []byte("new backend zip contents")
+	_, requests := releaseServer(t, data, `"v2"`, 0)
+	dest := filepath.Join(t.TempDir(), "backend.zip")
+
+	// A partial download of an older release is discarded via If-Range
+	require.NoError(t, os.WriteFile(dest+".part", []byte("old backend"), 0644))
+	require.NoError(t, os.WriteFile(dest+".etag", []byte(`"v1"`), 0644))
+
+	require.NoError(t, DownloadBackend(context.Background(), "", "linux-x64", dest))
+	got, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.Len(t, *requests, 1)
+}
+
+func TestDownloadBackend_Errors(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "backend.zip")
+
+	err := DownloadBackend(context.Background(), "", "wasip1-wasm", dest)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no backend release")
+
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	original := backendDownloadURL
+	backendDownloadURL = server.URL + "/%s/%s.zip"
+	defer func() { backendDownloadURL = original }()
+
+	err = DownloadBackend(context.Background(), "missing", "linux-x64", dest)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+// simulateStartError makes container startup fail with err for the rest of the test
+func simulateStartError(t *testing.T, err error) {
+	t.Helper()
+	original := startContainer
+	startContainer = func(context.Context, testcontainers.GenericContainerRequest) (testcontainers.Container, error) {
+		return nil, err
+	}
+	t.Cleanup(func() { startContainer = original })
+}
+
+func TestStartDockerBackend_DependencyCacheDir(t *testing.T) {
+	var req testcontainers.GenericContainerRequest
+	original := startContainer
+	startContainer = func(_ context.Context, r testcontainers.GenericContainerRequest) (testcontainers.Container, error) {
+		req = r
+		return nil, errors.New("not starting containers in tests")
+	}
+	t.Cleanup(func() { startContainer = original })
+
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	_, err := StartDockerBackend(context.Background(), Options{Apps: []string{t.TempDir()}, DependencyCacheDir: cacheDir})
+	require.Error(t, err)
+
+	assert.Contains(t, req.Mounts, testcontainers.BindMount(cacheDir, testcontainers.ContainerMountTarget(containerCacheDir)))
+	assert.Equal(t, containerCacheDir+"/npm", req.Env["npm_config_cache"])
+
+	// The cache is not created writable by other host users
+	info, err := os.Stat(cacheDir)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.Zero(t, info.Mode().Perm()&0022, "cache must not be group or world writable")
+
+	// Without the option, no cache is mounted
+	req = testcontainers.GenericContainerRequest{}
+	_, err = StartDockerBackend(context.Background(), Options{Apps: []string{t.TempDir()}})
+	require.Error(t, err)
+	for _, m := range req.Mounts {
+		assert.NotEqual(t, testcontainers.ContainerMountTarget(containerCacheDir), m.Target)
+	}
+	assert.Empty(t, req.Env)
+}
+
+func TestRun_DockerUnavailable(t *testing.T) {
+	startErr := errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?")
+	simulateStartError(t, startErr)
+
+	_, err := Run(context.Background(), Options{Apps: []string{t.TempDir()}})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrDockerUnavailable)
+	assert.ErrorIs(t, err, startErr, "the original error should be wrapped")
+	assert.Contains(t, err.Error(), "start Docker")
+	assert.NotErrorIs(t, err, ErrImagePullFailed)
+}
+
+func TestRun_ImagePullFailed(t *testing.T) {
+	startErr := errors.New("Error response from daemon: pull access denied for convex-predeploy, repository does not exist or may require 'docker login'")
+	simulateStartError(t, startErr)
+
+	_, err := Run(context.Background(), Options{Apps: []string{t.TempDir()}, DockerImage: "convex-predeploy:missing"})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrImagePullFailed)
+	assert.ErrorIs(t, err, startErr)
+	assert.Contains(t, err.Error(), "convex-predeploy:missing")
+	assert.Contains(t, err.Error(), "--docker-image")
+}
+
+func TestRun_OtherStartErrorUnchanged(t *testing.T) {
+	startErr := errors.New("container exited with code 137")
+	simulateStartError(t, startErr)
+
+	_, err := Run(context.Background(), Options{Apps: []string{t.TempDir()}})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, startErr)
+	assert.NotErrorIs(t, err, ErrDockerUnavailable)
+	assert.NotErrorIs(t, err, ErrImagePullFailed)
+	assert.Contains(t, err.Error(), "failed to start container")
+}
+
+func TestRun_EmptyStorage(t *testing.T) {
+	fakeConvexCLI(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	app := filepath.Join(tmpDir, "app")
+	require.NoError(t, os.MkdirAll(app, 0755))
+	databasePath := filepath.Join(tmpDir, "backend.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("external database"), 0644))
+
+	// The deployment uploads no files
+	backendStorage := filepath.Join(tmpDir, "backend-storage")
+	require.NoError(t, os.MkdirAll(backendStorage, 0755))
+
+	for name, storagePath := range map[string]string{
+		"empty storage":   backendStorage,
+		"missing storage": filepath.Join(tmpDir, "does-not-exist"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend := NewExternalBackend(server.URL, "admin-key")
+			backend.DatabasePath = databasePath
+			backend.StoragePath = storagePath
+
+			result, err := Run(context.Background(), Options{Apps: []string{app}, Backend: backend})
+			require.NoError(t, err)
+			defer result.Cleanup()
+
+			info, err := os.Stat(result.StoragePath)
+			require.NoError(t, err)
+			assert.True(t, info.IsDir())
+
+			// The bundle gets an empty but present storage/
+			creds, err := credentials.Generate("test-instance")
+			require.NoError(t, err)
+			backendBinary := filepath.Join(tmpDir, "backend")
+			require.NoError(t, os.WriteFile(backendBinary, []byte("fake backend"), 0755))
+			outputDir := filepath.Join(t.TempDir(), "bundle")
+			bundleResult, err := bundle.CreateWithResult(bundle.Options{
+				OutputDir:     outputDir,
+				BackendBinary: backendBinary,
+				DatabasePath:  result.DatabasePath,
+				StoragePath:   result.StoragePath,
+				Manifest:      manifest.New(manifest.Options{Name: "Empty", Version: "1.0.0", Platform: "linux-x64"}),
+				Credentials:   creds,
+			})
+			require.NoError(t, err)
+			assert.Zero(t, bundleResult.StorageFileCount)
+
+			entries, err := os.ReadDir(filepath.Join(outputDir, "storage"))
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestExtractTarDirectoryNoStrip_Empty(t *testing.T) {
+	// A tar of an empty directory holds only its "./" entry
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, tw.Close())
+
+	for name, data := range map[string][]byte{
+		"empty directory": buf.Bytes(),
+		"no entries":      make([]byte, 1024),
+		"no data":         nil,
+	} {
+		t.Run(name, func(t *testing.T) {
+			dest := t.TempDir()
+			require.NoError(t, extractTarDirectoryNoStrip(bytes.NewReader(data), dest))
+			entries, err := os.ReadDir(dest)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func TestGitApp_Validate(t *testing.T) {
+	valid := []GitApp{
+		{URL: "https://github.com/acme/app.git", Ref: "v1.2.3"},
+		{URL: "https://github.com/acme/app.git", Ref: "release/2024-06", Subdir: "apps/web"},
+		{URL: "ssh://git@github.com/acme/app.git", Ref: "main"},
+		{URL: "git@github.com:acme/app.git", Ref: "0123456789abcdef0123456789abcdef01234567"},
+	}
+	for _, app := range valid {
+		assert.NoError(t, app.Validate(), app.String())
+	}
+
+	tests := []struct {
+		app  GitApp
+		want string
+	}{
+		{app: GitApp{Ref: "main"}, want: "git URL is required"},
+		{app: GitApp{URL: "/local/repo", Ref: "main"}, want: "invalid git URL"},
+		{app: GitApp{URL: "file:///local/repo", Ref: "main"}, want: "invalid git URL"},
+		{app: GitApp{URL: "--upload-pack=touch /tmp/x", Ref: "main"}, want: "invalid git URL"},
+		{app: GitApp{URL: "https://github.com/acme/app.git\n", Ref: "main"}, want: "whitespace or control characters"},
+		{app: GitApp{URL: "https://github.com/acme/app.git"}, want: "git ref is required"},
+		{app: GitApp{URL: "https://github.com/acme/app.git", Ref: "--output=/tmp/x"}, want: "invalid git ref"},
+		{app: GitApp{URL: "https://github.com/acme/app.git", Ref: "main..dev"}, want: "invalid git ref"},
+		{app: GitApp{URL: "https://github.com/acme/app.git", Ref: "v1 beta"}, want: "invalid git ref"},
+		{app: GitApp{URL: "https://github.com/acme/app.git", Ref: "HEAD~1"}, want: "invalid git ref"},
+		{app: GitApp{URL: "https://github.com/acme/app.git", Ref: "main", Subdir: "../other"}, want: "invalid git app subdirectory"},
+		{app: GitApp{URL: "https://github.com/acme/app.git", Ref: "main", Subdir: "/abs"}, want: "invalid git app subdirectory"},
+	}
+	for _, tt := range tests {
+		assert.ErrorContains(t, tt.app.Validate(), tt.want, "%+v", tt.app)
+	}
+}
+
+func TestGitCloneCommand(t *testing.T) {
+	cmd := gitCloneCommand(GitApp{URL: "https://github.com/acme/app.git", Ref: "v1.2.3"}, "/git-app1")
+	assert.Equal(t, "git init --quiet '/git-app1' && cd '/git-app1' && git remote add origin 'https://github.com/acme/app.git' && git fetch --quiet --depth 1 origin 'v1.2.3' && git checkout --quiet FETCH_HEAD", cmd)
+
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+func TestRequiredPackages(t *testing.T) {
+	assert.Equal(t, []string{"curl", "unzip"}, requiredPackages(false, false))
+	assert.Equal(t, []string{"curl", "unzip", "git"}, requiredPackages(false, true))
+	assert.Equal(t, []string{"git"}, requiredPackages(true, true))
+	assert.Empty(t, requiredPackages(true, false))
+}
+
+// TestPrepareContainer_GitClone checks that a prepared base image can run the
+// clone command of a git app
+func TestPrepareContainer_GitClone(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping container test in short mode")
+	}
+	ctx := context.Background()
+
+	backendBinary := filepath.Join(t.TempDir(), "convex-local-backend")
+	require.NoError(t, os.WriteFile(backendBinary, []byte("#!/bin/sh\n"), 0755))
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:      "node:20-slim",
+			Cmd:        []string{"sh", "-c", "sleep infinity"},
+			WaitingFor: wait.ForExec([]string{"true"}).WithStartupTimeout(60 * time.Second),
+			Mounts: testcontainers.ContainerMounts{
+				testcontainers.BindMount(backendBinary, "/usr/local/bin/convex-local-backend"),
+			},
+			Labels: map[string]string{containerLabel: "true"},
+		},
+		Started: true,
+	})
+	require.NoError(t, err)
+	defer c.Terminate(context.WithoutCancel(ctx))
+
+	require.NoError(t, prepareContainer(ctx, c, "linux-x64", false, true, true))
+
+	app := GitApp{URL: "https://github.com/octocat/Hello-World.git", Ref: "master"}
+	exitCode, output, err := c.Exec(ctx, []string{"sh", "-c", gitCloneCommand(app, "/git-app0") + " && test -f /git-app0/README"}, tcexec.Multiplexed())
+	require.NoError(t, err)
+	assert.Equal(t, 0, exitCode, readOutput(output))
+}
+
+func TestDeployCommand(t *testing.T) {
+	extra := []string{"--typecheck=disable", "--message", "release notes with spaces", "$(touch pwned)", "it's; exit 1"}
+	cmd := deployCommand("/app0", "name|key", "http://localhost:3210", extra)
+	assert.Equal(t, `cd '/app0' && npx convex deploy --admin-key 'name|key' --url 'http://localhost:3210' --yes '--typecheck=disable' '--message' 'release notes with spaces' '$(touch pwned)' 'it'\''s; exit 1'`, cmd)
+
+	// Running the command passes each extra argument through unchanged
+	tmpDir := t.TempDir()
+	appDir := filepath.Join(tmpDir, "app0")
+	require.NoError(t, os.MkdirAll(appDir, 0755))
+	binDir := filepath.Join(tmpDir, "bin")
+	require.NoError(t, os.MkdirAll(binDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "npx"), []byte("#!/bin/sh\nfor arg in \"$@\"; do echo \"$arg\"; done\n"), 0755))
+
+	out, err := exec.Command("sh", "-c", "PATH="+shellQuote(binDir)+":$PATH; "+deployCommand(appDir, "key", "http://backend", extra)).Output()
+	require.NoError(t, err)
+	want := append([]string{"convex", "deploy", "--admin-key", "key", "--url", "http://backend", "--yes"}, extra...)
+	assert.Equal(t, want, strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"))
+	assert.NoFileExists(t, filepath.Join(appDir, "pwned"))
+}
+
+func TestValidateDeployArgs(t *testing.T) {
+	assert.NoError(t, validateDeployArgs(nil))
+	assert.NoError(t, validateDeployArgs([]string{"--typecheck=disable", "--message", "a b"}))
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{""}, "must not be empty"},
+		{[]string{"--message", "line\nbreak"}, "control characters"},
+		{[]string{"--admin-key", "other"}, "--admin-key is set by the bundler"},
+		{[]string{"--url=http://elsewhere"}, "--url is set by the bundler"},
+	}
+	for _, tt := range tests {
+		assert.ErrorContains(t, validateDeployArgs(tt.args), tt.want, "%q", tt.args)
+	}
+
+	_, err := Run(context.Background(), Options{Apps: []string{t.TempDir()}, DeployArgs: []string{"--url", "x"}})
+	assert.ErrorContains(t, err, "invalid deploy argument")
+}
+
+func TestContainerApps(t *testing.T) {
+	apps := containerApps(2, []GitApp{
+		{URL: "https://github.com/acme/app.git", Ref: "v1"},
+		{URL: "https://github.com/acme/mono.git", Ref: "main", Subdir: "apps/web"},
+	})
+	require.Len(t, apps, 4)
+	assert.Equal(t, containerApp{dir: "/app0"}, apps[0])
+	assert.Equal(t, containerApp{dir: "/app1"}, apps[1])
+	assert.Equal(t, "/git-app2", apps[2].dir)
+	assert.Contains(t, apps[2].clone, "git init --quiet '/git-app2'")
+	assert.Equal(t, "/git-app3/apps/web", apps[3].dir)
+	assert.Contains(t, apps[3].clone, "'https://github.com/acme/mono.git'")
+}
+
+func TestRun_GitAppsValidation(t *testing.T) {
+	_, err := Run(context.Background(), Options{
+		GitApps: []GitApp{{URL: "https://github.com/acme/app.git", Ref: "-x"}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid git app 0")
+
+	_, err = Run(context.Background(), Options{
+		GitApps: []GitApp{{URL: "https://github.com/acme/app.git", Ref: "v1"}},
+		Backend: NewExternalBackend("http://localhost:3210", "admin-key"),
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only be deployed with the Docker backend")
+}
+
+func TestDeployArgs_StrictTypecheck(t *testing.T) {
+	args, err := deployArgs(Options{DeployArgs: []string{"--message", "m"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--message", "m"}, args)
+
+	extra := []string{"--message", "m"}
+	args, err = deployArgs(Options{DeployArgs: extra, StrictTypecheck: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"--message", "m", "--typecheck=enable"}, args)
+	assert.Len(t, extra, 2, "DeployArgs must not be modified")
+
+	for _, conflicting := range [][]string{{"--typecheck=disable"}, {"--typecheck", "try"}} {
+		_, err = deployArgs(Options{DeployArgs: conflicting, StrictTypecheck: true})
+		assert.ErrorContains(t, err, "strict typechecking sets --typecheck=enable", "%q", conflicting)
+	}
+}
+
+func TestTypecheckError(t *testing.T) {
+	assert.NoError(t, typecheckError("✔ Deployed Convex functions to http://localhost:3210\n"))
+
+	output := "- Preparing Convex functions...\n" +
+		"\x1b[96mconvex/broken.ts\x1b[0m:\x1b[93m5\x1b[0m:\x1b[93m11\x1b[0m - \x1b[91merror\x1b[0m\x1b[90m TS2322: \x1b[0mType 'string' is not assignable to type 'number'.\n" +
+		"convex/other.ts:1:1 - error TS2304: Cannot find name 'missing'.\n" +
+		"✖ TypeScript typecheck via `tsc` failed.\n"
+	err := typecheckError(output)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrTypecheckFailed)
+	assert.Equal(t, "convex functions failed to typecheck:\n"+
+		"  convex/broken.ts:5:11 - error TS2322: Type 'string' is not assignable to type 'number'.\n"+
+		"  convex/other.ts:1:1 - error TS2304: Cannot find name 'missing'.", err.Error())
+}
+
+// fakeTypecheckingCLI puts an npx script on PATH whose `convex deploy`
+// prints a TypeScript error for apps containing a "type-error" file. It
+// fails only when typechecking is enabled, like a deploy whose default
+// typecheck is skipped.
+func fakeTypecheckingCLI(t *testing.T) {
+	t.Helper()
+	binDir := t.TempDir()
+	npx := `#!/bin/sh
+if [ "$1" = "convex" ] && [ "$2" = "--version" ]; then
+  echo "1.2.3"
+  exit 0
+fi
+if [ -f type-error ]; then
+  echo "convex/broken.ts:5:11 - error TS2322: Type 'string' is not assignable to type 'number'."
+  for arg in "$@"; do
+    if [ "$arg" = "--typecheck=enable" ]; then
+      echo "TypeScript typecheck via tsc failed."
+      exit 1
+    fi
+  done
+fi
+echo "Deployed Convex functions"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "npx"), []byte(npx), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "npm"), []byte("#!/bin/sh\nexit 0\n"), 0755))
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestRun_StrictTypecheck(t *testing.T) {
+	fakeTypecheckingCLI(t)
+
+	tmpDir := t.TempDir()
+	app := filepath.Join(tmpDir, "app")
+	require.NoError(t, os.MkdirAll(app, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(app, "type-error"), nil, 0644))
+	databasePath := filepath.Join(tmpDir, "backend.db")
+	require.NoError(t, os.WriteFile(databasePath, []byte("external database"), 0644))
+	backend := NewExternalBackend("http://localhost:3210", "admin-key")
+	backend.DatabasePath = databasePath
+
+	// Without strict typechecking the warnings do not fail the deploy
+	result, err := Run(context.Background(), Options{Apps: []string{app}, Backend: backend})
+	require.NoError(t, err)
+	require.NoError(t, result.Cleanup())
+
+	_, err = Run(context.Background(), Options{Apps: []string{app}, Backend: backend, StrictTypecheck: true})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrTypecheckFailed)
+	assert.Contains(t, err.Error(), "failed to deploy app 0")
+	assert.Contains(t, err.Error(), "convex/broken.ts:5:11 - error TS2322")
+}
+
+func TestRun_Integration_StrictTypecheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping container test in short mode")
+	}
+
+	// Copy the sample app and add a function with a deliberate type error
+	app := filepath.Join(t.TempDir(), "app")
+	src := "../../testdata/sample-app"
+	require.NoError(t, filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(app, rel), 0755)
+		}
+		return copyFile(path, filepath.Join(app, rel))
+	}))
+	broken := `import { query } from "./_generated/server";
+
+export const broken = query({
+  args: {},
+  handler: async () => {
+    const count: number = "not a number";
+    return count;
+  },
+});
+`
+	require.NoError(t, os.WriteFile(filepath.Join(app, "convex", "broken.ts"), []byte(broken), 0644))
+
+	_, err := Run(context.Background(), Options{
+		Apps:            []string{app},
+		OutputDir:       t.TempDir(),
+		Platform:        "linux-x64",
+		DockerImage:     "node:20-slim",
+		StrictTypecheck: true,
+	})
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrTypecheckFailed)
+	assert.Contains(t, err.Error(), "broken.ts")
+	assert.Contains(t, err.Error(), "TS2322")
+}
@@ -0,0 +1,319 @@
+package selfhost
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+)
+
+// CreateFromArchiveOptions contains options for creating a self-extracting
+// executable from an already compressed bundle archive.
+type CreateFromArchiveOptions struct {
+	// Archive is the compressed tar archive of a bundle directory
+	Archive io.Reader
+
+	// ArchiveCompression is the compression of Archive ("gzip", "zstd" or
+	// "brotli"). Defaults to "gzip" if empty
+	ArchiveCompression string
+
+	// Manifest is embedded in the header (optional, defaults to the
+	// archive's manifest.json)
+	Manifest *manifest.Manifest
+
+	// OpsBinary is the path to the convex-backend-ops binary
+	OpsBinary string
+
+	// OutputPath is the output path for the self-extracting executable
+	OutputPath string
+
+	// Platform is the target platform (e.g., "linux-x64", "linux-arm64")
+	Platform string
+
+	// Compression is the compression of the embedded bundle ("gzip", "zstd"
+	// or "brotli"). The archive is embedded as is when it matches
+	// ArchiveCompression and recompressed otherwise. Defaults to
+	// ArchiveCompression if empty
+	Compression string
+
+	// OpsVersion is the version (semver) of the ops binary (optional, for metadata)
+	OpsVersion string
+
+	// InstallPrefix is the directory the ops binary installs under
+	// (optional, defaults to DefaultInstallPrefix)
+	InstallPrefix string
+
+	// ServiceName is the systemd service name the ops binary installs
+	// (optional, defaults to DefaultServiceName)
+	ServiceName string
+
+	// HealthCheckPath is the endpoint the installer polls until the backend
+	// is ready (optional, defaults to DefaultHealthCheckPath)
+	HealthCheckPath string
+
+	// HealthCheckTimeout is how long the installer waits for the backend to
+	// become ready, in whole seconds (optional, defaults to DefaultHealthCheckTimeout)
+	HealthCheckTimeout time.Duration
+
+	// MaxBundleSize is the largest allowed size of the finished executable in
+	// bytes (optional, 0 means no limit)
+	MaxBundleSize int64
+
+	// ParallelCompression compresses gzip output on all CPUs using pgzip
+	// when the archive is recompressed
+	ParallelCompression bool
+
+	// ChecksumSidecar writes a <OutputPath>.sha256 file with the SHA256 of the
+	// finished executable (see WriteChecksumSidecar)
+	ChecksumSidecar bool
+
+	// MinOpsVersion is the oldest ops binary version (semver) that may
+	// install the bundle (optional, recorded in Header.MinOpsVersion)
+	MinOpsVersion string
+
+	// MinBackendVersion is the oldest backend version (semver) the bundle
+	// runs on (optional, recorded in Header.MinBackendVersion)
+	MinBackendVersion string
+
+	// ChecksumAlgorithm is the algorithm of the bundle checksum ("sha256",
+	// "sha512" or "blake3"; optional, defaults to "sha256")
+	ChecksumAlgorithm string
+
+	// Logger receives progress messages (optional, defaults to discarding them)
+	Logger logging.Logger
+}
+
+// CreateFromArchive assembles a self-extracting executable from a compressed
+// bundle archive, such as a tar.gz of a bundle directory, without unpacking
+// it to disk. The archive must contain the files every bundle requires.
+func CreateFromArchive(opts CreateFromArchiveOptions) error {
+	return CreateFromArchiveContext(context.Background(), opts)
+}
+
+// CreateFromArchiveContext is like CreateFromArchive but stops when ctx is
+// cancelled, returning ctx.Err() and removing the partially written output.
+func CreateFromArchiveContext(ctx context.Context, opts CreateFromArchiveOptions) error {
+	log := logging.OrNop(opts.Logger)
+
+	if opts.ArchiveCompression == "" {
+		opts.ArchiveCompression = CompressionGzip
+	}
+	if opts.Compression == "" {
+		opts.Compression = opts.ArchiveCompression
+	}
+	createOpts := CreateOptions{
+		OpsBinary:           opts.OpsBinary,
+		OutputPath:          opts.OutputPath,
+		Platform:            opts.Platform,
+		Compression:         opts.Compression,
+		OpsVersion:          opts.OpsVersion,
+		InstallPrefix:       opts.InstallPrefix,
+		ServiceName:         opts.ServiceName,
+		HealthCheckPath:     opts.HealthCheckPath,
+		HealthCheckTimeout:  opts.HealthCheckTimeout,
+		MaxBundleSize:       opts.MaxBundleSize,
+		ParallelCompression: opts.ParallelCompression,
+		ChecksumSidecar:     opts.ChecksumSidecar,
+		MinOpsVersion:       opts.MinOpsVersion,
+		MinBackendVersion:   opts.MinBackendVersion,
+		ChecksumAlgorithm:   opts.ChecksumAlgorithm,
+		Logger:              opts.Logger,
+	}
+	setCreateDefaults(&createOpts)
+
+	// Validate inputs
+	errs := validateExecutableInputs(createOpts, true)
+	if opts.Archive == nil {
+		errs = append(errs, fmt.Errorf("archive is required"))
+	}
+	if !isValidCompression(opts.ArchiveCompression) {
+		errs = append(errs, fmt.Errorf("invalid archive compression: %s (must be %q, %q or %q)", opts.ArchiveCompression, CompressionGzip, CompressionZstd, CompressionBrotli))
+	}
+	if !isValidCompression(opts.Compression) {
+		errs = append(errs, fmt.Errorf("invalid compression: %s (must be %q, %q or %q)", opts.Compression, CompressionGzip, CompressionZstd, CompressionBrotli))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	// Copy (or recompress) the archive to a temp file next to the output,
+	// hashing it and checking its entries on the way
+	archiveFile, err := os.CreateTemp(filepath.Dir(opts.OutputPath), "."+filepath.Base(opts.OutputPath)+".archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		archiveFile.Close()
+		os.Remove(archiveFile.Name())
+	}()
+
+	hash, err := newChecksumHash(createOpts.ChecksumAlgorithm)
+	if err != nil {
+		return err
+	}
+	summary, err := copyBundleArchive(ctx, io.MultiWriter(archiveFile, hash), opts.Archive, opts.ArchiveCompression, opts.Compression, opts.ParallelCompression)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	var missing []error
+	for _, file := range requiredBundleFiles {
+		if !summary.files[file] {
+			missing = append(missing, fmt.Errorf("archive is missing required file: %s", file))
+		}
+	}
+	if err := errors.Join(missing...); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+
+	mf := opts.Manifest
+	if mf == nil {
+		mf = &manifest.Manifest{}
+		if err := json.Unmarshal(summary.manifest, mf); err != nil {
+			return fmt.Errorf("failed to parse manifest.json: %w", err)
+		}
+	}
+
+	compressedSize, err := archiveFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to get archive size: %w", err)
+	}
+	if _, err := archiveFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind archive: %w", err)
+	}
+
+	if opts.Compression == opts.ArchiveCompression {
+		log.Debugf("Embedding %s archive as is: %d bytes -> %d bytes", opts.Compression, summary.uncompressedSize, compressedSize)
+	} else {
+		log.Debugf("Recompressed archive from %s to %s: %d bytes -> %d bytes", opts.ArchiveCompression, opts.Compression, summary.uncompressedSize, compressedSize)
+	}
+
+	checksum := formatChecksum(createOpts.ChecksumAlgorithm, hash)
+	header, err := newCreateHeader(createOpts, mf, time.Now().UTC(), summary.uncompressedSize, checksum, credentials.IsEncrypted(summary.credentials))
+	if err != nil {
+		return err
+	}
+
+	return writeExecutable(ctx, createOpts, header, archiveFile, compressedSize)
+}
+
+// archiveSummary describes the bundle archive read by copyBundleArchive.
+type archiveSummary struct {
+	// files holds the cleaned names of all regular file entries
+	files map[string]bool
+
+	// manifest is the content of manifest.json (nil if missing)
+	manifest []byte
+
+	// credentials is the content of credentials.json (nil if missing)
+	credentials []byte
+
+	// uncompressedSize is the total size of all regular files
+	uncompressedSize int64
+}
+
+// copyBundleArchive reads the tar archive r, compressed with srcCompression,
+// and writes it to w compressed with dstCompression. When the two match, the
+// compressed bytes are copied unchanged.
+func copyBundleArchive(ctx context.Context, w io.Writer, r io.Reader, srcCompression, dstCompression string, parallel bool) (*archiveSummary, error) {
+	r = &contextReader{ctx: ctx, r: r}
+
+	// Without recompression, the raw bytes are teed to w as they are read
+	passthrough := srcCompression == dstCompression
+	if passthrough {
+		r = io.TeeReader(r, w)
+	}
+
+	decompressReader, err := newDecompressReader(r, srcCompression, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressReader.Close()
+
+	var compressWriter io.WriteCloser
+	var tarWriter *tar.Writer
+	if !passthrough {
+		compressWriter, err = newCompressWriter(w, dstCompression, parallel, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer compressWriter.Close()
+		tarWriter = tar.NewWriter(compressWriter)
+		defer tarWriter.Close()
+	}
+
+	summary := &archiveSummary{files: make(map[string]bool)}
+	tarReader := tar.NewReader(decompressReader)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		var content io.Reader = tarReader
+		if tarWriter != nil {
+			if err := tarWriter.WriteHeader(hdr); err != nil {
+				return nil, fmt.Errorf("failed to write tar header for %s: %w", hdr.Name, err)
+			}
+			content = io.TeeReader(tarReader, tarWriter)
+		}
+
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		summary.files[name] = true
+
+		var n int64
+		if name == "manifest.json" {
+			summary.manifest, err = io.ReadAll(content)
+			n = int64(len(summary.manifest))
+		} else if name == credentialsFile {
+			summary.credentials, err = io.ReadAll(content)
+			n = int64(len(summary.credentials))
+		} else {
+			n, err = io.Copy(io.Discard, content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", hdr.Name, err)
+		}
+		summary.uncompressedSize += n
+	}
+
+	if passthrough {
+		// Consume the rest of the stream (e.g. the gzip trailer) so w
+		// receives the archive unchanged
+		if _, err := io.Copy(io.Discard, decompressReader); err != nil {
+			return nil, fmt.Errorf("failed to read archive trailer: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, fmt.Errorf("failed to read archive trailer: %w", err)
+		}
+		return summary, nil
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish tar archive: %w", err)
+	}
+	if err := compressWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish compression: %w", err)
+	}
+	return summary, nil
+}
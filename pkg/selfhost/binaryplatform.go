@@ -0,0 +1,95 @@
+package selfhost
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+)
+
+// Executable formats returned by binaryFormat
+const (
+	formatELF   = "ELF"
+	formatMachO = "Mach-O"
+	formatPE    = "PE"
+)
+
+// binaryFormat returns the executable format of the file at path, or "" if
+// it is not an ELF, Mach-O (including universal) or PE executable.
+func binaryFormat(path string) string {
+	if f, err := elf.Open(path); err == nil {
+		f.Close()
+		return formatELF
+	}
+	if f, err := macho.Open(path); err == nil {
+		f.Close()
+		return formatMachO
+	}
+	if f, err := macho.OpenFat(path); err == nil {
+		f.Close()
+		return formatMachO
+	}
+	if f, err := pe.Open(path); err == nil {
+		f.Close()
+		return formatPE
+	}
+	return ""
+}
+
+// checkOpsBinaryFormat returns an error if the bundle cannot be appended to
+// the ops binary. Linux ignores data after an ELF image, but code-signed
+// Mach-O and PE executables fail signature checks once bytes are appended,
+// so the resulting file would not run.
+func checkOpsBinaryFormat(opsBinary string) error {
+	switch format := binaryFormat(opsBinary); format {
+	case formatMachO, formatPE:
+		return fmt.Errorf("trailing-append embedding is not supported for %s ops binaries (appended data breaks code signatures); use an ELF ops binary: %s", format, opsBinary)
+	}
+	return nil
+}
+
+// binaryPlatform inspects the executable header of the file at path and
+// returns the GOOS and GOARCH it was built for. ok is false if the file is
+// not an ELF, Mach-O or PE executable for a recognized architecture.
+func binaryPlatform(path string) (goos, goarch string, ok bool) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		switch f.Machine {
+		case elf.EM_X86_64:
+			return "linux", "amd64", true
+		case elf.EM_AARCH64:
+			return "linux", "arm64", true
+		case elf.EM_386:
+			return "linux", "386", true
+		case elf.EM_ARM:
+			return "linux", "arm", true
+		case elf.EM_RISCV:
+			return "linux", "riscv64", true
+		}
+		return "", "", false
+	}
+
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		switch f.Cpu {
+		case macho.CpuAmd64:
+			return "darwin", "amd64", true
+		case macho.CpuArm64:
+			return "darwin", "arm64", true
+		}
+		return "", "", false
+	}
+
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		switch f.Machine {
+		case pe.IMAGE_FILE_MACHINE_AMD64:
+			return "windows", "amd64", true
+		case pe.IMAGE_FILE_MACHINE_ARM64:
+			return "windows", "arm64", true
+		}
+		return "", "", false
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,314 @@
+package selfhost
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// OpenBundle returns a read-only fs.FS over the bundle embedded in the
+// self-extracting executable at path, so files such as manifest.json can be
+// read with fs.ReadFile or walked with fs.WalkDir without extracting to disk.
+//
+// The bundle is verified and fully decompressed into memory when it is
+// opened, so the returned FS holds the whole uncompressed bundle (see
+// Header.BundleSize) for as long as it is referenced. Symlinks and hardlinks
+// resolve to their targets; links pointing outside the bundle are omitted.
+func OpenBundle(path string) (fs.FS, error) {
+	decompressReader, err := openBundleArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressReader.Close()
+
+	return indexBundle(tar.NewReader(decompressReader))
+}
+
+// ExtractFile returns the content of the regular file name, a slash-separated
+// path such as "convex.db", from the bundle embedded in the self-extracting
+// executable at executablePath. Unlike OpenBundle, only that file is held in
+// memory.
+func ExtractFile(executablePath, name string) ([]byte, error) {
+	decompressReader, err := openBundleArchive(executablePath)
+	if err != nil {
+		return nil, err
+	}
+	defer decompressReader.Close()
+
+	tarReader := tar.NewReader(decompressReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("bundle does not contain %s: %w", name, fs.ErrNotExist)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+		if path.Clean(filepath.ToSlash(header.Name)) != name {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s in bundle is not a regular file", name)
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		return data, nil
+	}
+}
+
+// openBundleArchive verifies the bundle embedded in the executable at path
+// and returns a reader of its uncompressed tar archive.
+func openBundleArchive(path string) (io.ReadCloser, error) {
+	_, header, compressedData, err := readEmbeddedBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := header.CheckCompatible(); err != nil {
+		return nil, err
+	}
+	if err := verifyChecksum(header.BundleChecksum, compressedData); err != nil {
+		return nil, err
+	}
+
+	return newDecompressReader(bytes.NewReader(compressedData), detectCompression(compressedData, header.Compression, nil), header.ZstdDictionary)
+}
+
+// bundleFS is an in-memory fs.FS built from the bundle's tar archive.
+type bundleFS struct {
+	entries map[string]*bundleEntry
+}
+
+// bundleEntry is a file or directory in a bundleFS.
+type bundleEntry struct {
+	name    string
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+
+	// children lists a directory's entries sorted by name
+	children []fs.DirEntry
+}
+
+// bundleLink is a symlink or hardlink awaiting resolution once all entries are indexed.
+type bundleLink struct {
+	name    string
+	target  string
+	symlink bool
+	header  *tar.Header
+}
+
+// indexBundle reads every entry of the tar archive into memory.
+func indexBundle(tarReader *tar.Reader) (*bundleFS, error) {
+	fsys := &bundleFS{entries: map[string]*bundleEntry{
+		".": {name: ".", mode: fs.ModeDir | 0755},
+	}}
+	var links []bundleLink
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		name := path.Clean(filepath.ToSlash(header.Name))
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("invalid path in tar: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			fsys.addEntry(name, &bundleEntry{mode: fs.ModeDir | fs.FileMode(header.Mode).Perm(), modTime: header.ModTime})
+
+		case tar.TypeReg:
+			data, err := io.ReadAll(tarReader)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			fsys.addEntry(name, &bundleEntry{mode: fs.FileMode(header.Mode).Perm(), modTime: header.ModTime, data: data})
+
+		case tar.TypeSymlink:
+			target := header.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			links = append(links, bundleLink{name: name, target: target, symlink: true, header: header})
+
+		case tar.TypeLink:
+			links = append(links, bundleLink{name: name, target: path.Clean(filepath.ToSlash(header.Linkname)), header: header})
+		}
+	}
+
+	// Links may point at entries archived after them, or at other links, so
+	// resolve them in passes until no more can be resolved
+	for len(links) > 0 {
+		var unresolved []bundleLink
+		for _, link := range links {
+			target, ok := fsys.entries[link.target]
+			if !ok || !fs.ValidPath(link.target) {
+				unresolved = append(unresolved, link)
+				continue
+			}
+			if target.mode.IsDir() {
+				// Directory links would require copying whole subtrees
+				continue
+			}
+			entry := *target
+			if !link.symlink {
+				entry.mode = fs.FileMode(link.header.Mode).Perm()
+				entry.modTime = link.header.ModTime
+			}
+			fsys.addEntry(link.name, &entry)
+		}
+		if len(unresolved) == len(links) {
+			break
+		}
+		links = unresolved
+	}
+
+	for _, entry := range fsys.entries {
+		sort.Slice(entry.children, func(i, j int) bool {
+			return entry.children[i].Name() < entry.children[j].Name()
+		})
+	}
+
+	return fsys, nil
+}
+
+// addEntry stores entry at name, creating any missing parent directories.
+func (f *bundleFS) addEntry(name string, entry *bundleEntry) {
+	entry.name = path.Base(name)
+	if existing, ok := f.entries[name]; ok {
+		// A directory seen implicitly before its own tar entry keeps its children
+		if existing.mode.IsDir() && entry.mode.IsDir() {
+			existing.mode = entry.mode
+			existing.modTime = entry.modTime
+			return
+		}
+		f.removeChild(path.Dir(name), entry.name)
+	}
+	f.entries[name] = entry
+
+	parent := path.Dir(name)
+	if _, ok := f.entries[parent]; !ok {
+		f.addEntry(parent, &bundleEntry{mode: fs.ModeDir | 0755})
+	}
+	dir := f.entries[parent]
+	dir.children = append(dir.children, fs.FileInfoToDirEntry(entry.info()))
+}
+
+// removeChild drops name from the children of the directory dirName.
+func (f *bundleFS) removeChild(dirName, name string) {
+	dir := f.entries[dirName]
+	for i, child := range dir.children {
+		if child.Name() == name {
+			dir.children = append(dir.children[:i], dir.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// Open implements fs.FS.
+func (f *bundleFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := f.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.mode.IsDir() {
+		return &bundleDir{entry: entry}, nil
+	}
+	return &bundleFile{entry: entry, reader: bytes.NewReader(entry.data)}, nil
+}
+
+// ReadFile implements fs.ReadFileFS without copying through a bundleFile.
+func (f *bundleFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	entry, ok := f.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	if entry.mode.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	return bytes.Clone(entry.data), nil
+}
+
+// info returns the fs.FileInfo describing the entry.
+func (e *bundleEntry) info() fs.FileInfo {
+	return bundleFileInfo{entry: e}
+}
+
+// bundleFileInfo implements fs.FileInfo for a bundleEntry.
+type bundleFileInfo struct {
+	entry *bundleEntry
+}
+
+func (i bundleFileInfo) Name() string       { return i.entry.name }
+func (i bundleFileInfo) Size() int64        { return int64(len(i.entry.data)) }
+func (i bundleFileInfo) Mode() fs.FileMode  { return i.entry.mode }
+func (i bundleFileInfo) ModTime() time.Time { return i.entry.modTime }
+func (i bundleFileInfo) IsDir() bool        { return i.entry.mode.IsDir() }
+func (i bundleFileInfo) Sys() any           { return nil }
+
+// bundleFile is an open regular file in a bundleFS.
+type bundleFile struct {
+	entry  *bundleEntry
+	reader *bytes.Reader
+}
+
+func (f *bundleFile) Stat() (fs.FileInfo, error) { return f.entry.info(), nil }
+func (f *bundleFile) Read(p []byte) (int, error) { return f.reader.Read(p) }
+func (f *bundleFile) Close() error               { return nil }
+
+// Seek implements io.Seeker.
+func (f *bundleFile) Seek(offset int64, whence int) (int64, error) {
+	return f.reader.Seek(offset, whence)
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *bundleFile) ReadAt(p []byte, offset int64) (int, error) {
+	return f.reader.ReadAt(p, offset)
+}
+
+// bundleDir is an open directory in a bundleFS.
+type bundleDir struct {
+	entry  *bundleEntry
+	offset int
+}
+
+func (d *bundleDir) Stat() (fs.FileInfo, error) { return d.entry.info(), nil }
+func (d *bundleDir) Close() error               { return nil }
+
+func (d *bundleDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.name, Err: fmt.Errorf("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *bundleDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entry.children[d.offset:]
+	if n <= 0 {
+		d.offset += len(remaining)
+		return append([]fs.DirEntry(nil), remaining...), nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	n = min(n, len(remaining))
+	d.offset += n
+	return append([]fs.DirEntry(nil), remaining[:n]...), nil
+}
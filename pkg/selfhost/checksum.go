@@ -0,0 +1,87 @@
+package selfhost
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/zeebo/blake3"
+)
+
+// Checksum algorithms for the bundle checksum. The algorithm is recorded as
+// the prefix of Header.BundleChecksum (e.g. "sha512:<hex>").
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA512 = "sha512"
+	ChecksumBLAKE3 = "blake3"
+)
+
+// isValidChecksumAlgorithm reports whether algorithm is a known checksum algorithm.
+func isValidChecksumAlgorithm(algorithm string) bool {
+	switch algorithm {
+	case ChecksumSHA256, ChecksumSHA512, ChecksumBLAKE3:
+		return true
+	}
+	return false
+}
+
+// newChecksumHash returns a hash for the given checksum algorithm.
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumSHA512:
+		return sha512.New(), nil
+	case ChecksumBLAKE3:
+		return blake3.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm: %s (must be %q, %q or %q)", algorithm, ChecksumSHA256, ChecksumSHA512, ChecksumBLAKE3)
+	}
+}
+
+// formatChecksum returns the sum of h in the "algorithm:hexstring" format.
+func formatChecksum(algorithm string, h hash.Hash) string {
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// checksumAlgorithm returns the algorithm prefix of a checksum in the
+// "algorithm:hexstring" format, or "" if it has none.
+func checksumAlgorithm(checksum string) string {
+	algorithm, _, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return ""
+	}
+	return algorithm
+}
+
+// calculateChecksumWith calculates the checksum of data with algorithm.
+func calculateChecksumWith(algorithm string, data []byte) (string, error) {
+	h, err := newChecksumHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	return formatChecksum(algorithm, h), nil
+}
+
+// verifyChecksum returns an error if the checksum of data, calculated with
+// the algorithm named in expected's prefix, does not match expected.
+func verifyChecksum(expected string, data []byte) error {
+	actual, err := checksumLike(expected, data)
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// checksumLike calculates the checksum of data with the algorithm named in
+// expected's prefix, so the result can be compared to expected.
+func checksumLike(expected string, data []byte) (string, error) {
+	return calculateChecksumWith(checksumAlgorithm(expected), data)
+}
@@ -0,0 +1,162 @@
+package selfhost
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
+)
+
+const (
+	// CompressionAuto selects the compression algorithm by trying each
+	// available one on the bundle. It is only valid in CreateOptions; the
+	// header always records the algorithm that was chosen.
+	CompressionAuto = "auto"
+
+	// DefaultAutoCompressionBudget is the time each algorithm may take to
+	// compress the bundle before it is excluded from automatic selection.
+	DefaultAutoCompressionBudget = 30 * time.Second
+
+	// autoMinSavings is the fraction by which an algorithm must beat gzip's
+	// output before it is preferred, so marginal gains don't trade away
+	// gzip's speed and compatibility.
+	autoMinSavings = 0.02
+)
+
+// autoCandidates are the algorithms tried by CompressionAuto, baseline first.
+var autoCandidates = []string{CompressionGzip, CompressionZstd, CompressionBrotli}
+
+// CompressionCandidate is one algorithm measured during automatic selection.
+type CompressionCandidate struct {
+	// Compression is the algorithm that was tried
+	Compression string `json:"compression"`
+
+	// Size is the compressed size in bytes
+	Size int64 `json:"size"`
+
+	// Duration is how long compression took
+	Duration time.Duration `json:"duration"`
+
+	// OverBudget is true if compression took longer than the time budget
+	OverBudget bool `json:"overBudget,omitempty"`
+}
+
+// CompressionDecision records how CompressionAuto picked an algorithm.
+type CompressionDecision struct {
+	// Compression is the chosen algorithm
+	Compression string `json:"compression"`
+
+	// Candidates lists every algorithm that was measured
+	Candidates []CompressionCandidate `json:"candidates"`
+}
+
+// compressedArchive is a bundle archive compressed in memory
+type compressedArchive struct {
+	data             []byte // Compressed tar archive
+	uncompressedSize int64  // Total size of the archived files
+	checksum         string // Checksum of data in the "algorithm:hexstring" format
+}
+
+// compressArchive compresses bundleDir into memory with compression,
+// hashing the compressed bytes with checksumAlgorithm as they are written so
+// they need no second pass. archiveOpts is passed to createCompressedTar.
+func compressArchive(ctx context.Context, bundleDir, compression, checksumAlgorithm string, archiveOpts archiveOptions) (*compressedArchive, error) {
+	h, err := newChecksumHash(checksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	size, err := createCompressedTar(ctx, io.MultiWriter(&buf, h), bundleDir, compression, archiveOpts)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedArchive{
+		data:             buf.Bytes(),
+		uncompressedSize: size,
+		checksum:         formatChecksum(checksumAlgorithm, h),
+	}, nil
+}
+
+// chooseCompression compresses the bundle with each candidate algorithm and
+// returns the decision along with the chosen compressed archive, checksummed
+// with checksumAlgorithm. Candidates exceeding budget are ignored, except the
+// gzip baseline which is always eligible. archiveOpts is passed to createCompressedTar.
+func chooseCompression(ctx context.Context, bundleDir string, budget time.Duration, checksumAlgorithm string, archiveOpts archiveOptions) (*CompressionDecision, *compressedArchive, error) {
+	if budget <= 0 {
+		budget = DefaultAutoCompressionBudget
+	}
+
+	decision := &CompressionDecision{}
+	var best *compressedArchive
+	var baselineSize int64
+
+	for i, compression := range autoCandidates {
+		start := time.Now()
+		archive, err := compressArchive(ctx, bundleDir, compression, checksumAlgorithm, archiveOpts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to compress with %s: %w", compression, err)
+		}
+		candidate := CompressionCandidate{
+			Compression: compression,
+			Size:        int64(len(archive.data)),
+			Duration:    time.Since(start),
+		}
+		candidate.OverBudget = candidate.Duration > budget
+		decision.Candidates = append(decision.Candidates, candidate)
+
+		if i == 0 {
+			baselineSize = candidate.Size
+			decision.Compression = compression
+			best = archive
+			continue
+		}
+
+		if candidate.OverBudget {
+			continue
+		}
+		beatsBaseline := float64(candidate.Size) <= float64(baselineSize)*(1-autoMinSavings)
+		if beatsBaseline && candidate.Size < int64(len(best.data)) {
+			decision.Compression = compression
+			best = archive
+		}
+	}
+
+	return decision, best, nil
+}
+
+// Magic numbers at the start of compressed streams. Brotli streams have none.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// sniffCompression returns the compression algorithm identified by the magic
+// number at the start of data, or "" if it is not recognized.
+func sniffCompression(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return CompressionZstd
+	default:
+		return ""
+	}
+}
+
+// detectCompression returns the algorithm to decompress data with: the one
+// identified by its magic number, or headerCompression if sniffing is
+// inconclusive. A warning is logged if the two disagree, since the header
+// was then written incorrectly or by another tool.
+func detectCompression(data []byte, headerCompression string, log logging.Logger) string {
+	sniffed := sniffCompression(data)
+	if sniffed == "" {
+		return headerCompression
+	}
+	if sniffed != headerCompression && !(sniffed == CompressionGzip && headerCompression == "") {
+		logging.OrNop(log).Warnf("Header says the bundle is %q compressed but its data is %s; using %s", headerCompression, sniffed, sniffed)
+	}
+	return sniffed
+}
@@ -0,0 +1,100 @@
+package selfhost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/dict"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+)
+
+const (
+	// DefaultZstdDictionarySize is the size of dictionaries built by
+	// TrainDictionary (64KB)
+	DefaultZstdDictionarySize = 64 << 10
+
+	// MaxZstdDictionarySize is the largest dictionary CreateOptions accepts,
+	// so the header, which stores it base64 encoded, stays well below
+	// MaxHeaderSize (256KB)
+	MaxZstdDictionarySize = 256 << 10
+
+	// dictionarySampleSize is how much of each file TrainDictionary samples.
+	// The trainer only looks at the start of each sample.
+	dictionarySampleSize = 128 << 10
+)
+
+// TrainDictionary builds a zstd dictionary from the files in bundleDir, for
+// CreateOptions.ZstdDictionary. It pays off for storage holding many small,
+// similar files. credentials.json, convex.env and storage paths matched by
+// the storage ignore file are not sampled, so no secrets end up in the
+// dictionary, which is stored in the header in the clear. Training is not
+// deterministic, so reproducible builds should train once and reuse the
+// saved dictionary.
+func TrainDictionary(bundleDir string) ([]byte, error) {
+	storageIgnore, err := ignore.Load(filepath.Join(bundleDir, "storage"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage ignore file: %w", err)
+	}
+	entries, err := collectArchiveEntries(context.Background(), bundleDir, map[string]bool{credentialsFile: true, envFile: true}, storageIgnore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk bundle directory: %w", err)
+	}
+
+	var samples [][]byte
+	for _, entry := range entries {
+		if !entry.info.Mode().IsRegular() || entry.info.Size() == 0 {
+			continue
+		}
+		sample, err := readSample(entry.path)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no files to train a dictionary on in %s", bundleDir)
+	}
+
+	dictionary, err := dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: DefaultZstdDictionarySize,
+		HashBytes:   6,
+		ZstdLevel:   zstd.SpeedBestCompression,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to train zstd dictionary: %w", err)
+	}
+	return dictionary, nil
+}
+
+// readSample returns up to dictionarySampleSize bytes from the start of path.
+func readSample(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	sample, err := io.ReadAll(io.LimitReader(f, dictionarySampleSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return sample, nil
+}
+
+// validateZstdDictionary checks that dictionary is a zstd dictionary that
+// fits in the header.
+func validateZstdDictionary(dictionary []byte) error {
+	if len(dictionary) > MaxZstdDictionarySize {
+		return fmt.Errorf("zstd dictionary is %d bytes, larger than the maximum of %d", len(dictionary), MaxZstdDictionarySize)
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderDict(dictionary))
+	if err != nil {
+		return fmt.Errorf("invalid zstd dictionary: %w", err)
+	}
+	encoder.Close()
+	return nil
+}
@@ -0,0 +1,149 @@
+package selfhost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// headerFields has Header's fields without its JSON methods.
+type headerFields Header
+
+// headerKeys holds the lowercased JSON names of Header's fields, which
+// extensions may not use in any case, since encoding/json matches field
+// names case-insensitively
+var headerKeys = lowerKeys(jsonFieldNames(reflect.TypeOf(headerFields{})))
+
+// jsonFieldNames returns the JSON names of typ's serialized fields.
+func jsonFieldNames(typ reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// lowerKeys returns a copy of names with every key lowercased.
+func lowerKeys(names map[string]bool) map[string]bool {
+	lower := make(map[string]bool, len(names))
+	for name := range names {
+		lower[strings.ToLower(name)] = true
+	}
+	return lower
+}
+
+// validateExtensionKey returns an error if key cannot be used as an
+// extension.
+func validateExtensionKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("extension key is required")
+	}
+	if headerKeys[strings.ToLower(key)] {
+		return fmt.Errorf("extension key %q is a header field", key)
+	}
+	return nil
+}
+
+// SetExtension stores value, serialized to JSON, as the extension key.
+func (h *Header) SetExtension(key string, value any) error {
+	if err := validateExtensionKey(key); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize extension %q: %w", key, err)
+	}
+	if h.Extensions == nil {
+		h.Extensions = make(map[string]json.RawMessage)
+	}
+	h.Extensions[key] = data
+	return nil
+}
+
+// Extension parses the extension key into v. It reports false, leaving v
+// unchanged, if the header has no such extension.
+func (h *Header) Extension(key string, v any) (bool, error) {
+	data, ok := h.Extensions[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("failed to parse extension %q: %w", key, err)
+	}
+	return true, nil
+}
+
+// MarshalJSON serializes the header fields followed by the extensions,
+// sorted by key.
+func (h Header) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(headerFields(h))
+	if err != nil || len(h.Extensions) == 0 {
+		return data, err
+	}
+
+	keys := make([]string, 0, len(h.Extensions))
+	for key := range h.Extensions {
+		if err := validateExtensionKey(key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Append the extensions inside the object's closing brace
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	for _, key := range keys {
+		keyData, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		value := h.Extensions[key]
+		if !json.Valid(value) {
+			return nil, fmt.Errorf("extension %q is not valid JSON", key)
+		}
+		buf.WriteByte(',')
+		buf.Write(keyData)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON parses the header fields and captures every other top-level
+// key, as compact JSON, in Extensions, so headers from newer bundlers keep
+// their metadata.
+func (h *Header) UnmarshalJSON(data []byte) error {
+	var fields headerFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for key, value := range raw {
+		if headerKeys[strings.ToLower(key)] {
+			continue
+		}
+		// Drop the indentation ToJSON adds, so values compare equal
+		// however the header was formatted
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, value); err != nil {
+			return err
+		}
+		if fields.Extensions == nil {
+			fields.Extensions = make(map[string]json.RawMessage)
+		}
+		fields.Extensions[key] = compact.Bytes()
+	}
+	*h = Header(fields)
+	return nil
+}
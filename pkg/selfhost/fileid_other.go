@@ -0,0 +1,11 @@
+//go:build !unix
+
+package selfhost
+
+import "os"
+
+// hardlinkID reports no hardlinks on platforms without inode information,
+// so linked files are archived as separate copies.
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
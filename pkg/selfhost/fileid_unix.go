@@ -0,0 +1,18 @@
+//go:build unix
+
+package selfhost
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardlinkID returns the device and inode identifying info's underlying file,
+// and whether it has more than one link and so may be a hardlink.
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -5,8 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/version"
 )
 
 // Magic markers for self-extracting executable format
@@ -18,6 +23,10 @@ var (
 	// MagicEnd is the marker that indicates the end of the embedded bundle section.
 	// Must be exactly 18 bytes: "CONVEX_BUNDLE_END\x00"
 	MagicEnd = []byte("CONVEX_BUNDLE_END\x00")
+
+	// MagicFooter is the marker that precedes the offset field in the footer.
+	// Must be exactly 8 bytes: "CVXFOOT\x00"
+	MagicFooter = []byte("CVXFOOT\x00")
 )
 
 const (
@@ -30,12 +39,60 @@ const (
 	// HeaderLengthSize is the size of the header length prefix (4 bytes, big-endian)
 	HeaderLengthSize = 4
 
-	// FooterSize is the size of the footer containing the offset to MagicStart (8 bytes, little-endian uint64)
-	FooterSize = 8
+	// MaxHeaderSize is the largest serialized header, in bytes, that can be written or read (1MB)
+	MaxHeaderSize = 1 << 20
+
+	// MagicFooterLen is the length of the footer magic marker (8 bytes)
+	MagicFooterLen = 8
+
+	// FooterVersionSize is the size of the footer format version field (4 bytes, little-endian uint32)
+	FooterVersionSize = 4
+
+	// FooterOffsetSize is the size of the footer field holding the offset to MagicStart (8 bytes, little-endian uint64)
+	FooterOffsetSize = 8
+
+	// FooterSize is the size of the footer: MagicFooter, the footer version and the offset to MagicStart.
+	// Later footer versions may add fields before MagicFooter but keep these final bytes unchanged.
+	FooterSize = MagicFooterLen + FooterVersionSize + FooterOffsetSize
+
+	// FooterVersion is the footer format version written by this bundler
+	FooterVersion uint32 = 1
 
 	// HeaderVersion is the current version of the header format
 	HeaderVersion = "1.0.0"
 
+	// BrotliHeaderVersion is the header version written for brotli bundles,
+	// which readers of HeaderVersion cannot extract
+	BrotliHeaderVersion = "1.1.0"
+
+	// ChecksumHeaderVersion is the header version written for bundles whose
+	// checksum is not SHA256, which readers of BrotliHeaderVersion cannot verify
+	ChecksumHeaderVersion = "1.2.0"
+
+	// CompressedOpsHeaderVersion is the header version written when the ops
+	// binary is stored compressed (see Header.OpsBinary), which readers of
+	// ChecksumHeaderVersion would treat as a runnable executable
+	CompressedOpsHeaderVersion = "1.3.0"
+
+	// EncryptedCredentialsHeaderVersion is the header version written when
+	// credentials.json is encrypted (see Header.CredentialsEncrypted), which
+	// readers of CompressedOpsHeaderVersion would install as plain credentials
+	EncryptedCredentialsHeaderVersion = "1.4.0"
+
+	// ZstdDictionaryHeaderVersion is the header version written when the
+	// bundle is compressed with a zstd dictionary (see Header.ZstdDictionary),
+	// which readers of EncryptedCredentialsHeaderVersion cannot decompress
+	ZstdDictionaryHeaderVersion = "1.5.0"
+
+	// OmittedCredentialsHeaderVersion is the header version written when
+	// credentials.json was left out of the bundle (see
+	// Header.CredentialsOmitted), which readers of ZstdDictionaryHeaderVersion
+	// would install without credentials
+	OmittedCredentialsHeaderVersion = "1.6.0"
+
+	// SupportedHeaderVersion is the newest header version this package can read
+	SupportedHeaderVersion = OmittedCredentialsHeaderVersion
+
 	// HeaderFormat is the format identifier for self-host bundles
 	HeaderFormat = "selfhost-v1"
 
@@ -44,8 +101,28 @@ const (
 
 	// CompressionZstd indicates zstd compression
 	CompressionZstd = "zstd"
+
+	// CompressionBrotli indicates brotli compression (requires header version 1.1.0)
+	CompressionBrotli = "brotli"
+
+	// DefaultInstallPrefix is the install prefix used when none is configured
+	DefaultInstallPrefix = "/usr/local"
+
+	// DefaultServiceName is the systemd service name used when none is configured
+	DefaultServiceName = "convex-backend"
+
+	// DefaultHealthCheckPath is the readiness endpoint used when none is configured
+	DefaultHealthCheckPath = "/version"
+
+	// DefaultHealthCheckTimeout is how long the installer waits for the
+	// backend to become ready when no timeout is configured
+	DefaultHealthCheckTimeout = 30 * time.Second
 )
 
+// serviceNamePattern matches systemd unit name prefixes: letters, digits and
+// ":_.@-", not starting with "-" or ".", and without the ".service" suffix.
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9:_@][A-Za-z0-9:_.@-]*$`)
+
 // Header contains metadata about the self-extracting executable and its embedded bundle.
 type Header struct {
 	// Version is the header format version
@@ -54,23 +131,127 @@ type Header struct {
 	// Format is always "selfhost-v1"
 	Format string `json:"format"`
 
-	// Compression is the compression algorithm used ("gzip" or "zstd")
+	// Compression is the compression algorithm used ("gzip", "zstd" or "brotli")
 	Compression string `json:"compression"`
 
 	// BundleSize is the uncompressed bundle size in bytes
 	BundleSize int64 `json:"bundleSize"`
 
-	// BundleChecksum is the SHA256 checksum of the compressed bundle (format: "sha256:hexstring")
+	// BundleChecksum is the checksum of the compressed bundle (format:
+	// "algorithm:hexstring", where algorithm is "sha256", "sha512" or "blake3")
 	BundleChecksum string `json:"bundleChecksum"`
 
 	// Manifest contains the embedded bundle manifest
 	Manifest *manifest.Manifest `json:"manifest"`
 
+	// Platform is the target platform (e.g. "linux-x64") the executable was
+	// created for. It is empty in headers written before it was added; see
+	// PlatformOrManifest.
+	Platform string `json:"platform,omitempty"`
+
 	// OpsVersion is the version of the embedded convex-backend-ops binary
+	// (semver when set by this bundler; see OpsSemver)
 	OpsVersion string `json:"opsVersion"`
 
 	// CreatedAt is the ISO 8601 timestamp of when the self-extracting executable was created
 	CreatedAt string `json:"createdAt"`
+
+	// InstallPrefix is the directory the ops binary installs under (e.g. "/usr/local")
+	InstallPrefix string `json:"installPrefix,omitempty"`
+
+	// ServiceName is the systemd service name the ops binary installs (without ".service")
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// HealthCheck configures how the installer checks that the backend is ready
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// CredentialsOmitted is true when credentials.json was left out of the
+	// bundle and must be supplied at install time
+	CredentialsOmitted bool `json:"credentialsOmitted,omitempty"`
+
+	// CredentialsEncrypted is true when the bundle's credentials.json is
+	// encrypted with a passphrase and must be decrypted at install time
+	CredentialsEncrypted bool `json:"credentialsEncrypted,omitempty"`
+
+	// MinOpsVersion is the oldest ops binary version (semver) that can
+	// install this bundle (see CheckVersionCompatibility)
+	MinOpsVersion string `json:"minOpsVersion,omitempty"`
+
+	// MinBackendVersion is the oldest backend version (semver) this bundle
+	// can run on (see CheckBackendVersionCompatibility)
+	MinBackendVersion string `json:"minBackendVersion,omitempty"`
+
+	// OpsBinary is set when the ops binary before the bundle section is
+	// stored compressed. Such a file is not directly runnable; Strip
+	// recovers the ops binary.
+	OpsBinary *OpsBinaryInfo `json:"opsBinary,omitempty"`
+
+	// ZstdDictionary is the dictionary a zstd bundle was compressed with
+	// (base64 in JSON), which is needed to decompress it (see
+	// CreateOptions.ZstdDictionary)
+	ZstdDictionary []byte `json:"zstdDictionary,omitempty"`
+
+	// Extensions holds additional top-level header keys, such as experimental
+	// metadata or fields written by newer bundlers. They are serialized next
+	// to the fields above, and unknown keys are captured here when parsing
+	// (see SetExtension and Extension)
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// HealthCheck configures the installer's backend readiness check.
+type HealthCheck struct {
+	// Path is the HTTP path polled until it responds successfully (e.g. "/version")
+	Path string `json:"path"`
+
+	// TimeoutSeconds is how long to wait for the backend to become ready
+	TimeoutSeconds int `json:"timeoutSeconds"`
+}
+
+// OpsBinaryInfo describes a compressed ops binary.
+type OpsBinaryInfo struct {
+	// Compression is the compression algorithm of the ops binary region
+	Compression string `json:"compression"`
+
+	// Size is the uncompressed ops binary size in bytes
+	Size int64 `json:"size"`
+
+	// Checksum is the checksum of the uncompressed ops binary, in the same
+	// "algorithm:hexstring" format as BundleChecksum
+	Checksum string `json:"checksum"`
+}
+
+// Validate checks that the compression and checksum algorithm are known and
+// the size is positive.
+func (o OpsBinaryInfo) Validate() error {
+	if !isValidCompression(o.Compression) {
+		return fmt.Errorf("invalid ops binary compression: expected %q, %q or %q, got %q", CompressionGzip, CompressionZstd, CompressionBrotli, o.Compression)
+	}
+	if o.Size <= 0 {
+		return fmt.Errorf("ops binary size must be positive")
+	}
+	if algorithm := checksumAlgorithm(o.Checksum); !isValidChecksumAlgorithm(algorithm) {
+		return fmt.Errorf("unsupported ops binary checksum algorithm %q", algorithm)
+	}
+	return nil
+}
+
+// Timeout returns TimeoutSeconds as a duration.
+func (c HealthCheck) Timeout() time.Duration {
+	return time.Duration(c.TimeoutSeconds) * time.Second
+}
+
+// Validate checks that the health check has a path and a positive timeout.
+func (c HealthCheck) Validate() error {
+	if c.Path == "" {
+		return fmt.Errorf("health check path is required")
+	}
+	if !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("health check path must start with \"/\", got %q", c.Path)
+	}
+	if c.TimeoutSeconds <= 0 {
+		return fmt.Errorf("health check timeout must be positive, got %ds", c.TimeoutSeconds)
+	}
+	return nil
 }
 
 // NewHeader creates a new Header with default values set.
@@ -101,6 +282,11 @@ func WriteHeader(w io.Writer, header *Header) (int, error) {
 		return 0, fmt.Errorf("failed to serialize header: %w", err)
 	}
 
+	// Refuse to write a header that ReadHeader would reject
+	if len(data) > MaxHeaderSize {
+		return 0, fmt.Errorf("header size %d exceeds maximum allowed size %d", len(data), MaxHeaderSize)
+	}
+
 	// Write length prefix (4 bytes, big-endian)
 	lengthBuf := make([]byte, HeaderLengthSize)
 	binary.BigEndian.PutUint32(lengthBuf, uint32(len(data)))
@@ -130,10 +316,9 @@ func ReadHeader(r io.Reader) (*Header, error) {
 
 	length := binary.BigEndian.Uint32(lengthBuf)
 
-	// Sanity check on length (max 1MB for header)
-	const maxHeaderSize = 1 << 20
-	if length > maxHeaderSize {
-		return nil, fmt.Errorf("header size %d exceeds maximum allowed size %d", length, maxHeaderSize)
+	// Sanity check on length
+	if length > MaxHeaderSize {
+		return nil, fmt.Errorf("header size %d exceeds maximum allowed size %d", length, MaxHeaderSize)
 	}
 
 	// Read header data
@@ -159,8 +344,8 @@ func (h *Header) Validate() error {
 	if h.Format != HeaderFormat {
 		return fmt.Errorf("invalid header format: expected %q, got %q", HeaderFormat, h.Format)
 	}
-	if h.Compression != CompressionGzip && h.Compression != CompressionZstd {
-		return fmt.Errorf("invalid compression: expected %q or %q, got %q", CompressionGzip, CompressionZstd, h.Compression)
+	if !isValidCompression(h.Compression) {
+		return fmt.Errorf("invalid compression: expected %q, %q or %q, got %q", CompressionGzip, CompressionZstd, CompressionBrotli, h.Compression)
 	}
 	if h.BundleSize <= 0 {
 		return fmt.Errorf("bundle size must be positive")
@@ -168,11 +353,165 @@ func (h *Header) Validate() error {
 	if h.BundleChecksum == "" {
 		return fmt.Errorf("bundle checksum is required")
 	}
+	if algorithm := checksumAlgorithm(h.BundleChecksum); !isValidChecksumAlgorithm(algorithm) {
+		return fmt.Errorf("unsupported bundle checksum algorithm %q", algorithm)
+	}
 	if h.Manifest == nil {
 		return fmt.Errorf("manifest is required")
 	}
 	if h.CreatedAt == "" {
 		return fmt.Errorf("createdAt is required")
 	}
+	if h.InstallPrefix != "" && !path.IsAbs(h.InstallPrefix) {
+		return fmt.Errorf("install prefix must be an absolute path, got %q", h.InstallPrefix)
+	}
+	if h.ServiceName != "" {
+		if err := ValidateServiceName(h.ServiceName); err != nil {
+			return err
+		}
+	}
+	if h.HealthCheck != nil {
+		if err := h.HealthCheck.Validate(); err != nil {
+			return err
+		}
+	}
+	if h.OpsBinary != nil {
+		if err := h.OpsBinary.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(h.ZstdDictionary) > 0 && h.Compression != CompressionZstd {
+		return fmt.Errorf("zstd dictionary requires %q compression, got %q", CompressionZstd, h.Compression)
+	}
+	if h.MinOpsVersion != "" && !version.Valid(h.MinOpsVersion) {
+		return fmt.Errorf("minimum ops version must be a semantic version, got %q", h.MinOpsVersion)
+	}
+	if h.MinBackendVersion != "" && !version.Valid(h.MinBackendVersion) {
+		return fmt.Errorf("minimum backend version must be a semantic version, got %q", h.MinBackendVersion)
+	}
+	for key := range h.Extensions {
+		if err := validateExtensionKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateServiceName checks that name is safe to use as a systemd unit name.
+func ValidateServiceName(name string) error {
+	const maxServiceNameLen = 255 - len(".service")
+	if len(name) > maxServiceNameLen || !serviceNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid service name %q: must be a systemd unit name (letters, digits, \":_.@-\", at most %d characters, not starting with \"-\" or \".\")", name, maxServiceNameLen)
+	}
+	return nil
+}
+
+// OpsSemver parses OpsVersion as a semantic version. Headers written before
+// ops versions were validated may hold free-form values, which return an
+// error, as does an empty OpsVersion.
+func (h *Header) OpsSemver() (version.Semver, error) {
+	if h.OpsVersion == "" {
+		return version.Semver{}, fmt.Errorf("header has no ops version")
+	}
+	return version.Parse(h.OpsVersion)
+}
+
+// PlatformOrManifest returns Platform, or the manifest's platform for
+// headers written before Platform was added.
+func (h *Header) PlatformOrManifest() string {
+	if h.Platform == "" && h.Manifest != nil {
+		return h.Manifest.Platform
+	}
+	return h.Platform
+}
+
+// InstallPrefixOrDefault returns the configured install prefix or DefaultInstallPrefix.
+func (h *Header) InstallPrefixOrDefault() string {
+	if h.InstallPrefix == "" {
+		return DefaultInstallPrefix
+	}
+	return h.InstallPrefix
+}
+
+// ServiceNameOrDefault returns the configured service name or DefaultServiceName.
+func (h *Header) ServiceNameOrDefault() string {
+	if h.ServiceName == "" {
+		return DefaultServiceName
+	}
+	return h.ServiceName
+}
+
+// HealthCheckOrDefault returns the configured health check, filling in
+// DefaultHealthCheckPath and DefaultHealthCheckTimeout for headers written
+// without one.
+func (h *Header) HealthCheckOrDefault() HealthCheck {
+	if h.HealthCheck == nil {
+		return HealthCheck{Path: DefaultHealthCheckPath, TimeoutSeconds: int(DefaultHealthCheckTimeout / time.Second)}
+	}
+	return *h.HealthCheck
+}
+
+// isValidCompression reports whether compression names a supported algorithm.
+func isValidCompression(compression string) bool {
+	switch compression {
+	case CompressionGzip, CompressionZstd, CompressionBrotli:
+		return true
+	}
+	return false
+}
+
+// headerVersionFor returns the oldest header version able to describe a
+// bundle compressed with compression, so older readers keep working with
+// bundles they can extract.
+func headerVersionFor(compression string) string {
+	if compression == CompressionBrotli {
+		return BrotliHeaderVersion
+	}
+	return HeaderVersion
+}
+
+// bundleHeaderVersion is like headerVersionFor but also accounts for the
+// checksum algorithm, which only ChecksumHeaderVersion readers know beyond SHA256.
+func bundleHeaderVersion(compression, checksumAlgorithm string) string {
+	if checksumAlgorithm != ChecksumSHA256 {
+		return ChecksumHeaderVersion
+	}
+	return headerVersionFor(compression)
+}
+
+// requiredHeaderVersion returns the oldest header version whose readers
+// understand every feature h uses.
+func requiredHeaderVersion(h *Header) string {
+	version := bundleHeaderVersion(h.Compression, checksumAlgorithm(h.BundleChecksum))
+	if h.OpsBinary != nil {
+		version = CompressedOpsHeaderVersion
+	}
+	if h.CredentialsEncrypted {
+		version = EncryptedCredentialsHeaderVersion
+	}
+	if len(h.ZstdDictionary) > 0 {
+		version = ZstdDictionaryHeaderVersion
+	}
+	if h.CredentialsOmitted {
+		version = OmittedCredentialsHeaderVersion
+	}
+	return version
+}
+
+// CheckCompatible returns an error if the header was written with a newer
+// header version than this package supports.
+func (h *Header) CheckCompatible() error {
+	return checkHeaderVersion(h, SupportedHeaderVersion)
+}
+
+// checkHeaderVersion compares the header version against supported.
+func checkHeaderVersion(h *Header, supported string) error {
+	c, err := version.Compare(h.Version, supported)
+	if err != nil {
+		return fmt.Errorf("invalid header version: %w", err)
+	}
+	if c > 0 {
+		return fmt.Errorf("header version %s is newer than supported version %s (compression %q): executable was created by a newer bundler", h.Version, supported, h.Compression)
+	}
 	return nil
 }
@@ -0,0 +1,91 @@
+package selfhost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// newOpsBinaryInfo describes opsBinary compressed with compression, with a
+// checksum of its uncompressed content calculated with checksumAlgorithm.
+func newOpsBinaryInfo(opsBinary, compression, checksumAlgorithm string) (*OpsBinaryInfo, error) {
+	f, err := os.Open(opsBinary)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ops binary: %w", err)
+	}
+	defer f.Close()
+
+	h, err := newChecksumHash(checksumAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ops binary: %w", err)
+	}
+	return &OpsBinaryInfo{
+		Compression: compression,
+		Size:        size,
+		Checksum:    formatChecksum(checksumAlgorithm, h),
+	}, nil
+}
+
+// writeCompressedOpsBinary compresses the ops binary read from r into w and
+// returns the number of compressed bytes written.
+func writeCompressedOpsBinary(ctx context.Context, w io.Writer, r io.Reader, compression string) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw, err := newCompressWriter(cw, compression, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(zw, &contextReader{ctx: ctx, r: r}); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return 0, ctxErr
+		}
+		return 0, fmt.Errorf("failed to compress ops binary: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to compress ops binary: %w", err)
+	}
+	return cw.n, nil
+}
+
+// copyOpsBinary writes the ops binary stored in the region r, described by
+// info, to w and verifies its size and checksum.
+func copyOpsBinary(w io.Writer, r io.Reader, info *OpsBinaryInfo) error {
+	zr, err := newDecompressReader(r, info.Compression, nil)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	h, err := newChecksumHash(checksumAlgorithm(info.Checksum))
+	if err != nil {
+		return err
+	}
+	// Read one byte past the recorded size to detect trailing data
+	n, err := io.Copy(io.MultiWriter(w, h), io.LimitReader(zr, info.Size+1))
+	if err != nil {
+		return fmt.Errorf("failed to decompress ops binary: %w", err)
+	}
+	if n != info.Size {
+		return fmt.Errorf("ops binary size mismatch: expected %d bytes, got %d", info.Size, n)
+	}
+	if actual := formatChecksum(checksumAlgorithm(info.Checksum), h); actual != info.Checksum {
+		return fmt.Errorf("ops binary checksum mismatch: expected %s, got %s", info.Checksum, actual)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
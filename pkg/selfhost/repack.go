@@ -0,0 +1,231 @@
+package selfhost
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+)
+
+// Repack recompresses the bundle embedded in the self-extracting executable at
+// path with newCompression ("gzip", "zstd", "brotli" or "auto"). The ops
+// binary, manifest, ops version and creation time are preserved; the header's
+// compression, version and checksum are updated. A zstd dictionary is kept
+// only if the bundle stays zstd compressed. The executable is replaced
+// atomically, so a failed repack leaves the original untouched.
+func Repack(path string, newCompression string) error {
+	if newCompression != CompressionAuto && !isValidCompression(newCompression) {
+		return fmt.Errorf("invalid compression: %s (must be %q, %q, %q or %q)", newCompression, CompressionGzip, CompressionZstd, CompressionBrotli, CompressionAuto)
+	}
+
+	result, header, compressedData, err := readEmbeddedBundle(path)
+	if err != nil {
+		return err
+	}
+	if err := header.CheckCompatible(); err != nil {
+		return err
+	}
+	if newCompression == header.Compression {
+		return nil
+	}
+
+	// Refuse to carry corrupted data into a freshly checksummed bundle
+	if err := verifyChecksum(header.BundleChecksum, compressedData); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	// Unpack the bundle so it can be recompressed
+	tempDir, err := os.MkdirTemp("", "convex-repack-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := extractCompressedTar(ctx, compressedData, tempDir, detectCompression(compressedData, header.Compression, nil), header.ZstdDictionary, newExtractLimits(header, 0, 0)); err != nil {
+		return fmt.Errorf("failed to extract bundle: %w", err)
+	}
+
+	archiveOpts := archiveOptions{zstdDictionary: header.ZstdDictionary}
+	algorithm := checksumAlgorithm(header.BundleChecksum)
+	var recompressed *compressedArchive
+	if newCompression == CompressionAuto {
+		var decision *CompressionDecision
+		decision, recompressed, err = chooseCompression(ctx, tempDir, 0, algorithm, archiveOpts)
+		if err == nil {
+			newCompression = decision.Compression
+		}
+	} else {
+		recompressed, err = compressArchive(ctx, tempDir, newCompression, algorithm, archiveOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create compressed archive: %w", err)
+	}
+
+	newHeader := *header
+	newHeader.Compression = newCompression
+	if newCompression != CompressionZstd {
+		newHeader.ZstdDictionary = nil
+	}
+	newHeader.BundleSize = recompressed.uncompressedSize
+	newHeader.BundleChecksum = recompressed.checksum
+	newHeader.Version = requiredHeaderVersion(&newHeader)
+	if err := newHeader.Validate(); err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+
+	return rewriteBundleSection(path, result.Offset, &newHeader, recompressed.data)
+}
+
+// ReplaceCredentials overwrites credentials.json in the bundle embedded in the
+// self-extracting executable at path, e.g. to rotate the admin key without
+// rebuilding the database. All other bundle files, the compression and the
+// header metadata are preserved; the bundle size and checksum are updated,
+// and a bundle created with OmitCredentials or with encrypted credentials no
+// longer reports them omitted or encrypted.
+// The executable is replaced atomically.
+func ReplaceCredentials(path string, creds *credentials.Credentials) error {
+	if creds == nil {
+		return fmt.Errorf("credentials are required")
+	}
+	credsData, err := creds.ToJSON()
+	if err != nil {
+		return fmt.Errorf("failed to serialize credentials: %w", err)
+	}
+
+	result, header, compressedData, err := readEmbeddedBundle(path)
+	if err != nil {
+		return err
+	}
+	if err := header.CheckCompatible(); err != nil {
+		return err
+	}
+	if err := verifyChecksum(header.BundleChecksum, compressedData); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	tempDir, err := os.MkdirTemp("", "convex-credentials-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	if err := extractCompressedTar(ctx, compressedData, tempDir, detectCompression(compressedData, header.Compression, nil), header.ZstdDictionary, newExtractLimits(header, 0, 0)); err != nil {
+		return fmt.Errorf("failed to extract bundle: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "credentials.json"), credsData, 0644); err != nil {
+		return fmt.Errorf("failed to write credentials.json: %w", err)
+	}
+
+	archive, err := compressArchive(ctx, tempDir, header.Compression, checksumAlgorithm(header.BundleChecksum), archiveOptions{zstdDictionary: header.ZstdDictionary})
+	if err != nil {
+		return fmt.Errorf("failed to create compressed archive: %w", err)
+	}
+
+	newHeader := *header
+	newHeader.BundleSize = archive.uncompressedSize
+	newHeader.BundleChecksum = archive.checksum
+	newHeader.CredentialsOmitted = false
+	newHeader.CredentialsEncrypted = false
+	newHeader.Version = requiredHeaderVersion(&newHeader)
+	if err := newHeader.Validate(); err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+
+	return rewriteBundleSection(path, result.Offset, &newHeader, archive.data)
+}
+
+// readEmbeddedBundle returns the detection result, header and compressed
+// bundle data of the self-extracting executable at path.
+func readEmbeddedBundle(path string) (*DetectResult, *Header, []byte, error) {
+	result, err := DetectSelfHostModeFromFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !result.IsSelfHost {
+		return nil, nil, nil, fmt.Errorf("file does not contain an embedded bundle")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to open executable: %w", err)
+	}
+	defer f.Close()
+
+	// Seek past start marker to header
+	if _, err := f.Seek(result.Offset+MagicStartLen, io.SeekStart); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to seek to header: %w", err)
+	}
+
+	header, err := ReadHeader(f)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	compressedDataStart, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to get current position: %w", err)
+	}
+
+	compressedData := make([]byte, result.Size-compressedDataStart-trailerSize(result.FooterVersion))
+	if _, err := io.ReadFull(f, compressedData); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read compressed data: %w", err)
+	}
+
+	return result, header, compressedData, nil
+}
+
+// rewriteBundleSection replaces everything after the ops binary (the first
+// bundleStartOffset bytes of path) with a new bundle section, writing to a
+// temporary file and renaming it over path.
+func rewriteBundleSection(path string, bundleStartOffset int64, header *Header, compressedData []byte) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open executable: %w", err)
+	}
+	defer src.Close()
+
+	stat, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat executable: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".repack-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	// Copy the ops binary unchanged
+	if _, err := io.CopyN(tmp, src, bundleStartOffset); err != nil {
+		return fmt.Errorf("failed to copy ops binary: %w", err)
+	}
+
+	if err := writeBundleSection(context.Background(), tmp, header, bytes.NewReader(compressedData), bundleStartOffset); err != nil {
+		return err
+	}
+
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace executable: %w", err)
+	}
+
+	return nil
+}
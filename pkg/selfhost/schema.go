@@ -0,0 +1,33 @@
+package selfhost
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+)
+
+//go:embed header_schema.json
+var headerSchema []byte
+
+// HeaderJSONSchema returns a JSON Schema (draft 2020-12) describing the
+// header JSON, with the manifest schema (see manifest.JSONSchema) included
+// under $defs.
+func HeaderJSONSchema() []byte {
+	var schema, manifestSchema map[string]any
+	// Both schemas are embedded and covered by tests, so they always parse
+	if err := json.Unmarshal(headerSchema, &schema); err != nil {
+		panic("selfhost: invalid embedded header schema: " + err.Error())
+	}
+	if err := json.Unmarshal(manifest.JSONSchema(), &manifestSchema); err != nil {
+		panic("selfhost: invalid manifest schema: " + err.Error())
+	}
+	delete(manifestSchema, "$schema")
+	schema["$defs"] = map[string]any{"manifest": manifestSchema}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		panic("selfhost: failed to serialize header schema: " + err.Error())
+	}
+	return data
+}
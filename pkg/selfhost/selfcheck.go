@@ -0,0 +1,74 @@
+package selfhost
+
+import (
+	"fmt"
+	"os"
+)
+
+// SkipSelfCheckEnv disables SelfCheck when set to a non-empty value, e.g.
+// while developing the ops binary against a bundle that is being rebuilt.
+const SkipSelfCheckEnv = "CONVEX_SELFHOST_SKIP_SELFCHECK"
+
+// SelfCheckError is returned by SelfCheck when the executable must not run.
+// ExitCode is the code the ops binary should exit with.
+type SelfCheckError struct {
+	ExitCode int
+	Err      error
+}
+
+func (e *SelfCheckError) Error() string { return e.Err.Error() }
+func (e *SelfCheckError) Unwrap() error { return e.Err }
+
+// SelfCheck verifies the bundle embedded in the running executable before the
+// ops binary does anything else. It only checksums the compressed bundle
+// region and compares the bundle platform with the host, so it is cheap
+// enough to run on every start. A plain ops binary without an embedded
+// bundle passes. Set SkipSelfCheckEnv to skip the check.
+func SelfCheck() error {
+	if os.Getenv(SkipSelfCheckEnv) != "" {
+		return nil
+	}
+	exePath, err := os.Executable()
+	if err != nil {
+		return &SelfCheckError{ExitCode: ExitGeneralError, Err: fmt.Errorf("failed to get executable path: %w", err)}
+	}
+	return SelfCheckFile(exePath)
+}
+
+// SelfCheckFile runs the SelfCheck verification against the executable at path.
+// Errors are *SelfCheckError: ExitVerificationFailed for a tampered or
+// unreadable bundle, ExitPlatformMismatch for a bundle built for another platform.
+func SelfCheckFile(path string) error {
+	result, err := DetectSelfHostModeFromFile(path)
+	if err != nil {
+		return &SelfCheckError{ExitCode: ExitVerificationFailed, Err: err}
+	}
+	if !result.IsSelfHost {
+		return nil
+	}
+
+	_, header, compressedData, err := readEmbeddedBundle(path)
+	if err != nil {
+		return &SelfCheckError{ExitCode: ExitVerificationFailed, Err: err}
+	}
+	if err := header.CheckCompatible(); err != nil {
+		return &SelfCheckError{ExitCode: ExitVerificationFailed, Err: err}
+	}
+	checksum, err := checksumLike(header.BundleChecksum, compressedData)
+	if err != nil {
+		return &SelfCheckError{ExitCode: ExitVerificationFailed, Err: err}
+	}
+	if checksum != header.BundleChecksum {
+		return &SelfCheckError{
+			ExitCode: ExitVerificationFailed,
+			Err:      fmt.Errorf("embedded bundle checksum mismatch: expected %s, got %s", header.BundleChecksum, checksum),
+		}
+	}
+
+	if bundlePlatform := header.PlatformOrManifest(); bundlePlatform != "" {
+		if err := CheckPlatformCompatibility(bundlePlatform); err != nil {
+			return &SelfCheckError{ExitCode: ExitPlatformMismatch, Err: err}
+		}
+	}
+	return nil
+}
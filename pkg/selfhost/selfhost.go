@@ -4,19 +4,32 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/sha256"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"runtime"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/database"
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
+	"github.com/ozanturksever/convex-bundler/pkg/version"
 )
 
 // CreateOptions contains options for creating a self-extracting executable.
@@ -33,71 +46,398 @@ type CreateOptions struct {
 	// Platform is the target platform (e.g., "linux-x64", "linux-arm64")
 	Platform string
 
-	// Compression is the compression algorithm ("gzip" or "zstd")
-	// Defaults to "gzip" if empty
+	// Compression is the compression algorithm ("gzip", "zstd", "brotli" or
+	// "auto" to pick the smallest). Defaults to "gzip" if empty
 	Compression string
 
-	// OpsVersion is the version of the ops binary (optional, for metadata)
+	// AutoCompressionBudget limits how long each algorithm may take when
+	// Compression is "auto" (optional, defaults to DefaultAutoCompressionBudget)
+	AutoCompressionBudget time.Duration
+
+	// OpsVersion is the version (semver) of the ops binary (optional, for metadata)
 	OpsVersion string
+
+	// InstallPrefix is the directory the ops binary installs under
+	// (optional, defaults to DefaultInstallPrefix)
+	InstallPrefix string
+
+	// ServiceName is the systemd service name the ops binary installs
+	// (optional, defaults to DefaultServiceName)
+	ServiceName string
+
+	// HealthCheckPath is the endpoint the installer polls until the backend
+	// is ready (optional, defaults to DefaultHealthCheckPath)
+	HealthCheckPath string
+
+	// HealthCheckTimeout is how long the installer waits for the backend to
+	// become ready, in whole seconds (optional, defaults to DefaultHealthCheckTimeout)
+	HealthCheckTimeout time.Duration
+
+	// Reproducible stamps the header and all archive entries with
+	// manifest.ReproducibleTime, so identical inputs produce identical bytes
+	Reproducible bool
+
+	// MaxBundleSize is the largest allowed size of the finished executable in
+	// bytes. Larger executables are deleted and Create returns an error
+	// (optional, 0 means no limit)
+	MaxBundleSize int64
+
+	// ParallelCompression compresses gzip bundles on all CPUs using pgzip.
+	// The output is standard gzip, so it speeds up packaging large bundles
+	// without affecting extraction
+	ParallelCompression bool
+
+	// ChecksumSidecar writes a <OutputPath>.sha256 file with the SHA256 of the
+	// finished executable (see WriteChecksumSidecar)
+	ChecksumSidecar bool
+
+	// OmitCredentials leaves credentials.json, and convex.env if present,
+	// out of the embedded bundle, for distributions that provision
+	// credentials at install time. The bundle directory need not contain
+	// credentials.json, and the header records that credentials must be
+	// supplied (see Header.CredentialsOmitted)
+	OmitCredentials bool
+
+	// MinOpsVersion is the oldest ops binary version (semver) that may
+	// install the bundle (optional, recorded in Header.MinOpsVersion)
+	MinOpsVersion string
+
+	// MinBackendVersion is the oldest backend version (semver) the bundle
+	// runs on (optional, recorded in Header.MinBackendVersion)
+	MinBackendVersion string
+
+	// ChecksumAlgorithm is the algorithm of the bundle checksum ("sha256",
+	// "sha512" or "blake3"), recorded as the prefix of Header.BundleChecksum.
+	// Anything but SHA256 needs ChecksumHeaderVersion to read (optional,
+	// defaults to "sha256")
+	ChecksumAlgorithm string
+
+	// ExtraFiles are written into the archive after the bundle files, keyed
+	// by slash-separated path relative to the bundle root (e.g. "README.md"
+	// or "docs/LICENSE"), for files shipped with the installer that are not
+	// part of the Convex bundle. Paths must stay inside the bundle and must
+	// not name a file already in BundleDir (optional)
+	ExtraFiles map[string][]byte
+
+	// ZstdDictionary primes zstd compression with a dictionary, such as one
+	// from TrainDictionary, which shrinks storage with many small similar
+	// files. It is recorded in Header.ZstdDictionary, which then needs
+	// ZstdDictionaryHeaderVersion to read. Requires Compression "zstd", or
+	// "auto", where only the zstd candidate uses it (optional)
+	ZstdDictionary []byte
+
+	// CompressOpsBinary stores the ops binary compressed with the bundle's
+	// algorithm, with its own checksum in Header.OpsBinary. The output is
+	// then an archive rather than an installer: it cannot be run directly,
+	// but Extract, Verify and OpenBundle work as usual and Strip recovers
+	// the ops binary. Needs CompressedOpsHeaderVersion to read
+	CompressOpsBinary bool
+
+	// Logger receives progress messages (optional, defaults to discarding them)
+	Logger logging.Logger
+}
+
+// BundleInfo describes a self-extracting executable written by CreateWithInfo.
+type BundleInfo struct {
+	// Header is the header embedded in the executable
+	Header *Header
+
+	// CompressionDecision explains the algorithm choice when Compression
+	// was "auto" (nil otherwise)
+	CompressionDecision *CompressionDecision
 }
 
 // Create assembles a self-extracting executable from a bundle directory and ops binary.
 func Create(opts CreateOptions) error {
-	// Set defaults
-	if opts.Compression == "" {
-		opts.Compression = CompressionGzip
-	}
+	return CreateContext(context.Background(), opts)
+}
+
+// CreateContext is like Create but stops when ctx is cancelled, returning
+// ctx.Err() and removing the partially written output file.
+func CreateContext(ctx context.Context, opts CreateOptions) error {
+	_, err := CreateWithInfo(ctx, opts)
+	return err
+}
+
+// CreateWithInfo is like CreateContext but also returns the embedded header
+// and, for automatic compression, how the algorithm was chosen.
+func CreateWithInfo(ctx context.Context, opts CreateOptions) (*BundleInfo, error) {
+	setCreateDefaults(&opts)
 
 	// Validate inputs
 	if err := validateCreateInputs(opts); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	return create(ctx, opts, func(header *Header, compressed io.Reader, compressedSize int64) error {
+		return writeExecutable(ctx, opts, header, compressed, compressedSize)
+	})
+}
+
+// CreateTo is like CreateWithInfo but writes the self-extracting executable
+// to w instead of opts.OutputPath. The output is written sequentially, so w
+// need not support seeking. opts.OutputPath is optional and
+// opts.ChecksumSidecar is not supported.
+func CreateTo(w io.Writer, opts CreateOptions) (*BundleInfo, error) {
+	return CreateToContext(context.Background(), w, opts)
+}
+
+// CreateToContext is like CreateTo but stops when ctx is cancelled,
+// returning ctx.Err(). Anything already written to w is left as is.
+func CreateToContext(ctx context.Context, w io.Writer, opts CreateOptions) (*BundleInfo, error) {
+	setCreateDefaults(&opts)
+
+	// Validate inputs
+	errs := createInputErrors(opts, false)
+	if w == nil {
+		errs = append(errs, fmt.Errorf("writer is required"))
+	}
+	if opts.ChecksumSidecar {
+		errs = append(errs, fmt.Errorf("checksum sidecar requires an output path"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	return create(ctx, opts, func(header *Header, compressed io.Reader, compressedSize int64) error {
+		return writeExecutableTo(ctx, w, opts, header, compressed, compressedSize)
+	})
+}
+
+// create compresses opts.BundleDir, builds its header and hands both to write.
+// opts must already have its defaults set and be validated.
+func create(ctx context.Context, opts CreateOptions, write func(header *Header, compressed io.Reader, compressedSize int64) error) (info *BundleInfo, err error) {
+	log := logging.OrNop(opts.Logger)
+
+	if _, _, ok := binaryPlatform(opts.OpsBinary); !ok {
+		log.Warnf("Could not determine the platform of ops binary %s; make sure it is built for %s", opts.OpsBinary, opts.Platform)
 	}
 
 	// Read manifest from bundle
 	manifestPath := filepath.Join(opts.BundleDir, "manifest.json")
 	manifestData, err := os.ReadFile(manifestPath)
 	if err != nil {
-		return fmt.Errorf("failed to read manifest.json: %w", err)
+		return nil, fmt.Errorf("failed to read manifest.json: %w", err)
 	}
 
 	var mf manifest.Manifest
 	if err := json.Unmarshal(manifestData, &mf); err != nil {
-		return fmt.Errorf("failed to parse manifest.json: %w", err)
+		return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+	// The header records opts.Platform; the manifest keeps its own for display
+	if mf.Platform != "" && mf.Platform != opts.Platform {
+		log.Warnf("Bundle manifest is for platform %s, but the executable is being created for %s", mf.Platform, opts.Platform)
+	}
+
+	// Reproducible builds use a fixed timestamp instead of the current time
+	createdAt := time.Now().UTC()
+	archiveOpts := archiveOptions{parallel: opts.ParallelCompression, extraFiles: opts.ExtraFiles, zstdDictionary: opts.ZstdDictionary}
+	if opts.OmitCredentials {
+		archiveOpts.exclude = map[string]bool{credentialsFile: true, envFile: true}
+	}
+	archiveOpts.storageIgnore, err = ignore.Load(filepath.Join(opts.BundleDir, "storage"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load storage ignore file: %w", err)
+	}
+	if opts.Reproducible {
+		createdAt = manifest.ReproducibleTime()
+		archiveOpts.modTime = createdAt
+	}
+
+	// Create compressed tar archive of bundle, hashing it as it is written.
+	// Auto compression compares candidates in memory; otherwise the archive
+	// is streamed to a temp file, so it is never held in memory whole.
+	var compressed io.Reader
+	var compressedSize, uncompressedSize int64
+	var checksum string
+	var decision *CompressionDecision
+	if opts.Compression == CompressionAuto {
+		var archive *compressedArchive
+		decision, archive, err = chooseCompression(ctx, opts.BundleDir, opts.AutoCompressionBudget, opts.ChecksumAlgorithm, archiveOpts)
+		if err == nil {
+			opts.Compression = decision.Compression
+			for _, c := range decision.Candidates {
+				log.Debugf("Auto compression candidate %s: %d bytes in %s", c.Compression, c.Size, c.Duration)
+			}
+			log.Infof("Auto compression selected %s", decision.Compression)
+			compressed = bytes.NewReader(archive.data)
+			compressedSize = int64(len(archive.data))
+			uncompressedSize = archive.uncompressedSize
+			checksum = archive.checksum
+		}
+	} else {
+		var archiveFile *os.File
+		archiveFile, err = createArchiveTemp(opts.OutputPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp file: %w", err)
+		}
+		defer func() {
+			archiveFile.Close()
+			os.Remove(archiveFile.Name())
+		}()
+
+		var h hash.Hash
+		h, err = newChecksumHash(opts.ChecksumAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		uncompressedSize, err = createCompressedTar(ctx, io.MultiWriter(archiveFile, h), opts.BundleDir, opts.Compression, archiveOpts)
+		if err == nil {
+			compressedSize, err = archiveFile.Seek(0, io.SeekCurrent)
+		}
+		if err == nil {
+			_, err = archiveFile.Seek(0, io.SeekStart)
+		}
+		compressed = archiveFile
+		checksum = formatChecksum(opts.ChecksumAlgorithm, h)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, fmt.Errorf("failed to create compressed archive: %w", err)
 	}
 
-	// Create compressed tar archive of bundle
-	var compressedBuf bytes.Buffer
-	uncompressedSize, err := createCompressedTar(&compressedBuf, opts.BundleDir, opts.Compression)
+	log.Debugf("Compressed bundle with %s: %d bytes -> %d bytes", opts.Compression, uncompressedSize, compressedSize)
+
+	var credentialsEncrypted bool
+	if !opts.OmitCredentials {
+		if credsData, err := os.ReadFile(filepath.Join(opts.BundleDir, credentialsFile)); err == nil {
+			credentialsEncrypted = credentials.IsEncrypted(credsData)
+		}
+	}
+	header, err := newCreateHeader(opts, &mf, createdAt, uncompressedSize, checksum, credentialsEncrypted)
 	if err != nil {
-		return fmt.Errorf("failed to create compressed archive: %w", err)
+		return nil, err
+	}
+
+	if err := write(header, compressed, compressedSize); err != nil {
+		return nil, err
 	}
 
-	compressedData := compressedBuf.Bytes()
+	return &BundleInfo{Header: header, CompressionDecision: decision}, nil
+}
+
+// createArchiveTemp creates the temp file the compressed archive is staged
+// in. It goes next to outputPath rather than in a possibly memory-backed
+// /tmp, falling back to the default temp directory if outputPath is empty.
+func createArchiveTemp(outputPath string) (*os.File, error) {
+	if outputPath == "" {
+		return os.CreateTemp("", "convex-bundle-archive-*")
+	}
+	return os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+".archive-*")
+}
 
-	// Calculate checksum of compressed data
-	checksum := calculateChecksum(compressedData)
+// setCreateDefaults fills in the defaults for unset options.
+func setCreateDefaults(opts *CreateOptions) {
+	if opts.Compression == "" {
+		opts.Compression = CompressionGzip
+	}
+	if opts.InstallPrefix == "" {
+		opts.InstallPrefix = DefaultInstallPrefix
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = DefaultServiceName
+	}
+	if opts.HealthCheckPath == "" {
+		opts.HealthCheckPath = DefaultHealthCheckPath
+	}
+	if opts.HealthCheckTimeout == 0 {
+		opts.HealthCheckTimeout = DefaultHealthCheckTimeout
+	}
+	if opts.ChecksumAlgorithm == "" {
+		opts.ChecksumAlgorithm = ChecksumSHA256
+	}
+}
 
-	// Build header
+// newCreateHeader builds and validates the header for a bundle compressed
+// with opts.Compression.
+func newCreateHeader(opts CreateOptions, mf *manifest.Manifest, createdAt time.Time, uncompressedSize int64, checksum string, credentialsEncrypted bool) (*Header, error) {
 	header := NewHeader()
 	header.Compression = opts.Compression
 	header.BundleSize = uncompressedSize
 	header.BundleChecksum = checksum
-	header.Manifest = &mf
+	header.Manifest = mf
+	header.Platform = opts.Platform
 	header.OpsVersion = opts.OpsVersion
-	header.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	header.CreatedAt = createdAt.Format(time.RFC3339)
+	header.InstallPrefix = opts.InstallPrefix
+	header.ServiceName = opts.ServiceName
+	header.HealthCheck = &HealthCheck{
+		Path:           opts.HealthCheckPath,
+		TimeoutSeconds: int(opts.HealthCheckTimeout / time.Second),
+	}
+	header.CredentialsOmitted = opts.OmitCredentials
+	header.CredentialsEncrypted = credentialsEncrypted
+	header.MinOpsVersion = opts.MinOpsVersion
+	header.MinBackendVersion = opts.MinBackendVersion
+	if opts.Compression == CompressionZstd {
+		header.ZstdDictionary = opts.ZstdDictionary
+	}
+	if opts.CompressOpsBinary {
+		opsInfo, err := newOpsBinaryInfo(opts.OpsBinary, opts.Compression, opts.ChecksumAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		header.OpsBinary = opsInfo
+	}
+	header.Version = requiredHeaderVersion(header)
 
-	// Validate header
 	if err := header.Validate(); err != nil {
-		return fmt.Errorf("invalid header: %w", err)
+		return nil, fmt.Errorf("invalid header: %w", err)
 	}
+	return header, nil
+}
+
+// writeExecutable writes opts.OpsBinary followed by the bundle section to
+// opts.OutputPath, enforces opts.MaxBundleSize and writes the checksum
+// sidecar if requested. The output is removed on failure.
+func writeExecutable(ctx context.Context, opts CreateOptions, header *Header, compressed io.Reader, compressedSize int64) (err error) {
+	log := logging.OrNop(opts.Logger)
 
 	// Create output file
+	log.Debugf("Writing self-extracting executable to %s", opts.OutputPath)
 	outFile, err := os.Create(opts.OutputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer outFile.Close()
+	defer func() {
+		outFile.Close()
+		// Don't leave a truncated executable behind
+		if err != nil {
+			os.Remove(opts.OutputPath)
+		}
+	}()
+
+	if err := writeExecutableTo(ctx, outFile, opts, header, compressed, compressedSize); err != nil {
+		return err
+	}
+
+	// Make executable, unless the ops binary is compressed and the file cannot run
+	mode := os.FileMode(0755)
+	if header.OpsBinary != nil {
+		mode = 0644
+	}
+	if err := outFile.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set executable permissions: %w", err)
+	}
 
+	if opts.ChecksumSidecar {
+		log.Debugf("Writing checksum sidecar %s", ChecksumSidecarPath(opts.OutputPath))
+		if err := WriteChecksumSidecar(opts.OutputPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeExecutableTo writes opts.OpsBinary, compressed if header.OpsBinary is
+// set, followed by the bundle section to w. opts.MaxBundleSize is enforced
+// before the bundle section, and for an uncompressed ops binary before
+// anything is written. The footer offset is the size of the ops region, so w
+// need not support seeking.
+func writeExecutableTo(ctx context.Context, w io.Writer, opts CreateOptions, header *Header, compressed io.Reader, compressedSize int64) error {
 	// Copy ops binary as base
 	opsFile, err := os.Open(opts.OpsBinary)
 	if err != nil {
@@ -110,46 +450,76 @@ func Create(opts CreateOptions) error {
 		return fmt.Errorf("failed to stat ops binary: %w", err)
 	}
 
-	_, err = io.Copy(outFile, opsFile)
-	if err != nil {
-		return fmt.Errorf("failed to copy ops binary: %w", err)
+	// Record the offset where the bundle section starts. A compressed ops
+	// binary's size is only known once it has been written
+	bundleStartOffset := opsStat.Size()
+	if header.OpsBinary != nil {
+		bundleStartOffset, err = writeCompressedOpsBinary(ctx, w, opsFile, header.OpsBinary.Compression)
+		if err != nil {
+			return err
+		}
 	}
 
-	// Record the offset where the bundle section starts
-	bundleStartOffset := opsStat.Size()
+	// Enforce the size budget on the finished executable
+	if opts.MaxBundleSize > 0 {
+		headerSize, err := WriteHeader(io.Discard, header)
+		if err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		overhead := int64(MagicStartLen) + int64(headerSize) + int64(MagicEndLen) + int64(FooterSize)
+		totalSize := bundleStartOffset + compressedSize + overhead
+		if totalSize > opts.MaxBundleSize {
+			return fmt.Errorf("executable size %d bytes exceeds the maximum of %d bytes (ops binary: %d bytes, compressed bundle: %d bytes, header and markers: %d bytes)",
+				totalSize, opts.MaxBundleSize, bundleStartOffset, compressedSize, overhead)
+		}
+	}
+
+	if header.OpsBinary == nil {
+		if _, err := io.Copy(w, &contextReader{ctx: ctx, r: opsFile}); err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return fmt.Errorf("failed to copy ops binary: %w", err)
+		}
+	}
+
+	// Write the bundle section after the ops binary
+	return writeBundleSection(ctx, w, header, compressed, bundleStartOffset)
+}
 
+// writeBundleSection writes the start marker, header, compressed bundle (read
+// from compressed), end marker and footer. bundleStartOffset is the offset of
+// the start marker in the final file. Returns ctx.Err() if ctx is cancelled
+// while copying.
+func writeBundleSection(ctx context.Context, w io.Writer, header *Header, compressed io.Reader, bundleStartOffset int64) error {
 	// Write start marker
-	if _, err := outFile.Write(MagicStart); err != nil {
+	if _, err := w.Write(MagicStart); err != nil {
 		return fmt.Errorf("failed to write start marker: %w", err)
 	}
 
 	// Write length-prefixed header
-	if _, err := WriteHeader(outFile, header); err != nil {
+	if _, err := WriteHeader(w, header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
 
 	// Write compressed bundle
-	if _, err := outFile.Write(compressedData); err != nil {
+	if _, err := io.Copy(w, &contextReader{ctx: ctx, r: compressed}); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
 		return fmt.Errorf("failed to write compressed bundle: %w", err)
 	}
 
 	// Write end marker
-	if _, err := outFile.Write(MagicEnd); err != nil {
+	if _, err := w.Write(MagicEnd); err != nil {
 		return fmt.Errorf("failed to write end marker: %w", err)
 	}
 
-	// Write footer (offset to start marker as uint64 little-endian)
-	footer := make([]byte, FooterSize)
-	binary.LittleEndian.PutUint64(footer, uint64(bundleStartOffset))
-	if _, err := outFile.Write(footer); err != nil {
+	// Write footer (footer magic, then offset to start marker as uint64 little-endian)
+	if _, err := w.Write(encodeFooter(bundleStartOffset)); err != nil {
 		return fmt.Errorf("failed to write footer: %w", err)
 	}
 
-	// Make executable
-	if err := outFile.Chmod(0755); err != nil {
-		return fmt.Errorf("failed to set executable permissions: %w", err)
-	}
-
 	return nil
 }
 
@@ -160,8 +530,27 @@ type DetectResult struct {
 
 	// Offset is the byte offset where the bundle section starts (at MagicStart)
 	Offset int64
+
+	// FooterVersion is the trailer layout version read from the footer
+	FooterVersion uint32
+
+	// Platform is the target platform recorded in the header (see
+	// Header.PlatformOrManifest)
+	Platform string
+
+	// Size is the length of the executable through the end of its footer,
+	// which is less than the file size when Recovered skipped bytes after it
+	Size int64
+
+	// Recovered is set when the footer was damaged or not at the end of the
+	// file and the bundle section was found by scanning for its markers
+	Recovered bool
 }
 
+// ErrUnsupportedFooterVersion is returned when an executable's footer was
+// written with a newer trailer layout than this package understands.
+var ErrUnsupportedFooterVersion = errors.New("unsupported footer version")
+
 // DetectSelfHostMode checks if the current executable contains an embedded bundle.
 // It reads the footer to find the offset and verifies the magic marker.
 func DetectSelfHostMode() (*DetectResult, error) {
@@ -186,48 +575,218 @@ func DetectSelfHostModeFromFile(path string) (*DetectResult, error) {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	fileSize := stat.Size()
+	return DetectSelfHostModeFromReaderAt(f, stat.Size())
+}
 
-	// File must be large enough to contain at least the footer
-	if fileSize < FooterSize {
-		return &DetectResult{IsSelfHost: false}, nil
+// DetectSelfHostModeFromReaderAt checks if the size bytes readable from r
+// contain an embedded bundle. Only the footer, the start and end markers and
+// the header are read, so r may be backed by e.g. HTTP Range requests against
+// a remote file. If the footer lookup fails, the bundle section is searched
+// for instead (see DetectResult.Recovered).
+func DetectSelfHostModeFromReaderAt(r io.ReaderAt, size int64) (*DetectResult, error) {
+	result, _, err := detectSelfHost(r, size)
+	return result, err
+}
+
+// detectSelfHost is DetectSelfHostModeFromReaderAt, also returning the
+// header parsed while checking the bundle section (nil if not self-host).
+func detectSelfHost(r io.ReaderAt, size int64) (*DetectResult, *Header, error) {
+	result, header, err := detectFromFooter(r, size)
+	if err != nil || result.IsSelfHost {
+		return result, header, err
 	}
+	if recovered, header, ok := recoverBundleSection(r, size); ok {
+		return recovered, header, nil
+	}
+	return result, nil, nil
+}
 
-	// Read footer (last 8 bytes)
-	if _, err := f.Seek(-FooterSize, io.SeekEnd); err != nil {
-		return nil, fmt.Errorf("failed to seek to footer: %w", err)
+// detectFromFooter locates the bundle section through the footer at the end
+// of the file.
+func detectFromFooter(r io.ReaderAt, size int64) (*DetectResult, *Header, error) {
+	// File must be large enough to contain at least the footer
+	if size < FooterSize {
+		return &DetectResult{IsSelfHost: false}, nil, nil
 	}
 
+	// Read footer (last FooterSize bytes)
 	footer := make([]byte, FooterSize)
-	if _, err := io.ReadFull(f, footer); err != nil {
-		return nil, fmt.Errorf("failed to read footer: %w", err)
+	if _, err := r.ReadAt(footer, size-FooterSize); err != nil {
+		return nil, nil, fmt.Errorf("failed to read footer: %w", err)
 	}
 
-	offset := int64(binary.LittleEndian.Uint64(footer))
-
-	// Sanity check: offset must be within file bounds
-	if offset < 0 || offset >= fileSize-FooterSize {
-		return &DetectResult{IsSelfHost: false}, nil
+	// Files without the footer magic (including ones written before it was
+	// introduced) are not treated as self-host executables
+	footerVersion, offset, ok := decodeFooter(footer)
+	if !ok {
+		return &DetectResult{IsSelfHost: false}, nil, nil
+	}
+	if footerVersion > FooterVersion {
+		return nil, nil, fmt.Errorf("%w %d (supports up to %d): executable was created by a newer bundler", ErrUnsupportedFooterVersion, footerVersion, FooterVersion)
 	}
 
-	// Seek to offset and check for magic marker
-	if _, err := f.Seek(offset, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("failed to seek to bundle start: %w", err)
+	// Sanity check: offset must be within file bounds
+	if offset < 0 || offset >= size-FooterSize {
+		return &DetectResult{IsSelfHost: false}, nil, nil
 	}
 
+	// Check for the magic marker at offset
 	marker := make([]byte, MagicStartLen)
-	if _, err := io.ReadFull(f, marker); err != nil {
-		return &DetectResult{IsSelfHost: false}, nil
+	if _, err := r.ReadAt(marker, offset); err != nil {
+		return &DetectResult{IsSelfHost: false}, nil, nil
 	}
 
 	if !bytes.Equal(marker, MagicStart) {
-		return &DetectResult{IsSelfHost: false}, nil
+		return &DetectResult{IsSelfHost: false}, nil, nil
+	}
+
+	// A binary that merely contains the marker bytes, with a footer that
+	// happens to point at them, must also have a parseable header followed
+	// by the end marker where the trailer says it is
+	header, ok := readBundleSection(r, offset, size, footerVersion)
+	if !ok {
+		return &DetectResult{IsSelfHost: false}, nil, nil
 	}
 
 	return &DetectResult{
-		IsSelfHost: true,
-		Offset:     offset,
-	}, nil
+		IsSelfHost:    true,
+		Offset:        offset,
+		FooterVersion: footerVersion,
+		Platform:      header.PlatformOrManifest(),
+		Size:          size,
+	}, header, nil
+}
+
+// recoveryScanSize is how far back from the end of a file recoverBundleSection
+// searches for the MagicEnd marker
+const recoveryScanSize = 64 << 10
+
+// recoverBundleSection locates the bundle section of a file whose footer is
+// damaged or followed by extra bytes, e.g. a newline appended by a file
+// transfer. It searches the end of the file backward for MagicEnd and uses
+// the footer after it; if that footer is damaged too, it searches forward
+// from the start of the file for a MagicStart marker whose header ends at
+// MagicEnd.
+func recoverBundleSection(r io.ReaderAt, size int64) (*DetectResult, *Header, bool) {
+	scanStart := max(size-recoveryScanSize, 0)
+	tail := make([]byte, size-scanStart)
+	if _, err := r.ReadAt(tail, scanStart); err != nil && err != io.EOF {
+		return nil, nil, false
+	}
+
+	trailer := trailerSize(FooterVersion)
+	for end := len(tail); ; {
+		idx := bytes.LastIndex(tail[:end], MagicEnd)
+		if idx < 0 {
+			return nil, nil, false
+		}
+		end = idx
+
+		// The section ends with the footer after the end marker
+		sectionSize := scanStart + int64(idx) + trailer
+		if sectionSize > size {
+			continue
+		}
+		if result, header, err := detectFromFooter(r, sectionSize); err == nil && result.IsSelfHost {
+			result.Recovered = true
+			return result, header, true
+		}
+
+		var header *Header
+		offset, found := findMarker(r, sectionSize-trailer, MagicStart, func(offset int64) bool {
+			var ok bool
+			header, ok = readBundleSection(r, offset, sectionSize, FooterVersion)
+			return ok
+		})
+		if found {
+			return &DetectResult{
+				IsSelfHost:    true,
+				Offset:        offset,
+				FooterVersion: FooterVersion,
+				Platform:      header.PlatformOrManifest(),
+				Size:          sectionSize,
+				Recovered:     true,
+			}, header, true
+		}
+	}
+}
+
+// findMarker reads the first limit bytes of r in chunks and returns the
+// offset of the first occurrence of marker for which match returns true.
+func findMarker(r io.ReaderAt, limit int64, marker []byte, match func(offset int64) bool) (int64, bool) {
+	const chunkSize = 1 << 20
+	// Chunks overlap by one byte less than the marker, so a marker spanning
+	// two chunks is still found
+	buf := make([]byte, chunkSize+len(marker)-1)
+	for start := int64(0); start < limit; start += chunkSize {
+		chunk := buf[:min(int64(len(buf)), limit-start)]
+		if _, err := r.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return 0, false
+		}
+		for i := 0; ; {
+			idx := bytes.Index(chunk[i:], marker)
+			if idx < 0 || i+idx >= chunkSize {
+				break
+			}
+			if offset := start + int64(i+idx); match(offset) {
+				return offset, true
+			}
+			i += idx + 1
+		}
+	}
+	return 0, false
+}
+
+// readBundleSection returns the header following the MagicStart marker at
+// offset, or false unless the header parses, ends before the MagicEnd
+// marker, and that marker is in place before the footer.
+func readBundleSection(r io.ReaderAt, offset, size int64, footerVersion uint32) (*Header, bool) {
+	endOffset := size - trailerSize(footerVersion)
+	headerStart := offset + MagicStartLen
+	if endOffset < headerStart {
+		return nil, false
+	}
+
+	endMarker := make([]byte, MagicEndLen)
+	if _, err := r.ReadAt(endMarker, endOffset); err != nil || !bytes.Equal(endMarker, MagicEnd) {
+		return nil, false
+	}
+
+	header, err := ReadHeader(io.NewSectionReader(r, headerStart, endOffset-headerStart))
+	if err != nil {
+		return nil, false
+	}
+	return header, true
+}
+
+// encodeFooter builds the current-version footer pointing at the MagicStart marker at offset.
+func encodeFooter(offset int64) []byte {
+	footer := make([]byte, FooterSize)
+	copy(footer, MagicFooter)
+	binary.LittleEndian.PutUint32(footer[MagicFooterLen:], FooterVersion)
+	binary.LittleEndian.PutUint64(footer[MagicFooterLen+FooterVersionSize:], uint64(offset))
+	return footer
+}
+
+// decodeFooter returns the footer version and MagicStart offset stored in
+// footer, or false if footer does not begin with MagicFooter.
+func decodeFooter(footer []byte) (uint32, int64, bool) {
+	if len(footer) != FooterSize || !bytes.Equal(footer[:MagicFooterLen], MagicFooter) {
+		return 0, 0, false
+	}
+	version := binary.LittleEndian.Uint32(footer[MagicFooterLen:])
+	offset := int64(binary.LittleEndian.Uint64(footer[MagicFooterLen+FooterVersionSize:]))
+	return version, offset, true
+}
+
+// trailerSize returns the number of bytes following the compressed bundle
+// (end marker and footer) for the given footer version.
+func trailerSize(footerVersion uint32) int64 {
+	// Version 1 is the only layout so far; newer versions are rejected during detection
+	switch footerVersion {
+	default:
+		return MagicEndLen + FooterSize
+	}
 }
 
 // ReadHeaderFromExecutable reads the header from a self-extracting executable.
@@ -241,27 +800,35 @@ func ReadHeaderFromExecutable(path string) (*Header, error) {
 		}
 	}
 
-	result, err := DetectSelfHostModeFromFile(path)
+	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
+	defer f.Close()
 
-	if !result.IsSelfHost {
-		return nil, fmt.Errorf("file is not a self-host executable")
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
-	f, err := os.Open(path)
+	return ReadHeaderFromReaderAt(f, stat.Size())
+}
+
+// ReadHeaderFromReaderAt reads the header of the self-extracting executable
+// whose size bytes are readable from r. Only the footer, start and end
+// markers and header are read, never the bundle itself.
+func ReadHeaderFromReaderAt(r io.ReaderAt, size int64) (*Header, error) {
+	result, header, err := detectSelfHost(r, size)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
 
-	// Seek past the start marker to the header
-	if _, err := f.Seek(result.Offset+MagicStartLen, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("failed to seek to header: %w", err)
+	if !result.IsSelfHost {
+		return nil, fmt.Errorf("file is not a self-host executable")
 	}
 
-	return ReadHeader(f)
+	// Detection already parsed the header following the start marker
+	return header, nil
 }
 
 // ExtractOptions contains options for extracting an embedded bundle.
@@ -275,10 +842,76 @@ type ExtractOptions struct {
 
 	// SkipVerify skips checksum verification if true.
 	SkipVerify bool
+
+	// VerifyDatabase runs a SQLite integrity check on the extracted
+	// convex.db, catching corruption that the bundle checksum cannot.
+	VerifyDatabase bool
+
+	// Atomic extracts into a temporary directory next to OutputDir and
+	// renames it into place only once extraction (and VerifyDatabase)
+	// succeeds, so an interrupted extraction never leaves a partial
+	// OutputDir. A non-empty OutputDir is only replaced if Clean is set.
+	Atomic bool
+
+	// Clean removes an existing non-empty OutputDir before extracting, so a
+	// retried extraction does not mix old and new files. As a guard, only
+	// directories that look like a previous extraction (containing
+	// manifest.json or IncompleteMarker) are removed.
+	Clean bool
+
+	// MaxExtractedSize aborts extraction once the files written exceed this
+	// many bytes, guarding against tampered bundles that decompress far
+	// beyond their recorded size. Zero allows twice the header's
+	// BundleSize; a negative value disables the limit.
+	MaxExtractedSize int64
+
+	// MaxEntries aborts extraction once the archive has more entries than
+	// this. Zero uses DefaultMaxExtractEntries; a negative value disables
+	// the limit.
+	MaxEntries int
+
+	// Logger receives warnings, e.g. when the header's compression does not
+	// match the data (optional, defaults to discarding them)
+	Logger logging.Logger
+}
+
+// DefaultMaxExtractEntries is the archive entry limit used when
+// ExtractOptions.MaxEntries is zero.
+const DefaultMaxExtractEntries = 1_000_000
+
+// ErrExtractLimitExceeded is returned when an archive being extracted exceeds
+// ExtractOptions.MaxExtractedSize or MaxEntries.
+var ErrExtractLimitExceeded = errors.New("extraction limit exceeded")
+
+// extractLimits bounds what extractCompressedTar writes; zero fields are
+// unlimited.
+type extractLimits struct {
+	maxSize    int64
+	maxEntries int
+}
+
+// newExtractLimits applies the defaults for header to the configured limits.
+func newExtractLimits(header *Header, maxSize int64, maxEntries int) extractLimits {
+	if maxSize == 0 {
+		maxSize = 2 * header.BundleSize
+	}
+	if maxEntries == 0 {
+		maxEntries = DefaultMaxExtractEntries
+	}
+	return extractLimits{maxSize: max(maxSize, 0), maxEntries: max(maxEntries, 0)}
 }
 
 // Extract extracts the embedded bundle from a self-extracting executable.
 func Extract(opts ExtractOptions) (*Header, error) {
+	return ExtractContext(context.Background(), opts)
+}
+
+// ExtractContext is like Extract but stops between tar entries and during file
+// copies when ctx is cancelled, returning ctx.Err(). If the output directory was
+// created by this call it is removed; otherwise an IncompleteMarker file is left
+// in it. The same cleanup happens when the archive exceeds MaxExtractedSize or
+// MaxEntries.
+func ExtractContext(ctx context.Context, opts ExtractOptions) (*Header, error) {
 	exePath := opts.ExecutablePath
 	if exePath == "" {
 		var err error
@@ -297,6 +930,9 @@ func Extract(opts ExtractOptions) (*Header, error) {
 	if !result.IsSelfHost {
 		return nil, fmt.Errorf("file does not contain an embedded bundle")
 	}
+	if result.Recovered {
+		logging.OrNop(opts.Logger).Warnf("Footer of %s is damaged or followed by extra bytes; found the bundle by scanning for its markers (recovery mode)", exePath)
+	}
 
 	f, err := os.Open(exePath)
 	if err != nil {
@@ -314,6 +950,15 @@ func Extract(opts ExtractOptions) (*Header, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read header: %w", err)
 	}
+	if err := header.CheckCompatible(); err != nil {
+		return nil, err
+	}
+	if header.CredentialsOmitted {
+		logging.OrNop(opts.Logger).Warnf("Bundle was created without credentials.json; credentials must be supplied before the backend starts")
+	}
+	if header.CredentialsEncrypted {
+		logging.OrNop(opts.Logger).Warnf("Bundle credentials.json is encrypted; it must be decrypted with the passphrase before the backend starts")
+	}
 
 	// Current position is at the start of compressed data
 	compressedDataStart, err := f.Seek(0, io.SeekCurrent)
@@ -321,15 +966,9 @@ func Extract(opts ExtractOptions) (*Header, error) {
 		return nil, fmt.Errorf("failed to get current position: %w", err)
 	}
 
-	// Get file size
-	stat, err := f.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to stat file: %w", err)
-	}
-
 	// Calculate compressed data size:
-	// file size - compressed start - end marker - footer
-	compressedDataSize := stat.Size() - compressedDataStart - MagicEndLen - FooterSize
+	// executable size - compressed start - trailer (end marker and footer)
+	compressedDataSize := result.Size - compressedDataStart - trailerSize(result.FooterVersion)
 
 	// Read compressed data for verification
 	compressedData := make([]byte, compressedDataSize)
@@ -339,65 +978,288 @@ func Extract(opts ExtractOptions) (*Header, error) {
 
 	// Verify checksum if not skipped
 	if !opts.SkipVerify {
-		calculatedChecksum := calculateChecksum(compressedData)
-		if calculatedChecksum != header.BundleChecksum {
-			return nil, fmt.Errorf("checksum mismatch: expected %s, got %s", header.BundleChecksum, calculatedChecksum)
+		if err := verifyChecksum(header.BundleChecksum, compressedData); err != nil {
+			return nil, err
+		}
+	}
+
+	// Trust the data's magic number over the header
+	compression := detectCompression(compressedData, header.Compression, opts.Logger)
+
+	if opts.Clean {
+		if err := checkCleanable(opts.OutputDir); err != nil {
+			return nil, err
+		}
+	}
+
+	limits := newExtractLimits(header, opts.MaxExtractedSize, opts.MaxEntries)
+
+	if opts.Atomic {
+		if err := extractAtomic(ctx, compressedData, compression, header.ZstdDictionary, limits, opts); err != nil {
+			return nil, err
+		}
+		return header, nil
+	}
+
+	if opts.Clean {
+		if err := os.RemoveAll(opts.OutputDir); err != nil {
+			return nil, fmt.Errorf("failed to clean output directory: %w", err)
 		}
 	}
 
-	// Create output directory
+	// Create output directory, remembering whether it already existed so a
+	// cancelled extraction knows whether it may remove it
+	_, statErr := os.Stat(opts.OutputDir)
+	createdOutputDir := os.IsNotExist(statErr)
 	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
 
 	// Decompress and extract
-	if err := extractCompressedTar(compressedData, opts.OutputDir, header.Compression); err != nil {
+	if err := extractCompressedTar(ctx, compressedData, opts.OutputDir, compression, header.ZstdDictionary, limits); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			cleanupIncompleteExtraction(opts.OutputDir, createdOutputDir)
+			return nil, ctxErr
+		}
+		if errors.Is(err, ErrExtractLimitExceeded) {
+			cleanupIncompleteExtraction(opts.OutputDir, createdOutputDir)
+		}
 		return nil, fmt.Errorf("failed to extract bundle: %w", err)
 	}
 
-	return header, nil
-}
-
-// VerifyResult contains the result of bundle verification.
-type VerifyResult struct {
-	// Valid indicates whether the checksum matched
-	Valid bool
-
-	// ExpectedChecksum is the checksum stored in the header
-	ExpectedChecksum string
+	if opts.VerifyDatabase {
+		if err := database.CheckIntegrity(filepath.Join(opts.OutputDir, "convex.db")); err != nil {
+			return nil, fmt.Errorf("failed to verify convex.db: %w", err)
+		}
+	}
 
-	// ActualChecksum is the calculated checksum
-	ActualChecksum string
+	return header, nil
 }
 
-// Verify verifies the integrity of the embedded bundle.
-func Verify(path string) (*VerifyResult, error) {
-	if path == "" {
-		var err error
-		path, err = os.Executable()
+// IncompleteMarker is written into a pre-existing output directory when an
+// extraction is cancelled or exceeds its limits part way through.
+const IncompleteMarker = ".extract-incomplete"
+
+// extractAtomic extracts compressedData into a temporary directory next to
+// opts.OutputDir and renames it into place on success. An existing
+// OutputDir is replaced only if it is empty or opts.Clean is set.
+func extractAtomic(ctx context.Context, compressedData []byte, compression string, dictionary []byte, limits extractLimits, opts ExtractOptions) (err error) {
+	outputDir := filepath.Clean(opts.OutputDir)
+	if !opts.Clean {
+		empty, err := isEmptyOrMissingDir(outputDir)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get executable path: %w", err)
+			return err
+		}
+		if !empty {
+			return fmt.Errorf("output directory is not empty: %s (set Clean to replace it)", outputDir)
 		}
 	}
 
-	// Detect self-host mode
-	result, err := DetectSelfHostModeFromFile(path)
+	parent := filepath.Dir(outputDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory: %w", err)
+	}
+	tempDir, err := os.MkdirTemp(parent, "."+filepath.Base(outputDir)+".extract-*")
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	if err := os.Chmod(tempDir, 0755); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
 	}
 
-	if !result.IsSelfHost {
-		return nil, fmt.Errorf("file does not contain an embedded bundle")
+	if err := extractCompressedTar(ctx, compressedData, tempDir, compression, dictionary, limits); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("failed to extract bundle: %w", err)
 	}
 
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+	if opts.VerifyDatabase {
+		if err := database.CheckIntegrity(filepath.Join(tempDir, "convex.db")); err != nil {
+			return fmt.Errorf("failed to verify convex.db: %w", err)
+		}
 	}
-	defer f.Close()
 
-	// Seek past start marker to header
-	if _, err := f.Seek(result.Offset+MagicStartLen, io.SeekStart); err != nil {
+	// Move any previous output aside first, so it is only deleted once the
+	// new directory is in place
+	if _, err := os.Stat(outputDir); err == nil {
+		oldDir := tempDir + ".old"
+		if err := os.Rename(outputDir, oldDir); err != nil {
+			return fmt.Errorf("failed to move aside existing output directory: %w", err)
+		}
+		defer func() {
+			if err != nil {
+				os.Rename(oldDir, outputDir)
+				return
+			}
+			os.RemoveAll(oldDir)
+		}()
+	}
+
+	if err := os.Rename(tempDir, outputDir); err != nil {
+		return fmt.Errorf("failed to move extracted bundle into place: %w", err)
+	}
+	return nil
+}
+
+// checkCleanable returns an error if dir exists, is not empty and does not
+// look like a previous extraction, so Clean never deletes unrelated data.
+func checkCleanable(dir string) error {
+	empty, err := isEmptyOrMissingDir(dir)
+	if err != nil || empty {
+		return err
+	}
+	for _, name := range []string{"manifest.json", IncompleteMarker} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("refusing to clean output directory that does not contain a previous extraction: %s", dir)
+}
+
+// isEmptyOrMissingDir reports whether dir does not exist or is an empty
+// directory.
+func isEmptyOrMissingDir(dir string) (bool, error) {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to access output directory: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to access output directory: %w", err)
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("output path is not a directory: %s", dir)
+	}
+	if _, err := f.Readdirnames(1); err == io.EOF {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read output directory: %w", err)
+	}
+	return false, nil
+}
+
+// cleanupIncompleteExtraction removes a cancelled extraction's output directory
+// if it was created for the extraction, or marks it incomplete otherwise.
+func cleanupIncompleteExtraction(outputDir string, created bool) {
+	if created {
+		os.RemoveAll(outputDir)
+		return
+	}
+	os.WriteFile(filepath.Join(outputDir, IncompleteMarker), []byte("extraction was stopped before completion\n"), 0644)
+}
+
+// contextReader wraps a reader and fails reads once ctx is cancelled, so
+// long copies stop promptly.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
+
+// VerifyResult contains the result of bundle verification.
+type VerifyResult struct {
+	// Valid indicates whether the checksum matched
+	Valid bool
+
+	// ExpectedChecksum is the checksum stored in the header
+	ExpectedChecksum string
+
+	// ActualChecksum is the calculated checksum
+	ActualChecksum string
+
+	// CompressedSize is the size in bytes of the compressed bundle region
+	CompressedSize int64
+
+	// UncompressedSize is the uncompressed bundle size recorded in the header
+	UncompressedSize int64
+
+	// CompressionRatio is CompressedSize divided by UncompressedSize
+	// (e.g. 0.35 means the bundle compressed to 35% of its size)
+	CompressionRatio float64
+
+	// CorruptRegion is the region most likely to be corrupted (one of the
+	// Region constants) when deep verification finds a problem
+	CorruptRegion string
+}
+
+// Regions of a self-host executable reported in VerifyResult.CorruptRegion.
+const (
+	// RegionOps is the ops binary preceding the bundle section
+	RegionOps = "ops"
+
+	// RegionHeader is the start marker and the length-prefixed header JSON
+	RegionHeader = "header"
+
+	// RegionBundle is the compressed bundle data
+	RegionBundle = "bundle"
+
+	// RegionFooter is the end marker and the footer
+	RegionFooter = "footer"
+)
+
+// VerifyOptions configures optional verification behavior.
+type VerifyOptions struct {
+	// Deep checks the markers, header and footer independently and reports
+	// the likely corrupted region in VerifyResult.CorruptRegion instead of
+	// returning an error for a damaged layout. The whole file is read into
+	// memory.
+	Deep bool
+}
+
+// Verify verifies the integrity of the embedded bundle.
+func Verify(path string) (*VerifyResult, error) {
+	return VerifyWithOptions(path, VerifyOptions{})
+}
+
+// VerifyWithOptions is like Verify but with the behavior configured in opts.
+func VerifyWithOptions(path string, opts VerifyOptions) (*VerifyResult, error) {
+	if path == "" {
+		var err error
+		path, err = os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get executable path: %w", err)
+		}
+	}
+
+	if opts.Deep {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		return deepVerify(data)
+	}
+
+	// Detect self-host mode
+	result, err := DetectSelfHostModeFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !result.IsSelfHost {
+		return nil, fmt.Errorf("file does not contain an embedded bundle")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	// Seek past start marker to header
+	if _, err := f.Seek(result.Offset+MagicStartLen, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("failed to seek to header: %w", err)
 	}
 
@@ -413,14 +1275,8 @@ func Verify(path string) (*VerifyResult, error) {
 		return nil, fmt.Errorf("failed to get current position: %w", err)
 	}
 
-	// Get file size
-	stat, err := f.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to stat file: %w", err)
-	}
-
 	// Calculate compressed data size
-	compressedDataSize := stat.Size() - compressedDataStart - MagicEndLen - FooterSize
+	compressedDataSize := result.Size - compressedDataStart - trailerSize(result.FooterVersion)
 
 	// Read compressed data
 	compressedData := make([]byte, compressedDataSize)
@@ -428,16 +1284,137 @@ func Verify(path string) (*VerifyResult, error) {
 		return nil, fmt.Errorf("failed to read compressed data: %w", err)
 	}
 
-	// Calculate checksum
-	actualChecksum := calculateChecksum(compressedData)
+	// Calculate checksum with the header's algorithm
+	actualChecksum, err := checksumLike(header.BundleChecksum, compressedData)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratio float64
+	if header.BundleSize > 0 {
+		ratio = float64(compressedDataSize) / float64(header.BundleSize)
+	}
 
 	return &VerifyResult{
 		Valid:            actualChecksum == header.BundleChecksum,
 		ExpectedChecksum: header.BundleChecksum,
 		ActualChecksum:   actualChecksum,
+		CompressedSize:   compressedDataSize,
+		UncompressedSize: header.BundleSize,
+		CompressionRatio: ratio,
 	}, nil
 }
 
+// deepVerify checks each region of a self-host executable in turn and reports
+// the first one that looks corrupted. The ops binary carries no checksum, so
+// it is only reported when the bundle section has moved, e.g. because bytes
+// were inserted into or removed from the ops binary.
+func deepVerify(data []byte) (*VerifyResult, error) {
+	size := int64(len(data))
+	trailer := trailerSize(FooterVersion)
+	if size < trailer+MagicStartLen {
+		return nil, fmt.Errorf("file does not contain an embedded bundle")
+	}
+
+	// A damaged footer is recognized by the intact end marker just before it;
+	// without either, the file was never a self-host executable
+	footerVersion, offset, ok := decodeFooter(data[size-FooterSize:])
+	endMarkerOK := bytes.Equal(data[size-trailer:size-FooterSize], MagicEnd)
+	if !ok {
+		if !endMarkerOK {
+			return nil, fmt.Errorf("file does not contain an embedded bundle")
+		}
+		return &VerifyResult{CorruptRegion: RegionFooter}, nil
+	}
+	if footerVersion > FooterVersion {
+		return nil, fmt.Errorf("%w %d (supports up to %d): executable was created by a newer bundler", ErrUnsupportedFooterVersion, footerVersion, FooterVersion)
+	}
+	if !endMarkerOK {
+		return &VerifyResult{CorruptRegion: RegionFooter}, nil
+	}
+
+	// An out-of-range offset can only come from the footer. An in-range offset
+	// without the start marker means either the ops binary changed size (a
+	// marker followed by a readable header is found elsewhere) or the marker
+	// itself was overwritten. The last occurrence is used since the ops binary
+	// may contain the marker bytes.
+	if offset < 0 || offset > size-trailer-MagicStartLen {
+		return &VerifyResult{CorruptRegion: RegionFooter}, nil
+	}
+	if !bytes.Equal(data[offset:offset+MagicStartLen], MagicStart) {
+		if idx := bytes.LastIndex(data[:size-trailer], MagicStart); idx >= 0 {
+			if _, err := ReadHeader(bytes.NewReader(data[idx+MagicStartLen : size-trailer])); err == nil {
+				return &VerifyResult{CorruptRegion: RegionOps}, nil
+			}
+		}
+		return &VerifyResult{CorruptRegion: RegionHeader}, nil
+	}
+
+	r := bytes.NewReader(data[offset+MagicStartLen : size-trailer])
+	header, err := ReadHeader(r)
+	if err != nil || header.Validate() != nil {
+		return &VerifyResult{CorruptRegion: RegionHeader}, nil
+	}
+
+	compressedData := data[size-trailer-int64(r.Len()) : size-trailer]
+	compressedDataSize := int64(len(compressedData))
+	actualChecksum, err := checksumLike(header.BundleChecksum, compressedData)
+	if err != nil {
+		return nil, err
+	}
+
+	var ratio float64
+	if header.BundleSize > 0 {
+		ratio = float64(compressedDataSize) / float64(header.BundleSize)
+	}
+
+	result := &VerifyResult{
+		Valid:            actualChecksum == header.BundleChecksum,
+		ExpectedChecksum: header.BundleChecksum,
+		ActualChecksum:   actualChecksum,
+		CompressedSize:   compressedDataSize,
+		UncompressedSize: header.BundleSize,
+		CompressionRatio: ratio,
+	}
+	if !result.Valid {
+		result.CorruptRegion = RegionBundle
+	}
+	return result, nil
+}
+
+// ErrIncompatibleVersion is returned when an ops binary or backend is older
+// than the minimum version recorded in a bundle's header.
+var ErrIncompatibleVersion = errors.New("incompatible version")
+
+// CheckVersionCompatibility checks that actualOpsVersion satisfies the
+// header's MinOpsVersion. Versions are compared as semver, so a prerelease
+// is older than its release. Headers without a minimum accept any version.
+func CheckVersionCompatibility(header *Header, actualOpsVersion string) error {
+	return checkMinVersion("ops", header.MinOpsVersion, actualOpsVersion)
+}
+
+// CheckBackendVersionCompatibility is like CheckVersionCompatibility for the
+// header's MinBackendVersion.
+func CheckBackendVersionCompatibility(header *Header, actualBackendVersion string) error {
+	return checkMinVersion("backend", header.MinBackendVersion, actualBackendVersion)
+}
+
+// checkMinVersion returns an error wrapping ErrIncompatibleVersion if actual
+// is older than minimum.
+func checkMinVersion(component, minimum, actual string) error {
+	if minimum == "" {
+		return nil
+	}
+	c, err := version.Compare(actual, minimum)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s version with minimum %s: %w", component, minimum, err)
+	}
+	if c < 0 {
+		return fmt.Errorf("%w: %s version %s is older than the minimum %s required by this bundle", ErrIncompatibleVersion, component, actual, minimum)
+	}
+	return nil
+}
+
 // CheckPlatformCompatibility checks if the bundle platform matches the host.
 func CheckPlatformCompatibility(bundlePlatform string) error {
 	hostPlatform := getHostPlatform()
@@ -451,95 +1428,245 @@ func CheckPlatformCompatibility(bundlePlatform string) error {
 
 // getHostPlatform returns the current host platform in the format used by bundles.
 func getHostPlatform() string {
-	platformMap := map[string]string{
-		"linux-amd64": "linux-x64",
-		"linux-arm64": "linux-arm64",
-		"darwin-amd64": "darwin-x64",
-		"darwin-arm64": "darwin-arm64",
+	return platform.Host()
+}
+
+// credentialsFile is the bundle file left out by CreateOptions.OmitCredentials
+const credentialsFile = "credentials.json"
+
+// envFile is the optional startup env file (bundle.EnvFileName), also left
+// out by CreateOptions.OmitCredentials because it holds the instance secret
+const envFile = "convex.env"
+
+// requiredBundleFiles are the files every bundle must contain
+var requiredBundleFiles = []string{"manifest.json", "backend", "convex.db", credentialsFile}
+
+// validateCreateInputs validates the inputs for Create. It reports every
+// problem found, joined with errors.Join, rather than stopping at the first.
+func validateCreateInputs(opts CreateOptions) error {
+	return errors.Join(createInputErrors(opts, true)...)
+}
+
+// createInputErrors returns the problems with the inputs for Create, or for
+// CreateTo when requireOutputPath is false.
+func createInputErrors(opts CreateOptions, requireOutputPath bool) []error {
+	var errs []error
+
+	if opts.BundleDir == "" {
+		errs = append(errs, fmt.Errorf("bundle directory is required"))
 	}
 
-	key := runtime.GOOS + "-" + runtime.GOARCH
-	if platform, ok := platformMap[key]; ok {
-		return platform
+	errs = append(errs, validateExecutableInputs(opts, requireOutputPath)...)
+
+	// Check bundle directory exists, then its required files
+	if opts.BundleDir != "" {
+		info, err := os.Stat(opts.BundleDir)
+		switch {
+		case os.IsNotExist(err):
+			errs = append(errs, fmt.Errorf("bundle directory does not exist: %s", opts.BundleDir))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to access bundle directory: %w", err))
+		case !info.IsDir():
+			errs = append(errs, fmt.Errorf("bundle path is not a directory: %s", opts.BundleDir))
+		default:
+			for _, file := range requiredBundleFiles {
+				if file == credentialsFile && opts.OmitCredentials {
+					continue
+				}
+				path := filepath.Join(opts.BundleDir, file)
+				if _, err := os.Stat(path); os.IsNotExist(err) {
+					errs = append(errs, fmt.Errorf("bundle is missing required file: %s", file))
+				}
+			}
+			errs = append(errs, validateExtraFiles(opts.BundleDir, opts.ExtraFiles)...)
+		}
 	}
 
-	// Return as-is if not in map
-	return key
+	// Validate compression
+	if opts.Compression != "" && opts.Compression != CompressionAuto && !isValidCompression(opts.Compression) {
+		errs = append(errs, fmt.Errorf("invalid compression: %s (must be %q, %q, %q or %q)", opts.Compression, CompressionGzip, CompressionZstd, CompressionBrotli, CompressionAuto))
+	}
+	if len(opts.ZstdDictionary) > 0 {
+		if opts.Compression != CompressionZstd && opts.Compression != CompressionAuto {
+			errs = append(errs, fmt.Errorf("zstd dictionary requires %q or %q compression, got %q", CompressionZstd, CompressionAuto, opts.Compression))
+		}
+		if err := validateZstdDictionary(opts.ZstdDictionary); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
 }
 
-// validateCreateInputs validates the inputs for Create.
-func validateCreateInputs(opts CreateOptions) error {
-	if opts.BundleDir == "" {
-		return fmt.Errorf("bundle directory is required")
+// validateExtraFiles returns the problems with the ExtraFiles paths: each
+// must be a clean relative path, must not be inside another extra file, and
+// must not replace anything in bundleDir.
+func validateExtraFiles(bundleDir string, extraFiles map[string][]byte) []error {
+	var errs []error
+	for _, name := range sortedKeys(extraFiles) {
+		if name == "." || !fs.ValidPath(name) || strings.Contains(name, "\\") {
+			errs = append(errs, fmt.Errorf("invalid extra file path: %q", name))
+			continue
+		}
+		for dir := pathDir(name); dir != "."; dir = pathDir(dir) {
+			if _, ok := extraFiles[dir]; ok {
+				errs = append(errs, fmt.Errorf("extra file %s is inside extra file %s", name, dir))
+				break
+			}
+		}
+		if _, err := os.Lstat(filepath.Join(bundleDir, filepath.FromSlash(name))); err == nil {
+			errs = append(errs, fmt.Errorf("extra file would replace bundle file: %s", name))
+		}
 	}
+	return errs
+}
+
+// pathDir returns the parent of the slash-separated path name ("." at the top level).
+func pathDir(name string) string {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i]
+	}
+	return "."
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateExecutableInputs returns the problems with the options that do not
+// depend on where the bundle comes from: the ops binary, output, platform
+// and install settings. The output path is only checked if requireOutputPath
+// is set.
+func validateExecutableInputs(opts CreateOptions, requireOutputPath bool) []error {
+	var errs []error
 
 	if opts.OpsBinary == "" {
-		return fmt.Errorf("ops binary is required")
+		errs = append(errs, fmt.Errorf("ops binary is required"))
 	}
 
-	if opts.OutputPath == "" {
-		return fmt.Errorf("output path is required")
+	if requireOutputPath && opts.OutputPath == "" {
+		errs = append(errs, fmt.Errorf("output path is required"))
 	}
 
 	if opts.Platform == "" {
-		return fmt.Errorf("platform is required")
+		errs = append(errs, fmt.Errorf("platform is required"))
 	}
 
-	// Check bundle directory exists
-	info, err := os.Stat(opts.BundleDir)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("bundle directory does not exist: %s", opts.BundleDir)
+	if opts.InstallPrefix != "" && !filepath.IsAbs(opts.InstallPrefix) {
+		errs = append(errs, fmt.Errorf("install prefix must be an absolute path: %s", opts.InstallPrefix))
 	}
-	if err != nil {
-		return fmt.Errorf("failed to access bundle directory: %w", err)
+
+	if opts.ServiceName != "" {
+		if err := ValidateServiceName(opts.ServiceName); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	if !info.IsDir() {
-		return fmt.Errorf("bundle path is not a directory: %s", opts.BundleDir)
+
+	if opts.HealthCheckPath != "" && !strings.HasPrefix(opts.HealthCheckPath, "/") {
+		errs = append(errs, fmt.Errorf("health check path must start with \"/\": %s", opts.HealthCheckPath))
+	}
+	if opts.HealthCheckTimeout < 0 || opts.HealthCheckTimeout%time.Second != 0 {
+		errs = append(errs, fmt.Errorf("health check timeout must be a positive whole number of seconds: %s", opts.HealthCheckTimeout))
+	}
+
+	if opts.MaxBundleSize < 0 {
+		errs = append(errs, fmt.Errorf("max bundle size must not be negative: %d", opts.MaxBundleSize))
 	}
 
-	// Check required bundle files exist
-	requiredFiles := []string{"manifest.json", "backend", "convex.db", "credentials.json"}
-	for _, file := range requiredFiles {
-		path := filepath.Join(opts.BundleDir, file)
-		if _, err := os.Stat(path); os.IsNotExist(err) {
-			return fmt.Errorf("bundle is missing required file: %s", file)
+	if opts.OpsVersion != "" && !version.Valid(opts.OpsVersion) {
+		errs = append(errs, fmt.Errorf("ops version must be a semantic version: %s", opts.OpsVersion))
+	}
+	if opts.MinOpsVersion != "" && !version.Valid(opts.MinOpsVersion) {
+		errs = append(errs, fmt.Errorf("minimum ops version must be a semantic version: %s", opts.MinOpsVersion))
+	}
+	if opts.MinBackendVersion != "" && !version.Valid(opts.MinBackendVersion) {
+		errs = append(errs, fmt.Errorf("minimum backend version must be a semantic version: %s", opts.MinBackendVersion))
+	}
+	if opts.ChecksumAlgorithm != "" {
+		if _, err := newChecksumHash(opts.ChecksumAlgorithm); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
 	// Check ops binary exists
-	info, err = os.Stat(opts.OpsBinary)
-	if os.IsNotExist(err) {
-		return fmt.Errorf("ops binary does not exist: %s", opts.OpsBinary)
+	if opts.OpsBinary != "" {
+		info, err := os.Stat(opts.OpsBinary)
+		switch {
+		case os.IsNotExist(err):
+			errs = append(errs, fmt.Errorf("ops binary does not exist: %s", opts.OpsBinary))
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to access ops binary: %w", err))
+		case info.IsDir():
+			errs = append(errs, fmt.Errorf("ops binary path is a directory: %s", opts.OpsBinary))
+		default:
+			if err := checkOpsBinaryFormat(opts.OpsBinary); err != nil {
+				errs = append(errs, err)
+			} else if err := checkOpsBinaryPlatform(opts.OpsBinary, opts.Platform); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	}
-	if err != nil {
-		return fmt.Errorf("failed to access ops binary: %w", err)
+
+	return errs
+}
+
+// checkOpsBinaryPlatform returns an error if the ops binary's executable
+// header names a different OS or architecture than platformName. Binaries in
+// unrecognized formats, and unknown platforms, are not rejected.
+func checkOpsBinaryPlatform(opsBinary, platformName string) error {
+	target, ok := platform.Lookup(platformName)
+	if !ok {
+		return nil
 	}
-	if info.IsDir() {
-		return fmt.Errorf("ops binary path is a directory: %s", opts.OpsBinary)
+	goos, goarch, ok := binaryPlatform(opsBinary)
+	if !ok || (goos == target.GOOS && goarch == target.GOARCH) {
+		return nil
 	}
-
-	// Validate compression
-	if opts.Compression != CompressionGzip && opts.Compression != CompressionZstd && opts.Compression != "" {
-		return fmt.Errorf("invalid compression: %s (must be %q or %q)", opts.Compression, CompressionGzip, CompressionZstd)
+	built := goos + "/" + goarch
+	if p, ok := platform.FromGo(goos, goarch); ok {
+		built = p.Name
 	}
+	return fmt.Errorf("ops binary is built for %s, not %s: %s", built, platformName, opsBinary)
+}
 
-	return nil
+// archiveOptions controls how createCompressedTar writes the archive.
+type archiveOptions struct {
+	// modTime, if non-zero, is used for every entry, which then carries no
+	// owner information, making the archive reproducible
+	modTime time.Time
+
+	// parallel compresses gzip and zstd output on all CPUs
+	parallel bool
+
+	// zstdDictionary primes zstd compression (see CreateOptions.ZstdDictionary)
+	zstdDictionary []byte
+
+	// exclude holds slash-separated paths, relative to the bundle directory,
+	// that are left out of the archive
+	exclude map[string]bool
+
+	// storageIgnore, if set, excludes the storage/ paths it matches
+	storageIgnore *ignore.Matcher
+
+	// extraFiles are written after the bundle directory's entries, keyed by
+	// slash-separated archive path
+	extraFiles map[string][]byte
 }
 
 // createCompressedTar creates a compressed tar archive of the bundle directory.
 // Returns the uncompressed size.
-func createCompressedTar(w io.Writer, bundleDir string, compression string) (int64, error) {
-	var compressWriter io.WriteCloser
-	var err error
+func createCompressedTar(ctx context.Context, w io.Writer, bundleDir string, compression string, archiveOpts archiveOptions) (int64, error) {
+	modTime := archiveOpts.modTime
 
-	switch compression {
-	case CompressionGzip, "":
-		compressWriter = gzip.NewWriter(w)
-	case CompressionZstd:
-		// For now, we only support gzip. Zstd would require an additional dependency.
-		return 0, fmt.Errorf("zstd compression is not yet implemented")
-	default:
-		return 0, fmt.Errorf("unsupported compression: %s", compression)
+	compressWriter, err := newCompressWriter(w, compression, archiveOpts.parallel, archiveOpts.zstdDictionary)
+	if err != nil {
+		return 0, err
 	}
 	defer compressWriter.Close()
 
@@ -548,8 +1675,88 @@ func createCompressedTar(w io.Writer, bundleDir string, compression string) (int
 
 	var totalSize int64
 
-	err = filepath.Walk(bundleDir, func(path string, info os.FileInfo, err error) error {
+	entries, err := collectArchiveEntries(ctx, bundleDir, archiveOpts.exclude, archiveOpts.storageIgnore)
+	if err != nil {
+		return 0, err
+	}
+
+	// First archived path of each multiply-linked file, so later links to
+	// the same inode are stored as hardlinks instead of full copies
+	linkTargets := make(map[fileID]string)
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		n, err := writeArchiveEntry(ctx, tarWriter, bundleDir, entry, modTime, linkTargets)
 		if err != nil {
+			return 0, err
+		}
+		totalSize += n
+	}
+
+	n, err := writeExtraFiles(tarWriter, archiveOpts.extraFiles, modTime)
+	if err != nil {
+		return 0, err
+	}
+	totalSize += n
+
+	return totalSize, nil
+}
+
+// writeExtraFiles writes extraFiles to tarWriter as 0644 regular files, in
+// sorted order, and returns the number of content bytes written. A zero
+// modTime stamps them with the current time.
+func writeExtraFiles(tarWriter *tar.Writer, extraFiles map[string][]byte, modTime time.Time) (int64, error) {
+	if modTime.IsZero() {
+		modTime = time.Now()
+	}
+
+	var total int64
+	for _, name := range sortedKeys(extraFiles) {
+		content := extraFiles[name]
+		header := &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(content)),
+			ModTime:  modTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return 0, fmt.Errorf("failed to write tar header for %s: %w", name, err)
+		}
+		if _, err := tarWriter.Write(content); err != nil {
+			return 0, fmt.Errorf("failed to write %s to tar: %w", name, err)
+		}
+		total += int64(len(content))
+	}
+	return total, nil
+}
+
+// archiveEntry is a file or directory to be written by createCompressedTar.
+type archiveEntry struct {
+	// path is the file's path on disk
+	path string
+
+	// name is the slash-separated path relative to the bundle directory
+	name string
+
+	// info is the Lstat result for path
+	info os.FileInfo
+}
+
+// collectArchiveEntries returns every entry under bundleDir, except the root,
+// the excluded paths and the storage/ paths matched by storageIgnore, sorted
+// by name. Sorting the full list, instead of
+// relying on walk order, keeps archives byte-identical across platforms and
+// filesystems.
+func collectArchiveEntries(ctx context.Context, bundleDir string, exclude map[string]bool, storageIgnore *ignore.Matcher) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	err := filepath.Walk(bundleDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
@@ -564,77 +1771,223 @@ func createCompressedTar(w io.Writer, bundleDir string, compression string) (int
 			return nil
 		}
 
-		// Create tar header
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return fmt.Errorf("failed to create tar header for %s: %w", relPath, err)
+		name := filepath.ToSlash(relPath)
+		storageName, inStorage := strings.CutPrefix(name, "storage/")
+		if exclude[name] || (inStorage && storageIgnore.Match(storageName, info.IsDir())) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 
-		// Use relative path as the name
-		header.Name = relPath
+		entries = append(entries, archiveEntry{path: path, name: name, info: info})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Handle symlinks
-		if info.Mode()&os.ModeSymlink != 0 {
-			link, err := os.Readlink(path)
-			if err != nil {
-				return fmt.Errorf("failed to read symlink %s: %w", path, err)
-			}
-			header.Linkname = link
-		}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
 
-		// Write header
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return fmt.Errorf("failed to write tar header for %s: %w", relPath, err)
+// writeArchiveEntry writes entry to tarWriter and returns the number of
+// content bytes written. Owner information is always cleared; a non-zero
+// modTime replaces the entry's timestamps. Regular files already in
+// linkTargets are written as hardlinks.
+func writeArchiveEntry(ctx context.Context, tarWriter *tar.Writer, bundleDir string, entry archiveEntry, modTime time.Time, linkTargets map[fileID]string) (int64, error) {
+	info := entry.info
+
+	// Embed the content of symlinks to files outside the bundle (e.g. a
+	// linked backend binary), which would dangle once extracted
+	if info.Mode()&os.ModeSymlink != 0 {
+		targetInfo, external, err := externalSymlinkTarget(bundleDir, entry.path)
+		if err != nil {
+			return 0, err
 		}
+		if external {
+			info = targetInfo
+		}
+	}
 
-		// Write file content (skip directories)
-		if !info.IsDir() && info.Mode().IsRegular() {
-			file, err := os.Open(path)
-			if err != nil {
-				return fmt.Errorf("failed to open %s: %w", path, err)
-			}
-			defer file.Close()
+	// Create tar header
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create tar header for %s: %w", entry.name, err)
+	}
 
-			n, err := io.Copy(tarWriter, file)
-			if err != nil {
-				return fmt.Errorf("failed to write %s to tar: %w", relPath, err)
+	// Use relative path as the name
+	header.Name = entry.name
+
+	// Owners differ between build machines and are not restored on extraction
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+
+	if !modTime.IsZero() {
+		header.ModTime = modTime
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+	}
+
+	// Handle symlinks
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(entry.path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read symlink %s: %w", entry.path, err)
+		}
+		header.Linkname = link
+	}
+
+	// Handle hardlinks to a file that was already archived
+	if info.Mode().IsRegular() {
+		if id, ok := hardlinkID(info); ok {
+			if target, seen := linkTargets[id]; seen {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = target
+				header.Size = 0
+			} else {
+				linkTargets[id] = entry.name
 			}
-			totalSize += n
 		}
+	}
 
-		return nil
-	})
+	// Write header
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("failed to write tar header for %s: %w", entry.name, err)
+	}
 
+	// Write file content (skip directories and hardlinks)
+	if header.Typeflag != tar.TypeReg {
+		return 0, nil
+	}
+	file, err := os.Open(entry.path)
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("failed to open %s: %w", entry.path, err)
 	}
+	defer file.Close()
 
-	return totalSize, nil
+	n, err := io.Copy(tarWriter, &contextReader{ctx: ctx, r: file})
+	if err != nil {
+		return n, fmt.Errorf("failed to write %s to tar: %w", entry.name, err)
+	}
+	return n, nil
 }
 
-// extractCompressedTar extracts a compressed tar archive to the output directory.
-func extractCompressedTar(compressedData []byte, outputDir string, compression string) error {
-	reader := bytes.NewReader(compressedData)
+// externalSymlinkTarget reports whether the symlink at path resolves to a
+// regular file outside bundleDir, returning the target's info if so.
+// Dangling symlinks are not external.
+func externalSymlinkTarget(bundleDir, path string) (os.FileInfo, bool, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, false, nil
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve symlink %s: %w", path, err)
+	}
+	root, err := filepath.EvalSymlinks(bundleDir)
+	if err == nil {
+		root, err = filepath.Abs(root)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to resolve bundle directory: %w", err)
+	}
+	if isWithinDir(root, target) {
+		return nil, false, nil
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to stat symlink target %s: %w", target, err)
+	}
+	return info, info.Mode().IsRegular(), nil
+}
 
-	var decompressReader io.ReadCloser
-	var err error
+// newCompressWriter returns a writer that compresses to w with the given
+// algorithm. parallel compresses gzip and zstd output on all CPUs (gzip with
+// pgzip). dictionary, if set, primes zstd compression and must then also be
+// passed to newDecompressReader; other algorithms ignore it.
+func newCompressWriter(w io.Writer, compression string, parallel bool, dictionary []byte) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionGzip, "":
+		if parallel {
+			// pgzip writes standard gzip members, so extraction is unchanged
+			return pgzip.NewWriter(w), nil
+		}
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		zstdOpts := []zstd.EOption{zstd.WithEncoderLevel(zstd.SpeedBestCompression)}
+		if !parallel {
+			zstdOpts = append(zstdOpts, zstd.WithEncoderConcurrency(1))
+		}
+		if len(dictionary) > 0 {
+			zstdOpts = append(zstdOpts, zstd.WithEncoderDict(dictionary))
+		}
+		zstdWriter, err := zstd.NewWriter(w, zstdOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		return zstdWriter, nil
+	case CompressionBrotli:
+		return brotli.NewWriterLevel(w, brotli.BestCompression), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
 
+// newDecompressReader returns a reader that decompresses r with the given
+// algorithm. dictionary is the zstd dictionary the data was compressed with,
+// if any.
+func newDecompressReader(r io.Reader, compression string, dictionary []byte) (io.ReadCloser, error) {
 	switch compression {
 	case CompressionGzip, "":
-		decompressReader, err = gzip.NewReader(reader)
+		gzipReader, err := gzip.NewReader(r)
 		if err != nil {
-			return fmt.Errorf("failed to create gzip reader: %w", err)
+			return nil, fmt.Errorf("failed to create gzip reader: %w", err)
 		}
+		return gzipReader, nil
 	case CompressionZstd:
-		return fmt.Errorf("zstd decompression is not yet implemented")
+		zstdOpts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if len(dictionary) > 0 {
+			zstdOpts = append(zstdOpts, zstd.WithDecoderDicts(dictionary))
+		}
+		zstdReader, err := zstd.NewReader(r, zstdOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd reader: %w", err)
+		}
+		return zstdReader.IOReadCloser(), nil
+	case CompressionBrotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
 	default:
-		return fmt.Errorf("unsupported compression: %s", compression)
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// extractCompressedTar extracts a compressed tar archive to the output directory.
+// Directories and files get exactly the mode stored in the archive, whatever
+// the umask, and the backend binary is always left executable.
+func extractCompressedTar(ctx context.Context, compressedData []byte, outputDir string, compression string, dictionary []byte, limits extractLimits) error {
+	decompressReader, err := newDecompressReader(bytes.NewReader(compressedData), compression, dictionary)
+	if err != nil {
+		return err
 	}
 	defer decompressReader.Close()
 
 	tarReader := tar.NewReader(decompressReader)
 
+	// Symlinks extracted earlier can redirect later entries, so paths are
+	// also checked with symlinks resolved, against the resolved outputDir
+	realOutputDir, err := resolveExistingPath(outputDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve output directory: %w", err)
+	}
+
+	var entries int
+	var extractedSize int64
 	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			break
@@ -643,17 +1996,37 @@ func extractCompressedTar(compressedData []byte, outputDir string, compression s
 			return fmt.Errorf("failed to read tar header: %w", err)
 		}
 
+		entries++
+		if limits.maxEntries > 0 && entries > limits.maxEntries {
+			return fmt.Errorf("%w: archive has more than %d entries", ErrExtractLimitExceeded, limits.maxEntries)
+		}
+		if header.Typeflag == tar.TypeReg && limits.maxSize > 0 && header.Size > limits.maxSize-extractedSize {
+			return fmt.Errorf("%w: extracted files exceed %d bytes", ErrExtractLimitExceeded, limits.maxSize)
+		}
+
 		// Sanitize the path to prevent path traversal attacks
 		targetPath := filepath.Join(outputDir, header.Name)
-		if !strings.HasPrefix(filepath.Clean(targetPath), filepath.Clean(outputDir)) {
+		if !isWithinDir(outputDir, targetPath) {
 			return fmt.Errorf("invalid path in tar: %s", header.Name)
 		}
+		// Links replace targetPath itself, so only its parent must not
+		// lead outside; files and directories are written through it
+		checkPath := targetPath
+		if header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink {
+			checkPath = filepath.Dir(targetPath)
+		}
+		if resolved, err := resolveExistingPath(checkPath); err != nil || !isWithinDir(realOutputDir, resolved) {
+			return fmt.Errorf("invalid path in tar: %s crosses a symlink out of the output directory", header.Name)
+		}
 
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(targetPath, os.FileMode(header.Mode)); err != nil {
 				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
 			}
+			if err := os.Chmod(targetPath, os.FileMode(header.Mode).Perm()); err != nil {
+				return fmt.Errorf("failed to set mode of directory %s: %w", targetPath, err)
+			}
 
 		case tar.TypeReg:
 			// Ensure parent directory exists
@@ -666,10 +2039,18 @@ func extractCompressedTar(compressedData []byte, outputDir string, compression s
 				return fmt.Errorf("failed to create file %s: %w", targetPath, err)
 			}
 
-			if _, err := io.Copy(file, tarReader); err != nil {
+			// The tar reader stops at header.Size, which was checked against the limit
+			n, err := io.Copy(file, &contextReader{ctx: ctx, r: tarReader})
+			extractedSize += n
+			if err != nil {
 				file.Close()
 				return fmt.Errorf("failed to write file %s: %w", targetPath, err)
 			}
+			// OpenFile applies the umask and keeps the mode of an existing file
+			if err := file.Chmod(os.FileMode(header.Mode).Perm()); err != nil {
+				file.Close()
+				return fmt.Errorf("failed to set mode of file %s: %w", targetPath, err)
+			}
 			file.Close()
 
 		case tar.TypeSymlink:
@@ -685,15 +2066,98 @@ func extractCompressedTar(compressedData []byte, outputDir string, compression s
 				return fmt.Errorf("failed to create symlink %s: %w", targetPath, err)
 			}
 
+		case tar.TypeLink:
+			// Hardlink to a file extracted earlier; the target must stay inside outputDir
+			linkTarget := filepath.Join(outputDir, header.Linkname)
+			if !isWithinDir(outputDir, linkTarget) {
+				return fmt.Errorf("invalid hardlink target in tar: %s -> %s", header.Name, header.Linkname)
+			}
+			// os.Link follows symlinks in the target path, e.g. ones extracted earlier
+			if resolved, err := resolveExistingPath(linkTarget); err != nil || !isWithinDir(realOutputDir, resolved) {
+				return fmt.Errorf("invalid hardlink target in tar: %s -> %s resolves outside the output directory", header.Name, header.Linkname)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+				return fmt.Errorf("failed to create parent directory for hardlink %s: %w", targetPath, err)
+			}
+
+			// Remove existing file if it exists
+			os.Remove(targetPath)
+
+			if err := os.Link(linkTarget, targetPath); err != nil {
+				return fmt.Errorf("failed to create hardlink %s: %w", targetPath, err)
+			}
+
 		default:
 			// Skip other types (devices, etc.)
 			continue
 		}
 	}
 
+	return ensureBackendExecutable(outputDir)
+}
+
+// ensureBackendExecutable adds the executable bits to the extracted backend
+// binary, which the installer runs directly. Bundles without a regular
+// backend file are left alone.
+func ensureBackendExecutable(outputDir string) error {
+	backendPath := filepath.Join(outputDir, "backend")
+	info, err := os.Lstat(backendPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat backend: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0111 {
+		return nil
+	}
+	if err := os.Chmod(backendPath, info.Mode().Perm()|0111); err != nil {
+		return fmt.Errorf("failed to make backend executable: %w", err)
+	}
 	return nil
 }
 
+// fileID identifies a file by device and inode.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// isWithinDir reports whether path is dir or lies inside it.
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveExistingPath returns path with the symlinks in its longest
+// existing prefix resolved and the rest appended unchanged.
+func resolveExistingPath(path string) (string, error) {
+	path = filepath.Clean(path)
+	var rest []string
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = parent
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{resolved}, rest...)...), nil
+}
+
 // calculateChecksum calculates the SHA256 checksum of data.
 // Returns the checksum in the format "sha256:hexstring".
 func calculateChecksum(data []byte) string {
@@ -1,20 +1,44 @@
 package selfhost
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/santhosh-tekuri/jsonschema/v6"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/ozanturksever/convex-bundler/pkg/credentials"
+	"github.com/ozanturksever/convex-bundler/pkg/ignore"
+	"github.com/ozanturksever/convex-bundler/pkg/logging"
 	"github.com/ozanturksever/convex-bundler/pkg/manifest"
+	"github.com/ozanturksever/convex-bundler/pkg/platform"
+	"github.com/ozanturksever/convex-bundler/pkg/version"
 )
 
 // Helper function to create a mock bundle directory with all required files
-func createMockBundleDir(t *testing.T, dir string) {
+func createMockBundleDir(t testing.TB, dir string) {
 	t.Helper()
 
 	// Create manifest.json
@@ -46,7 +70,7 @@ func createMockBundleDir(t *testing.T, dir string) {
 }
 
 // Helper function to create a mock ops binary
-func createMockOpsBinary(t *testing.T, path string) {
+func createMockOpsBinary(t testing.TB, path string) {
 	t.Helper()
 	// Create a simple shell script as mock ops binary
 	content := `#!/bin/bash
@@ -149,6 +173,21 @@ func TestHeaderValidation(t *testing.T) {
 			modify:  func(h *Header) { h.CreatedAt = "" },
 			wantErr: "createdAt is required",
 		},
+		{
+			name:    "minimum versions",
+			modify:  func(h *Header) { h.MinOpsVersion, h.MinBackendVersion = "v1.2.0", "0.9.0-rc.1" },
+			wantErr: "",
+		},
+		{
+			name:    "invalid minimum ops version",
+			modify:  func(h *Header) { h.MinOpsVersion = "1.2" },
+			wantErr: "minimum ops version must be a semantic version",
+		},
+		{
+			name:    "invalid minimum backend version",
+			modify:  func(h *Header) { h.MinBackendVersion = "latest" },
+			wantErr: "minimum backend version must be a semantic version",
+		},
 	}
 
 	for _, tt := range tests {
@@ -280,6 +319,224 @@ echo "I am a regular binary"
 	assert.False(t, result.IsSelfHost)
 }
 
+// TestDetectSelfHostMode_CoincidentalOffset tests that a binary whose last 8
+// bytes happen to point at MagicStart-looking bytes is not misdetected
+func TestDetectSelfHostMode_CoincidentalOffset(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var data bytes.Buffer
+	data.WriteString("regular binary prefix")
+	offset := int64(data.Len())
+	data.Write(MagicStart)
+	data.WriteString("more regular binary content, long enough to fill a footer")
+	offsetBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(offsetBytes, uint64(offset))
+	data.Write(offsetBytes)
+
+	path := filepath.Join(tmpDir, "coincidental")
+	require.NoError(t, os.WriteFile(path, data.Bytes(), 0755))
+
+	result, err := DetectSelfHostModeFromFile(path)
+	require.NoError(t, err)
+	assert.False(t, result.IsSelfHost)
+}
+
+// TestDetectSelfHostMode_FooterMagicRequired tests that a valid offset without
+// the footer magic is not accepted by the footer lookup, while the same layout
+// with it is
+func TestDetectSelfHostMode_FooterMagicRequired(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var data bytes.Buffer
+	data.WriteString("ops binary")
+	offset := int64(data.Len())
+	data.Write(MagicStart)
+	_, err := WriteHeader(&data, NewHeader())
+	require.NoError(t, err)
+	data.WriteString("payload")
+	data.Write(MagicEnd)
+
+	withoutMagic := append(bytes.Clone(data.Bytes()), make([]byte, MagicFooterLen+FooterVersionSize)...)
+	offsetBytes := make([]byte, FooterOffsetSize)
+	binary.LittleEndian.PutUint64(offsetBytes, uint64(offset))
+	withoutMagic = append(withoutMagic, offsetBytes...)
+
+	// The intact markers and header are still found by recovery
+	path := filepath.Join(tmpDir, "no-footer-magic")
+	require.NoError(t, os.WriteFile(path, withoutMagic, 0755))
+	result, err := DetectSelfHostModeFromFile(path)
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+	assert.True(t, result.Recovered)
+	assert.Equal(t, offset, result.Offset)
+
+	withMagic := append(bytes.Clone(data.Bytes()), encodeFooter(offset)...)
+	path = filepath.Join(tmpDir, "footer-magic")
+	require.NoError(t, os.WriteFile(path, withMagic, 0755))
+	result, err = DetectSelfHostModeFromFile(path)
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+	assert.False(t, result.Recovered)
+	assert.Equal(t, offset, result.Offset)
+}
+
+// TestDetectSelfHostMode_MarkerInOpsBinary tests that marker bytes inside an
+// ops binary are never mistaken for the bundle section
+func TestDetectSelfHostMode_MarkerInOpsBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// An ops binary carrying both markers in its own data, as a binary that
+	// embeds these constants would
+	var ops bytes.Buffer
+	ops.WriteString("#!/bin/bash\necho \"mock convex-backend-ops\"\nexit 0\n")
+	markerOffset := int64(ops.Len())
+	ops.Write(MagicStart)
+	ops.WriteString("not a header")
+	ops.Write(MagicEnd)
+
+	// Not self-host, even with a valid-looking footer pointing at the marker
+	plain := append(bytes.Clone(ops.Bytes()), encodeFooter(markerOffset)...)
+	plainPath := filepath.Join(tmpDir, "plain")
+	require.NoError(t, os.WriteFile(plainPath, plain, 0755))
+	result, err := DetectSelfHostModeFromFile(plainPath)
+	require.NoError(t, err)
+	assert.False(t, result.IsSelfHost)
+	_, err = ReadHeaderFromExecutable(plainPath)
+	assert.Error(t, err)
+
+	// A real executable built on it is found at its own start marker
+	opsBinary := filepath.Join(tmpDir, "ops")
+	require.NoError(t, os.WriteFile(opsBinary, ops.Bytes(), 0755))
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	result, err = DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+	assert.Equal(t, int64(ops.Len()), result.Offset)
+
+	verifyResult, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.True(t, verifyResult.Valid)
+
+	// Pointing the footer at the ops binary's marker is rejected, since the
+	// bytes there do not parse as a header; recovery finds the real section
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	copy(data[len(data)-FooterSize:], encodeFooter(markerOffset))
+	require.NoError(t, os.WriteFile(executablePath, data, 0755))
+	result, err = DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+	assert.True(t, result.Recovered)
+	assert.Equal(t, int64(ops.Len()), result.Offset)
+}
+
+// TestDetectSelfHostMode_Recovery tests that a bundle whose footer is followed
+// by junk or damaged is found by scanning, while a clean file uses the footer
+func TestDetectSelfHostMode_Recovery(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+	original, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+
+	clean, err := DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	require.True(t, clean.IsSelfHost)
+	assert.False(t, clean.Recovered)
+	assert.Equal(t, int64(len(original)), clean.Size)
+
+	damagedFooter := bytes.Clone(original)
+	copy(damagedFooter[len(damagedFooter)-FooterSize:], bytes.Repeat([]byte{0xff}, FooterSize))
+	cases := map[string][]byte{
+		"trailing newline": append(bytes.Clone(original), '\n'),
+		"trailing junk":    append(bytes.Clone(original), bytes.Repeat([]byte("junk"), 1000)...),
+		"damaged footer":   damagedFooter,
+	}
+	for name, data := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, strings.ReplaceAll(name, " ", "-"))
+			require.NoError(t, os.WriteFile(path, data, 0755))
+
+			result, err := DetectSelfHostModeFromFile(path)
+			require.NoError(t, err)
+			assert.True(t, result.IsSelfHost)
+			assert.True(t, result.Recovered)
+			assert.Equal(t, clean.Offset, result.Offset)
+			assert.Equal(t, int64(len(original)), result.Size)
+
+			verifyResult, err := Verify(path)
+			require.NoError(t, err)
+			assert.True(t, verifyResult.Valid)
+
+			var logs bytes.Buffer
+			_, err = Extract(ExtractOptions{
+				ExecutablePath: path,
+				OutputDir:      filepath.Join(tmpDir, "extracted-"+strings.ReplaceAll(name, " ", "-")),
+				Logger:         logging.New(&logs, logging.LevelWarn),
+			})
+			require.NoError(t, err)
+			assert.Contains(t, logs.String(), "recovery mode")
+		})
+	}
+
+	// Junk alone is not mistaken for a bundle
+	path := filepath.Join(tmpDir, "junk")
+	require.NoError(t, os.WriteFile(path, append(bytes.Repeat([]byte("junk"), 1000), MagicEnd...), 0755))
+	result, err := DetectSelfHostModeFromFile(path)
+	require.NoError(t, err)
+	assert.False(t, result.IsSelfHost)
+}
+
+// TestDetectSelfHostMode_FooterVersion tests that created executables carry a v1 footer
+func TestDetectSelfHostMode_FooterVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	result, err := DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+	assert.Equal(t, uint32(1), result.FooterVersion)
+
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	footer := data[len(data)-FooterSize:]
+	assert.Equal(t, MagicFooter, footer[:MagicFooterLen])
+	assert.Equal(t, uint32(1), binary.LittleEndian.Uint32(footer[MagicFooterLen:]))
+}
+
+// TestDetectSelfHostMode_FutureFooterVersion tests that footers written by a
+// newer bundler are rejected with a clear error
+func TestDetectSelfHostMode_FutureFooterVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	binary.LittleEndian.PutUint32(data[len(data)-FooterSize+MagicFooterLen:], FooterVersion+1)
+	require.NoError(t, os.WriteFile(executablePath, data, 0755))
+
+	_, err = DetectSelfHostModeFromFile(executablePath)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrUnsupportedFooterVersion)
+	assert.Contains(t, err.Error(), "created by a newer bundler")
+
+	_, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      filepath.Join(tmpDir, "extracted"),
+	})
+	assert.ErrorIs(t, err, ErrUnsupportedFooterVersion)
+}
+
 // TestDetectSelfHostMode_SelfHostBinary tests that a self-host binary is correctly detected
 func TestDetectSelfHostMode_SelfHostBinary(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -393,6 +650,134 @@ func TestVerify_ChecksumMatch(t *testing.T) {
 	assert.Equal(t, result.ExpectedChecksum, result.ActualChecksum)
 }
 
+// TestCreate_ChecksumAlgorithms tests that each checksum algorithm is recorded
+// in the header and selected from its prefix when verifying and extracting
+func TestCreate_ChecksumAlgorithms(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	tests := []struct {
+		algorithm string
+		hexLen    int
+		version   string
+	}{
+		{algorithm: ChecksumSHA256, hexLen: 64, version: HeaderVersion},
+		{algorithm: ChecksumSHA512, hexLen: 128, version: ChecksumHeaderVersion},
+		{algorithm: ChecksumBLAKE3, hexLen: 64, version: ChecksumHeaderVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			executablePath := filepath.Join(tmpDir, "selfhost-"+tt.algorithm)
+			require.NoError(t, Create(CreateOptions{
+				BundleDir:         bundleDir,
+				OpsBinary:         opsBinary,
+				OutputPath:        executablePath,
+				Platform:          "linux-x64",
+				ChecksumAlgorithm: tt.algorithm,
+			}))
+
+			header, err := ReadHeaderFromExecutable(executablePath)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(header.BundleChecksum, tt.algorithm+":"), header.BundleChecksum)
+			assert.Len(t, header.BundleChecksum, len(tt.algorithm)+1+tt.hexLen)
+			assert.Equal(t, tt.version, header.Version)
+
+			result, err := Verify(executablePath)
+			require.NoError(t, err)
+			assert.True(t, result.Valid)
+			result, err = VerifyWithOptions(executablePath, VerifyOptions{Deep: true})
+			require.NoError(t, err)
+			assert.True(t, result.Valid)
+
+			_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "extracted-"+tt.algorithm)})
+			require.NoError(t, err)
+
+			// Repacking keeps the algorithm
+			require.NoError(t, Repack(executablePath, CompressionBrotli))
+			header, err = ReadHeaderFromExecutable(executablePath)
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(header.BundleChecksum, tt.algorithm+":"), header.BundleChecksum)
+			result, err = Verify(executablePath)
+			require.NoError(t, err)
+			assert.True(t, result.Valid)
+		})
+	}
+
+	err := Create(CreateOptions{
+		BundleDir:         bundleDir,
+		OpsBinary:         opsBinary,
+		OutputPath:        filepath.Join(tmpDir, "selfhost-md5"),
+		Platform:          "linux-x64",
+		ChecksumAlgorithm: "md5",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported checksum algorithm: md5")
+}
+
+func TestCalculateChecksumWith_BLAKE3(t *testing.T) {
+	// Test vectors from the BLAKE3 reference implementation
+	empty, err := calculateChecksumWith(ChecksumBLAKE3, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "blake3:af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262", empty)
+	abc, err := calculateChecksumWith(ChecksumBLAKE3, []byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, "blake3:6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", abc)
+
+	assert.NoError(t, verifyChecksum(abc, []byte("abc")))
+	assert.Error(t, verifyChecksum(abc, []byte("abd")))
+}
+
+// TestVerify_ChecksumPrefixMismatch tests a header whose checksum prefix does
+// not match the algorithm the checksum was calculated with
+func TestVerify_ChecksumPrefixMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	// Relabel the SHA256 checksum as SHA512: the data is hashed with SHA512
+	// and no longer matches
+	result, header, compressedData, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	relabeled := *header
+	relabeled.BundleChecksum = ChecksumSHA512 + strings.TrimPrefix(header.BundleChecksum, ChecksumSHA256)
+	require.NoError(t, rewriteBundleSection(executablePath, result.Offset, &relabeled, compressedData))
+
+	verifyResult, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.False(t, verifyResult.Valid)
+	assert.True(t, strings.HasPrefix(verifyResult.ActualChecksum, ChecksumSHA512+":"))
+
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "extracted")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+
+	// An unknown algorithm prefix makes the header invalid
+	unknown := *header
+	unknown.BundleChecksum = "md5:" + strings.TrimPrefix(header.BundleChecksum, ChecksumSHA256+":")
+	err = unknown.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported bundle checksum algorithm "md5"`)
+}
+
 // TestVerify_ChecksumMismatch tests that verification fails for a corrupted executable
 func TestVerify_ChecksumMismatch(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -677,6 +1062,7 @@ func TestPlatformCompatibility(t *testing.T) {
 	// Get current host platform
 	hostPlatform := getHostPlatform()
 	assert.NotEmpty(t, hostPlatform)
+	assert.Equal(t, platform.Host(), hostPlatform)
 
 	// Matching platform should succeed
 	err := CheckPlatformCompatibility(hostPlatform)
@@ -689,10 +1075,116 @@ func TestPlatformCompatibility(t *testing.T) {
 	assert.Contains(t, err.Error(), "platform mismatch")
 }
 
+// TestCheckVersionCompatibility tests the minimum ops and backend version checks
+func TestCheckVersionCompatibility(t *testing.T) {
+	header := &Header{MinOpsVersion: "1.2.0", MinBackendVersion: "2.0.0-beta.2"}
+
+	for _, actual := range []string{"1.2.0", "v1.2.0", "1.2.1", "1.3.0-rc.1", "2.0.0"} {
+		assert.NoError(t, CheckVersionCompatibility(header, actual), actual)
+	}
+	for _, actual := range []string{"1.1.9", "1.2.0-rc.1", "0.9.0"} {
+		err := CheckVersionCompatibility(header, actual)
+		require.Error(t, err, actual)
+		assert.ErrorIs(t, err, ErrIncompatibleVersion)
+		assert.Contains(t, err.Error(), "ops version "+actual+" is older than the minimum 1.2.0")
+	}
+
+	require.NoError(t, CheckBackendVersionCompatibility(header, "2.0.0-beta.2"))
+	require.NoError(t, CheckBackendVersionCompatibility(header, "2.0.0-beta.10"))
+	err := CheckBackendVersionCompatibility(header, "2.0.0-alpha")
+	assert.ErrorIs(t, err, ErrIncompatibleVersion)
+
+	// Versions that cannot be compared are rejected, but not as too old
+	err = CheckVersionCompatibility(header, "dev")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrIncompatibleVersion)
+
+	// Headers without a minimum accept any version
+	assert.NoError(t, CheckVersionCompatibility(&Header{}, "dev"))
+	assert.NoError(t, CheckBackendVersionCompatibility(&Header{}, ""))
+}
+
+// TestCreate_MinVersions tests that minimum versions are validated and recorded in the header
+func TestCreate_MinVersions(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	opts := CreateOptions{
+		BundleDir:         bundleDir,
+		OpsBinary:         opsBinary,
+		OutputPath:        filepath.Join(tmpDir, "selfhost"),
+		Platform:          "linux-x64",
+		MinOpsVersion:     "1.4.0",
+		MinBackendVersion: "v0.5.0",
+	}
+	require.NoError(t, Create(opts))
+
+	header, err := ReadHeaderFromExecutable(opts.OutputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "1.4.0", header.MinOpsVersion)
+	assert.Equal(t, "v0.5.0", header.MinBackendVersion)
+
+	opts.OutputPath = filepath.Join(tmpDir, "invalid")
+	opts.MinOpsVersion = "1.4"
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "minimum ops version must be a semantic version")
+	assert.NoFileExists(t, opts.OutputPath)
+}
+
+// TestCreate_OpsVersion tests that the ops version must be semver when set
+func TestCreate_OpsVersion(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	opts := CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: filepath.Join(tmpDir, "selfhost"),
+		Platform:   "linux-x64",
+		OpsVersion: "v1.4.0-rc.2",
+	}
+	require.NoError(t, Create(opts))
+	header, err := ReadHeaderFromExecutable(opts.OutputPath)
+	require.NoError(t, err)
+	ops, err := header.OpsSemver()
+	require.NoError(t, err)
+	assert.Equal(t, version.Semver{Major: 1, Minor: 4, Patch: 0, Prerelease: "rc.2"}, ops)
+
+	// Empty stays allowed
+	opts.OutputPath = filepath.Join(tmpDir, "empty")
+	opts.OpsVersion = ""
+	require.NoError(t, Create(opts))
+	header, err = ReadHeaderFromExecutable(opts.OutputPath)
+	require.NoError(t, err)
+	_, err = header.OpsSemver()
+	assert.ErrorContains(t, err, "no ops version")
+
+	opts.OutputPath = filepath.Join(tmpDir, "invalid")
+	opts.OpsVersion = "nightly"
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ops version must be a semantic version")
+	assert.NoFileExists(t, opts.OutputPath)
+
+	// Headers from older bundlers may hold free-form versions
+	_, err = (&Header{OpsVersion: "nightly"}).OpsSemver()
+	assert.ErrorContains(t, err, "invalid semantic version")
+}
+
 // TestMagicMarkerLengths verifies magic marker constants have correct lengths
 func TestMagicMarkerLengths(t *testing.T) {
 	assert.Equal(t, MagicStartLen, len(MagicStart), "MagicStart should be %d bytes", MagicStartLen)
 	assert.Equal(t, MagicEndLen, len(MagicEnd), "MagicEnd should be %d bytes", MagicEndLen)
+	assert.Equal(t, MagicFooterLen, len(MagicFooter), "MagicFooter should be %d bytes", MagicFooterLen)
 }
 
 // TestCalculateChecksum tests checksum calculation
@@ -902,6 +1394,7 @@ func TestManifestParsing(t *testing.T) {
 		Version:  "3.2.1",
 		Apps:     []string{"./app1", "./app2", "./app3"},
 		Platform: "linux-arm64",
+		Labels:   map[string]string{"git.branch": "main"},
 	})
 	manifestData, err := mf.ToJSON()
 	require.NoError(t, err)
@@ -934,6 +1427,7 @@ func TestManifestParsing(t *testing.T) {
 	assert.Equal(t, "linux-arm64", header.Manifest.Platform)
 	assert.Len(t, header.Manifest.Apps, 3)
 	assert.Equal(t, []string{"./app1", "./app2", "./app3"}, header.Manifest.Apps)
+	assert.Equal(t, map[string]string{"git.branch": "main"}, header.Manifest.Labels)
 }
 
 // TestNewHeader tests the NewHeader constructor
@@ -997,3 +1491,3197 @@ func BenchmarkCreate(b *testing.B) {
 		})
 	}
 }
+
+// cancelAfterContext reports cancellation once Err has been called more than
+// n times, letting tests cancel deterministically part way through a copy.
+type cancelAfterContext struct {
+	context.Context
+	n     int
+	calls int
+}
+
+func (c *cancelAfterContext) Err() error {
+	c.calls++
+	if c.calls > c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+// createTestExecutable builds a self-extracting executable from a mock bundle
+func createTestExecutable(t *testing.T, tmpDir string) string {
+	t.Helper()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+	return executablePath
+}
+
+// TestCreateContext_Cancelled tests that a cancelled create leaves no output file
+func TestCreateContext_Cancelled(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	for _, n := range []int{0, 3, 8} {
+		outputPath := filepath.Join(tmpDir, "selfhost")
+		err := CreateContext(&cancelAfterContext{Context: context.Background(), n: n}, CreateOptions{
+			BundleDir:  bundleDir,
+			OpsBinary:  opsBinary,
+			OutputPath: outputPath,
+			Platform:   "linux-x64",
+		})
+		require.ErrorIs(t, err, context.Canceled, "cancel after %d checks", n)
+		assert.NoFileExists(t, outputPath)
+	}
+}
+
+// TestExtractContext_CancelledRemovesCreatedDir tests that cancelling
+// mid-extraction removes an output directory created for the extraction
+func TestExtractContext_CancelledRemovesCreatedDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err := ExtractContext(&cancelAfterContext{Context: context.Background(), n: 4}, ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.NoDirExists(t, extractDir)
+}
+
+// TestExtractContext_CancelledMarksExistingDir tests that cancelling
+// mid-extraction into an existing directory marks it incomplete
+func TestExtractContext_CancelledMarksExistingDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	require.NoError(t, os.MkdirAll(extractDir, 0755))
+
+	_, err := ExtractContext(&cancelAfterContext{Context: context.Background(), n: 4}, ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	assert.FileExists(t, filepath.Join(extractDir, IncompleteMarker))
+}
+
+// TestExtractContext_Completes tests that an uncancelled context extracts normally
+func TestExtractContext_Completes(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err := ExtractContext(context.Background(), ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+	})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+	assert.NoFileExists(t, filepath.Join(extractDir, IncompleteMarker))
+}
+
+// TestCreateExtract_Brotli tests a round trip through a brotli-compressed executable
+func TestCreateExtract_Brotli(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   opsBinary,
+		OutputPath:  executablePath,
+		Platform:    "linux-x64",
+		Compression: CompressionBrotli,
+	}))
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, CompressionBrotli, header.Compression)
+	assert.Equal(t, "1.1.0", header.Version)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+	})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+
+	for _, name := range []string{"backend", "convex.db", "credentials.json", "storage/test-file.txt"} {
+		original, err := os.ReadFile(filepath.Join(bundleDir, name))
+		require.NoError(t, err)
+		extracted, err := os.ReadFile(filepath.Join(extractDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, original, extracted, name)
+	}
+}
+
+// TestCreateExtract_Zstd tests a round trip through a zstd-compressed executable
+func TestCreateExtract_Zstd(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   opsBinary,
+		OutputPath:  executablePath,
+		Platform:    "linux-x64",
+		Compression: CompressionZstd,
+	}))
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, CompressionZstd, header.Compression)
+	assert.Equal(t, HeaderVersion, header.Version)
+	assert.Empty(t, header.ZstdDictionary)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+	})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+
+	for _, name := range []string{"backend", "convex.db", "credentials.json", "storage/test-file.txt"} {
+		original, err := os.ReadFile(filepath.Join(bundleDir, name))
+		require.NoError(t, err)
+		extracted, err := os.ReadFile(filepath.Join(extractDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, original, extracted, name)
+	}
+}
+
+// createSimilarFilesBundleDir creates a mock bundle whose storage holds many
+// small JSON documents sharing their structure, the case zstd dictionaries
+// are meant for
+func createSimilarFilesBundleDir(t *testing.T, dir string) {
+	t.Helper()
+	createMockBundleDir(t, dir)
+	for i := range 120 {
+		doc := fmt.Sprintf(`{"_id":"k57%04dxq8v3m2n1p0","_creationTime":17000%05d.123,"kind":"invoice","customer":{"name":"Customer %d","email":"customer%d@example.com","tier":"standard"},"lines":[{"sku":"SKU-%03d","quantity":%d,"unitPrice":%d.99,"currency":"EUR"}],"status":"paid","notes":"Thank you for your business."}`, i, i*37, i, i, i%50, i%7+1, i%90+10)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "storage", fmt.Sprintf("doc-%04d.json", i)), []byte(doc), 0644))
+	}
+}
+
+// TestCreateExtract_ZstdDictionary tests that a dictionary-compressed bundle
+// round-trips, records the dictionary in the header and is smaller than
+// without the dictionary
+func TestCreateExtract_ZstdDictionary(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSimilarFilesBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	dictionary, err := TrainDictionary(bundleDir)
+	require.NoError(t, err)
+	require.NotEmpty(t, dictionary)
+
+	plainPath := filepath.Join(tmpDir, "plain")
+	require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: plainPath, Platform: "linux-x64", Compression: CompressionZstd}))
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:      bundleDir,
+		OpsBinary:      opsBinary,
+		OutputPath:     executablePath,
+		Platform:       "linux-x64",
+		Compression:    CompressionZstd,
+		ZstdDictionary: dictionary,
+	}))
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, dictionary, header.ZstdDictionary)
+	assert.Equal(t, ZstdDictionaryHeaderVersion, header.Version)
+
+	// The header carries the dictionary, so compare the compressed bundles
+	_, plainHeader, plainData, err := readEmbeddedBundle(plainPath)
+	require.NoError(t, err)
+	assert.Empty(t, plainHeader.ZstdDictionary)
+	_, _, dictData, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	assert.Less(t, len(dictData), len(plainData))
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	for _, name := range []string{"backend", "convex.db", "credentials.json", "storage/doc-0000.json", "storage/doc-0119.json"} {
+		original, err := os.ReadFile(filepath.Join(bundleDir, name))
+		require.NoError(t, err)
+		extracted, err := os.ReadFile(filepath.Join(extractDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, original, extracted, name)
+	}
+
+	fsys, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+	doc, err := fs.ReadFile(fsys, "storage/doc-0042.json")
+	require.NoError(t, err)
+	assert.Contains(t, string(doc), "Customer 42")
+
+	// Without the dictionary the data cannot be decompressed
+	err = extractCompressedTar(context.Background(), dictData, t.TempDir(), CompressionZstd, nil, extractLimits{})
+	assert.Error(t, err)
+
+	// Installers predating dictionaries must reject the bundle
+	err = checkHeaderVersion(header, EncryptedCredentialsHeaderVersion)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "created by a newer bundler")
+}
+
+// TestCreate_ZstdDictionaryValidation tests that dictionaries are only
+// accepted with zstd compression and must be valid
+func TestCreate_ZstdDictionaryValidation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSimilarFilesBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	dictionary, err := TrainDictionary(bundleDir)
+	require.NoError(t, err)
+
+	opts := CreateOptions{
+		BundleDir:      bundleDir,
+		OpsBinary:      opsBinary,
+		OutputPath:     filepath.Join(tmpDir, "selfhost"),
+		Platform:       "linux-x64",
+		Compression:    CompressionGzip,
+		ZstdDictionary: dictionary,
+	}
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "zstd dictionary requires")
+
+	opts.Compression = CompressionZstd
+	opts.ZstdDictionary = []byte("not a dictionary")
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid zstd dictionary")
+
+	opts.ZstdDictionary = make([]byte, MaxZstdDictionarySize+1)
+	err = Create(opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "larger than the maximum")
+
+	// With auto compression, only a zstd bundle keeps the dictionary
+	opts.Compression = CompressionAuto
+	opts.ZstdDictionary = dictionary
+	info, err := CreateWithInfo(context.Background(), opts)
+	require.NoError(t, err)
+	if info.Header.Compression == CompressionZstd {
+		assert.Equal(t, dictionary, info.Header.ZstdDictionary)
+	} else {
+		assert.Empty(t, info.Header.ZstdDictionary)
+	}
+}
+
+// TestTrainDictionary tests that training skips credentials and needs files
+func TestTrainDictionary(t *testing.T) {
+	bundleDir := t.TempDir()
+	createSimilarFilesBundleDir(t, bundleDir)
+	secret := strings.Repeat("s3cr3t", 20)
+	creds := &credentials.Credentials{AdminKey: secret, InstanceSecret: strings.Repeat("ab", 32)}
+	credsData, err := creds.ToJSON()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "credentials.json"), credsData, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "convex.env"), []byte("CONVEX_ADMIN_KEY="+secret+"\n"), 0600))
+
+	dictionary, err := TrainDictionary(bundleDir)
+	require.NoError(t, err)
+	assert.NoError(t, validateZstdDictionary(dictionary))
+	assert.NotContains(t, string(dictionary), "s3cr3t")
+
+	_, err = TrainDictionary(t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no files to train")
+}
+
+// TestRepack_ZstdDictionary tests that a dictionary is kept while the bundle
+// stays zstd compressed and dropped otherwise
+func TestRepack_ZstdDictionary(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createSimilarFilesBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	dictionary, err := TrainDictionary(bundleDir)
+	require.NoError(t, err)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:      bundleDir,
+		OpsBinary:      opsBinary,
+		OutputPath:     executablePath,
+		Platform:       "linux-x64",
+		Compression:    CompressionZstd,
+		ZstdDictionary: dictionary,
+	}))
+
+	// Rewriting credentials keeps the compression and the dictionary
+	require.NoError(t, ReplaceCredentials(executablePath, &credentials.Credentials{AdminKey: "rotated", InstanceSecret: strings.Repeat("cd", 32)}))
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, dictionary, header.ZstdDictionary)
+	verify, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.True(t, verify.Valid)
+
+	require.NoError(t, Repack(executablePath, CompressionGzip))
+	header, err = ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Empty(t, header.ZstdDictionary)
+	assert.Equal(t, HeaderVersion, header.Version)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	original, err := os.ReadFile(filepath.Join(bundleDir, "storage", "doc-0007.json"))
+	require.NoError(t, err)
+	extracted, err := os.ReadFile(filepath.Join(extractDir, "storage", "doc-0007.json"))
+	require.NoError(t, err)
+	assert.Equal(t, original, extracted)
+}
+
+// TestHeaderVersion_Compression tests that only brotli bundles require the newer header version
+func TestHeaderVersion_Compression(t *testing.T) {
+	assert.Equal(t, "1.0.0", headerVersionFor(CompressionGzip))
+	assert.Equal(t, "1.0.0", headerVersionFor(CompressionZstd))
+	assert.Equal(t, "1.1.0", headerVersionFor(CompressionBrotli))
+}
+
+// TestRequiredHeaderVersion tests that a header gets the version of the newest feature it uses
+func TestRequiredHeaderVersion(t *testing.T) {
+	header := NewHeader()
+	header.BundleChecksum = "sha256:" + strings.Repeat("0", 64)
+	assert.Equal(t, HeaderVersion, requiredHeaderVersion(header))
+
+	header.Compression = CompressionBrotli
+	assert.Equal(t, BrotliHeaderVersion, requiredHeaderVersion(header))
+
+	header.BundleChecksum = "sha512:" + strings.Repeat("0", 128)
+	assert.Equal(t, ChecksumHeaderVersion, requiredHeaderVersion(header))
+
+	header.OpsBinary = &OpsBinaryInfo{}
+	assert.Equal(t, CompressedOpsHeaderVersion, requiredHeaderVersion(header))
+
+	header.CredentialsEncrypted = true
+	assert.Equal(t, EncryptedCredentialsHeaderVersion, requiredHeaderVersion(header))
+
+	header.Compression = CompressionZstd
+	header.ZstdDictionary = []byte{0x37, 0xa4, 0x30, 0xec}
+	assert.Equal(t, ZstdDictionaryHeaderVersion, requiredHeaderVersion(header))
+
+	header.CredentialsOmitted = true
+	assert.Equal(t, OmittedCredentialsHeaderVersion, requiredHeaderVersion(header))
+}
+
+// TestCheckHeaderVersion_OlderReader tests that a reader predating brotli
+// support rejects brotli bundles cleanly but still accepts gzip bundles
+func TestCheckHeaderVersion_OlderReader(t *testing.T) {
+	const preBrotliVersion = "1.0.0"
+
+	brotliHeader := NewHeader()
+	brotliHeader.Compression = CompressionBrotli
+	brotliHeader.Version = headerVersionFor(CompressionBrotli)
+
+	err := checkHeaderVersion(brotliHeader, preBrotliVersion)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "created by a newer bundler")
+	assert.NoError(t, brotliHeader.CheckCompatible())
+
+	gzipHeader := NewHeader()
+	assert.NoError(t, checkHeaderVersion(gzipHeader, preBrotliVersion))
+
+	futureHeader := NewHeader()
+	futureHeader.Version = "2.0.0"
+	assert.Error(t, futureHeader.CheckCompatible())
+
+	futureHeader.Version = "not-a-version"
+	assert.Error(t, futureHeader.CheckCompatible())
+}
+
+// TestCheckHeaderVersion_PrereleaseAndBuild tests that header versions are
+// compared with semantic version precedence
+func TestCheckHeaderVersion_PrereleaseAndBuild(t *testing.T) {
+	header := NewHeader()
+
+	// A prerelease sorts before its release
+	header.Version = "1.1.0-rc.1"
+	assert.NoError(t, checkHeaderVersion(header, "1.1.0"))
+	assert.Error(t, checkHeaderVersion(header, "1.1.0-beta.2"))
+	assert.Error(t, checkHeaderVersion(header, "1.0.0"))
+
+	// Build metadata does not affect precedence
+	header.Version = "1.1.0+build.7"
+	assert.NoError(t, checkHeaderVersion(header, "1.1.0"))
+
+	header.Version = "1.1.0junk"
+	assert.Error(t, checkHeaderVersion(header, "1.1.0"))
+}
+
+// createAutoCompressionExecutable creates an executable with "auto" compression
+// from a mock bundle whose storage holds the given payload
+func createAutoCompressionExecutable(t *testing.T, payload []byte) *BundleInfo {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "storage", "payload.bin"), payload, 0644))
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	info, err := CreateWithInfo(context.Background(), CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   opsBinary,
+		OutputPath:  executablePath,
+		Platform:    "linux-x64",
+		Compression: CompressionAuto,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, info.CompressionDecision)
+
+	// The header records the concrete algorithm, and the bundle extracts
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, info.CompressionDecision.Compression, header.Compression)
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "extracted")})
+	require.NoError(t, err)
+
+	return info
+}
+
+// TestCreateAutoCompression_Compressible tests that highly compressible text picks brotli
+func TestCreateAutoCompression_Compressible(t *testing.T) {
+	payload := bytes.Repeat([]byte("convex storage asset: the quick brown fox jumps over the lazy dog\n"), 20000)
+
+	info := createAutoCompressionExecutable(t, payload)
+	assert.Equal(t, CompressionBrotli, info.CompressionDecision.Compression)
+	assert.Equal(t, CompressionBrotli, info.Header.Compression)
+	assert.Len(t, info.CompressionDecision.Candidates, len(autoCandidates))
+}
+
+// TestCreateAutoCompression_Incompressible tests that random data keeps gzip
+// since no algorithm meaningfully beats it
+func TestCreateAutoCompression_Incompressible(t *testing.T) {
+	payload := make([]byte, 256*1024)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+
+	info := createAutoCompressionExecutable(t, payload)
+	assert.Equal(t, CompressionGzip, info.CompressionDecision.Compression)
+}
+
+// TestChooseCompression_OverBudget tests that slow candidates are excluded
+// while the gzip baseline remains eligible
+func TestChooseCompression_OverBudget(t *testing.T) {
+	bundleDir := t.TempDir()
+	createMockBundleDir(t, bundleDir)
+
+	decision, archive, err := chooseCompression(context.Background(), bundleDir, time.Nanosecond, ChecksumSHA256, archiveOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, CompressionGzip, decision.Compression)
+	assert.NotEmpty(t, archive.data)
+	assert.Greater(t, archive.uncompressedSize, int64(0))
+	for _, c := range decision.Candidates[1:] {
+		assert.True(t, c.OverBudget, c.Compression)
+	}
+}
+
+// TestCompressArchive_StreamedChecksum tests that the checksum computed while
+// compressing matches one recomputed over the finished archive
+func TestCompressArchive_StreamedChecksum(t *testing.T) {
+	bundleDir := t.TempDir()
+	createMockBundleDir(t, bundleDir)
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd, CompressionBrotli} {
+		for _, algorithm := range []string{ChecksumSHA256, ChecksumSHA512, ChecksumBLAKE3} {
+			archive, err := compressArchive(context.Background(), bundleDir, compression, algorithm, archiveOptions{})
+			require.NoError(t, err)
+			recomputed, err := calculateChecksumWith(algorithm, archive.data)
+			require.NoError(t, err)
+			assert.Equal(t, recomputed, archive.checksum, "%s/%s", compression, algorithm)
+		}
+	}
+
+	_, err := compressArchive(context.Background(), bundleDir, CompressionGzip, "md5", archiveOptions{})
+	assert.Error(t, err)
+}
+
+// TestCreate_AutoCompressionStreamedChecksum tests that the header checksum
+// of an auto-compressed executable matches its embedded bytes, before and
+// after repacking
+func TestCreate_AutoCompressionStreamedChecksum(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	_, err := CreateWithInfo(context.Background(), CreateOptions{
+		BundleDir:         bundleDir,
+		OpsBinary:         opsBinary,
+		OutputPath:        executablePath,
+		Platform:          "linux-x64",
+		Compression:       CompressionAuto,
+		ChecksumAlgorithm: ChecksumSHA512,
+	})
+	require.NoError(t, err)
+
+	assertChecksum := func() {
+		t.Helper()
+		_, header, compressedData, err := readEmbeddedBundle(executablePath)
+		require.NoError(t, err)
+		recomputed, err := calculateChecksumWith(ChecksumSHA512, compressedData)
+		require.NoError(t, err)
+		assert.Equal(t, recomputed, header.BundleChecksum)
+	}
+	assertChecksum()
+
+	// Repack to whichever algorithm auto did not choose
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	other := CompressionBrotli
+	if header.Compression == CompressionBrotli {
+		other = CompressionGzip
+	}
+	require.NoError(t, Repack(executablePath, other))
+	assertChecksum()
+}
+
+// TestCreate_ExplicitCompressionIsAuthoritative tests that explicit choices skip selection
+func TestCreate_ExplicitCompressionIsAuthoritative(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	info, err := CreateWithInfo(context.Background(), CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   opsBinary,
+		OutputPath:  filepath.Join(tmpDir, "selfhost"),
+		Platform:    "linux-x64",
+		Compression: CompressionGzip,
+	})
+	require.NoError(t, err)
+	assert.Nil(t, info.CompressionDecision)
+	assert.Equal(t, CompressionGzip, info.Header.Compression)
+}
+
+// TestRepack_GzipToBrotli tests that repacking keeps the ops binary and bundle contents
+func TestRepack_GzipToBrotli(t *testing.T) {
+	testRepackFromGzip(t, CompressionBrotli, BrotliHeaderVersion)
+}
+
+// TestRepack_GzipToZstd tests repacking a gzip bundle with zstd
+func TestRepack_GzipToZstd(t *testing.T) {
+	testRepackFromGzip(t, CompressionZstd, HeaderVersion)
+}
+
+// testRepackFromGzip repacks a gzip executable with compression and checks
+// that the ops binary, metadata and bundle contents are kept
+func testRepackFromGzip(t *testing.T, compression, wantVersion string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+		OpsVersion: "2.0.0",
+	}))
+	before, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+
+	require.NoError(t, Repack(executablePath, compression))
+
+	after, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, compression, after.Compression)
+	assert.Equal(t, wantVersion, after.Version)
+	assert.NotEqual(t, before.BundleChecksum, after.BundleChecksum)
+	assert.Equal(t, before.Manifest, after.Manifest)
+	assert.Equal(t, "2.0.0", after.OpsVersion)
+	assert.Equal(t, before.CreatedAt, after.CreatedAt)
+
+	// Ops binary prefix is preserved
+	opsData, err := os.ReadFile(opsBinary)
+	require.NoError(t, err)
+	repacked, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, opsData, repacked[:len(opsData)])
+
+	verify, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.True(t, verify.Valid)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	for _, name := range []string{"backend", "convex.db", "credentials.json", "manifest.json", "storage/test-file.txt"} {
+		original, err := os.ReadFile(filepath.Join(bundleDir, name))
+		require.NoError(t, err)
+		extracted, err := os.ReadFile(filepath.Join(extractDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, original, extracted, name)
+	}
+}
+
+// TestRepack_FailureLeavesOriginal tests that a failed repack doesn't modify the executable
+func TestRepack_FailureLeavesOriginal(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	// Understate the bundle size, leaving the data and its checksum intact,
+	// so the extraction limit stops the repack after the checksum passes
+	result, header, compressedData, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	header.BundleSize = 1
+	require.NoError(t, rewriteBundleSection(executablePath, result.Offset, header, compressedData))
+
+	original, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+
+	err = Repack(executablePath, CompressionBrotli)
+	require.ErrorIs(t, err, ErrExtractLimitExceeded)
+
+	err = Repack(executablePath, "lz4")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid compression")
+
+	current, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, original, current)
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".repack-")
+	}
+}
+
+// TestRepack_NotSelfHost tests repacking a regular file
+func TestRepack_NotSelfHost(t *testing.T) {
+	regularFile := filepath.Join(t.TempDir(), "regular")
+	require.NoError(t, os.WriteFile(regularFile, []byte("not a selfhost file"), 0644))
+
+	err := Repack(regularFile, CompressionBrotli)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not contain an embedded bundle")
+}
+
+// TestVerify_Sizes tests that Verify reports the on-disk compressed region and ratio
+func TestVerify_Sizes(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	result, err := Verify(executablePath)
+	require.NoError(t, err)
+	require.True(t, result.Valid)
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	headerJSON, err := header.ToJSON()
+	require.NoError(t, err)
+	exeStat, err := os.Stat(executablePath)
+	require.NoError(t, err)
+	opsStat, err := os.Stat(filepath.Join(tmpDir, "ops"))
+	require.NoError(t, err)
+
+	expectedCompressed := exeStat.Size() - opsStat.Size() - MagicStartLen - HeaderLengthSize - int64(len(headerJSON)) - MagicEndLen - FooterSize
+	assert.Equal(t, expectedCompressed, result.CompressedSize)
+	assert.Equal(t, header.BundleSize, result.UncompressedSize)
+	assert.InDelta(t, float64(result.CompressedSize)/float64(result.UncompressedSize), result.CompressionRatio, 1e-9)
+	assert.Greater(t, result.CompressionRatio, 0.0)
+}
+
+// TestVerifyWithOptions_DeepCorruptRegion tests that deep verification reports
+// which region of the executable was corrupted
+func TestVerifyWithOptions_DeepCorruptRegion(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+	original, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	detect, err := DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	headerStart := int(detect.Offset) + MagicStartLen + HeaderLengthSize
+	footerStart := len(original) - FooterSize
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		region  string
+	}{
+		{
+			name: "ops grown",
+			corrupt: func(data []byte) []byte {
+				return append([]byte("extra"), data...)
+			},
+			region: RegionOps,
+		},
+		{
+			name: "ops shrunk",
+			corrupt: func(data []byte) []byte {
+				return data[3:]
+			},
+			region: RegionOps,
+		},
+		{
+			name: "start marker",
+			corrupt: func(data []byte) []byte {
+				data[detect.Offset] ^= 0xFF
+				return data
+			},
+			region: RegionHeader,
+		},
+		{
+			name: "header json",
+			corrupt: func(data []byte) []byte {
+				data[headerStart] = '['
+				return data
+			},
+			region: RegionHeader,
+		},
+		{
+			name: "compressed data",
+			corrupt: func(data []byte) []byte {
+				data[footerStart-MagicEndLen-10] ^= 0xFF
+				return data
+			},
+			region: RegionBundle,
+		},
+		{
+			name: "end marker",
+			corrupt: func(data []byte) []byte {
+				data[footerStart-MagicEndLen] ^= 0xFF
+				return data
+			},
+			region: RegionFooter,
+		},
+		{
+			name: "footer magic",
+			corrupt: func(data []byte) []byte {
+				data[footerStart] ^= 0xFF
+				return data
+			},
+			region: RegionFooter,
+		},
+		{
+			name: "footer offset",
+			corrupt: func(data []byte) []byte {
+				data[len(data)-1] = 0x7F
+				return data
+			},
+			region: RegionFooter,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.corrupt(bytes.Clone(original))
+			path := filepath.Join(t.TempDir(), "selfhost")
+			require.NoError(t, os.WriteFile(path, data, 0755))
+
+			result, err := VerifyWithOptions(path, VerifyOptions{Deep: true})
+			require.NoError(t, err)
+			assert.False(t, result.Valid)
+			assert.Equal(t, tt.region, result.CorruptRegion)
+		})
+	}
+}
+
+// TestVerifyWithOptions_DeepIntact tests that deep verification of an intact
+// executable matches the regular verification
+func TestVerifyWithOptions_DeepIntact(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	expected, err := Verify(executablePath)
+	require.NoError(t, err)
+	result, err := VerifyWithOptions(executablePath, VerifyOptions{Deep: true})
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Empty(t, result.CorruptRegion)
+	assert.Equal(t, expected, result)
+
+	regularFile := filepath.Join(tmpDir, "ops")
+	_, err = VerifyWithOptions(regularFile, VerifyOptions{Deep: true})
+	assert.Error(t, err)
+}
+
+// TestCreateExtract_Hardlinks tests that hardlinked storage files round-trip as links
+func TestCreateExtract_Hardlinks(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("hardlink detection is tested on Linux")
+	}
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	blob := bytes.Repeat([]byte("deduplicated blob "), 4096)
+	original := filepath.Join(bundleDir, "storage", "blob-a")
+	require.NoError(t, os.WriteFile(original, blob, 0644))
+	require.NoError(t, os.Link(original, filepath.Join(bundleDir, "storage", "blob-b")))
+
+	// The archive stores the second name as a link rather than a second copy
+	var withLinks bytes.Buffer
+	size, err := createCompressedTar(context.Background(), &withLinks, bundleDir, CompressionGzip, archiveOptions{})
+	require.NoError(t, err)
+	assert.Less(t, size, int64(2*len(blob)))
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+
+	infoA, err := os.Stat(filepath.Join(extractDir, "storage", "blob-a"))
+	require.NoError(t, err)
+	infoB, err := os.Stat(filepath.Join(extractDir, "storage", "blob-b"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(infoA, infoB), "extracted files should be hardlinked")
+
+	extracted, err := os.ReadFile(filepath.Join(extractDir, "storage", "blob-b"))
+	require.NoError(t, err)
+	assert.Equal(t, blob, extracted)
+}
+
+// TestExtractCompressedTar_HardlinkOutsideOutputDir tests that hardlinks
+// pointing outside the output directory are rejected
+func TestExtractCompressedTar_HardlinkOutsideOutputDir(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "storage/escape",
+		Typeflag: tar.TypeLink,
+		Linkname: "../../etc/passwd",
+		Mode:     0644,
+	}))
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	err := extractCompressedTar(context.Background(), buf.Bytes(), outputDir, CompressionGzip, nil, extractLimits{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid hardlink target")
+	assert.NoFileExists(t, filepath.Join(outputDir, "storage", "escape"))
+}
+
+// TestExtractCompressedTar_LinksThroughSymlinks tests that entries cannot
+// reach outside the output directory through a symlink extracted earlier
+func TestExtractCompressedTar_LinksThroughSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "passwd")
+	require.NoError(t, os.WriteFile(secret, []byte("secret"), 0644))
+
+	tests := []struct {
+		name  string
+		entry tar.Header
+		want  string
+	}{
+		{name: "hardlink target", entry: tar.Header{Name: "x", Typeflag: tar.TypeLink, Linkname: "evil/passwd"}, want: "invalid hardlink target"},
+		{name: "hardlink path", entry: tar.Header{Name: "evil/x", Typeflag: tar.TypeLink, Linkname: "storage/a"}, want: "crosses a symlink"},
+		{name: "file", entry: tar.Header{Name: "evil/passwd", Typeflag: tar.TypeReg}, want: "crosses a symlink"},
+		{name: "symlink", entry: tar.Header{Name: "evil/link", Typeflag: tar.TypeSymlink, Linkname: "/"}, want: "crosses a symlink"},
+		{name: "directory", entry: tar.Header{Name: "evil/dir", Typeflag: tar.TypeDir}, want: "crosses a symlink"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			tw := tar.NewWriter(gz)
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: "storage/a", Typeflag: tar.TypeReg, Mode: 0644}))
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside}))
+			entry := tt.entry
+			entry.Mode = 0644
+			require.NoError(t, tw.WriteHeader(&entry))
+			require.NoError(t, tw.Close())
+			require.NoError(t, gz.Close())
+
+			outputDir := filepath.Join(t.TempDir(), "out")
+			err := extractCompressedTar(context.Background(), buf.Bytes(), outputDir, CompressionGzip, nil, extractLimits{})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+
+			assert.NoFileExists(t, filepath.Join(outputDir, "x"))
+			entries, err := os.ReadDir(outside)
+			require.NoError(t, err)
+			assert.Len(t, entries, 1, "nothing should be created outside the output directory")
+			content, err := os.ReadFile(secret)
+			require.NoError(t, err)
+			assert.Equal(t, "secret", string(content))
+		})
+	}
+}
+
+// replaceEmbeddedArchive swaps the archive embedded in executablePath for a
+// gzip tar written by build, keeping the rest of the header and updating its
+// checksum so the tampered bundle still verifies
+func replaceEmbeddedArchive(t *testing.T, executablePath string, build func(tw *tar.Writer)) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	build(tw)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	result, header, _, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	tampered := *header
+	tampered.Compression = CompressionGzip
+	tampered.BundleChecksum, err = calculateChecksumWith(checksumAlgorithm(header.BundleChecksum), buf.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, rewriteBundleSection(executablePath, result.Offset, &tampered, buf.Bytes()))
+}
+
+// TestExtract_MaxExtractedSize tests that an archive decompressing far beyond
+// its recorded size is stopped and cleaned up
+func TestExtract_MaxExtractedSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+
+	// Compresses to a few kilobytes but expands to 4 MiB
+	bomb := make([]byte, 4<<20)
+	replaceEmbeddedArchive(t, executablePath, func(tw *tar.Writer) {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "manifest.json", Typeflag: tar.TypeReg, Mode: 0644, Size: 2}))
+		_, err := tw.Write([]byte("{}"))
+		require.NoError(t, err)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: "storage/bomb", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(bomb))}))
+		_, err = tw.Write(bomb)
+		require.NoError(t, err)
+	})
+	require.Less(t, 2*header.BundleSize, int64(len(bomb)))
+
+	// The default limit is derived from the header's BundleSize
+	outputDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: outputDir})
+	require.ErrorIs(t, err, ErrExtractLimitExceeded)
+	assert.Contains(t, err.Error(), "exceed")
+	assert.NoDirExists(t, outputDir)
+
+	// A pre-existing output directory is kept and marked incomplete
+	existingDir := filepath.Join(tmpDir, "existing")
+	require.NoError(t, os.MkdirAll(existingDir, 0755))
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: existingDir, MaxExtractedSize: 1 << 20})
+	require.ErrorIs(t, err, ErrExtractLimitExceeded)
+	assert.FileExists(t, filepath.Join(existingDir, IncompleteMarker))
+	assert.NoFileExists(t, filepath.Join(existingDir, "storage", "bomb"))
+
+	// Atomic extraction leaves nothing behind
+	atomicDir := filepath.Join(tmpDir, "atomic")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: atomicDir, Atomic: true})
+	require.ErrorIs(t, err, ErrExtractLimitExceeded)
+	assert.NoDirExists(t, atomicDir)
+	leftovers, err := filepath.Glob(filepath.Join(tmpDir, ".atomic.extract-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers)
+
+	// Raising or disabling the limit allows the archive
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "raised"), MaxExtractedSize: 8 << 20})
+	require.NoError(t, err)
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "unlimited"), MaxExtractedSize: -1})
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(tmpDir, "unlimited", "storage", "bomb"))
+}
+
+// TestExtract_MaxEntries tests that an archive with too many entries is
+// stopped and cleaned up
+func TestExtract_MaxEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	replaceEmbeddedArchive(t, executablePath, func(tw *tar.Writer) {
+		for i := 0; i < 50; i++ {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("storage/dir%02d/", i), Typeflag: tar.TypeDir, Mode: 0755}))
+		}
+	})
+
+	outputDir := filepath.Join(tmpDir, "extracted")
+	_, err := Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: outputDir, MaxEntries: 10})
+	require.ErrorIs(t, err, ErrExtractLimitExceeded)
+	assert.Contains(t, err.Error(), "more than 10 entries")
+	assert.NoDirExists(t, outputDir)
+
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: outputDir, MaxEntries: 50})
+	require.NoError(t, err)
+	assert.DirExists(t, filepath.Join(outputDir, "storage", "dir49"))
+}
+
+// TestIsWithinDir tests path containment checks
+func TestIsWithinDir(t *testing.T) {
+	assert.True(t, isWithinDir("/out", "/out"))
+	assert.True(t, isWithinDir("/out", "/out/storage/file"))
+	assert.False(t, isWithinDir("/out", "/out2/file"))
+	assert.False(t, isWithinDir("/out", "/etc/passwd"))
+	assert.False(t, isWithinDir("/out", "/out/../etc"))
+}
+
+// TestWriteHeader_Oversized tests that a header larger than MaxHeaderSize is
+// rejected at write time instead of producing unreadable output
+func TestWriteHeader_Oversized(t *testing.T) {
+	apps := make([]string, 0, 40000)
+	for i := 0; i < cap(apps); i++ {
+		apps = append(apps, fmt.Sprintf("./apps/generated-application-%06d", i))
+	}
+
+	header := NewHeader()
+	header.BundleSize = 1
+	header.BundleChecksum = "sha256:00"
+	header.CreatedAt = "2024-01-01T00:00:00Z"
+	header.Manifest = manifest.New(manifest.Options{
+		Name:     "Huge Bundle",
+		Version:  "1.0.0",
+		Apps:     apps,
+		Platform: "linux-x64",
+	})
+
+	var buf bytes.Buffer
+	_, err := WriteHeader(&buf, header)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds maximum allowed size")
+	assert.Zero(t, buf.Len(), "nothing should be written for an oversized header")
+}
+
+// TestWriteReadHeader_RoundTrip tests that a written header reads back unchanged
+func TestWriteReadHeader_RoundTrip(t *testing.T) {
+	header := NewHeader()
+	header.BundleSize = 42
+	header.BundleChecksum = "sha256:abc"
+	header.CreatedAt = "2024-01-01T00:00:00Z"
+
+	var buf bytes.Buffer
+	n, err := WriteHeader(&buf, header)
+	require.NoError(t, err)
+	assert.Equal(t, buf.Len(), n)
+
+	read, err := ReadHeader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, header, read)
+}
+
+// TestChecksumSidecar tests sidecar generation during create and tamper detection
+func TestChecksumSidecar(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:       bundleDir,
+		OpsBinary:       opsBinary,
+		OutputPath:      executablePath,
+		Platform:        "linux-x64",
+		ChecksumSidecar: true,
+	}))
+
+	sidecar, err := os.ReadFile(ChecksumSidecarPath(executablePath))
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{64}  selfhost\n$`, string(sidecar))
+
+	ok, err := VerifyAgainstSidecar(executablePath)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Tamper with the executable
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	data[0] ^= 0xFF
+	require.NoError(t, os.WriteFile(executablePath, data, 0755))
+
+	ok, err = VerifyAgainstSidecar(executablePath)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// TestVerifyAgainstSidecar_Errors tests missing and malformed sidecars
+func TestVerifyAgainstSidecar_Errors(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "file")
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0644))
+
+	_, err := VerifyAgainstSidecar(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(ChecksumSidecarPath(path), []byte("not-a-checksum  file\n"), 0644))
+	_, err = VerifyAgainstSidecar(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not contain a SHA256 checksum")
+
+	require.NoError(t, WriteChecksumSidecar(path))
+	ok, err := VerifyAgainstSidecar(path)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// TestHeader_InstallSettingsSerialization tests that install settings round-trip
+// and that headers without them fall back to defaults
+func TestHeader_InstallSettingsSerialization(t *testing.T) {
+	header := NewHeader()
+	header.InstallPrefix = "/opt/convex"
+	header.ServiceName = "my-backend"
+
+	data, err := header.ToJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"installPrefix": "/opt/convex"`)
+	assert.Contains(t, string(data), `"serviceName": "my-backend"`)
+
+	parsed := &Header{}
+	require.NoError(t, parsed.FromJSON(data))
+	assert.Equal(t, "/opt/convex", parsed.InstallPrefixOrDefault())
+	assert.Equal(t, "my-backend", parsed.ServiceNameOrDefault())
+
+	// Headers written before these fields existed use the defaults
+	legacy := &Header{}
+	require.NoError(t, legacy.FromJSON([]byte(`{"version":"1.0.0","format":"selfhost-v1"}`)))
+	assert.Equal(t, DefaultInstallPrefix, legacy.InstallPrefixOrDefault())
+	assert.Equal(t, DefaultServiceName, legacy.ServiceNameOrDefault())
+}
+
+// TestCreate_InstallSettings tests that install settings are recorded with defaults
+func TestCreate_InstallSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	defaults := filepath.Join(tmpDir, "defaults")
+	require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: defaults, Platform: "linux-x64"}))
+	header, err := ReadHeaderFromExecutable(defaults)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultInstallPrefix, header.InstallPrefix)
+	assert.Equal(t, DefaultServiceName, header.ServiceName)
+
+	custom := filepath.Join(tmpDir, "custom")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:     bundleDir,
+		OpsBinary:     opsBinary,
+		OutputPath:    custom,
+		Platform:      "linux-x64",
+		InstallPrefix: "/home/user/.local",
+		ServiceName:   "convex-staging",
+	}))
+	header, err = ReadHeaderFromExecutable(custom)
+	require.NoError(t, err)
+	assert.Equal(t, "/home/user/.local", header.InstallPrefix)
+	assert.Equal(t, "convex-staging", header.ServiceName)
+
+	err = Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: custom, Platform: "linux-x64", InstallPrefix: "relative/path"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "absolute path")
+}
+
+// TestValidateServiceName tests systemd unit name validation
+func TestValidateServiceName(t *testing.T) {
+	for _, name := range []string{"convex-backend", "convex_backend.prod", "convex@1", "a"} {
+		assert.NoError(t, ValidateServiceName(name), name)
+	}
+	for _, name := range []string{"", "-leading-dash", ".hidden", "has space", "../etc/passwd", "a/b", "semi;colon", strings.Repeat("a", 300)} {
+		assert.Error(t, ValidateServiceName(name), name)
+	}
+
+	header := NewHeader()
+	header.BundleSize = 1
+	header.BundleChecksum = "sha256:00"
+	header.CreatedAt = "2024-01-01T00:00:00Z"
+	header.Manifest = &manifest.Manifest{}
+	header.ServiceName = "bad/name"
+	assert.Error(t, header.Validate())
+}
+
+// TestCreate_Reproducible tests that reproducible builds ignore file timestamps
+func TestCreate_Reproducible(t *testing.T) {
+	t.Setenv(manifest.SourceDateEpochEnv, "1700000000")
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	build := func(name string) []byte {
+		outputPath := filepath.Join(tmpDir, name)
+		require.NoError(t, Create(CreateOptions{
+			BundleDir:    bundleDir,
+			OpsBinary:    opsBinary,
+			OutputPath:   outputPath,
+			Platform:     "linux-x64",
+			Reproducible: true,
+		}))
+		data, err := os.ReadFile(outputPath)
+		require.NoError(t, err)
+		return data
+	}
+
+	first := build("first")
+
+	// Touch every file so only timestamps differ between builds
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, filepath.Walk(bundleDir, func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, later, later)
+	}))
+
+	second := build("second")
+	assert.True(t, bytes.Equal(first, second), "reproducible builds should be byte-identical")
+
+	header, err := ReadHeaderFromExecutable(filepath.Join(tmpDir, "second"))
+	require.NoError(t, err)
+	assert.Equal(t, "2023-11-14T22:13:20Z", header.CreatedAt)
+}
+
+// TestCreateExtract_ParallelCompression tests that pgzip output is standard gzip
+func TestCreateExtract_ParallelCompression(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	writeMixedPayload(t, filepath.Join(bundleDir, "storage"), 4<<20)
+
+	// The archive must be readable by the standard library gzip decoder
+	var compressed bytes.Buffer
+	size, err := createCompressedTar(context.Background(), &compressed, bundleDir, CompressionGzip, archiveOptions{parallel: true})
+	require.NoError(t, err)
+	gzReader, err := gzip.NewReader(&compressed)
+	require.NoError(t, err)
+	tarReader := tar.NewReader(gzReader)
+	var tarSize int64
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if hdr.Typeflag == tar.TypeReg {
+			tarSize += hdr.Size
+		}
+	}
+	assert.Equal(t, size, tarSize)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:           bundleDir,
+		OpsBinary:           opsBinary,
+		OutputPath:          executablePath,
+		Platform:            "linux-x64",
+		ParallelCompression: true,
+	}))
+
+	result, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	original, err := os.ReadFile(filepath.Join(bundleDir, "storage", "random.bin"))
+	require.NoError(t, err)
+	extracted, err := os.ReadFile(filepath.Join(extractDir, "storage", "random.bin"))
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(original, extracted))
+}
+
+// BenchmarkCreateCompressedTar compares standard and parallel gzip on a
+// 500MB bundle that is half incompressible and half compressible.
+func BenchmarkCreateCompressedTar(b *testing.B) {
+	bundleDir := b.TempDir()
+	writeMixedPayload(b, bundleDir, 500<<20)
+
+	for _, bc := range []struct {
+		name     string
+		parallel bool
+	}{
+		{"standard", false},
+		{"parallel", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				size, err := createCompressedTar(context.Background(), io.Discard, bundleDir, CompressionGzip, archiveOptions{parallel: bc.parallel})
+				require.NoError(b, err)
+				b.SetBytes(size)
+			}
+		})
+	}
+}
+
+// writeMixedPayload writes size bytes split between a random (incompressible)
+// file and a repetitive (compressible) file in dir.
+func writeMixedPayload(tb testing.TB, dir string, size int) {
+	tb.Helper()
+	random := make([]byte, size/2)
+	_, err := rand.Read(random)
+	require.NoError(tb, err)
+	require.NoError(tb, os.WriteFile(filepath.Join(dir, "random.bin"), random, 0644))
+
+	text := bytes.Repeat([]byte("compressible convex storage line\n"), size/2/33+1)
+	require.NoError(tb, os.WriteFile(filepath.Join(dir, "text.txt"), text[:size/2], 0644))
+}
+
+// TestOpenBundle tests reading the embedded bundle through fs.FS
+func TestOpenBundle(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	nestedDir := filepath.Join(bundleDir, "storage", "modules", "abc")
+	require.NoError(t, os.MkdirAll(nestedDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(nestedDir, "blob.bin"), []byte("nested blob"), 0644))
+	require.NoError(t, os.Symlink("test-file.txt", filepath.Join(bundleDir, "storage", "latest.txt")))
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   opsBinary,
+		OutputPath:  executablePath,
+		Platform:    "linux-x64",
+		Compression: CompressionBrotli,
+	}))
+
+	bundleFS, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+
+	require.NoError(t, fstest.TestFS(bundleFS,
+		"manifest.json",
+		"backend",
+		"convex.db",
+		"credentials.json",
+		"storage/test-file.txt",
+		"storage/latest.txt",
+		"storage/modules/abc/blob.bin",
+	))
+
+	manifestData, err := fs.ReadFile(bundleFS, "manifest.json")
+	require.NoError(t, err)
+	var mf manifest.Manifest
+	require.NoError(t, json.Unmarshal(manifestData, &mf))
+	assert.Equal(t, "Test Bundle", mf.Name)
+
+	blob, err := fs.ReadFile(bundleFS, "storage/modules/abc/blob.bin")
+	require.NoError(t, err)
+	assert.Equal(t, "nested blob", string(blob))
+
+	latest, err := fs.ReadFile(bundleFS, "storage/latest.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "test storage content", string(latest))
+
+	var storageFiles []string
+	require.NoError(t, fs.WalkDir(bundleFS, "storage", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			storageFiles = append(storageFiles, path)
+		}
+		return err
+	}))
+	assert.Equal(t, []string{"storage/latest.txt", "storage/modules/abc/blob.bin", "storage/test-file.txt"}, storageFiles)
+
+	_, err = fs.ReadFile(bundleFS, "missing.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+// TestOpenBundle_NotSelfHost tests that plain binaries are rejected
+func TestOpenBundle_NotSelfHost(t *testing.T) {
+	opsBinary := filepath.Join(t.TempDir(), "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	_, err := OpenBundle(opsBinary)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not contain an embedded bundle")
+}
+
+// TestExtractFile tests reading a single file from the embedded bundle
+func TestExtractFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	require.NoError(t, os.Symlink("test-file.txt", filepath.Join(bundleDir, "storage", "latest.txt")))
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	data, err := ExtractFile(executablePath, "convex.db")
+	require.NoError(t, err)
+	assert.Equal(t, "mock database content", string(data))
+
+	data, err = ExtractFile(executablePath, "storage/test-file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "test storage content", string(data))
+
+	_, err = ExtractFile(executablePath, "missing.db")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, err = ExtractFile(executablePath, "storage/latest.txt")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a regular file")
+
+	_, err = ExtractFile(opsBinary, "convex.db")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not contain an embedded bundle")
+}
+
+// TestStrip tests recovering the original ops binary from an executable
+func TestStrip(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	strippedPath := filepath.Join(tmpDir, "stripped")
+	require.NoError(t, Strip(executablePath, strippedPath))
+
+	original, err := os.ReadFile(opsBinary)
+	require.NoError(t, err)
+	stripped, err := os.ReadFile(strippedPath)
+	require.NoError(t, err)
+	assert.Equal(t, original, stripped)
+
+	info, err := os.Stat(strippedPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// The plain ops binary cannot be stripped again
+	err = Strip(strippedPath, filepath.Join(tmpDir, "again"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not contain an embedded bundle")
+	assert.NoFileExists(t, filepath.Join(tmpDir, "again"))
+}
+
+// TestCreate_MaxBundleSize tests the executable size budget
+func TestCreate_MaxBundleSize(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	outputPath := filepath.Join(tmpDir, "selfhost")
+	err := Create(CreateOptions{
+		BundleDir:     bundleDir,
+		OpsBinary:     opsBinary,
+		OutputPath:    outputPath,
+		Platform:      "linux-x64",
+		MaxBundleSize: 100,
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the maximum of 100 bytes")
+	assert.Contains(t, err.Error(), "ops binary:")
+	assert.Contains(t, err.Error(), "compressed bundle:")
+	assert.NoFileExists(t, outputPath, "oversized executable should be deleted")
+
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:     bundleDir,
+		OpsBinary:     opsBinary,
+		OutputPath:    outputPath,
+		Platform:      "linux-x64",
+		MaxBundleSize: 10 << 20,
+	}))
+	info, err := os.Stat(outputPath)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, info.Size(), int64(10<<20))
+
+	err = Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: outputPath, Platform: "linux-x64", MaxBundleSize: -1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must not be negative")
+}
+
+// TestHeader_HealthCheck tests health check serialization, validation and defaults
+func TestHeader_HealthCheck(t *testing.T) {
+	header := NewHeader()
+	header.BundleSize = 1
+	header.BundleChecksum = "sha256:00"
+	header.CreatedAt = "2024-01-01T00:00:00Z"
+	header.Manifest = &manifest.Manifest{}
+	header.HealthCheck = &HealthCheck{Path: "/api/ready", TimeoutSeconds: 90}
+	require.NoError(t, header.Validate())
+
+	data, err := header.ToJSON()
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"timeoutSeconds": 90`)
+
+	parsed := &Header{}
+	require.NoError(t, parsed.FromJSON(data))
+	assert.Equal(t, header.HealthCheck, parsed.HealthCheck)
+	assert.Equal(t, 90*time.Second, parsed.HealthCheckOrDefault().Timeout())
+
+	header.HealthCheck = &HealthCheck{Path: "", TimeoutSeconds: 30}
+	assert.ErrorContains(t, header.Validate(), "health check path is required")
+	header.HealthCheck = &HealthCheck{Path: "version", TimeoutSeconds: 30}
+	assert.ErrorContains(t, header.Validate(), "must start with")
+	header.HealthCheck = &HealthCheck{Path: "/version", TimeoutSeconds: 0}
+	assert.ErrorContains(t, header.Validate(), "timeout must be positive")
+	header.HealthCheck = &HealthCheck{Path: "/version", TimeoutSeconds: -5}
+	assert.ErrorContains(t, header.Validate(), "timeout must be positive")
+
+	// Headers written before health checks were configurable use the defaults
+	legacy := &Header{}
+	require.NoError(t, legacy.FromJSON([]byte(`{"version":"1.0.0","format":"selfhost-v1"}`)))
+	assert.Equal(t, DefaultHealthCheckPath, legacy.HealthCheckOrDefault().Path)
+	assert.Equal(t, DefaultHealthCheckTimeout, legacy.HealthCheckOrDefault().Timeout())
+}
+
+// TestCreate_HealthCheck tests that health check settings are recorded with defaults
+func TestCreate_HealthCheck(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	outputPath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: outputPath, Platform: "linux-x64"}))
+	header, err := ReadHeaderFromExecutable(outputPath)
+	require.NoError(t, err)
+	require.NotNil(t, header.HealthCheck)
+	assert.Equal(t, HealthCheck{Path: DefaultHealthCheckPath, TimeoutSeconds: 30}, *header.HealthCheck)
+
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:          bundleDir,
+		OpsBinary:          opsBinary,
+		OutputPath:         outputPath,
+		Platform:           "linux-x64",
+		HealthCheckPath:    "/healthz",
+		HealthCheckTimeout: 2 * time.Minute,
+	}))
+	header, err = ReadHeaderFromExecutable(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, HealthCheck{Path: "/healthz", TimeoutSeconds: 120}, *header.HealthCheck)
+
+	for _, opts := range []CreateOptions{
+		{HealthCheckPath: "healthz"},
+		{HealthCheckTimeout: -time.Second},
+		{HealthCheckTimeout: 1500 * time.Millisecond},
+	} {
+		opts.BundleDir, opts.OpsBinary, opts.OutputPath, opts.Platform = bundleDir, opsBinary, outputPath, "linux-x64"
+		assert.ErrorContains(t, Create(opts), "health check")
+	}
+}
+
+// TestReplaceCredentials tests that only credentials.json changes in the embedded bundle
+func TestReplaceCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   opsBinary,
+		OutputPath:  executablePath,
+		Platform:    "linux-x64",
+		Compression: CompressionBrotli,
+	}))
+	before, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+
+	creds := &credentials.Credentials{AdminKey: "rotated-admin-key", InstanceSecret: strings.Repeat("ab", 32)}
+	require.NoError(t, ReplaceCredentials(executablePath, creds))
+
+	after, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, CompressionBrotli, after.Compression)
+	assert.NotEqual(t, before.BundleChecksum, after.BundleChecksum)
+	assert.Equal(t, before.Manifest, after.Manifest)
+	assert.Equal(t, before.CreatedAt, after.CreatedAt)
+
+	bundleFS, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+
+	credsData, err := fs.ReadFile(bundleFS, "credentials.json")
+	require.NoError(t, err)
+	var got credentials.Credentials
+	require.NoError(t, json.Unmarshal(credsData, &got))
+	assert.Equal(t, *creds, got)
+
+	for _, name := range []string{"manifest.json", "backend", "convex.db", "storage/test-file.txt"} {
+		want, err := os.ReadFile(filepath.Join(bundleDir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		data, err := fs.ReadFile(bundleFS, name)
+		require.NoError(t, err)
+		assert.Equal(t, want, data, name)
+	}
+
+	verify, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.True(t, verify.Valid)
+
+	assert.Error(t, ReplaceCredentials(executablePath, nil))
+	assert.Error(t, ReplaceCredentials(opsBinary, creds))
+}
+
+// TestExtract_VerifyDatabase tests the opt-in SQLite integrity check after extraction
+func TestExtract_VerifyDatabase(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	// The mock convex.db is not a SQLite database, so only the opt-in check rejects it
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: executablePath, Platform: "linux-x64"}))
+
+	_, err := Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "unchecked")})
+	require.NoError(t, err)
+
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "checked"), VerifyDatabase: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to verify convex.db")
+
+	// A real database passes
+	dbPath := filepath.Join(bundleDir, "convex.db")
+	require.NoError(t, os.Remove(dbPath))
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE documents (id INTEGER PRIMARY KEY, body TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: executablePath, Platform: "linux-x64"}))
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "valid"), VerifyDatabase: true})
+	require.NoError(t, err)
+}
+
+// TestSelfCheck tests startup verification against copies of the running test binary
+func TestSelfCheck(t *testing.T) {
+	hostPlatform := platform.Host()
+	if !platform.IsSelfHostTarget(hostPlatform) {
+		t.Skipf("host platform %s is not a self-host target", hostPlatform)
+	}
+
+	// The test binary has no embedded bundle, so it passes as a plain ops binary
+	require.NoError(t, SelfCheck())
+
+	tmpDir := t.TempDir()
+	testBinary, err := os.Executable()
+	require.NoError(t, err)
+
+	// The manifest always names the host, so only the header platform differs
+	build := func(name, bundlePlatform string) string {
+		bundleDir := filepath.Join(tmpDir, name+"-bundle")
+		require.NoError(t, os.MkdirAll(bundleDir, 0755))
+		createMockBundleDir(t, bundleDir)
+		mf := manifest.New(manifest.Options{Name: "Test Bundle", Version: "1.0.0", Platform: hostPlatform})
+		data, err := mf.ToJSON()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "manifest.json"), data, 0644))
+
+		// An ops binary for another platform would be rejected, so use a
+		// mock one whose format is not recognized
+		opsBinary := testBinary
+		if bundlePlatform != hostPlatform {
+			opsBinary = filepath.Join(tmpDir, name+"-ops")
+			createMockOpsBinary(t, opsBinary)
+		}
+		outputPath := filepath.Join(tmpDir, name)
+		require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: outputPath, Platform: bundlePlatform}))
+		return outputPath
+	}
+
+	valid := build("valid", hostPlatform)
+	require.NoError(t, SelfCheckFile(valid))
+
+	// Flip a byte inside the compressed bundle region
+	corrupted := build("corrupted", hostPlatform)
+	data, err := os.ReadFile(corrupted)
+	require.NoError(t, err)
+	result, err := DetectSelfHostModeFromFile(corrupted)
+	require.NoError(t, err)
+	data[int64(len(data))-trailerSize(result.FooterVersion)-10] ^= 0xff
+	require.NoError(t, os.WriteFile(corrupted, data, 0755))
+
+	err = SelfCheckFile(corrupted)
+	var checkErr *SelfCheckError
+	require.ErrorAs(t, err, &checkErr)
+	assert.Equal(t, ExitVerificationFailed, checkErr.ExitCode)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+
+	otherPlatform := "linux-arm64"
+	if hostPlatform == otherPlatform {
+		otherPlatform = "linux-x64"
+	}
+	err = SelfCheckFile(build("other-platform", otherPlatform))
+	require.ErrorAs(t, err, &checkErr)
+	assert.Equal(t, ExitPlatformMismatch, checkErr.ExitCode)
+
+	t.Setenv(SkipSelfCheckEnv, "1")
+	require.NoError(t, SelfCheck())
+}
+
+// TestCreate_HeaderPlatform tests that the header records CreateOptions.Platform
+// even when the bundle manifest names another platform
+func TestCreate_HeaderPlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	var logs bytes.Buffer
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-arm64",
+		Logger:     logging.New(&logs, logging.LevelWarn),
+	}))
+	assert.Contains(t, logs.String(), "Bundle manifest is for platform linux-x64, but the executable is being created for linux-arm64")
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, "linux-arm64", header.Platform)
+	assert.Equal(t, "linux-x64", header.Manifest.Platform)
+	assert.Equal(t, "linux-arm64", header.PlatformOrManifest())
+
+	result, err := DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, "linux-arm64", result.Platform)
+}
+
+// TestHeader_PlatformOrManifest tests the fallback for headers written
+// before Header.Platform was added
+func TestHeader_PlatformOrManifest(t *testing.T) {
+	header := &Header{Manifest: &manifest.Manifest{Platform: "linux-x64"}}
+	assert.Equal(t, "linux-x64", header.PlatformOrManifest())
+
+	header.Platform = "linux-arm64"
+	assert.Equal(t, "linux-arm64", header.PlatformOrManifest())
+
+	assert.Empty(t, (&Header{}).PlatformOrManifest())
+}
+
+// TestValidateCreateInputs_ReportsAllProblems tests that every problem is reported at once
+func TestValidateCreateInputs_ReportsAllProblems(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "manifest.json"), []byte("{}"), 0644))
+
+	err := validateCreateInputs(CreateOptions{
+		BundleDir:   bundleDir,
+		OpsBinary:   filepath.Join(tmpDir, "missing-ops"),
+		OutputPath:  filepath.Join(tmpDir, "out"),
+		Platform:    "linux-x64",
+		Compression: "lzma",
+	})
+	require.Error(t, err)
+	for _, want := range []string{
+		"bundle is missing required file: backend",
+		"bundle is missing required file: convex.db",
+		"bundle is missing required file: credentials.json",
+		"ops binary does not exist",
+		"invalid compression: lzma",
+	} {
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.NotContains(t, err.Error(), "manifest.json")
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 5)
+
+	err = validateCreateInputs(CreateOptions{})
+	require.Error(t, err)
+	for _, want := range []string{"bundle directory is required", "ops binary is required", "output path is required", "platform is required"} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+// TestCreate_NoTempArchiveLeftBehind tests that the streamed archive temp file is removed
+func TestCreate_NoTempArchiveLeftBehind(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	outDir := filepath.Join(tmpDir, "out")
+	require.NoError(t, os.MkdirAll(outDir, 0755))
+	outputPath := filepath.Join(outDir, "selfhost")
+	info, err := CreateWithInfo(context.Background(), CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: outputPath, Platform: "linux-x64"})
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "selfhost", entries[0].Name())
+
+	// The streamed checksum matches the embedded data
+	_, header, compressedData, err := readEmbeddedBundle(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, calculateChecksum(compressedData), header.BundleChecksum)
+	assert.Equal(t, info.Header.BundleChecksum, header.BundleChecksum)
+
+	// A failed create cleans up too
+	_, err = CreateWithInfo(context.Background(), CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: outputPath, Platform: "linux-x64", MaxBundleSize: 1})
+	require.Error(t, err)
+	entries, err = os.ReadDir(outDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// BenchmarkCreate_LargeBundle reports allocations when creating an
+// executable from a 64MB bundle; the archive is streamed through a temp
+// file, so bytes allocated per op stay far below the bundle size.
+func BenchmarkCreate_LargeBundle(b *testing.B) {
+	tmpDir := b.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(b, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(b, bundleDir)
+	writeMixedPayload(b, filepath.Join(bundleDir, "storage"), 64<<20)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(b, opsBinary)
+	outputPath := filepath.Join(tmpDir, "selfhost")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		require.NoError(b, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: outputPath, Platform: "linux-x64"}))
+	}
+}
+
+// writeELFHeader writes a minimal 64-bit little-endian ELF executable header for machine
+func writeELFHeader(t *testing.T, path string, machine elf.Machine) {
+	t.Helper()
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Ehsize:    64,
+		Phentsize: 56,
+		Shentsize: 64,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, header))
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0755))
+}
+
+// TestBinaryPlatform tests executable header inspection
+func TestBinaryPlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		machine elf.Machine
+		goarch  string
+	}{
+		{elf.EM_X86_64, "amd64"},
+		{elf.EM_AARCH64, "arm64"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(tmpDir, tt.goarch)
+		writeELFHeader(t, path, tt.machine)
+		goos, goarch, ok := binaryPlatform(path)
+		require.True(t, ok, tt.goarch)
+		assert.Equal(t, "linux", goos)
+		assert.Equal(t, tt.goarch, goarch)
+	}
+
+	script := filepath.Join(tmpDir, "script")
+	createMockOpsBinary(t, script)
+	_, _, ok := binaryPlatform(script)
+	assert.False(t, ok)
+
+	unknown := filepath.Join(tmpDir, "sparc")
+	writeELFHeader(t, unknown, elf.EM_SPARCV9)
+	_, _, ok = binaryPlatform(unknown)
+	assert.False(t, ok)
+}
+
+// TestValidateCreateInputs_OpsBinaryPlatform tests that a mislabelled ops binary is rejected
+func TestValidateCreateInputs_OpsBinaryPlatform(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	x64Ops := filepath.Join(tmpDir, "ops-x64")
+	writeELFHeader(t, x64Ops, elf.EM_X86_64)
+	arm64Ops := filepath.Join(tmpDir, "ops-arm64")
+	writeELFHeader(t, arm64Ops, elf.EM_AARCH64)
+	scriptOps := filepath.Join(tmpDir, "ops-script")
+	createMockOpsBinary(t, scriptOps)
+
+	opts := func(opsBinary, platformName string) CreateOptions {
+		return CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: filepath.Join(tmpDir, "out"), Platform: platformName}
+	}
+
+	require.NoError(t, validateCreateInputs(opts(x64Ops, "linux-x64")))
+	require.NoError(t, validateCreateInputs(opts(arm64Ops, "linux-arm64")))
+
+	err := validateCreateInputs(opts(x64Ops, "linux-arm64"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ops binary is built for linux-x64, not linux-arm64")
+
+	err = validateCreateInputs(opts(arm64Ops, "linux-x64"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ops binary is built for linux-arm64, not linux-x64")
+
+	// Unrecognized formats are only warned about
+	require.NoError(t, validateCreateInputs(opts(scriptOps, "linux-arm64")))
+}
+
+// writeMachOHeader writes a minimal 64-bit Mach-O executable header for arm64
+func writeMachOHeader(t *testing.T, path string) {
+	t.Helper()
+	header := macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   macho.CpuArm64,
+		Type:  macho.TypeExec,
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, header))
+	buf.Write(make([]byte, 4)) // reserved field of the 64-bit header
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0755))
+}
+
+// writePEHeader writes a minimal amd64 PE executable: a DOS stub pointing at
+// the PE signature and a file header without sections
+func writePEHeader(t *testing.T, path string) {
+	t.Helper()
+	const peOffset = 0x80 // debug/pe reads a 96-byte DOS header
+	data := make([]byte, peOffset)
+	copy(data, "MZ")
+	binary.LittleEndian.PutUint32(data[0x3c:], peOffset)
+	data = append(data, "PE\x00\x00"...)
+
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, pe.FileHeader{Machine: pe.IMAGE_FILE_MACHINE_AMD64}))
+	require.NoError(t, os.WriteFile(path, append(data, buf.Bytes()...), 0755))
+}
+
+// TestBinaryFormat tests executable format detection
+func TestBinaryFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	elfPath := filepath.Join(tmpDir, "elf")
+	writeELFHeader(t, elfPath, elf.EM_X86_64)
+	machoPath := filepath.Join(tmpDir, "macho")
+	writeMachOHeader(t, machoPath)
+	pePath := filepath.Join(tmpDir, "pe")
+	writePEHeader(t, pePath)
+	script := filepath.Join(tmpDir, "script")
+	createMockOpsBinary(t, script)
+
+	assert.Equal(t, formatELF, binaryFormat(elfPath))
+	assert.Equal(t, formatMachO, binaryFormat(machoPath))
+	assert.Equal(t, formatPE, binaryFormat(pePath))
+	assert.Empty(t, binaryFormat(script))
+	assert.Empty(t, binaryFormat(filepath.Join(tmpDir, "missing")))
+}
+
+// TestCreate_RejectsSignedBinaryFormats tests that Mach-O and PE ops binaries
+// are rejected instead of producing an executable that will not run
+func TestCreate_RejectsSignedBinaryFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	machoPath := filepath.Join(tmpDir, "ops-macho")
+	writeMachOHeader(t, machoPath)
+	pePath := filepath.Join(tmpDir, "ops-pe")
+	writePEHeader(t, pePath)
+
+	for path, format := range map[string]string{machoPath: "Mach-O", pePath: "PE"} {
+		outputPath := filepath.Join(tmpDir, "out-"+format)
+		err := Create(CreateOptions{
+			BundleDir:  bundleDir,
+			OpsBinary:  path,
+			OutputPath: outputPath,
+			Platform:   "linux-x64",
+		})
+		require.Error(t, err, format)
+		assert.Contains(t, err.Error(), "trailing-append embedding is not supported for "+format+" ops binaries")
+		assert.NotContains(t, err.Error(), "ops binary is built for", "the platform mismatch is not reported twice")
+		assert.NoFileExists(t, outputPath)
+	}
+}
+
+// createBundleArchive writes a mock bundle directory and returns it as a
+// compressed tar archive
+func createBundleArchive(t *testing.T, dir string, compression string) []byte {
+	t.Helper()
+
+	bundleDir := filepath.Join(dir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	var buf bytes.Buffer
+	_, err := createCompressedTar(context.Background(), &buf, bundleDir, compression, archiveOptions{})
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestCreateFromArchive_Gzip(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := createBundleArchive(t, tmpDir, CompressionGzip)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, CreateFromArchive(CreateFromArchiveOptions{
+		Archive:    bytes.NewReader(archive),
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	// The archive is embedded unchanged
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, CompressionGzip, header.Compression)
+	assert.Equal(t, calculateChecksum(archive), header.BundleChecksum)
+	assert.Equal(t, "Test Bundle", header.Manifest.Name)
+
+	result, err := Verify(executablePath)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+	verifyFilesMatch(t, filepath.Join(tmpDir, "bundle"), extractDir, "storage/test-file.txt")
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".archive-", "temp archive should be removed")
+	}
+}
+
+func TestCreateFromArchive_Recompress(t *testing.T) {
+	tmpDir := t.TempDir()
+	archive := createBundleArchive(t, tmpDir, CompressionGzip)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	mf := manifest.New(manifest.Options{Name: "Override", Version: "2.0.0", Platform: "linux-x64"})
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, CreateFromArchive(CreateFromArchiveOptions{
+		Archive:     bytes.NewReader(archive),
+		Manifest:    mf,
+		OpsBinary:   opsBinary,
+		OutputPath:  executablePath,
+		Platform:    "linux-x64",
+		Compression: CompressionBrotli,
+	}))
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	header, err := Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	assert.Equal(t, CompressionBrotli, header.Compression)
+	assert.Equal(t, "Override", header.Manifest.Name)
+	assertExtractedBundleStructure(t, extractDir)
+	verifyFilesMatch(t, filepath.Join(tmpDir, "bundle"), extractDir, "convex.db")
+}
+
+func TestCreateFromArchive_MissingRequiredFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	require.NoError(t, os.Remove(filepath.Join(bundleDir, "credentials.json")))
+
+	var archive bytes.Buffer
+	_, err := createCompressedTar(context.Background(), &archive, bundleDir, CompressionGzip, archiveOptions{})
+	require.NoError(t, err)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	err = CreateFromArchive(CreateFromArchiveOptions{
+		Archive:    &archive,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "archive is missing required file: credentials.json")
+	assert.NoFileExists(t, executablePath)
+}
+
+func TestCreateFromArchive_NotAnArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	err := CreateFromArchive(CreateFromArchiveOptions{
+		Archive:    strings.NewReader("not a gzip archive"),
+		OpsBinary:  opsBinary,
+		OutputPath: filepath.Join(tmpDir, "selfhost"),
+		Platform:   "linux-x64",
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read archive")
+}
+
+// TestExtract_CleanRetryAfterInterruption tests that retrying an interrupted
+// extraction with Clean leaves only the bundle's files
+func TestExtract_CleanRetryAfterInterruption(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	require.NoError(t, os.MkdirAll(extractDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(extractDir, "stale.txt"), []byte("old"), 0644))
+
+	_, err := ExtractContext(&cancelAfterContext{Context: context.Background(), n: 4}, ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.FileExists(t, filepath.Join(extractDir, IncompleteMarker))
+
+	_, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+		Clean:          true,
+	})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+	assert.NoFileExists(t, filepath.Join(extractDir, IncompleteMarker))
+	assert.NoFileExists(t, filepath.Join(extractDir, "stale.txt"))
+}
+
+// TestExtract_CleanRefusesUnrelatedDir tests that Clean does not delete a
+// directory that was never an extraction target
+func TestExtract_CleanRefusesUnrelatedDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "unrelated")
+	require.NoError(t, os.MkdirAll(extractDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(extractDir, "important.txt"), []byte("keep"), 0644))
+
+	for _, atomic := range []bool{false, true} {
+		_, err := Extract(ExtractOptions{
+			ExecutablePath: executablePath,
+			OutputDir:      extractDir,
+			Clean:          true,
+			Atomic:         atomic,
+		})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "refusing to clean")
+		assert.FileExists(t, filepath.Join(extractDir, "important.txt"))
+	}
+}
+
+// TestExtract_AtomicInterruptedThenRetried tests that a cancelled atomic
+// extraction leaves nothing behind and a retry succeeds
+func TestExtract_AtomicInterruptedThenRetried(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	parent := filepath.Join(tmpDir, "out")
+	extractDir := filepath.Join(parent, "extracted")
+
+	_, err := ExtractContext(&cancelAfterContext{Context: context.Background(), n: 4}, ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+		Atomic:         true,
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	entries, err := os.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no partial output or temp directory should remain")
+
+	_, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+		Atomic:         true,
+	})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+	entries, err = os.ReadDir(parent)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestExtract_AtomicReplacesPreviousExtraction tests that an atomic
+// extraction only replaces a non-empty directory when Clean is set
+func TestExtract_AtomicReplacesPreviousExtraction(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err := Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(extractDir, "stale.txt"), []byte("old"), 0644))
+
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir, Atomic: true})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "output directory is not empty")
+	assert.FileExists(t, filepath.Join(extractDir, "stale.txt"))
+
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir, Atomic: true, Clean: true})
+	require.NoError(t, err)
+	assertExtractedBundleStructure(t, extractDir)
+	assert.NoFileExists(t, filepath.Join(extractDir, "stale.txt"))
+
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".extract-", "temp directories should be removed")
+	}
+}
+
+// countingReaderAt records how many bytes are read through it
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.n += int64(n)
+	return n, err
+}
+
+// TestReadHeaderFromReaderAt tests that reading the header through a
+// ReaderAt only touches the footer, start and end markers and header
+func TestReadHeaderFromReaderAt(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	writeMixedPayload(t, filepath.Join(bundleDir, "storage"), 1<<20)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+	r := &countingReaderAt{r: bytes.NewReader(data)}
+
+	header, err := ReadHeaderFromReaderAt(r, int64(len(data)))
+	require.NoError(t, err)
+	assert.Equal(t, "Test Bundle", header.Manifest.Name)
+
+	expected, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, expected, header)
+
+	// WriteHeader reports the length prefix plus JSON
+	var buf bytes.Buffer
+	headerLen, err := WriteHeader(&buf, header)
+	require.NoError(t, err)
+	assert.Equal(t, int64(FooterSize+MagicStartLen+MagicEndLen+headerLen), r.n, "only the footer, start and end markers and header should be read")
+	assert.Less(t, r.n, int64(len(data))/100)
+}
+
+// TestDetectSelfHostModeFromReaderAt tests detection over in-memory data
+func TestDetectSelfHostModeFromReaderAt(t *testing.T) {
+	executablePath := createTestExecutable(t, t.TempDir())
+	data, err := os.ReadFile(executablePath)
+	require.NoError(t, err)
+
+	result, err := DetectSelfHostModeFromReaderAt(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+
+	fileResult, err := DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, fileResult, result)
+
+	plain := []byte("#!/bin/bash\necho 'not a bundle'\n")
+	result, err = DetectSelfHostModeFromReaderAt(bytes.NewReader(plain), int64(len(plain)))
+	require.NoError(t, err)
+	assert.False(t, result.IsSelfHost)
+
+	_, err = ReadHeaderFromReaderAt(bytes.NewReader(plain), int64(len(plain)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not a self-host executable")
+}
+
+// TestExtract_DetectsCompressionWhenHeaderIsWrong tests that extraction
+// follows the data's magic number when the header names another algorithm
+func TestExtract_DetectsCompressionWhenHeaderIsWrong(t *testing.T) {
+	tmpDir := t.TempDir()
+	executablePath := createTestExecutable(t, tmpDir)
+
+	// Rewrite the header of the gzip bundle to claim brotli
+	result, header, compressedData, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	require.Equal(t, CompressionGzip, header.Compression)
+	header.Compression = CompressionBrotli
+	header.Version = headerVersionFor(CompressionBrotli)
+	require.NoError(t, rewriteBundleSection(executablePath, result.Offset, header, compressedData))
+
+	var logs bytes.Buffer
+	extractDir := filepath.Join(tmpDir, "extracted")
+	extracted, err := Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+		Logger:         logging.New(&logs, logging.LevelWarn),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, CompressionBrotli, extracted.Compression)
+	assertExtractedBundleStructure(t, extractDir)
+	assert.Contains(t, logs.String(), `Header says the bundle is "brotli" compressed but its data is gzip`)
+
+	bundleFS, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+	_, err = fs.Stat(bundleFS, "manifest.json")
+	require.NoError(t, err)
+}
+
+func TestSniffCompression(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, CompressionGzip, sniffCompression(gz.Bytes()))
+	assert.Equal(t, CompressionZstd, sniffCompression([]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}))
+	assert.Empty(t, sniffCompression([]byte{0x1f}))
+	assert.Empty(t, sniffCompression(nil))
+
+	// Inconclusive sniffing (e.g. brotli) falls back to the header
+	var logs bytes.Buffer
+	log := logging.New(&logs, logging.LevelWarn)
+	assert.Equal(t, CompressionBrotli, detectCompression([]byte{0x8b, 0x02}, CompressionBrotli, log))
+	assert.Equal(t, CompressionGzip, detectCompression(gz.Bytes(), CompressionGzip, log))
+	assert.Empty(t, logs.String(), "matching or inconclusive data should not warn")
+}
+
+// TestHeaderJSONSchema_ValidatesHeader tests that a header written by Create
+// matches the published schema
+func TestHeaderJSONSchema_ValidatesHeader(t *testing.T) {
+	schemaDoc, err := jsonschema.UnmarshalJSON(bytes.NewReader(HeaderJSONSchema()))
+	require.NoError(t, err)
+	compiler := jsonschema.NewCompiler()
+	require.NoError(t, compiler.AddResource("header.json", schemaDoc))
+	schema, err := compiler.Compile("header.json")
+	require.NoError(t, err)
+
+	validate := func(data []byte) error {
+		inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		require.NoError(t, err)
+		return schema.Validate(inst)
+	}
+
+	header, err := ReadHeaderFromExecutable(createTestExecutable(t, t.TempDir()))
+	require.NoError(t, err)
+	data, err := header.ToJSON()
+	require.NoError(t, err)
+	assert.NoError(t, validate(data))
+
+	// The embedded manifest is validated with the manifest schema
+	header.Manifest.Labels = map[string]string{"-bad": "v"}
+	data, err = header.ToJSON()
+	require.NoError(t, err)
+	assert.Error(t, validate(data))
+
+	header.Manifest.Labels = nil
+	header.Compression = "lz4"
+	data, err = header.ToJSON()
+	require.NoError(t, err)
+	assert.Error(t, validate(data))
+}
+
+// TestHeaderJSONSchema_CoversAllFields tests that every Header field is
+// described by the schema
+func TestHeaderJSONSchema_CoversAllFields(t *testing.T) {
+	type objectSchema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+		Defs       map[string]json.RawMessage `json:"$defs"`
+	}
+	var schema, healthCheck, opsBinary objectSchema
+	require.NoError(t, json.Unmarshal(HeaderJSONSchema(), &schema))
+	require.NoError(t, json.Unmarshal(schema.Properties["healthCheck"], &healthCheck))
+	require.NoError(t, json.Unmarshal(schema.Properties["opsBinary"], &opsBinary))
+	assert.Contains(t, schema.Defs, "manifest")
+
+	assertCovers := func(properties map[string]json.RawMessage, typ reflect.Type) {
+		names := jsonFieldNames(typ)
+		for name := range names {
+			assert.Contains(t, properties, name, "schema is missing %s field %q", typ.Name(), name)
+		}
+		assert.Len(t, properties, len(names))
+	}
+	assertCovers(schema.Properties, reflect.TypeOf(Header{}))
+	assertCovers(healthCheck.Properties, reflect.TypeOf(HealthCheck{}))
+	assertCovers(opsBinary.Properties, reflect.TypeOf(OpsBinaryInfo{}))
+}
+
+// TestCreate_ExtraFiles tests that extra files round-trip through the archive
+func TestCreate_ExtraFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+		ExtraFiles: map[string][]byte{
+			"README.md":    []byte("# Installer\n"),
+			"docs/LICENSE": []byte("MIT\n"),
+		},
+	}))
+
+	bundleFS, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+	data, err := fs.ReadFile(bundleFS, "README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# Installer\n", string(data))
+	data, err = fs.ReadFile(bundleFS, "docs/LICENSE")
+	require.NoError(t, err)
+	assert.Equal(t, "MIT\n", string(data))
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+	data, err = os.ReadFile(filepath.Join(extractDir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Installer\n", string(data))
+	data, err = os.ReadFile(filepath.Join(extractDir, "docs", "LICENSE"))
+	require.NoError(t, err)
+	assert.Equal(t, "MIT\n", string(data))
+	assert.FileExists(t, filepath.Join(extractDir, "manifest.json"))
+}
+
+// TestCreate_ExtraFilesInvalidPaths tests that extra files cannot escape the
+// bundle or replace bundle files
+func TestCreate_ExtraFilesInvalidPaths(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		want  string
+	}{
+		{name: "parent traversal", files: map[string][]byte{"../escape": nil}, want: "invalid extra file path"},
+		{name: "nested traversal", files: map[string][]byte{"docs/../../escape": nil}, want: "invalid extra file path"},
+		{name: "absolute", files: map[string][]byte{"/etc/escape": nil}, want: "invalid extra file path"},
+		{name: "backslash", files: map[string][]byte{"..\\escape": nil}, want: "invalid extra file path"},
+		{name: "empty", files: map[string][]byte{"": nil}, want: "invalid extra file path"},
+		{name: "bundle file", files: map[string][]byte{"manifest.json": nil}, want: "would replace bundle file"},
+		{name: "inside extra file", files: map[string][]byte{"docs": nil, "docs/LICENSE": nil}, want: "is inside extra file docs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executablePath := filepath.Join(tmpDir, "selfhost")
+			err := Create(CreateOptions{
+				BundleDir:  bundleDir,
+				OpsBinary:  opsBinary,
+				OutputPath: executablePath,
+				Platform:   "linux-x64",
+				ExtraFiles: tt.files,
+			})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+			assert.NoFileExists(t, executablePath)
+			assert.NoFileExists(t, filepath.Join(tmpDir, "escape"))
+		})
+	}
+}
+
+// TestCreate_OmitCredentials tests that credentials.json is neither required
+// nor embedded when OmitCredentials is set, and that the header records it
+func TestCreate_OmitCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "convex.env"), []byte("INSTANCE_SECRET=secret\n"), 0600))
+
+	// A bundle that has credentials.json still leaves it, and the env file
+	// holding the same secret, out
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:       bundleDir,
+		OpsBinary:       opsBinary,
+		OutputPath:      executablePath,
+		Platform:        "linux-x64",
+		OmitCredentials: true,
+	}))
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.True(t, header.CredentialsOmitted)
+
+	// Readers that predate omitted credentials reject the bundle instead of
+	// installing it without credentials
+	assert.Equal(t, OmittedCredentialsHeaderVersion, header.Version)
+	assert.NoError(t, header.CheckCompatible())
+	err = checkHeaderVersion(header, ZstdDictionaryHeaderVersion)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "created by a newer bundler")
+
+	bundleFS, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+	_, err = fs.Stat(bundleFS, "credentials.json")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(bundleFS, "convex.env")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fs.Stat(bundleFS, "manifest.json")
+	assert.NoError(t, err)
+
+	// Extraction warns that credentials must be supplied
+	var logs bytes.Buffer
+	extractDir := filepath.Join(tmpDir, "extracted")
+	header, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+		Logger:         logging.New(&logs, logging.LevelInfo),
+	})
+	require.NoError(t, err)
+	assert.True(t, header.CredentialsOmitted)
+	assert.NoFileExists(t, filepath.Join(extractDir, "credentials.json"))
+	assert.Contains(t, logs.String(), "credentials must be supplied")
+
+	// Without credentials.json, the bundle is only valid with OmitCredentials
+	require.NoError(t, os.Remove(filepath.Join(bundleDir, "credentials.json")))
+	err = validateCreateInputs(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: executablePath, Platform: "linux-x64"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bundle is missing required file: credentials.json")
+	assert.NoError(t, validateCreateInputs(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: executablePath, Platform: "linux-x64", OmitCredentials: true}))
+
+	// Supplying credentials later clears the flag
+	creds := &credentials.Credentials{AdminKey: "provisioned-admin-key", InstanceSecret: strings.Repeat("ab", 32)}
+	require.NoError(t, ReplaceCredentials(executablePath, creds))
+	header, err = ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.False(t, header.CredentialsOmitted)
+	assert.Equal(t, HeaderVersion, header.Version)
+}
+
+// TestCreate_EncryptedCredentials tests that the header records encrypted
+// credentials and that extraction warns about them
+func TestCreate_EncryptedCredentials(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	creds := &credentials.Credentials{AdminKey: "admin-key", InstanceSecret: strings.Repeat("ab", 32)}
+	encrypted, err := creds.ToEncryptedJSON("correct horse")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "credentials.json"), encrypted, 0644))
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	header, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.True(t, header.CredentialsEncrypted)
+	assert.Equal(t, EncryptedCredentialsHeaderVersion, header.Version)
+
+	// Installers predating encrypted credentials must reject the bundle
+	err = checkHeaderVersion(header, CompressedOpsHeaderVersion)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "created by a newer bundler")
+
+	var logs bytes.Buffer
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err = Extract(ExtractOptions{
+		ExecutablePath: executablePath,
+		OutputDir:      extractDir,
+		Logger:         logging.New(&logs, logging.LevelInfo),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "credentials.json is encrypted")
+	loaded, err := credentials.LoadEncrypted(filepath.Join(extractDir, "credentials.json"), "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, creds, loaded)
+
+	// Replacing the credentials stores them in plaintext
+	require.NoError(t, ReplaceCredentials(executablePath, creds))
+	header, err = ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.False(t, header.CredentialsEncrypted)
+	assert.Equal(t, HeaderVersion, header.Version)
+}
+
+func TestCreate_StorageIgnoreFile(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+	storageDir := filepath.Join(bundleDir, "storage")
+	require.NoError(t, os.MkdirAll(filepath.Join(storageDir, "cache"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, "cache", "blob"), []byte("cached"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, "debug.log"), []byte("log"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, "keep.log"), []byte("log"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(storageDir, ignore.FileName), []byte("cache/\n*.log\n!keep.log\n"), 0644))
+	// Patterns only apply inside storage/
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "top.log"), []byte("log"), 0644))
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	bundleFS, err := OpenBundle(executablePath)
+	require.NoError(t, err)
+	for _, name := range []string{"storage/test-file.txt", "storage/keep.log", "top.log"} {
+		_, err := fs.Stat(bundleFS, name)
+		assert.NoError(t, err, name)
+	}
+	for _, name := range []string{"storage/cache", "storage/cache/blob", "storage/debug.log", "storage/" + ignore.FileName} {
+		_, err := fs.Stat(bundleFS, name)
+		assert.ErrorIs(t, err, fs.ErrNotExist, name)
+	}
+}
+
+// TestCreateCompressedTar_SortedAndStable tests that archive entries are
+// written in sorted order without owners, and that two runs over the same
+// tree produce identical bytes
+func TestCreateCompressedTar_SortedAndStable(t *testing.T) {
+	bundleDir := t.TempDir()
+	// Created out of order, with names where sorting by full path differs
+	// from sorting each directory's names ("a.txt" < "a/..." but "a" < "a.txt")
+	for i := 99; i >= 0; i-- {
+		dir := filepath.Join(bundleDir, "storage", fmt.Sprintf("d%02d", i%7))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d.bin", i)), []byte(fmt.Sprintf("content %d", i)), 0644))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(bundleDir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "a", "b"), []byte("b"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleDir, "a.txt"), []byte("a"), 0644))
+
+	archiveOpts := archiveOptions{modTime: time.Unix(0, 0).UTC()}
+	var first, second bytes.Buffer
+	_, err := createCompressedTar(context.Background(), &first, bundleDir, CompressionGzip, archiveOpts)
+	require.NoError(t, err)
+	_, err = createCompressedTar(context.Background(), &second, bundleDir, CompressionGzip, archiveOpts)
+	require.NoError(t, err)
+	assert.Equal(t, first.Bytes(), second.Bytes())
+
+	gz, err := gzip.NewReader(bytes.NewReader(first.Bytes()))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		assert.Zero(t, hdr.Uid, hdr.Name)
+		assert.Zero(t, hdr.Gid, hdr.Name)
+		assert.Empty(t, hdr.Uname, hdr.Name)
+		assert.Empty(t, hdr.Gname, hdr.Name)
+	}
+	assert.Len(t, names, 100+7+1+3) // files, d00-d06, storage, a, a/b, a.txt
+	assert.True(t, sort.StringsAreSorted(names), "entries are not sorted: %v", names)
+	assert.Equal(t, []string{"a", "a.txt", "a/b"}, names[:3])
+}
+
+// TestHeaderExtensions tests setting, reading and round-tripping extensions
+func TestHeaderExtensions(t *testing.T) {
+	header := NewHeader()
+	header.BundleSize = 100
+	header.BundleChecksum = "sha256:abc123"
+	header.Manifest = &manifest.Manifest{Name: "Test"}
+	header.CreatedAt = "2024-01-15T10:30:00Z"
+
+	type signature struct {
+		KeyID string `json:"keyId"`
+		Value string `json:"value"`
+	}
+	require.NoError(t, header.SetExtension("x-signature", signature{KeyID: "key-1", Value: "c2ln"}))
+	require.NoError(t, header.SetExtension("x-experimental", true))
+	require.NoError(t, header.Validate())
+
+	// Header fields cannot be shadowed by an extension
+	err := header.SetExtension("compression", "lz4")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `extension key "compression" is a header field`)
+	err = header.SetExtension("Compression", "lz4")
+	require.Error(t, err, "header fields match case-insensitively")
+	assert.Contains(t, err.Error(), `extension key "Compression" is a header field`)
+
+	data, err := header.ToJSON()
+	require.NoError(t, err)
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(data, &raw))
+	assert.Contains(t, raw, "x-signature", "extensions are top-level keys")
+	assert.NotContains(t, raw, "extensions")
+
+	var buf bytes.Buffer
+	_, err = WriteHeader(&buf, header)
+	require.NoError(t, err)
+	parsed, err := ReadHeader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, header.Manifest, parsed.Manifest)
+
+	var sig signature
+	ok, err := parsed.Extension("x-signature", &sig)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, signature{KeyID: "key-1", Value: "c2ln"}, sig)
+
+	var experimental bool
+	ok, err = parsed.Extension("x-experimental", &experimental)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, experimental)
+
+	ok, err = parsed.Extension("missing", &sig)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	var wrongType int
+	_, err = parsed.Extension("x-signature", &wrongType)
+	assert.Error(t, err)
+
+	// Headers without extensions serialize exactly as before
+	header.Extensions = nil
+	withoutExtensions, err := header.ToJSON()
+	require.NoError(t, err)
+	plain, err := json.MarshalIndent(headerFields(*header), "", "  ")
+	require.NoError(t, err)
+	assert.Equal(t, plain, withoutExtensions)
+
+	header.Extensions = map[string]json.RawMessage{"x-bad": json.RawMessage("{")}
+	_, err = header.ToJSON()
+	assert.Error(t, err)
+}
+
+// TestHeaderExtensions_UnknownKeysPreserved tests that keys this version
+// does not know survive parsing and rewriting an executable
+func TestHeaderExtensions_UnknownKeysPreserved(t *testing.T) {
+	data := []byte(`{
+		"version": "1.0.0",
+		"format": "selfhost-v1",
+		"compression": "gzip",
+		"bundleSize": 100,
+		"bundleChecksum": "sha256:abc123",
+		"manifest": {"name": "Test", "version": "1.0.0", "apps": [], "platform": "linux-x64", "createdAt": "2024-01-15T10:30:00Z"},
+		"opsVersion": "1.0.0",
+		"createdAt": "2024-01-15T10:30:00Z",
+		"futureField": {"nested": [1, 2, 3]},
+		"futureFlag": true
+	}`)
+
+	header := &Header{}
+	require.NoError(t, header.FromJSON(data))
+	assert.Equal(t, CompressionGzip, header.Compression)
+	require.Len(t, header.Extensions, 2)
+	assert.Equal(t, `{"nested":[1,2,3]}`, string(header.Extensions["futureField"]))
+	assert.Equal(t, `true`, string(header.Extensions["futureFlag"]))
+
+	// Rewriting an executable whose header has unknown keys keeps them
+	executablePath := createTestExecutable(t, t.TempDir())
+	result, embedded, compressedData, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	embedded.Extensions = header.Extensions
+	require.NoError(t, rewriteBundleSection(executablePath, result.Offset, embedded, compressedData))
+
+	creds := &credentials.Credentials{AdminKey: "rotated-admin-key", InstanceSecret: strings.Repeat("ab", 32)}
+	require.NoError(t, ReplaceCredentials(executablePath, creds))
+
+	rewritten, err := ReadHeaderFromExecutable(executablePath)
+	require.NoError(t, err)
+	assert.Equal(t, header.Extensions, rewritten.Extensions)
+}
+
+// TestHeaderExtensions_FieldNamesCaseInsensitive tests that a key matching
+// a header field in another case sets the field instead of becoming an
+// extension
+func TestHeaderExtensions_FieldNamesCaseInsensitive(t *testing.T) {
+	data := []byte(`{
+		"Version": "9.9.9",
+		"format": "selfhost-v1",
+		"compression": "gzip",
+		"bundleSize": 100,
+		"bundleChecksum": "sha256:abc123",
+		"manifest": {"name": "Test", "version": "1.0.0", "apps": [], "platform": "linux-x64", "createdAt": "2024-01-15T10:30:00Z"},
+		"opsVersion": "1.0.0",
+		"createdAt": "2024-01-15T10:30:00Z"
+	}`)
+
+	header := &Header{}
+	require.NoError(t, header.FromJSON(data))
+	assert.Equal(t, "9.9.9", header.Version)
+	assert.Empty(t, header.Extensions)
+
+	// The field is written once and survives a round trip
+	header.Version = HeaderVersion
+	out, err := header.ToJSON()
+	require.NoError(t, err)
+	var raw map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(out, &raw))
+	assert.Contains(t, raw, "version")
+	assert.NotContains(t, raw, "Version")
+	assert.NotContains(t, string(out), "9.9.9")
+
+	reparsed := &Header{}
+	require.NoError(t, reparsed.FromJSON(out))
+	assert.Equal(t, HeaderVersion, reparsed.Version)
+	assert.Empty(t, reparsed.Extensions)
+}
+
+// TestCreateTo tests writing a self-host executable to a non-seekable writer
+func TestCreateTo(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+	opsData, err := os.ReadFile(opsBinary)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	info, err := CreateTo(&buf, CreateOptions{
+		BundleDir:    bundleDir,
+		OpsBinary:    opsBinary,
+		Platform:     "linux-x64",
+		Reproducible: true,
+	})
+	require.NoError(t, err)
+	require.NotNil(t, info.Header)
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), opsData))
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, os.WriteFile(executablePath, buf.Bytes(), 0755))
+
+	result, err := DetectSelfHostModeFromFile(executablePath)
+	require.NoError(t, err)
+	assert.True(t, result.IsSelfHost)
+	assert.Equal(t, int64(len(opsData)), result.Offset)
+
+	_, err = Verify(executablePath)
+	require.NoError(t, err)
+
+	// The output matches what Create writes to a file
+	createdPath := filepath.Join(tmpDir, "created")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:    bundleDir,
+		OpsBinary:    opsBinary,
+		OutputPath:   createdPath,
+		Platform:     "linux-x64",
+		Reproducible: true,
+	}))
+	created, err := os.ReadFile(createdPath)
+	require.NoError(t, err)
+	assert.Equal(t, created, buf.Bytes())
+}
+
+// TestCreateTo_Validation tests the CreateTo-specific input checks
+func TestCreateTo_Validation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	opts := CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, Platform: "linux-x64"}
+
+	_, err := CreateTo(nil, opts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "writer is required")
+
+	sidecarOpts := opts
+	sidecarOpts.ChecksumSidecar = true
+	_, err = CreateTo(io.Discard, sidecarOpts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum sidecar requires an output path")
+
+	// The size budget is enforced before anything is written
+	var buf bytes.Buffer
+	limitedOpts := opts
+	limitedOpts.MaxBundleSize = 100
+	_, err = CreateTo(&buf, limitedOpts)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the maximum")
+	assert.Zero(t, buf.Len())
+}
+
+// TestCreate_CompressOpsBinary tests storing the ops binary compressed and
+// recovering it with Strip
+func TestCreate_CompressOpsBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	// A compressible stand-in for a real ops binary
+	opsBinary := filepath.Join(tmpDir, "ops")
+	opsData := bytes.Repeat([]byte("convex-backend-ops\x00"), 64<<10)
+	require.NoError(t, os.WriteFile(opsBinary, opsData, 0755))
+
+	plainPath := filepath.Join(tmpDir, "plain")
+	require.NoError(t, Create(CreateOptions{BundleDir: bundleDir, OpsBinary: opsBinary, OutputPath: plainPath, Platform: "linux-x64"}))
+
+	for _, compression := range []string{CompressionGzip, CompressionZstd, CompressionBrotli} {
+		t.Run(compression, func(t *testing.T) {
+			executablePath := filepath.Join(tmpDir, "compressed-"+compression)
+			info, err := CreateWithInfo(context.Background(), CreateOptions{
+				BundleDir:         bundleDir,
+				OpsBinary:         opsBinary,
+				OutputPath:        executablePath,
+				Platform:          "linux-x64",
+				Compression:       compression,
+				CompressOpsBinary: true,
+			})
+			require.NoError(t, err)
+			require.NotNil(t, info.Header.OpsBinary)
+			assert.Equal(t, CompressedOpsHeaderVersion, info.Header.Version)
+			assert.Equal(t, compression, info.Header.OpsBinary.Compression)
+			assert.Equal(t, int64(len(opsData)), info.Header.OpsBinary.Size)
+
+			plainStat, err := os.Stat(plainPath)
+			require.NoError(t, err)
+			stat, err := os.Stat(executablePath)
+			require.NoError(t, err)
+			assert.Less(t, stat.Size(), plainStat.Size()/10)
+			assert.Equal(t, os.FileMode(0644), stat.Mode().Perm(), "the file cannot run, so it is not executable")
+
+			header, err := ReadHeaderFromExecutable(executablePath)
+			require.NoError(t, err)
+			assert.Equal(t, info.Header.OpsBinary, header.OpsBinary)
+
+			verifyResult, err := Verify(executablePath)
+			require.NoError(t, err)
+			assert.True(t, verifyResult.Valid)
+
+			_, err = Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: filepath.Join(tmpDir, "extracted-"+compression)})
+			require.NoError(t, err)
+
+			strippedPath := filepath.Join(tmpDir, "stripped-"+compression)
+			require.NoError(t, Strip(executablePath, strippedPath))
+			stripped, err := os.ReadFile(strippedPath)
+			require.NoError(t, err)
+			assert.Equal(t, opsData, stripped)
+		})
+	}
+}
+
+// TestStrip_CompressedOpsChecksumMismatch tests that Strip refuses an ops
+// binary that does not match its recorded checksum
+func TestStrip_CompressedOpsChecksumMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:         bundleDir,
+		OpsBinary:         opsBinary,
+		OutputPath:        executablePath,
+		Platform:          "linux-x64",
+		CompressOpsBinary: true,
+	}))
+
+	// Record a different ops binary checksum in the header
+	result, header, compressedData, err := readEmbeddedBundle(executablePath)
+	require.NoError(t, err)
+	header.OpsBinary.Checksum = "sha256:" + strings.Repeat("0", 64)
+	require.NoError(t, rewriteBundleSection(executablePath, result.Offset, header, compressedData))
+
+	strippedPath := filepath.Join(tmpDir, "stripped")
+	err = Strip(executablePath, strippedPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ops binary checksum mismatch")
+	assert.NoFileExists(t, strippedPath)
+}
@@ -0,0 +1,79 @@
+//go:build unix
+
+package selfhost
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExtract_RestrictiveUmask tests that extracted files keep the modes
+// stored in the archive when the umask would strip them
+func TestExtract_RestrictiveUmask(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	require.NoError(t, os.MkdirAll(bundleDir, 0755))
+	createMockBundleDir(t, bundleDir)
+
+	opsBinary := filepath.Join(tmpDir, "ops")
+	createMockOpsBinary(t, opsBinary)
+
+	executablePath := filepath.Join(tmpDir, "selfhost")
+	require.NoError(t, Create(CreateOptions{
+		BundleDir:  bundleDir,
+		OpsBinary:  opsBinary,
+		OutputPath: executablePath,
+		Platform:   "linux-x64",
+	}))
+
+	oldUmask := syscall.Umask(0077)
+	defer syscall.Umask(oldUmask)
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	_, err := Extract(ExtractOptions{ExecutablePath: executablePath, OutputDir: extractDir})
+	require.NoError(t, err)
+
+	info, err := os.Stat(filepath.Join(extractDir, "backend"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Join(extractDir, "manifest.json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+// TestExtractCompressedTar_BackendMadeExecutable tests that a backend stored
+// without executable bits is still executable after extraction
+func TestExtractCompressedTar_BackendMadeExecutable(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	content := []byte("#!/bin/sh\n")
+	require.NoError(t, tw.WriteHeader(&tar.Header{
+		Name:     "backend",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(content)),
+	}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, extractCompressedTar(context.Background(), buf.Bytes(), outputDir, CompressionGzip, nil, extractLimits{}))
+
+	info, err := os.Stat(filepath.Join(outputDir, "backend"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
@@ -0,0 +1,74 @@
+package selfhost
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChecksumSidecarExt is appended to an executable's path to name its checksum sidecar.
+const ChecksumSidecarExt = ".sha256"
+
+// ChecksumSidecarPath returns the checksum sidecar path for the executable at path.
+func ChecksumSidecarPath(path string) string {
+	return path + ChecksumSidecarExt
+}
+
+// WriteChecksumSidecar writes the SHA256 of the whole executable at path to
+// <path>.sha256 in sha256sum format ("<hex>  <file name>"), so it can be
+// checked with standard tools or signed by existing release pipelines.
+func WriteChecksumSidecar(path string) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(path))
+	if err := os.WriteFile(ChecksumSidecarPath(path), []byte(line), 0644); err != nil {
+		return fmt.Errorf("failed to write checksum sidecar: %w", err)
+	}
+	return nil
+}
+
+// VerifyAgainstSidecar reports whether the executable at path matches the
+// checksum recorded in its <path>.sha256 sidecar.
+func VerifyAgainstSidecar(path string) (bool, error) {
+	data, err := os.ReadFile(ChecksumSidecarPath(path))
+	if err != nil {
+		return false, fmt.Errorf("failed to read checksum sidecar: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return false, fmt.Errorf("checksum sidecar %s is empty", ChecksumSidecarPath(path))
+	}
+	expected := strings.ToLower(fields[0])
+	if _, err := hex.DecodeString(expected); err != nil || len(expected) != sha256.Size*2 {
+		return false, fmt.Errorf("checksum sidecar %s does not contain a SHA256 checksum", ChecksumSidecarPath(path))
+	}
+
+	actual, err := fileSHA256(path)
+	if err != nil {
+		return false, err
+	}
+	return actual == expected, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,59 @@
+package selfhost
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// Strip writes the ops binary embedded in the self-extracting executable at
+// selfHostPath to outputPath, dropping the bundle section so the result is
+// byte-identical to the ops binary passed to Create. An ops binary stored
+// compressed (see CreateOptions.CompressOpsBinary) is decompressed and its
+// checksum verified.
+func Strip(selfHostPath, outputPath string) (err error) {
+	result, err := DetectSelfHostModeFromFile(selfHostPath)
+	if err != nil {
+		return err
+	}
+	if !result.IsSelfHost {
+		return fmt.Errorf("file does not contain an embedded bundle")
+	}
+	header, err := ReadHeaderFromExecutable(selfHostPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(selfHostPath)
+	if err != nil {
+		return fmt.Errorf("failed to open executable: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer func() {
+		dst.Close()
+		if err != nil {
+			os.Remove(outputPath)
+		}
+	}()
+
+	if header.OpsBinary != nil {
+		if err := copyOpsBinary(dst, io.LimitReader(src, result.Offset), header.OpsBinary); err != nil {
+			return err
+		}
+	} else if _, err := io.CopyN(dst, src, result.Offset); err != nil {
+		return fmt.Errorf("failed to copy ops binary: %w", err)
+	}
+	// OpenFile's mode is masked by the umask and ignored for existing files
+	if err := dst.Chmod(0755); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+	return nil
+}
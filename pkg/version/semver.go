@@ -0,0 +1,204 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed semantic version; build metadata is dropped since it
+// does not affect precedence.
+type semver struct {
+	core       [3]uint64
+	prerelease []string
+}
+
+// parseSemver parses a MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version.
+func parseSemver(v string) (semver, bool) {
+	var sv semver
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		if !validIdentifiers(v[i+1:], false) {
+			return sv, false
+		}
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		if !validIdentifiers(v[i+1:], true) {
+			return sv, false
+		}
+		sv.prerelease = strings.Split(v[i+1:], ".")
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return sv, false
+	}
+	for i, part := range parts {
+		if !isNumeric(part) || (len(part) > 1 && part[0] == '0') {
+			return sv, false
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return sv, false
+		}
+		sv.core[i] = n
+	}
+	return sv, true
+}
+
+// validIdentifiers reports whether s is a non-empty dot-separated list of
+// alphanumeric/hyphen identifiers. Prerelease numeric identifiers must not
+// have leading zeros.
+func validIdentifiers(s string, prerelease bool) bool {
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		for _, c := range id {
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+				return false
+			}
+		}
+		if prerelease && isNumeric(id) && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Semver is a parsed semantic version.
+type Semver struct {
+	Major, Minor, Patch uint64
+
+	// Prerelease is the dot-separated prerelease, empty for a release
+	Prerelease string
+
+	// Build is the build metadata, which does not affect precedence
+	Build string
+}
+
+// Parse parses a semantic version, optionally prefixed with "v".
+func Parse(v string) (Semver, error) {
+	trimmed := strings.TrimPrefix(v, "v")
+	sv, ok := parseSemver(trimmed)
+	if !ok {
+		return Semver{}, fmt.Errorf("invalid semantic version: %q", v)
+	}
+	rest, build, _ := strings.Cut(trimmed, "+")
+	_, prerelease, _ := strings.Cut(rest, "-")
+	return Semver{Major: sv.core[0], Minor: sv.core[1], Patch: sv.core[2], Prerelease: prerelease, Build: build}, nil
+}
+
+// String formats the version as MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD].
+func (s Semver) String() string {
+	v := fmt.Sprintf("%d.%d.%d", s.Major, s.Minor, s.Patch)
+	if s.Prerelease != "" {
+		v += "-" + s.Prerelease
+	}
+	if s.Build != "" {
+		v += "+" + s.Build
+	}
+	return v
+}
+
+// Compare returns -1, 0 or 1 as s has lower, equal or higher precedence than
+// other. Both must have been returned by Parse.
+func (s Semver) Compare(other Semver) int {
+	return compareSemver(s.String(), other.String())
+}
+
+// Compare returns -1, 0 or 1 as a has lower, equal or higher precedence than
+// b under semantic versioning, so prereleases sort before their release
+// (1.2.0-rc.1 < 1.2.0). A leading "v" is ignored, as for git tags.
+func Compare(a, b string) (int, error) {
+	for _, v := range []string{a, b} {
+		if !Valid(v) {
+			return 0, fmt.Errorf("invalid semantic version: %q", v)
+		}
+	}
+	return compareSemver(strings.TrimPrefix(a, "v"), strings.TrimPrefix(b, "v")), nil
+}
+
+// Valid reports whether v is a semantic version, optionally prefixed with "v".
+func Valid(v string) bool {
+	return isSemver(strings.TrimPrefix(v, "v"))
+}
+
+// isSemver reports whether v is a valid semantic version.
+func isSemver(v string) bool {
+	_, ok := parseSemver(v)
+	return ok
+}
+
+// compareSemver returns -1, 0 or 1 as a has lower, equal or higher precedence
+// than b. Both must be valid semantic versions.
+func compareSemver(a, b string) int {
+	sa, _ := parseSemver(a)
+	sb, _ := parseSemver(b)
+
+	for i := range sa.core {
+		if sa.core[i] != sb.core[i] {
+			if sa.core[i] < sb.core[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A release has higher precedence than any of its prereleases
+	switch {
+	case len(sa.prerelease) == 0 && len(sb.prerelease) == 0:
+		return 0
+	case len(sa.prerelease) == 0:
+		return 1
+	case len(sb.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(sa.prerelease) && i < len(sb.prerelease); i++ {
+		if c := compareIdentifier(sa.prerelease[i], sb.prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(sa.prerelease) < len(sb.prerelease):
+		return -1
+	case len(sa.prerelease) > len(sb.prerelease):
+		return 1
+	}
+	return 0
+}
+
+// compareIdentifier compares prerelease identifiers: numeric ones numerically
+// and below alphanumeric ones, which compare lexically.
+func compareIdentifier(a, b string) int {
+	aNum, bNum := isNumeric(a), isNumeric(b)
+	switch {
+	case aNum && bNum:
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a, b)
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
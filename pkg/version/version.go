@@ -14,19 +14,50 @@ import (
 // 3. package.json version field
 // 4. Default "0.0.0"
 func Detect(appPath string, cliOverride string) (string, error) {
+	return DetectMulti([]string{appPath}, cliOverride)
+}
+
+// DetectMulti is like Detect for a bundle built from several apps.
+// The git tag of the first app that has one is used; otherwise the highest
+// semver among the apps' package.json versions is chosen. Apps whose versions
+// have equal precedence (e.g. differing only in build metadata) resolve to
+// the earliest one in appPaths. Versions that are not valid semver are only
+// used if no app has a valid one, again preferring the earliest.
+func DetectMulti(appPaths []string, cliOverride string) (string, error) {
 	// Priority 1: CLI override
 	if cliOverride != "" {
 		return cliOverride, nil
 	}
 
 	// Priority 2: Git tags
-	if version, err := detectFromGitTag(appPath); err == nil && version != "" {
-		return version, nil
+	for _, appPath := range appPaths {
+		if version, err := detectFromGitTag(appPath); err == nil && version != "" {
+			return version, nil
+		}
 	}
 
 	// Priority 3: package.json
-	if version, err := detectFromPackageJSON(appPath); err == nil && version != "" {
-		return version, nil
+	var best, fallback string
+	for _, appPath := range appPaths {
+		version, err := detectFromPackageJSON(appPath)
+		if err != nil || version == "" {
+			continue
+		}
+		if !isSemver(version) {
+			if fallback == "" {
+				fallback = version
+			}
+			continue
+		}
+		if best == "" || compareSemver(version, best) > 0 {
+			best = version
+		}
+	}
+	if best != "" {
+		return best, nil
+	}
+	if fallback != "" {
+		return fallback, nil
 	}
 
 	// Default
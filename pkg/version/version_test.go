@@ -91,3 +91,131 @@ func TestDetectFromPackageJSON_FileNotFound(t *testing.T) {
 	_, err := detectFromPackageJSON(tmpDir)
 	require.Error(t, err)
 }
+
+func writePackageJSON(t *testing.T, version string) string {
+	t.Helper()
+	dir := t.TempDir()
+	packageJSON := `{"name": "test", "version": "` + version + `"}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(packageJSON), 0644))
+	return dir
+}
+
+func TestDetectMulti_HighestVersion(t *testing.T) {
+	apps := []string{
+		writePackageJSON(t, "1.2.0"),
+		writePackageJSON(t, "1.10.0"),
+		writePackageJSON(t, "1.9.9"),
+		t.TempDir(),
+	}
+
+	version, err := DetectMulti(apps, "")
+	require.NoError(t, err)
+	assert.Equal(t, "1.10.0", version)
+}
+
+func TestDetectMulti_Prerelease(t *testing.T) {
+	apps := []string{
+		writePackageJSON(t, "2.0.0-rc.2"),
+		writePackageJSON(t, "1.5.0"),
+		writePackageJSON(t, "2.0.0-rc.10"),
+	}
+
+	version, err := DetectMulti(apps, "")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0-rc.10", version)
+
+	version, err = DetectMulti(append(apps, writePackageJSON(t, "2.0.0")), "")
+	require.NoError(t, err)
+	assert.Equal(t, "2.0.0", version)
+}
+
+func TestDetectMulti_TieBreak(t *testing.T) {
+	apps := []string{
+		writePackageJSON(t, "1.0.0+build.1"),
+		writePackageJSON(t, "1.0.0+build.2"),
+	}
+
+	version, err := DetectMulti(apps, "")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0+build.1", version)
+}
+
+func TestDetectMulti_InvalidSemver(t *testing.T) {
+	apps := []string{
+		writePackageJSON(t, "latest"),
+		writePackageJSON(t, "0.1.0"),
+	}
+	version, err := DetectMulti(apps, "")
+	require.NoError(t, err)
+	assert.Equal(t, "0.1.0", version)
+
+	version, err = DetectMulti(apps[:1], "")
+	require.NoError(t, err)
+	assert.Equal(t, "latest", version)
+}
+
+func TestDetectMulti_CLIOverrideAndDefault(t *testing.T) {
+	apps := []string{writePackageJSON(t, "3.0.0")}
+
+	version, err := DetectMulti(apps, "9.9.9")
+	require.NoError(t, err)
+	assert.Equal(t, "9.9.9", version)
+
+	version, err = DetectMulti([]string{t.TempDir(), t.TempDir()}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.0", version)
+
+	version, err = DetectMulti(nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "0.0.0", version)
+}
+
+func TestCompareSemver(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.0.0", "2.0.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0.0-alpha", "1.0.0", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1},
+		{"1.0.0-rc.1", "1.0.0-beta", 1},
+		{"1.0.0+a", "1.0.0+b", 0},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, compareSemver(tt.a, tt.b), "%s vs %s", tt.a, tt.b)
+	}
+
+	for _, v := range []string{"1.0", "01.0.0", "1.0.0-", "1.0.0-01", "v1.0.0", "1.0.0+"} {
+		assert.False(t, isSemver(v), v)
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, err := Parse("v1.2.3-rc.1+build.5")
+	require.NoError(t, err)
+	assert.Equal(t, Semver{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1", Build: "build.5"}, v)
+	assert.Equal(t, "1.2.3-rc.1+build.5", v.String())
+
+	release, err := Parse("1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, -1, v.Compare(release))
+	assert.Equal(t, 1, release.Compare(v))
+	assert.Equal(t, 0, release.Compare(Semver{Major: 1, Minor: 2, Patch: 3, Build: "other"}))
+
+	_, err = Parse("1.2")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid semantic version")
+}
+
+func TestCompare(t *testing.T) {
+	c, err := Compare("v1.2.0", "1.2.0-rc.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c)
+
+	_, err = Compare("1.2", "1.2.0")
+	assert.ErrorContains(t, err, `invalid semantic version: "1.2"`)
+}